@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/icon"
 	"github.com/gotify/server/v2/model"
 	"github.com/h2non/filetype"
 	"gorm.io/gorm"
@@ -23,12 +25,23 @@ type ApplicationDatabase interface {
 	GetApplicationsByUser(userID uint) ([]*model.Application, error)
 	DeleteApplicationByID(id uint) error
 	UpdateApplication(application *model.Application) error
+	GetUserByID(id uint) (*model.User, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	GetApplicationSharesByApplication(appID uint) ([]*model.ApplicationShare, error)
+	GetApplicationSharesByUser(userID uint) ([]*model.ApplicationShare, error)
+	SaveApplicationShare(share *model.ApplicationShare) error
+	DeleteApplicationShare(appID, userID uint) error
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetGroupsByUser(userID uint) ([]*model.Group, error)
+	GetApplicationsByGroup(groupID uint) ([]*model.Application, error)
 }
 
 // The ApplicationAPI provides handlers for managing applications.
 type ApplicationAPI struct {
-	DB       ApplicationDatabase
-	ImageDir string
+	DB          ApplicationDatabase
+	ImageDir    string
+	Quota       *QuotaAPI
+	Attachments *AttachmentAPI
 }
 
 // Application Params Model
@@ -50,10 +63,19 @@ type ApplicationParams struct {
 	//
 	// example: 5
 	DefaultPriority int `form:"defaultPriority" query:"defaultPriority" json:"defaultPriority"`
+	// The default number of seconds after which messages of this application expire. 0 means the messages do not expire.
+	//
+	// example: 3600
+	DefaultTTLSeconds int `form:"defaultTTLSeconds" query:"defaultTTLSeconds" json:"defaultTTLSeconds" binding:"min=0"`
 	// The sortKey for the application. Uses fractional indexing.
 	//
 	// example: a1
 	SortKey string `form:"sortKey" query:"sortKey" json:"sortKey"`
+	// The id of the group owning the application. Messages are delivered to all members of the group.
+	// Can only be set on creation, the current user must be a member of the group.
+	//
+	// example: 3
+	GroupID uint `form:"groupId" query:"groupId" json:"groupId"`
 }
 
 // CreateApplication creates an application and returns the access token.
@@ -92,15 +114,30 @@ type ApplicationParams struct {
 func (a *ApplicationAPI) CreateApplication(ctx *gin.Context) {
 	applicationParams := ApplicationParams{}
 	if err := ctx.Bind(&applicationParams); err == nil {
+		if applicationParams.GroupID != 0 {
+			member, err := a.DB.IsGroupMember(applicationParams.GroupID, auth.GetUserID(ctx))
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if !member {
+				ctx.AbortWithError(400, fmt.Errorf("group with id %d doesn't exists", applicationParams.GroupID))
+				return
+			}
+		}
+		if ok := a.Quota.checkApplications(ctx, auth.GetUserID(ctx)); !ok {
+			return
+		}
 		tokenPublic, tokenPrivate := generateApplicationToken()
 		app := model.Application{
-			Name:            applicationParams.Name,
-			Description:     applicationParams.Description,
-			DefaultPriority: applicationParams.DefaultPriority,
-			SortKey:         applicationParams.SortKey,
-			Token:           tokenPublic,
-			UserID:          auth.GetUserID(ctx),
-			Internal:        false,
+			Name:              applicationParams.Name,
+			Description:       applicationParams.Description,
+			DefaultPriority:   applicationParams.DefaultPriority,
+			DefaultTTLSeconds: applicationParams.DefaultTTLSeconds,
+			SortKey:           applicationParams.SortKey,
+			GroupID:           applicationParams.GroupID,
+			Token:             tokenPublic,
+			UserID:            auth.GetUserID(ctx),
+			Internal:          false,
 		}
 
 		if err := a.DB.CreateApplication(&app); err != nil {
@@ -115,7 +152,7 @@ func (a *ApplicationAPI) CreateApplication(ctx *gin.Context) {
 // GetApplications returns all applications a user has.
 // swagger:operation GET /application application getApps
 //
-// Return all applications.
+// Return all applications including the applications shared with the current user and the applications of the groups of the current user.
 //
 //	---
 //	consumes: [application/json]
@@ -142,6 +179,44 @@ func (a *ApplicationAPI) GetApplications(ctx *gin.Context) {
 	if success := successOrAbort(ctx, 500, err); !success {
 		return
 	}
+	included := map[uint]bool{}
+	for _, app := range apps {
+		included[app.ID] = true
+	}
+	groups, err := a.DB.GetGroupsByUser(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	for _, group := range groups {
+		groupApps, err := a.DB.GetApplicationsByGroup(group.ID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		for _, app := range groupApps {
+			if !included[app.ID] {
+				included[app.ID] = true
+				app.SharedPermission = model.SharePermissionManage
+				apps = append(apps, app)
+			}
+		}
+	}
+	shares, err := a.DB.GetApplicationSharesByUser(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	for _, share := range shares {
+		if included[share.ApplicationID] {
+			continue
+		}
+		app, err := a.DB.GetApplicationByID(share.ApplicationID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if app != nil {
+			app.SharedPermission = share.Permission
+			apps = append(apps, app)
+		}
+	}
 	for _, app := range apps {
 		app.Token = ""
 		withResolvedImage(app)
@@ -197,12 +272,14 @@ func (a *ApplicationAPI) DeleteApplication(ctx *gin.Context) {
 				ctx.AbortWithError(400, errors.New("cannot delete internal application"))
 				return
 			}
+			attached := a.Attachments.attachedMessagesOfApplication(id)
 			if success := successOrAbort(ctx, 500, a.DB.DeleteApplicationByID(id)); !success {
 				return
 			}
 			if app.Image != "" {
-				os.Remove(a.ImageDir + app.Image)
+				icon.Remove(a.ImageDir, app.Image)
 			}
+			a.Attachments.deleteOrphaned(attached)
 		} else {
 			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exists", id))
 		}
@@ -258,12 +335,17 @@ func (a *ApplicationAPI) UpdateApplication(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if app != nil && app.UserID == auth.GetUserID(ctx) {
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == model.SharePermissionManage {
 			applicationParams := ApplicationParams{}
 			if err := ctx.Bind(&applicationParams); err == nil {
 				app.Description = applicationParams.Description
 				app.Name = applicationParams.Name
 				app.DefaultPriority = applicationParams.DefaultPriority
+				app.DefaultTTLSeconds = applicationParams.DefaultTTLSeconds
 				if applicationParams.SortKey != "" {
 					app.SortKey = applicationParams.SortKey
 				}
@@ -363,6 +445,10 @@ func (a *ApplicationAPI) UpdateApplicationSecurity(ctx *gin.Context) {
 //
 // Upload an image for an application.
 //
+// The image is stored as png with at most 256x256 pixels,
+// smaller sizes can be requested via the size parameter of /image/{name}.
+// The stored image and its smaller sizes count towards the storage quota of the owner of the application.
+//
 //	---
 //	consumes:
 //	- multipart/form-data
@@ -401,6 +487,10 @@ func (a *ApplicationAPI) UpdateApplicationSecurity(ctx *gin.Context) {
 //	    description: Not Found
 //	    schema:
 //	        $ref: "#/definitions/Error"
+//	  413:
+//	    description: Request Entity Too Large
+//	    schema:
+//	        $ref: "#/definitions/Error"
 //	  500:
 //	    description: Server Error
 //	    schema:
@@ -411,7 +501,11 @@ func (a *ApplicationAPI) UploadApplicationImage(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if app != nil && app.UserID == auth.GetUserID(ctx) {
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == model.SharePermissionManage {
 			file, err := ctx.FormFile("file")
 			if err == http.ErrMissingFile {
 				ctx.AbortWithError(400, errors.New("file with key 'file' must be present"))
@@ -421,7 +515,12 @@ func (a *ApplicationAPI) UploadApplicationImage(ctx *gin.Context) {
 				return
 			}
 			head := make([]byte, 261)
-			open, _ := file.Open()
+			open, err := file.Open()
+			if err != nil {
+				ctx.AbortWithError(500, err)
+				return
+			}
+			defer open.Close()
 			open.Read(head)
 			if !filetype.IsImage(head) {
 				ctx.AbortWithError(400, errors.New("file must be an image"))
@@ -434,18 +533,33 @@ func (a *ApplicationAPI) UploadApplicationImage(ctx *gin.Context) {
 				return
 			}
 
+			if _, err := open.Seek(0, io.SeekStart); err != nil {
+				ctx.AbortWithError(500, err)
+				return
+			}
+			img, err := icon.Decode(open)
+			if err != nil {
+				ctx.AbortWithError(400, fmt.Errorf("cannot decode image: %w", err))
+				return
+			}
+
 			name := generateNonExistingImageName(a.ImageDir, func() string {
-				return generateImageName() + ext
+				return generateImageName() + ".png"
 			})
 
-			err = ctx.SaveUploadedFile(file, a.ImageDir+name)
-			if err != nil {
+			if err := icon.Save(a.ImageDir, name, img); err != nil {
 				ctx.AbortWithError(500, err)
 				return
 			}
+			// the size is known after the variants were stored, the replaced image is freed.
+			added := imageSize(a.ImageDir, name) - imageSize(a.ImageDir, app.Image)
+			if ok := a.Quota.checkStorage(ctx, app.UserID, added); !ok {
+				icon.Remove(a.ImageDir, name)
+				return
+			}
 
 			if app.Image != "" {
-				os.Remove(a.ImageDir + app.Image)
+				icon.Remove(a.ImageDir, app.Image)
 			}
 
 			app.Image = name
@@ -504,7 +618,11 @@ func (a *ApplicationAPI) RemoveApplicationImage(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if app != nil && app.UserID == auth.GetUserID(ctx) {
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == model.SharePermissionManage {
 			if app.Image == "" {
 				ctx.AbortWithError(400, fmt.Errorf("app with id %d does not have a customized image", id))
 				return
@@ -515,7 +633,7 @@ func (a *ApplicationAPI) RemoveApplicationImage(ctx *gin.Context) {
 			if success := successOrAbort(ctx, 500, a.DB.UpdateApplication(app)); !success {
 				return
 			}
-			os.Remove(a.ImageDir + image)
+			icon.Remove(a.ImageDir, image)
 			ctx.JSON(200, withResolvedImage(app))
 		} else {
 			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exists", id))
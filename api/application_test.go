@@ -9,11 +9,13 @@ import (
 	"mime/multipart"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/icon"
 	"github.com/gotify/server/v2/mode"
 	"github.com/gotify/server/v2/model"
 	"github.com/gotify/server/v2/test"
@@ -87,7 +89,7 @@ func (s *ApplicationSuite) Test_ensureApplicationHasCorrectJsonRepresentation()
 		SortKey:     "a1",
 		CreatedAt:   testdb.Now,
 	}
-	test.JSONEquals(s.T(), actual, `{"id":1,"token":"Aasdasfgeeg","name":"myapp","description":"mydesc", "image": "asd", "internal":true, "defaultPriority":0, "createdAt":"2020-01-01T00:00:00Z", "lastUsed":null, "sortKey":"a1"}`)
+	test.JSONEquals(s.T(), actual, `{"id":1,"token":"Aasdasfgeeg","name":"myapp","description":"mydesc", "image": "asd", "internal":true, "defaultPriority":0, "defaultTTLSeconds":0, "createdAt":"2020-01-01T00:00:00Z", "lastUsed":null, "sortKey":"a1"}`)
 }
 
 func (s *ApplicationSuite) Test_CreateApplication_expectBadRequestOnEmptyName() {
@@ -451,8 +453,12 @@ func (s *ApplicationSuite) Test_UploadAppImage_WithImageFile_expectSuccess() {
 		imgName := app.Image
 
 		assert.Equal(s.T(), 200, s.recorder.Code)
+		assert.Equal(s.T(), ".png", filepath.Ext(imgName))
 		_, err = os.Stat(s.imageDir.Path(imgName))
 		assert.Nil(s.T(), err)
+		for _, size := range icon.Sizes {
+			assert.FileExists(s.T(), s.imageDir.Path(icon.VariantName(imgName, size)))
+		}
 
 		s.a.DeleteApplication(s.ctx)
 
@@ -466,6 +472,7 @@ func (s *ApplicationSuite) Test_UploadAppImage_WithImageFile_DeleteExstingImage(
 	s.db.User(5)
 	s.db.CreateApplication(&model.Application{UserID: 5, ID: 1, Image: existingImageName})
 	fakeImage(s.T(), s.imageDir.Path(existingImageName))
+	fakeImage(s.T(), s.imageDir.Path("existing@64.png"))
 
 	cType, buffer, err := upload(map[string]*os.File{"file": mustOpen("../test/assets/image.png")})
 	assert.Nil(s.T(), err)
@@ -480,7 +487,31 @@ func (s *ApplicationSuite) Test_UploadAppImage_WithImageFile_DeleteExstingImage(
 
 	listing, err := os.ReadDir(s.imageDir.Path())
 	assert.Nil(s.T(), err)
-	assert.Len(s.T(), listing, 1)
+	assert.Len(s.T(), listing, 1+len(icon.Sizes))
+	assert.NoFileExists(s.T(), s.imageDir.Path(existingImageName))
+	assert.NoFileExists(s.T(), s.imageDir.Path("existing@64.png"))
+}
+
+func (s *ApplicationSuite) Test_UploadAppImage_exceedsStorageQuota() {
+	s.db.User(5).App(1)
+	s.a.Quota = &QuotaAPI{DB: s.db, ImageDir: s.a.ImageDir, Defaults: model.QuotaLimits{StorageBytes: 10}}
+
+	cType, buffer, err := upload(map[string]*os.File{"file": mustOpen("../test/assets/image.png")})
+	assert.Nil(s.T(), err)
+	s.ctx.Request = httptest.NewRequest("POST", "/irrelevant", &buffer)
+	s.ctx.Request.Header.Set("Content-Type", cType)
+	test.WithUser(s.ctx, 5)
+	s.ctx.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	s.a.UploadApplicationImage(s.ctx)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	if app, err := s.db.GetApplicationByID(1); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), app.Image)
+	}
+	listing, err := os.ReadDir(s.imageDir.Path())
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), listing, "the stored image is removed")
 }
 
 func (s *ApplicationSuite) Test_UploadAppImage_WithTextFile_expectBadRequest() {
@@ -641,6 +672,34 @@ func (s *ApplicationSuite) Test_UpdateApplicationDefaultPriority_expectSuccess()
 	}
 }
 
+func (s *ApplicationSuite) Test_UpdateApplicationDefaultTTL_expectSuccess() {
+	s.db.User(5).NewAppWithToken(2, "app-2")
+
+	test.WithUser(s.ctx, 5)
+	s.withFormData("name=name&defaultTTLSeconds=3600")
+	s.ctx.Params = gin.Params{{Key: "id", Value: "2"}}
+	s.a.UpdateApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if app, err := s.db.GetApplicationByID(2); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), 3600, app.DefaultTTLSeconds)
+	}
+}
+
+func (s *ApplicationSuite) Test_UpdateApplicationDefaultTTL_failWhenNegative() {
+	s.db.User(5).NewAppWithToken(2, "app-2")
+
+	test.WithUser(s.ctx, 5)
+	s.withFormData("name=name&defaultTTLSeconds=-1")
+	s.ctx.Params = gin.Params{{Key: "id", Value: "2"}}
+	s.a.UpdateApplication(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if app, err := s.db.GetApplicationByID(2); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), 0, app.DefaultTTLSeconds)
+	}
+}
+
 func (s *ApplicationSuite) Test_UpdateApplication_preservesImageAndSortKey() {
 	app := s.db.User(5).NewAppWithToken(2, "app-2")
 	app.Image = "existing.png"
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/h2non/filetype"
+	"github.com/rs/zerolog/log"
+)
+
+// AttachmentsExtrasKey is the key of the message extras referencing the attachments of a message.
+const AttachmentsExtrasKey = "client::attachments"
+
+// The AttachmentDatabase interface for encapsulating database access.
+type AttachmentDatabase interface {
+	GetMessageByID(id uint) (*model.Message, error)
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetAttachmentByFile(file string) (*model.Attachment, error)
+	GetAttachmentsByMessage(messageID uint) ([]*model.Attachment, error)
+	GetOrphanedAttachments(limit int) ([]*model.Attachment, error)
+	GetOrphanedAttachmentsByMessages(messageIDs []uint) ([]*model.Attachment, error)
+	GetAttachedMessageIDsByApplication(appID uint) ([]uint, error)
+	GetAttachedMessageIDsByUser(userID uint) ([]uint, error)
+	GetAttachmentSizeByUser(userID uint) (int64, error)
+	CreateAttachments(attachments []*model.Attachment) error
+	DeleteAttachmentByID(id uint) error
+}
+
+// The AttachmentAPI provides handlers for message attachments and stores uploaded attachments.
+type AttachmentAPI struct {
+	DB  AttachmentDatabase
+	Dir string
+	// MaxBytes is the maximum size of a single attachment.
+	MaxBytes int64
+	// UserQuotaBytes is the maximum size of all attachments of a user, 0 disables the limit.
+	UserQuotaBytes int64
+	// Quota limits the storage of a user together with the application images, both limits apply.
+	Quota *QuotaAPI
+}
+
+// GetAttachment returns the file of an attachment.
+// swagger:operation GET /attachment/{file} message getAttachment
+//
+// Download the file of a message attachment.
+//
+// Images are served inline, all other files are served as download.
+//
+//	---
+//	produces: [application/octet-stream]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: file
+//	  in: path
+//	  description: the name of the stored file
+//	  required: true
+//	  type: string
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: file
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *AttachmentAPI) GetAttachment(ctx *gin.Context) {
+	file := ctx.Param("file")
+	attachment, err := a.DB.GetAttachmentByFile(file)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	if attachment == nil {
+		ctx.AbortWithError(404, errors.New("attachment does not exist"))
+		return
+	}
+	msg, err := a.DB.GetMessageByID(attachment.MessageID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	if msg == nil {
+		ctx.AbortWithError(404, errors.New("attachment does not exist"))
+		return
+	}
+	app, err := a.DB.GetApplicationByID(msg.ApplicationID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	if permission == "" {
+		ctx.AbortWithError(404, errors.New("attachment does not exist"))
+		return
+	}
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	ctx.Header("Content-Type", attachment.ContentType)
+	ctx.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.File(a.Dir + attachment.File)
+}
+
+// CleanupAttachments deletes the attachments of all deleted messages.
+// It scans all attachments and is therefore only run on startup.
+func (a *AttachmentAPI) CleanupAttachments() {
+	for {
+		attachments, err := a.DB.GetOrphanedAttachments(reaperBatchSize)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not load attachments of deleted messages")
+			return
+		}
+		if !a.delete(attachments) {
+			return
+		}
+		if len(attachments) < reaperBatchSize {
+			return
+		}
+	}
+}
+
+// NotifyDeletedApplicationMessages deletes the attachments of the deleted messages.
+func (a *AttachmentAPI) NotifyDeletedApplicationMessages(app *model.Application, ids []uint) {
+	a.deleteOrphaned(ids)
+}
+
+// attachedMessagesOfApplication returns the ids of the messages of the application which have attachments.
+// It must be called before deleting the messages to clean up their attachments with deleteOrphaned afterwards.
+func (a *AttachmentAPI) attachedMessagesOfApplication(appID uint) []uint {
+	if a == nil {
+		return nil
+	}
+	ids, err := a.DB.GetAttachedMessageIDsByApplication(appID)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load attachments of application")
+	}
+	return ids
+}
+
+// attachedMessagesOfUser returns the ids of the messages of the user which have attachments.
+// It must be called before deleting the messages to clean up their attachments with deleteOrphaned afterwards.
+func (a *AttachmentAPI) attachedMessagesOfUser(userID uint) []uint {
+	if a == nil {
+		return nil
+	}
+	ids, err := a.DB.GetAttachedMessageIDsByUser(userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load attachments of user")
+	}
+	return ids
+}
+
+// deleteOrphaned deletes the attachments of the given messages if the messages were deleted.
+func (a *AttachmentAPI) deleteOrphaned(messageIDs []uint) {
+	if a == nil {
+		return
+	}
+	for len(messageIDs) > 0 {
+		batch := messageIDs[:min(len(messageIDs), reaperBatchSize)]
+		messageIDs = messageIDs[len(batch):]
+		attachments, err := a.DB.GetOrphanedAttachmentsByMessages(batch)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not load attachments of deleted messages")
+			return
+		}
+		if !a.delete(attachments) {
+			return
+		}
+	}
+}
+
+func (a *AttachmentAPI) delete(attachments []*model.Attachment) bool {
+	for _, attachment := range attachments {
+		if err := os.Remove(a.Dir + attachment.File); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("file", attachment.File).Msg("Could not delete attachment")
+			return false
+		}
+		if err := a.DB.DeleteAttachmentByID(attachment.ID); err != nil {
+			log.Error().Err(err).Str("file", attachment.File).Msg("Could not delete attachment")
+			return false
+		}
+	}
+	return true
+}
+
+// AttachmentQuotaError is returned if storing attachments exceeds the attachment quota of a user.
+type AttachmentQuotaError struct {
+	Limit int64
+}
+
+func (e *AttachmentQuotaError) Error() string {
+	return fmt.Sprintf("attachment quota of %d bytes exceeded", e.Limit)
+}
+
+// checkQuota returns an error if storing bytes of attachments exceeds the attachment quota or the storage limit of the user.
+func (a *AttachmentAPI) checkQuota(userID uint, bytes int64) error {
+	if a.UserQuotaBytes > 0 {
+		used, err := a.DB.GetAttachmentSizeByUser(userID)
+		if err != nil {
+			return err
+		}
+		if used+bytes > a.UserQuotaBytes {
+			return &AttachmentQuotaError{Limit: a.UserQuotaBytes}
+		}
+	}
+	return a.Quota.CheckStorage(userID, bytes)
+}
+
+// CopyAttachments stores copies of the attachment files of the message in the storage of the user,
+// so that a copy of the message keeps its attachments when the original is deleted.
+// It returns the copied attachments, which must be persisted together with the copy, and the extras referencing them.
+func (a *AttachmentAPI) CopyAttachments(msg *model.Message, userID uint) ([]*model.Attachment, []byte, error) {
+	originals, err := a.DB.GetAttachmentsByMessage(msg.ID)
+	if err != nil || len(originals) == 0 {
+		return nil, msg.Extras, err
+	}
+	total := int64(0)
+	for _, attachment := range originals {
+		total += attachment.Size
+	}
+	if err := a.checkQuota(userID, total); err != nil {
+		return nil, nil, err
+	}
+
+	attachments := make([]*model.Attachment, 0, len(originals))
+	for _, original := range originals {
+		name := generateNonExistingImageName(a.Dir, func() string {
+			return generateAttachmentName() + filepath.Ext(original.File)
+		})
+		if err := copyFile(a.Dir+original.File, a.Dir+name); err != nil {
+			a.RemoveAttachments(attachments)
+			return nil, nil, err
+		}
+		attachments = append(attachments, &model.Attachment{
+			UserID:      userID,
+			Name:        original.Name,
+			File:        name,
+			ContentType: original.ContentType,
+			Size:        original.Size,
+			CreatedAt:   timeNow(),
+		})
+	}
+
+	extras := map[string]any{}
+	if len(msg.Extras) > 0 {
+		if err := json.Unmarshal(msg.Extras, &extras); err != nil {
+			a.RemoveAttachments(attachments)
+			return nil, nil, err
+		}
+	}
+	extras[AttachmentsExtrasKey] = attachmentRefs(attachments)
+	encoded, err := json.Marshal(extras)
+	if err != nil {
+		a.RemoveAttachments(attachments)
+		return nil, nil, err
+	}
+	return attachments, encoded, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// save validates and stores the uploaded files as attachments of the user.
+// The returned attachments must be persisted after the message was created.
+func (a *AttachmentAPI) save(ctx *gin.Context, userID uint, files []*multipart.FileHeader) ([]*model.Attachment, bool) {
+	total := int64(0)
+	for _, file := range files {
+		if file.Size > a.MaxBytes {
+			ctx.AbortWithError(http.StatusRequestEntityTooLarge,
+				fmt.Errorf("attachment %s exceeds the maximum size of %d bytes", file.Filename, a.MaxBytes))
+			return nil, false
+		}
+		total += file.Size
+	}
+	if err := a.checkQuota(userID, total); err != nil {
+		var attachmentExceeded *AttachmentQuotaError
+		var storageExceeded *StorageQuotaError
+		if errors.As(err, &attachmentExceeded) || errors.As(err, &storageExceeded) {
+			ctx.AbortWithError(http.StatusRequestEntityTooLarge, err)
+		} else {
+			ctx.AbortWithError(500, err)
+		}
+		return nil, false
+	}
+
+	attachments := make([]*model.Attachment, 0, len(files))
+	for _, file := range files {
+		contentType, ext, err := detectAttachmentType(file)
+		if err != nil {
+			a.RemoveAttachments(attachments)
+			ctx.AbortWithError(400, err)
+			return nil, false
+		}
+		name := generateNonExistingImageName(a.Dir, func() string {
+			return generateAttachmentName() + "." + ext
+		})
+		if err := ctx.SaveUploadedFile(file, a.Dir+name); err != nil {
+			a.RemoveAttachments(attachments)
+			ctx.AbortWithError(500, err)
+			return nil, false
+		}
+		attachments = append(attachments, &model.Attachment{
+			UserID:      userID,
+			Name:        file.Filename,
+			File:        name,
+			ContentType: contentType,
+			Size:        file.Size,
+			CreatedAt:   timeNow(),
+		})
+	}
+	return attachments, true
+}
+
+// RemoveAttachments deletes the stored files of attachments which were not persisted.
+func (a *AttachmentAPI) RemoveAttachments(attachments []*model.Attachment) {
+	for _, attachment := range attachments {
+		os.Remove(a.Dir + attachment.File)
+	}
+}
+
+func detectAttachmentType(file *multipart.FileHeader) (contentType, ext string, err error) {
+	open, err := file.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer open.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(open, head)
+	kind, _ := filetype.Match(head[:n])
+	if kind != filetype.Unknown {
+		return kind.MIME.Value, kind.Extension, nil
+	}
+	// text files like logs have no signature, they are always served as plain text
+	// so that uploaded html isn't rendered.
+	if strings.HasPrefix(http.DetectContentType(head[:n]), "text/") {
+		return "text/plain; charset=utf-8", textExtension(file.Filename), nil
+	}
+	return "", "", fmt.Errorf("attachment %s has an unsupported file type", file.Filename)
+}
+
+var textExtensions = map[string]bool{"txt": true, "log": true, "csv": true, "json": true, "md": true, "yaml": true, "yml": true}
+
+func textExtension(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if textExtensions[ext] {
+		return ext
+	}
+	return "txt"
+}
+
+func withAttachmentExtras(message *model.CreateMessage, attachments []*model.Attachment) {
+	if message.Extras == nil {
+		message.Extras = map[string]any{}
+	}
+	message.Extras[AttachmentsExtrasKey] = attachmentRefs(attachments)
+}
+
+func attachmentRefs(attachments []*model.Attachment) []map[string]any {
+	refs := make([]map[string]any, len(attachments))
+	for i, attachment := range attachments {
+		refs[i] = map[string]any{
+			"name":        attachment.Name,
+			"url":         "attachment/" + attachment.File,
+			"contentType": attachment.ContentType,
+			"size":        attachment.Size,
+		}
+	}
+	return refs
+}
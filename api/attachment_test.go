@@ -0,0 +1,419 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestAttachmentSuite(t *testing.T) {
+	suite.Run(t, new(AttachmentSuite))
+}
+
+type AttachmentSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *AttachmentAPI
+	m        *MessageAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	dir      *test.TmpDir
+}
+
+func (s *AttachmentSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	tmpDir := test.NewTmpDir("gotify_attachmentsuite")
+	s.dir = &tmpDir
+	s.a = &AttachmentAPI{DB: s.db, Dir: s.dir.Path() + "/", MaxBytes: 1024 * 1024}
+	s.m = &MessageAPI{DB: s.db, Notifier: s, Attachments: s.a}
+
+	s.db.User(4).AppWithToken(8, "app-token")
+	s.db.User(5)
+}
+
+func (s *AttachmentSuite) AfterTest(suiteName, testName string) {
+	s.dir.Clean()
+	s.db.Close()
+}
+
+func (s *AttachmentSuite) Notify(userID uint, msg *model.MessageExternal) {
+}
+
+func (s *AttachmentSuite) Test_ensureAttachmentHasCorrectJsonRepresentation() {
+	actual := &model.Attachment{
+		ID: 7, MessageID: 25, UserID: 4, Name: "screenshot.png", File: "abc.png", ContentType: "image/png", Size: 3,
+		CreatedAt: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+	}
+	test.JSONEquals(s.T(), actual, `{"id":7,"messageId":25,"name":"screenshot.png","file":"abc.png","contentType":"image/png","size":3,"createdAt":"2024-01-05T00:00:00Z"}`)
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_withAttachment() {
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	attachments, err := s.db.GetAttachmentsByMessage(1)
+	assert.NoError(s.T(), err)
+	if !assert.Len(s.T(), attachments, 1) {
+		return
+	}
+	attachment := attachments[0]
+	assert.Equal(s.T(), "image.png", attachment.Name)
+	assert.Equal(s.T(), "image/png", attachment.ContentType)
+	assert.Equal(s.T(), uint(4), attachment.UserID)
+	assert.FileExists(s.T(), s.a.Dir+attachment.File)
+	info, _ := os.Stat("../test/assets/image.png")
+	assert.Equal(s.T(), info.Size(), attachment.Size)
+
+	msg := &model.MessageExternal{}
+	json.NewDecoder(s.recorder.Body).Decode(msg)
+	assert.Equal(s.T(), "ui test failed", msg.Message)
+	assert.Equal(s.T(), []any{map[string]any{
+		"name":        "image.png",
+		"url":         "attachment/" + attachment.File,
+		"contentType": "image/png",
+		"size":        float64(info.Size()),
+	}}, msg.Extras[AttachmentsExtrasKey])
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_withTextAttachment() {
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/text.txt")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if attachments, err := s.db.GetAttachmentsByMessage(1); assert.NoError(s.T(), err) && assert.Len(s.T(), attachments, 1) {
+		assert.Equal(s.T(), "text/plain; charset=utf-8", attachments[0].ContentType)
+		assert.Equal(s.T(), ".txt", filepath.Ext(attachments[0].File))
+	}
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_withUnsupportedAttachment() {
+	binary := filepath.Join(s.T().TempDir(), "core.dump")
+	os.WriteFile(binary, []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff}, 0o644)
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"},
+		"../test/assets/image.png", binary)
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_withTooLargeAttachment() {
+	s.a.MaxBytes = 10
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_exceedsQuota() {
+	info, _ := os.Stat("../test/assets/image.png")
+	s.a.UserQuotaBytes = info.Size() + 10
+	s.db.User(4).App(8).Message(1)
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 1, UserID: 4, File: "old.png", Size: 20}})
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	s.db.AssertMessageNotExist(2)
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_exceedsStorageQuota() {
+	info, _ := os.Stat("../test/assets/image.png")
+	s.a.Quota = &QuotaAPI{DB: s.db, ImageDir: s.dir.Path() + "/", Defaults: model.QuotaLimits{StorageBytes: info.Size() + 10}}
+	s.db.User(4).App(8).Message(1)
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 1, UserID: 4, File: "old.png", Size: 20}})
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, fmt.Sprintf("storage quota of %d bytes exceeded, 20 bytes are used", info.Size()+10))
+	s.db.AssertMessageNotExist(2)
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_withinAttachmentAndStorageQuota() {
+	s.createWithQuotas(20, 20)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_exceedsQuotaWithinStorageQuota() {
+	size := s.createWithQuotas(10, 20)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, fmt.Sprintf("attachment quota of %d bytes exceeded", size+10))
+	s.db.AssertMessageNotExist(2)
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_exceedsStorageQuotaWithinQuota() {
+	size := s.createWithQuotas(20, 10)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, fmt.Sprintf("storage quota of %d bytes exceeded, 20 bytes are used", size+10))
+	s.db.AssertMessageNotExist(2)
+}
+
+// createWithQuotas creates a message with an attachment while 20 bytes of attachments are stored.
+// The attachment quota and the storage quota both apply, they allow the size of the attachment plus the given bytes.
+func (s *AttachmentSuite) createWithQuotas(attachmentBytes, storageBytes int64) int64 {
+	info, _ := os.Stat("../test/assets/image.png")
+	s.a.UserQuotaBytes = info.Size() + attachmentBytes
+	s.a.Quota = &QuotaAPI{DB: s.db, ImageDir: s.dir.Path() + "/", Defaults: model.QuotaLimits{StorageBytes: info.Size() + storageBytes}}
+	s.db.User(4).App(8).Message(1)
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 1, UserID: 4, File: "old.png", Size: 20}})
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+	return info.Size()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_scheduledWithAttachment() {
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "later", "deliverAt": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		"../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_droppedByRule() {
+	s.m.Rules = rules.NewEngine(s.db, s)
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "drop", Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 204, s.ctx.Writer.Status())
+	s.assertNoStoredFiles()
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_copiedByRule_keepsAttachmentsOfCopy() {
+	engine := rules.NewEngine(s.db, s)
+	engine.Attachments = s.a
+	s.m.Rules = engine
+	s.db.User(4).App(9)
+	s.db.CreateRule(&model.Rule{UserID: 4, ApplicationID: 8, Action: model.RuleActionCopy, TargetApplicationID: 9})
+	original := s.createMessageWithAttachment()
+
+	copied, err := s.db.GetAttachmentsByMessage(2)
+	assert.NoError(s.T(), err)
+	if assert.Len(s.T(), copied, 1) {
+		assert.NotEqual(s.T(), original, copied[0].File)
+		assert.Equal(s.T(), "image.png", copied[0].Name)
+		assert.Equal(s.T(), uint(4), copied[0].UserID)
+	}
+	msg, err := s.db.GetMessageByID(2)
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), string(msg.Extras), "attachment/"+copied[0].File)
+	assert.NotContains(s.T(), string(msg.Extras), original)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.NoFileExists(s.T(), s.a.Dir+original)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("file", copied[0].File)
+	s.ctx.Request = httptest.NewRequest("GET", "/attachment/"+copied[0].File, nil)
+	s.a.GetAttachment(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	expected, _ := os.ReadFile("../test/assets/image.png")
+	assert.Equal(s.T(), expected, s.recorder.Body.Bytes())
+}
+
+func (s *AttachmentSuite) Test_CreateMessage_copiedByRule_exceedsQuota() {
+	info, _ := os.Stat("../test/assets/image.png")
+	s.a.UserQuotaBytes = info.Size() + 10
+	engine := rules.NewEngine(s.db, s)
+	engine.Attachments = s.a
+	s.m.Rules = engine
+	s.db.User(4).App(9)
+	s.db.CreateRule(&model.Rule{UserID: 4, ApplicationID: 8, Action: model.RuleActionCopy, TargetApplicationID: 9})
+	file := s.createMessageWithAttachment()
+
+	s.db.AssertMessageNotExist(2)
+	files, err := os.ReadDir(s.a.Dir)
+	assert.NoError(s.T(), err)
+	if assert.Len(s.T(), files, 1) {
+		assert.Equal(s.T(), file, files[0].Name())
+	}
+}
+
+func (s *AttachmentSuite) Test_GetAttachment() {
+	file := s.createMessageWithAttachment()
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("file", file)
+	s.ctx.Request = httptest.NewRequest("GET", "/attachment/"+file, nil)
+	s.a.GetAttachment(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), "image/png", s.recorder.Header().Get("Content-Type"))
+	assert.Equal(s.T(), `inline; filename=image.png`, s.recorder.Header().Get("Content-Disposition"))
+	expected, _ := os.ReadFile("../test/assets/image.png")
+	assert.Equal(s.T(), expected, s.recorder.Body.Bytes())
+}
+
+func (s *AttachmentSuite) Test_GetAttachment_otherUser() {
+	file := s.createMessageWithAttachment()
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("file", file)
+	s.ctx.Request = httptest.NewRequest("GET", "/attachment/"+file, nil)
+	s.a.GetAttachment(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *AttachmentSuite) Test_GetAttachment_unknown() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("file", "unknown.png")
+	s.ctx.Request = httptest.NewRequest("GET", "/attachment/unknown.png", nil)
+	s.a.GetAttachment(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *AttachmentSuite) Test_DeleteMessage_removesAttachments() {
+	file := s.createMessageWithAttachment()
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.NoFileExists(s.T(), s.a.Dir+file)
+	if attachment, err := s.db.GetAttachmentByFile(file); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), attachment)
+	}
+}
+
+func (s *AttachmentSuite) Test_DeleteMessageWithApplication_removesAttachments() {
+	file := s.createMessageWithAttachment()
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 99, UserID: 4, File: "orphan.png"}})
+	os.WriteFile(s.a.Dir+"orphan.png", []byte{}, 0o644)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/message", nil)
+	s.m.DeleteMessageWithApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.NoFileExists(s.T(), s.a.Dir+file)
+	assert.FileExists(s.T(), s.a.Dir+"orphan.png", "only attachments of the deleted messages are removed")
+}
+
+func (s *AttachmentSuite) Test_NotifyDeletedApplicationMessages_removesAttachments() {
+	file := s.createMessageWithAttachment()
+	s.db.DeleteMessageByID(1)
+
+	s.a.NotifyDeletedApplicationMessages(&model.Application{ID: 7, UserID: 4}, []uint{1})
+
+	assert.NoFileExists(s.T(), s.a.Dir+file)
+	if attachment, err := s.db.GetAttachmentByFile(file); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), attachment)
+	}
+}
+
+func (s *AttachmentSuite) Test_CleanupAttachments_keepsAttachmentsOfExistingMessages() {
+	file := s.createMessageWithAttachment()
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 99, UserID: 4, File: "orphan.png"}})
+	os.WriteFile(s.a.Dir+"orphan.png", []byte{}, 0o644)
+
+	s.a.CleanupAttachments()
+
+	assert.FileExists(s.T(), s.a.Dir+file)
+	assert.NoFileExists(s.T(), s.a.Dir+"orphan.png")
+	if attachment, err := s.db.GetAttachmentByFile("orphan.png"); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), attachment)
+	}
+}
+
+func (s *AttachmentSuite) createMessageWithAttachment() string {
+	test.WithUser(s.ctx, 4)
+	s.withAttachments(map[string]string{"appid": "8", "message": "ui test failed"}, "../test/assets/image.png")
+	s.m.CreateMessage(s.ctx)
+	assert.Equal(s.T(), 200, s.recorder.Code)
+
+	attachments, err := s.db.GetAttachmentsByMessage(1)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), attachments, 1)
+	return attachments[0].File
+}
+
+func (s *AttachmentSuite) assertNoStoredFiles() {
+	files, err := os.ReadDir(s.a.Dir)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), files)
+}
+
+func (s *AttachmentSuite) withAttachments(fields map[string]string, files ...string) {
+	var buffer bytes.Buffer
+	w := multipart.NewWriter(&buffer)
+	for key, value := range fields {
+		w.WriteField(key, value)
+	}
+	for _, file := range files {
+		fw, err := w.CreateFormFile("attachment", filepath.Base(file))
+		assert.NoError(s.T(), err)
+		r := mustOpen(file)
+		io.Copy(fw, r)
+		r.Close()
+	}
+	w.Close()
+	s.ctx.Request = httptest.NewRequest("POST", "/message", &buffer)
+	s.ctx.Request.Header.Set("Content-Type", w.FormDataContentType())
+}
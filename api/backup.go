@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// The BackupWriter writes a backup archive.
+type BackupWriter interface {
+	Write(w io.Writer) error
+}
+
+// The BackupAPI provides handlers for creating backups while the server is running.
+type BackupAPI struct {
+	Backup BackupWriter
+}
+
+// CreateBackup streams a backup archive.
+// swagger:operation GET /backup backup createBackup
+//
+// Create a backup of all data.
+//
+// The archive contains all users, clients, applications, messages, plugin configurations, the uploaded images and
+// the attachments. It can be restored with `gotify restore <file>` while the server is stopped.
+//
+//	---
+//	produces: [application/gzip]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: file
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *BackupAPI) CreateBackup(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/gzip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=gotify-backup-%s.tar.gz", timeNow().UTC().Format("20060102-150405")))
+	ctx.Status(200)
+	if err := a.Backup.Write(ctx.Writer); err != nil {
+		// the status was already sent, the client notices the error by the truncated archive.
+		log.Error().Err(err).Msg("Could not create backup")
+		ctx.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBackup struct {
+	err error
+}
+
+func (f *fakeBackup) Write(w io.Writer) error {
+	w.Write([]byte("archive"))
+	return f.err
+}
+
+func TestCreateBackup(t *testing.T) {
+	mode.Set(mode.TestDev)
+	now := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("GET", "/backup", nil)
+	a := &BackupAPI{Backup: &fakeBackup{}}
+	a.CreateBackup(ctx)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/gzip", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=gotify-backup-20240105-120000.tar.gz", recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, "archive", recorder.Body.String())
+}
+
+func TestCreateBackup_error(t *testing.T) {
+	mode.Set(mode.TestDev)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("GET", "/backup", nil)
+	a := &BackupAPI{Backup: &fakeBackup{err: errors.New("disk full")}}
+	a.CreateBackup(ctx)
+
+	assert.Len(t, ctx.Errors, 1)
+}
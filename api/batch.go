@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+)
+
+const maxBatchSize = 200
+
+// BatchMessageResult Model
+//
+// The result of a single message of a batch.
+//
+// swagger:model BatchMessageResult
+type BatchMessageResult struct {
+	// The status of the message: 200 created, 202 scheduled, 204 dropped by a rule or 400 rejected.
+	//
+	// required: true
+	// example: 200
+	Status int `json:"status"`
+	// The created message.
+	Message *model.MessageExternal `json:"message,omitempty"`
+	// The scheduled message.
+	ScheduledMessage *model.ScheduledMessageExternal `json:"scheduledMessage,omitempty"`
+	// The reason the message was rejected.
+	//
+	// example: appid not found
+	Error string `json:"error,omitempty"`
+}
+
+type batchMessage struct {
+	index  int
+	app    *model.Application
+	msg    *model.Message
+	result *rules.Result
+}
+
+// CreateMessages creates multiple messages, authentication via application token, client token, or basic auth is required.
+// swagger:operation POST /message/batch message createMessages
+//
+// Create multiple messages at once.
+//
+// The messages are stored in one transaction and the stream clients are notified in the order of the batch.
+// Invalid messages are rejected individually, the result of each message is returned at the same index.
+// The same authentication rules as for creating a single message apply, a batch can contain up to 200 messages.
+// The batch is rejected as a whole if it exceeds the message quota of an application owner.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [appTokenAuthorizationHeader: [], appTokenHeader: [], appTokenQuery: [], clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the messages to add
+//	  required: true
+//	  schema:
+//	    type: array
+//	    items:
+//	      $ref: "#/definitions/CreateMessage"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/BatchMessageResult"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) CreateMessages(ctx *gin.Context) {
+	var messages []*model.CreateMessage
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&messages); err != nil {
+		ctx.AbortWithError(400, err)
+		return
+	}
+	if len(messages) == 0 {
+		ctx.AbortWithError(400, errors.New("the batch must contain at least one message"))
+		return
+	}
+	if len(messages) > maxBatchSize {
+		ctx.AbortWithError(400, fmt.Errorf("the batch must not contain more than %d messages", maxBatchSize))
+		return
+	}
+
+	results := make([]*BatchMessageResult, len(messages))
+	reject := func(index int, err error) {
+		results[index] = &BatchMessageResult{Status: 400, Error: err.Error()}
+	}
+	apps := map[uint]*model.Application{}
+	// the number of messages per owner, the quota is checked for the whole batch.
+	counts := map[uint]int64{}
+	var created []*batchMessage
+	var scheduled []*model.ScheduledMessage
+	var scheduledIndexes []int
+	for i, message := range messages {
+		if message == nil {
+			reject(i, errors.New("message must not be null"))
+			continue
+		}
+		if err := binding.Validator.ValidateStruct(message); err != nil {
+			reject(i, err)
+			continue
+		}
+		app, err := a.batchApplication(ctx, apps, message.ApplicationID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if app == nil {
+			if message.ApplicationID == 0 {
+				reject(i, errors.New("appid is required when not authenticating with an application token"))
+			} else {
+				reject(i, errors.New("appid not found"))
+			}
+			continue
+		}
+		if err := validateExpiry(message); err != nil {
+			reject(i, err)
+			continue
+		}
+		applyApplicationDefaults(app, message)
+
+		if message.DeliverAt != nil && message.DeliverAt.After(timeNow()) {
+			scheduled = append(scheduled, toScheduledMessage(message))
+			scheduledIndexes = append(scheduledIndexes, i)
+			counts[app.UserID]++
+			continue
+		}
+
+		msg := toInternalMessage(message)
+		var result *rules.Result
+		if a.Rules != nil {
+			result, err = a.Rules.Evaluate(app.UserID, msg)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if result.Drop {
+				results[i] = &BatchMessageResult{Status: 204}
+				continue
+			}
+		}
+		created = append(created, &batchMessage{index: i, app: app, msg: msg, result: result})
+		counts[app.UserID]++
+	}
+
+	owners := slices.Sorted(maps.Keys(counts))
+	for _, userID := range owners {
+		if ok := a.Quota.checkMessages(ctx, userID, counts[userID]); !ok {
+			return
+		}
+	}
+
+	internal := make([]*model.Message, len(created))
+	for i, message := range created {
+		internal[i] = message.msg
+	}
+	if success := successOrAbort(ctx, 500, a.DB.CreateMessages(internal, scheduled)); !success {
+		return
+	}
+
+	for i, msg := range scheduled {
+		results[scheduledIndexes[i]] = &BatchMessageResult{Status: 202, ScheduledMessage: toExternalScheduledMessage(msg)}
+	}
+	if len(scheduled) > 0 && a.Scheduler != nil {
+		a.Scheduler.Reschedule()
+	}
+	for _, message := range created {
+		results[message.index] = &BatchMessageResult{Status: 200, Message: toExternalMessage(message.msg)}
+		a.Notifier.Notify(message.app.UserID, toExternalMessage(message.msg))
+		if message.result != nil {
+			a.Rules.Dispatch(message.result, message.msg)
+		}
+	}
+	ctx.JSON(200, results)
+}
+
+// batchApplication returns the application the current user may create messages for or nil.
+// The applications are cached in apps, so that every application is only loaded once per batch.
+func (a *MessageAPI) batchApplication(ctx *gin.Context, apps map[uint]*model.Application, appID uint) (*model.Application, error) {
+	if app := auth.GetApplication(ctx); app != nil {
+		return app, nil
+	}
+	if appID == 0 {
+		return nil, nil
+	}
+	if app, ok := apps[appID]; ok {
+		return app, nil
+	}
+	app, err := a.DB.GetApplicationByID(appID)
+	if err != nil {
+		return nil, err
+	}
+	permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if permission != model.SharePermissionManage {
+		app = nil
+	}
+	apps[appID] = app
+	return app, nil
+}
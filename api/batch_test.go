@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestBatchSuite(t *testing.T) {
+	suite.Run(t, new(BatchSuite))
+}
+
+type BatchSuite struct {
+	suite.Suite
+	db          *testdb.Database
+	a           *MessageAPI
+	ctx         *gin.Context
+	recorder    *httptest.ResponseRecorder
+	notified    []*model.MessageExternal
+	rescheduled bool
+}
+
+func (s *BatchSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.db = testdb.NewDB(s.T())
+	s.notified = nil
+	s.rescheduled = false
+	s.a = &MessageAPI{DB: s.db, Notifier: s, Scheduler: s}
+}
+
+func (s *BatchSuite) AfterTest(string, string) {
+	s.db.Close()
+}
+
+func (s *BatchSuite) Notify(userID uint, msg *model.MessageExternal) {
+	s.notified = append(s.notified, msg)
+}
+
+func (s *BatchSuite) Reschedule() {
+	s.rescheduled = true
+}
+
+func (s *BatchSuite) Test_CreateMessages_withApplicationToken() {
+	t := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithTokenAndDefaultPriority(7, "app-token", 3))
+	s.withJSON(`[{"message":"first"},{"message":"second","title":"disk","priority":8,"appid":99}]`)
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), []*BatchMessageResult{
+		{Status: 200, Message: &model.MessageExternal{ID: 1, ApplicationID: 7, Message: "first", Title: "", Priority: intPtr(3), Date: t}},
+		{Status: 200, Message: &model.MessageExternal{ID: 2, ApplicationID: 7, Message: "second", Title: "disk", Priority: intPtr(8), Date: t}},
+	}, s.recorder)
+	if assert.Len(s.T(), s.notified, 2) {
+		assert.Equal(s.T(), "first", s.notified[0].Message)
+		assert.Equal(s.T(), "second", s.notified[1].Message)
+	}
+	if msgs, err := s.db.GetMessagesByApplication(7); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 2)
+	}
+}
+
+func (s *BatchSuite) Test_CreateMessages_rejectsInvalidMessages() {
+	user := s.db.User(4)
+	user.App(7)
+	s.db.User(5).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON(`[{"appid":7,"message":"ok"},{"appid":7},{"message":"no app"},{"appid":8,"message":"foreign"},null,
+		{"appid":7,"message":"expired","expiresAt":"2000-01-01T00:00:00Z"},{"appid":7,"message":"also ok"}]`)
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	results := s.results()
+	statuses := []int{}
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(s.T(), []int{200, 400, 400, 400, 400, 400, 200}, statuses)
+	assert.Equal(s.T(), "appid not found", results[3].Error)
+	if assert.Len(s.T(), s.notified, 2) {
+		assert.Equal(s.T(), "ok", s.notified[0].Message)
+		assert.Equal(s.T(), "also ok", s.notified[1].Message)
+	}
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *BatchSuite) Test_CreateMessages_scheduledAndDropped() {
+	s.a.Rules = rules.NewEngine(s.db, s)
+	s.db.User(4).App(7)
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "drop", TitlePattern: "spam", Action: model.RuleActionDrop})
+	deliverAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON(fmt.Sprintf(`[{"appid":7,"message":"later","deliverAt":"%s"},{"appid":7,"title":"spam","message":"x"},{"appid":7,"message":"now"}]`,
+		deliverAt.Format(time.RFC3339)))
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	results := s.results()
+	if assert.Len(s.T(), results, 3) {
+		assert.Equal(s.T(), 202, results[0].Status)
+		if assert.NotNil(s.T(), results[0].ScheduledMessage) {
+			assert.Equal(s.T(), deliverAt, results[0].ScheduledMessage.DeliverAt)
+		}
+		assert.Equal(s.T(), 204, results[1].Status)
+		assert.Equal(s.T(), 200, results[2].Status)
+	}
+	assert.True(s.T(), s.rescheduled)
+	if scheduled, err := s.db.GetScheduledMessagesByApplication(7); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), scheduled, 1)
+	}
+	if msgs, err := s.db.GetMessagesByApplication(7); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), "now", msgs[0].Message)
+	}
+}
+
+func (s *BatchSuite) Test_CreateMessages_invalidBatch() {
+	s.db.User(4).App(7)
+	tooLarge := "[" + strings.TrimSuffix(strings.Repeat(`{"appid":7,"message":"x"},`, maxBatchSize+1), ",") + "]"
+
+	for _, body := range []string{`{"appid":7,"message":"x"}`, `[]`, tooLarge} {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		test.WithUser(s.ctx, 4)
+		s.withJSON(body)
+		s.a.CreateMessages(s.ctx)
+
+		assert.Equal(s.T(), 400, s.recorder.Code)
+	}
+	if msgs, err := s.db.GetMessagesByApplication(7); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *BatchSuite) Test_CreateMessages_exceedsMessageQuota() {
+	s.a.Quota = &QuotaAPI{DB: s.db, Defaults: model.QuotaLimits{Messages: 3}}
+	s.db.User(4).App(7).Message(1)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON(`[{"appid":7,"message":"first"},{"appid":7,"message":"second"},{"appid":7,"message":"third"}]`)
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	assert.Empty(s.T(), s.notified)
+	if msgs, err := s.db.GetMessagesByApplication(7); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 1, "the batch is rejected as a whole")
+	}
+}
+
+func (s *BatchSuite) Test_CreateMessages_withinMessageQuota() {
+	s.a.Quota = &QuotaAPI{DB: s.db, Defaults: model.QuotaLimits{Messages: 3}}
+	s.db.User(4).App(7).Message(1)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON(`[{"appid":7,"message":"first"},{"appid":7,"message":"second"}]`)
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Len(s.T(), s.notified, 2)
+}
+
+func (s *BatchSuite) Test_CreateMessages_scheduledMessagesCountTowardsMessageQuota() {
+	s.a.Quota = &QuotaAPI{DB: s.db, Defaults: model.QuotaLimits{Messages: 2}}
+	s.db.User(4).App(7).Message(1)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON(`[{"appid":7,"message":"now"},{"appid":7,"message":"later","deliverAt":"2999-01-01T00:00:00Z"}]`)
+	s.a.CreateMessages(s.ctx)
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	if scheduled, err := s.db.GetScheduledMessagesByApplication(7); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), scheduled)
+	}
+}
+
+func (s *BatchSuite) results() []*BatchMessageResult {
+	var results []*BatchMessageResult
+	assert.NoError(s.T(), json.NewDecoder(s.recorder.Body).Decode(&results))
+	return results
+}
+
+func (s *BatchSuite) withJSON(body string) {
+	s.ctx.Request = httptest.NewRequest("POST", "/message/batch", strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
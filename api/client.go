@@ -26,6 +26,7 @@ type ClientAPI struct {
 	DB            ClientDatabase
 	ImageDir      string
 	NotifyDeleted func(uint, string)
+	Quota         *QuotaAPI
 }
 
 // Client Params Model
@@ -150,6 +151,9 @@ func (a *ClientAPI) UpdateClient(ctx *gin.Context) {
 func (a *ClientAPI) CreateClient(ctx *gin.Context) {
 	clientParams := ClientParams{}
 	if err := ctx.Bind(&clientParams); err == nil {
+		if ok := a.Quota.checkClients(ctx, auth.GetUserID(ctx)); !ok {
+			return
+		}
 		tokenPublic, tokenPrivate := generateClientToken()
 		client := model.Client{
 			Name:   clientParams.Name,
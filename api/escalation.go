@@ -0,0 +1,361 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+)
+
+const defaultEscalationMinPriority = 10
+
+// The EscalationDatabase interface for encapsulating database access.
+type EscalationDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	GetApplicationSharesByApplication(appID uint) ([]*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetGroupMemberIDs(groupID uint) ([]uint, error)
+	GetMessageByID(id uint) (*model.Message, error)
+	GetEscalationPolicyByApplication(appID uint) (*model.EscalationPolicy, error)
+	SaveEscalationPolicy(policy *model.EscalationPolicy) error
+	DeleteEscalationPolicyByApplication(appID uint) error
+	GetEscalationByMessage(messageID uint) (*model.Escalation, error)
+	DeleteEscalationByMessage(messageID uint) error
+}
+
+// AckNotifier notifies when a message was acknowledged.
+type AckNotifier interface {
+	NotifyAcknowledgedMessage(userID, id uint)
+}
+
+// The EscalationAPI provides handlers for managing escalation policies and acknowledging messages.
+type EscalationAPI struct {
+	DB          EscalationDatabase
+	Notifier    AckNotifier
+	MailEnabled bool
+}
+
+// EscalationPolicy Params Model
+//
+// Params allowed to set an escalation policy.
+//
+// swagger:model EscalationPolicyParams
+type EscalationPolicyParams struct {
+	// Messages with at least this priority are repeated until they are acknowledged. Defaults to 10.
+	//
+	// example: 10
+	MinPriority *int `form:"minPriority" query:"minPriority" json:"minPriority" binding:"omitempty,min=0"`
+	// The number of minutes between repeated deliveries.
+	//
+	// required: true
+	// example: 5
+	IntervalMinutes int `form:"intervalMinutes" query:"intervalMinutes" json:"intervalMinutes" binding:"required,min=1"`
+	// The number of repeated deliveries after which the message is escalated. 0 disables escalation.
+	//
+	// example: 3
+	EscalateAfter int `form:"escalateAfter" query:"escalateAfter" json:"escalateAfter" binding:"min=0"`
+	// The id of the user the message is escalated to.
+	//
+	// example: 2
+	EscalateToUserID uint `form:"escalateToUserId" query:"escalateToUserId" json:"escalateToUserId"`
+	// The email address the message is escalated to. Requires email forwarding to be configured.
+	//
+	// example: oncall@example.com
+	EscalateToEmail string `form:"escalateToEmail" query:"escalateToEmail" json:"escalateToEmail" binding:"omitempty,email"`
+}
+
+// GetEscalationPolicy returns the escalation policy of an application.
+// swagger:operation GET /application/{id}/escalation escalation getEscalationPolicy
+//
+// Return the escalation policy of an application.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/EscalationPolicy"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *EscalationAPI) GetEscalationPolicy(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		policy, err := a.DB.GetEscalationPolicyByApplication(app.ID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if policy == nil {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d has no escalation policy", app.ID))
+			return
+		}
+		ctx.JSON(200, policy)
+	})
+}
+
+// UpdateEscalationPolicy creates or replaces the escalation policy of an application.
+// swagger:operation PUT /application/{id}/escalation escalation updateEscalationPolicy
+//
+// Create or replace the escalation policy of an application.
+//
+// Messages of the application with at least minPriority are delivered again
+// every intervalMinutes until they are acknowledged via POST /message/{id}/ack.
+// The user escalateToUserId must have access to the application, as owner,
+// member of its group or user it is shared with.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the escalation policy
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/EscalationPolicyParams"
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/EscalationPolicy"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *EscalationAPI) UpdateEscalationPolicy(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		params := EscalationPolicyParams{}
+		if err := ctx.Bind(&params); err != nil {
+			return
+		}
+		if params.EscalateToEmail != "" && !a.MailEnabled {
+			ctx.AbortWithError(400, errors.New("escalation via email requires GOTIFY_SMTP_HOST to be configured"))
+			return
+		}
+		if params.EscalateToUserID != 0 {
+			// the copy keeps the shared permission of the target out of app.
+			target := *app
+			permission, err := applicationPermission(a.DB, &target, params.EscalateToUserID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			// unknown users and users without access get the same error, so that user ids can't be probed.
+			if permission == "" {
+				ctx.AbortWithError(400, fmt.Errorf("user with id %d has no access to the application", params.EscalateToUserID))
+				return
+			}
+		}
+
+		policy := &model.EscalationPolicy{
+			ApplicationID:    app.ID,
+			MinPriority:      defaultEscalationMinPriority,
+			IntervalMinutes:  params.IntervalMinutes,
+			EscalateAfter:    params.EscalateAfter,
+			EscalateToUserID: params.EscalateToUserID,
+			EscalateToEmail:  params.EscalateToEmail,
+		}
+		if params.MinPriority != nil {
+			policy.MinPriority = *params.MinPriority
+		}
+		if success := successOrAbort(ctx, 500, a.DB.SaveEscalationPolicy(policy)); !success {
+			return
+		}
+		ctx.JSON(200, policy)
+	})
+}
+
+// DeleteEscalationPolicy deletes the escalation policy of an application.
+// swagger:operation DELETE /application/{id}/escalation escalation deleteEscalationPolicy
+//
+// Delete the escalation policy of an application. Pending escalations are stopped.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *EscalationAPI) DeleteEscalationPolicy(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		successOrAbort(ctx, 500, a.DB.DeleteEscalationPolicyByApplication(app.ID))
+	})
+}
+
+// AcknowledgeMessage stops the escalation of a message.
+// swagger:operation POST /message/{id}/ack message acknowledgeMessage
+//
+// Acknowledge a message, this stops repeating the message.
+//
+// The message can be acknowledged by the users with access to its application and by the user it was escalated to.
+// All of them are notified about the acknowledgement via the stream.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the message id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *EscalationAPI) AcknowledgeMessage(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		msg, err := a.DB.GetMessageByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if msg == nil {
+			ctx.AbortWithError(404, errors.New("message does not exist"))
+			return
+		}
+		app, err := a.DB.GetApplicationByID(msg.ApplicationID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		escalation, err := a.DB.GetEscalationByMessage(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		var escalatedTo uint
+		if escalation != nil && escalation.Escalated {
+			policy, err := a.DB.GetEscalationPolicyByApplication(msg.ApplicationID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if policy != nil {
+				escalatedTo = policy.EscalateToUserID
+			}
+		}
+
+		userID := auth.GetUserID(ctx)
+		permission, err := applicationPermission(a.DB, app, userID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if app == nil || (permission == "" && escalatedTo != userID) {
+			ctx.AbortWithError(404, errors.New("message does not exist"))
+			return
+		}
+		if escalation == nil {
+			return
+		}
+		readers, err := applicationReaders(a.DB, app)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if escalatedTo != 0 && !slices.Contains(readers, escalatedTo) {
+			readers = append(readers, escalatedTo)
+		}
+		if success := successOrAbort(ctx, 500, a.DB.DeleteEscalationByMessage(id)); !success {
+			return
+		}
+		for _, readerID := range readers {
+			a.Notifier.NotifyAcknowledgedMessage(readerID, id)
+		}
+	})
+}
+
+func (a *EscalationAPI) withApplication(ctx *gin.Context, f func(app *model.Application)) {
+	withID(ctx, "id", func(id uint) {
+		app, err := a.DB.GetApplicationByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission != model.SharePermissionManage {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exists", id))
+			return
+		}
+		f(app)
+	})
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestEscalationSuite(t *testing.T) {
+	suite.Run(t, new(EscalationSuite))
+}
+
+type EscalationSuite struct {
+	suite.Suite
+	db           *testdb.Database
+	a            *EscalationAPI
+	ctx          *gin.Context
+	recorder     *httptest.ResponseRecorder
+	acknowledged map[uint][]uint
+}
+
+func (s *EscalationSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.acknowledged = map[uint][]uint{}
+	s.a = &EscalationAPI{DB: s.db, Notifier: s, MailEnabled: true}
+}
+
+func (s *EscalationSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+}
+
+func (s *EscalationSuite) NotifyAcknowledgedMessage(userID, id uint) {
+	s.acknowledged[userID] = append(s.acknowledged[userID], id)
+}
+
+func (s *EscalationSuite) Test_ensureEscalationPolicyHasCorrectJsonRepresentation() {
+	actual := &model.EscalationPolicy{ApplicationID: 1, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 3, EscalateToUserID: 2, EscalateToEmail: "oncall@example.com"}
+	test.JSONEquals(s.T(), actual, `{"appid":1,"minPriority":10,"intervalMinutes":5,"escalateAfter":3,"escalateToUserId":2,"escalateToEmail":"oncall@example.com"}`)
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy() {
+	s.db.User(4).App(8)
+	s.db.User(5)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionRead})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5,"escalateAfter":3,"escalateToUserId":5,"escalateToEmail":"oncall@example.com"}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	expected := &model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 3, EscalateToUserID: 5, EscalateToEmail: "oncall@example.com"}
+	test.BodyEquals(s.T(), expected, s.recorder)
+	if policy, err := s.db.GetEscalationPolicyByApplication(8); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), expected, policy)
+	}
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_minPriority() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"minPriority":0,"intervalMinutes":1}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if policy, err := s.db.GetEscalationPolicyByApplication(8); assert.NoError(s.T(), err) && assert.NotNil(s.T(), policy) {
+		assert.Equal(s.T(), 0, policy.MinPriority)
+	}
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_invalidInterval() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":0}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if policy, err := s.db.GetEscalationPolicyByApplication(8); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), policy)
+	}
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_unknownUser() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5,"escalateToUserId":99}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "user with id 99 has no access to the application")
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_userWithoutAccess() {
+	s.db.User(4).App(8)
+	s.db.User(5).App(9)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5,"escalateToUserId":5}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "user with id 5 has no access to the application")
+	if policy, err := s.db.GetEscalationPolicyByApplication(8); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), policy)
+	}
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_groupMember() {
+	s.db.User(4)
+	s.db.User(5)
+	group := &model.Group{Name: "ops", Members: []uint{4, 5}}
+	s.db.CreateGroup(group)
+	s.db.CreateApplication(&model.Application{ID: 8, UserID: 4, GroupID: group.ID, Token: "A8", Name: "production"})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5,"escalateToUserId":5}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_emailWithoutMail() {
+	s.db.User(4).App(8)
+	s.a.MailEnabled = false
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5,"escalateToEmail":"oncall@example.com"}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_otherUser() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *EscalationSuite) Test_UpdateEscalationPolicy_managePermission() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 4, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/escalation", `{"intervalMinutes":5}`)
+	s.a.UpdateEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+}
+
+func (s *EscalationSuite) Test_GetEscalationPolicy() {
+	user := s.db.User(4)
+	user.App(8)
+	user.App(9)
+	s.db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/escalation", nil)
+	s.a.GetEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5}, s.recorder)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "9")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/9/escalation", nil)
+	s.a.GetEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *EscalationSuite) Test_DeleteEscalationPolicy() {
+	s.db.User(4).App(8)
+	s.db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/escalation", nil)
+	s.a.DeleteEscalationPolicy(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if policy, err := s.db.GetEscalationPolicyByApplication(8); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), policy)
+	}
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage() {
+	s.db.User(4).App(8).NewMessage(1)
+	s.db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5})
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: 8, NextAt: time.Now()})
+
+	s.ack(4, 1)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if escalation, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), escalation)
+	}
+	assert.Equal(s.T(), map[uint][]uint{4: {1}}, s.acknowledged)
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_withoutEscalation() {
+	s.db.User(4).App(8).NewMessage(1)
+
+	s.ack(4, 1)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Empty(s.T(), s.acknowledged)
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_byEscalationTarget() {
+	s.db.User(4).App(8).NewMessage(1)
+	s.db.User(5)
+	s.db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 1, EscalateToUserID: 5})
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: 8, Attempts: 1, Escalated: true, NextAt: time.Now()})
+
+	s.ack(5, 1)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if escalation, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), escalation)
+	}
+	assert.Equal(s.T(), map[uint][]uint{4: {1}, 5: {1}}, s.acknowledged)
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_sharedApplication() {
+	s.db.User(4).App(8).NewMessage(1)
+	s.db.User(5)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionRead})
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: 8, NextAt: time.Now()})
+
+	s.ack(5, 1)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if escalation, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), escalation)
+	}
+	assert.Equal(s.T(), map[uint][]uint{4: {1}, 5: {1}}, s.acknowledged)
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_notifiesAllReaders() {
+	s.db.User(4)
+	s.db.User(5)
+	s.db.User(6)
+	s.db.User(7)
+	group := &model.Group{Name: "ops", Members: []uint{4, 6}}
+	s.db.CreateGroup(group)
+	s.db.CreateApplication(&model.Application{ID: 8, UserID: 4, GroupID: group.ID, Token: "A8", Name: "production"})
+	s.db.CreateMessage(&model.Message{ID: 1, ApplicationID: 8, Message: "disk full"})
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionRead})
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: 8, NextAt: time.Now()})
+
+	s.ack(4, 1)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), map[uint][]uint{4: {1}, 5: {1}, 6: {1}}, s.acknowledged)
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_otherUser() {
+	s.db.User(4).App(8).NewMessage(1)
+	s.db.User(5)
+	s.db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 2, EscalateToUserID: 5})
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: 8, NextAt: time.Now()})
+
+	s.ack(5, 1)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if escalation, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), escalation, "not yet escalated to the user")
+	}
+}
+
+func (s *EscalationSuite) Test_AcknowledgeMessage_unknownMessage() {
+	s.db.User(4)
+
+	s.ack(4, 1)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *EscalationSuite) ack(userID, messageID uint) {
+	test.WithUser(s.ctx, userID)
+	s.ctx.AddParam("id", fmt.Sprint(messageID))
+	s.ctx.Request = httptest.NewRequest("POST", fmt.Sprintf("/message/%d/ack", messageID), nil)
+	s.a.AcknowledgeMessage(s.ctx)
+}
+
+func (s *EscalationSuite) withJSON(method, url, body string) {
+	s.ctx.Request = httptest.NewRequest(method, url, strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
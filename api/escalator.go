@@ -0,0 +1,185 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	escalatorMaxWait    = time.Hour
+	escalatorRetryDelay = time.Minute
+)
+
+// The EscalatorDatabase interface for encapsulating database access.
+type EscalatorDatabase interface {
+	GetMessageByID(id uint) (*model.Message, error)
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetEscalationPolicyByApplication(appID uint) (*model.EscalationPolicy, error)
+	CreateEscalation(escalation *model.Escalation) error
+	UpdateEscalation(escalation *model.Escalation) error
+	GetDueEscalations(now time.Time) ([]*model.Escalation, error)
+	GetNextEscalation() (*model.Escalation, error)
+	DeleteEscalationByMessage(messageID uint) error
+}
+
+// Mailer sends messages via email.
+type Mailer interface {
+	Send(recipient string, message *model.MessageExternal)
+}
+
+// Escalator repeats messages matching the escalation policy of their
+// application until they are acknowledged. After the configured amount of
+// repetitions the message is additionally delivered to another user or email
+// address.
+type Escalator struct {
+	DB       EscalatorDatabase
+	Notifier Notifier
+	Mailer   Mailer
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewEscalator creates an Escalator and starts repeating due messages.
+// Repeated messages are delivered via notifier, mailer may be nil if email
+// is not configured.
+func NewEscalator(db EscalatorDatabase, notifier Notifier, mailer Mailer) *Escalator {
+	e := &Escalator{
+		DB:       db,
+		Notifier: notifier,
+		Mailer:   mailer,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// Notify starts the escalation of the message if it matches the escalation policy of its application.
+func (e *Escalator) Notify(userID uint, msg *model.MessageExternal) {
+	policy, err := e.DB.GetEscalationPolicyByApplication(msg.ApplicationID)
+	if err != nil {
+		log.Error().Err(err).Uint("message_id", msg.ID).Msg("Could not load escalation policy")
+		return
+	}
+	if policy == nil || msg.Priority == nil || *msg.Priority < policy.MinPriority {
+		return
+	}
+	escalation := &model.Escalation{
+		MessageID:     msg.ID,
+		ApplicationID: msg.ApplicationID,
+		NextAt:        timeNow().Add(escalationInterval(policy)),
+	}
+	if err := e.DB.CreateEscalation(escalation); err != nil {
+		log.Error().Err(err).Uint("message_id", msg.ID).Msg("Could not start escalation")
+		return
+	}
+	e.Reschedule()
+}
+
+// Reschedule must be called when escalations were added, so that the
+// next repetition is recalculated.
+func (e *Escalator) Reschedule() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the escalator.
+func (e *Escalator) Close() {
+	e.closeOnce.Do(func() {
+		close(e.done)
+	})
+	e.wg.Wait()
+}
+
+func (e *Escalator) run() {
+	defer e.wg.Done()
+	for {
+		timer := time.NewTimer(e.escalateDue())
+		select {
+		case <-e.done:
+			timer.Stop()
+			return
+		case <-e.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// escalateDue repeats all due messages and returns the duration until the next repetition is due.
+func (e *Escalator) escalateDue() time.Duration {
+	due, err := e.DB.GetDueEscalations(timeNow())
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load escalations")
+		return escalatorRetryDelay
+	}
+	for _, escalation := range due {
+		if err := e.escalate(escalation); err != nil {
+			log.Error().Err(err).Uint("message_id", escalation.MessageID).Msg("Could not escalate message")
+			return escalatorRetryDelay
+		}
+	}
+
+	next, err := e.DB.GetNextEscalation()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load escalations")
+		return escalatorRetryDelay
+	}
+	if next == nil {
+		return escalatorMaxWait
+	}
+	return min(max(next.NextAt.Sub(timeNow()), 0), escalatorMaxWait)
+}
+
+func (e *Escalator) escalate(escalation *model.Escalation) error {
+	msg, err := e.DB.GetMessageByID(escalation.MessageID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return e.DB.DeleteEscalationByMessage(escalation.MessageID)
+	}
+	app, err := e.DB.GetApplicationByID(msg.ApplicationID)
+	if err != nil {
+		return err
+	}
+	if app == nil {
+		return e.DB.DeleteEscalationByMessage(escalation.MessageID)
+	}
+	policy, err := e.DB.GetEscalationPolicyByApplication(app.ID)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return e.DB.DeleteEscalationByMessage(escalation.MessageID)
+	}
+
+	external := toExternalMessage(msg)
+	e.Notifier.Notify(app.UserID, external)
+	escalation.Attempts++
+
+	if escalation.Escalated || (policy.EscalateAfter > 0 && escalation.Attempts >= policy.EscalateAfter) {
+		if policy.EscalateToUserID != 0 && policy.EscalateToUserID != app.UserID {
+			e.Notifier.Notify(policy.EscalateToUserID, external)
+		}
+		if !escalation.Escalated && policy.EscalateToEmail != "" && e.Mailer != nil {
+			e.Mailer.Send(policy.EscalateToEmail, external)
+		}
+		escalation.Escalated = true
+	}
+	escalation.NextAt = timeNow().Add(escalationInterval(policy))
+	return e.DB.UpdateEscalation(escalation)
+}
+
+func escalationInterval(policy *model.EscalationPolicy) time.Duration {
+	return time.Duration(policy.IntervalMinutes) * time.Minute
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMailer struct {
+	mutex sync.Mutex
+	sent  map[string][]*model.MessageExternal
+}
+
+func (m *recordingMailer) Send(recipient string, msg *model.MessageExternal) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.sent == nil {
+		m.sent = map[string][]*model.MessageExternal{}
+	}
+	m.sent[recipient] = append(m.sent[recipient], msg)
+}
+
+func (m *recordingMailer) get(recipient string) []*model.MessageExternal {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]*model.MessageExternal{}, m.sent[recipient]...)
+}
+
+func createEscalatingMessage(t *testing.T, db *testdb.Database, appID uint, priority int) *model.Message {
+	msg := &model.Message{ApplicationID: appID, Message: "server down", Priority: priority, Date: time.Now()}
+	require.NoError(t, db.CreateMessage(msg))
+	return msg
+}
+
+func TestEscalator_startsEscalationForMatchingMessages(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5})
+
+	escalator := NewEscalator(db, &recordingNotifier{}, nil)
+	defer escalator.Close()
+
+	low := createEscalatingMessage(t, db, 8, 5)
+	escalator.Notify(4, toExternalMessage(low))
+	high := createEscalatingMessage(t, db, 8, 10)
+	before := time.Now()
+	escalator.Notify(4, toExternalMessage(high))
+
+	if escalation, err := db.GetEscalationByMessage(low.ID); assert.NoError(t, err) {
+		assert.Nil(t, escalation, "priority below minPriority")
+	}
+	if escalation, err := db.GetEscalationByMessage(high.ID); assert.NoError(t, err) && assert.NotNil(t, escalation) {
+		assert.Equal(t, 0, escalation.Attempts)
+		assert.False(t, escalation.NextAt.Before(before.Add(5*time.Minute).Truncate(time.Second)))
+	}
+}
+
+func TestEscalator_ignoresApplicationsWithoutPolicy(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+
+	escalator := NewEscalator(db, &recordingNotifier{}, nil)
+	defer escalator.Close()
+
+	msg := createEscalatingMessage(t, db, 8, 10)
+	escalator.Notify(4, toExternalMessage(msg))
+
+	if escalation, err := db.GetEscalationByMessage(msg.ID); assert.NoError(t, err) {
+		assert.Nil(t, escalation)
+	}
+}
+
+func TestEscalator_repeatsDueMessages(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 3})
+	msg := createEscalatingMessage(t, db, 8, 10)
+	db.CreateEscalation(&model.Escalation{MessageID: msg.ID, ApplicationID: 8, NextAt: time.Now().Add(-time.Second)})
+
+	notifier := &recordingNotifier{}
+	mailer := &recordingMailer{}
+	escalator := NewEscalator(db, notifier, mailer)
+	defer escalator.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, msg.ID, notifier.get(4)[0].ID)
+	assert.Equal(t, "server down", notifier.get(4)[0].Message)
+
+	require.Eventually(t, func() bool {
+		escalation, _ := db.GetEscalationByMessage(msg.ID)
+		return escalation != nil && escalation.Attempts == 1
+	}, time.Second, 5*time.Millisecond)
+	escalation, _ := db.GetEscalationByMessage(msg.ID)
+	assert.False(t, escalation.Escalated)
+	assert.True(t, escalation.NextAt.After(time.Now().Add(4*time.Minute)))
+}
+
+func TestEscalator_escalatesAfterAttempts(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.User(5)
+	db.SaveEscalationPolicy(&model.EscalationPolicy{
+		ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5,
+		EscalateAfter: 2, EscalateToUserID: 5, EscalateToEmail: "oncall@example.com",
+	})
+	msg := createEscalatingMessage(t, db, 8, 10)
+	db.CreateEscalation(&model.Escalation{MessageID: msg.ID, ApplicationID: 8, Attempts: 1, NextAt: time.Now().Add(-time.Second)})
+
+	notifier := &recordingNotifier{}
+	mailer := &recordingMailer{}
+	escalator := NewEscalator(db, notifier, mailer)
+	defer escalator.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(5)) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, notifier.get(4), 1)
+	assert.Equal(t, msg.ID, notifier.get(5)[0].ID)
+	require.Eventually(t, func() bool { return len(mailer.get("oncall@example.com")) == 1 }, time.Second, 5*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		escalation, _ := db.GetEscalationByMessage(msg.ID)
+		return escalation != nil && escalation.Escalated
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestEscalator_stopsWhenMessageWasDeleted(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.SaveEscalationPolicy(&model.EscalationPolicy{ApplicationID: 8, MinPriority: 10, IntervalMinutes: 5})
+	db.CreateEscalation(&model.Escalation{MessageID: 42, ApplicationID: 8, NextAt: time.Now().Add(-time.Second)})
+
+	notifier := &recordingNotifier{}
+	escalator := NewEscalator(db, notifier, nil)
+	defer escalator.Close()
+
+	require.Eventually(t, func() bool {
+		escalation, _ := db.GetEscalationByMessage(42)
+		return escalation == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, notifier.get(4))
+}
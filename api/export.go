@@ -0,0 +1,532 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	exportBatchSize = 500
+	formatNDJSON    = "ndjson"
+	formatCSV       = "csv"
+)
+
+// maxImportBytes is the maximum size of the body of an import.
+var maxImportBytes int64 = 100 << 20
+
+var csvHeader = []string{"id", "appid", "date", "priority", "title", "message", "extras", "expiresAt"}
+
+type exportParams struct {
+	Format string `form:"format" binding:"omitempty,oneof=ndjson csv"`
+}
+
+// MessageImportResult Model
+//
+// The result of a message import.
+//
+// swagger:model MessageImportResult
+type MessageImportResult struct {
+	// The amount of imported messages.
+	//
+	// required: true
+	// example: 120
+	Imported int `json:"imported"`
+	// The amount of skipped messages, because they already expired.
+	//
+	// required: true
+	// example: 3
+	Skipped int `json:"skipped"`
+}
+
+// ExportMessages streams all messages of the current user.
+// swagger:operation GET /message/export message exportMessages
+//
+// Export all messages of the current user.
+//
+// The messages are streamed as newline delimited JSON (one message per line) or as CSV with a header row.
+// CSV titles and messages starting with =, +, -, @, a tab, a carriage return or ' are prefixed with ',
+// so that spreadsheets don't evaluate them as formula. The import removes the prefix again.
+// The same filters as for returning the messages can be applied, by default the messages are exported in ascending order.
+//
+//	---
+//	produces: [application/x-ndjson, text/csv]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: format
+//	  in: query
+//	  description: the format of the export
+//	  required: false
+//	  type: string
+//	  enum: [ndjson, csv]
+//	  default: ndjson
+//	- name: appid
+//	  in: query
+//	  description: only export messages of these applications
+//	  required: false
+//	  type: array
+//	  items:
+//	    type: integer
+//	    format: int64
+//	  collectionFormat: multi
+//	- name: after
+//	  in: query
+//	  description: only export messages created after this date (RFC 3339)
+//	  required: false
+//	  type: string
+//	  format: date-time
+//	- name: before
+//	  in: query
+//	  description: only export messages created before this date (RFC 3339)
+//	  required: false
+//	  type: string
+//	  format: date-time
+//	- name: order
+//	  in: query
+//	  description: the order of the messages by id
+//	  required: false
+//	  type: string
+//	  enum: [asc, desc]
+//	  default: asc
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: file
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) ExportMessages(ctx *gin.Context) {
+	params := &exportParams{Format: formatNDJSON}
+	if err := ctx.MustBindWith(params, binding.Query); err != nil {
+		return
+	}
+	filterParams := &messageFilterParams{Order: "asc"}
+	if err := ctx.MustBindWith(filterParams, binding.Query); err != nil {
+		return
+	}
+	filter := filterParams.toFilter()
+	userID := auth.GetUserID(ctx)
+
+	messages, err := a.DB.GetMessagesByUserSince(userID, exportBatchSize, 0, filter)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+
+	var write func(msg *model.Message) error
+	var flush func() error
+	if params.Format == formatCSV {
+		w := csv.NewWriter(ctx.Writer)
+		write = func(msg *model.Message) error { return w.Write(toCSVRecord(msg)) }
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Header("Content-Disposition", "attachment; filename=messages.csv")
+		ctx.Status(200)
+		if err := w.Write(csvHeader); err != nil {
+			return
+		}
+	} else {
+		w := bufio.NewWriter(ctx.Writer)
+		encoder := json.NewEncoder(w)
+		write = func(msg *model.Message) error { return encoder.Encode(toExternalMessage(msg)) }
+		flush = w.Flush
+		ctx.Header("Content-Type", "application/x-ndjson")
+		ctx.Header("Content-Disposition", "attachment; filename=messages.ndjson")
+		ctx.Status(200)
+	}
+
+	for {
+		for _, msg := range messages {
+			if err := write(msg); err != nil {
+				log.Error().Err(err).Uint("user", userID).Msg("Could not export messages")
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			log.Error().Err(err).Uint("user", userID).Msg("Could not export messages")
+			return
+		}
+		ctx.Writer.Flush()
+		if len(messages) < exportBatchSize {
+			return
+		}
+		messages, err = a.DB.GetMessagesByUserSince(userID, exportBatchSize, messages[len(messages)-1].ID, filter)
+		if err != nil {
+			// the status was already sent, the client notices the error by the truncated export.
+			log.Error().Err(err).Uint("user", userID).Msg("Could not export messages")
+			return
+		}
+	}
+}
+
+// ImportMessages imports messages into an application.
+// swagger:operation POST /application/{id}/message/import message importMessages
+//
+// Import messages into an application.
+//
+// The body must be in the format of a message export. The date, priority, title, message, extras
+// and expiry of the messages are preserved, ids and application ids are ignored.
+// Already expired messages are skipped. Imported messages are not sent to the stream clients.
+// The import is atomic, if one message is invalid or the messages exceed the message quota of the owner
+// of the application no message is imported. The body must not be larger than 100 MiB.
+//
+//	---
+//	consumes: [application/x-ndjson, text/csv]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	- name: format
+//	  in: query
+//	  description: the format of the body
+//	  required: false
+//	  type: string
+//	  enum: [ndjson, csv]
+//	  default: ndjson
+//	- name: body
+//	  in: body
+//	  description: the exported messages
+//	  required: true
+//	  schema:
+//	    type: string
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/MessageImportResult"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  413:
+//	    description: Request Entity Too Large
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) ImportMessages(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		params := &exportParams{Format: formatNDJSON}
+		if err := ctx.MustBindWith(params, binding.Query); err != nil {
+			return
+		}
+		app, err := a.DB.GetApplicationByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission != model.SharePermissionManage {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exist", id))
+			return
+		}
+
+		spooled, err := spoolImport(ctx)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ctx.AbortWithError(http.StatusRequestEntityTooLarge, fmt.Errorf("the import must not be larger than %d bytes", maxImportBytes))
+				return
+			}
+			ctx.AbortWithError(500, err)
+			return
+		}
+		defer func() {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}()
+
+		var reader messageReader
+		if params.Format == formatCSV {
+			reader, err = newCSVMessageReader(spooled)
+		} else {
+			reader = newNDJSONMessageReader(spooled)
+		}
+		if err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		// the messages are counted while importing, the database isn't queried inside the import transaction.
+		limit, used, err := a.Quota.messageUsage(app.UserID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+
+		result := &MessageImportResult{}
+		expires := false
+		now := timeNow()
+		index := 0
+		next := func() ([]*model.Message, error) {
+			messages := make([]*model.Message, 0, exportBatchSize)
+			for len(messages) < exportBatchSize {
+				msg, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				index++
+				if err != nil {
+					return nil, &importError{fmt.Errorf("message %d: %s", index, err)}
+				}
+				if msg.Message == "" {
+					return nil, &importError{fmt.Errorf("message %d: message is required", index)}
+				}
+				if msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+					result.Skipped++
+					continue
+				}
+				messages = append(messages, toImportedMessage(app, msg, now))
+				expires = expires || msg.ExpiresAt != nil
+			}
+			result.Imported += len(messages)
+			if err := checkMessageLimit(limit, used+int64(result.Imported)); err != nil {
+				return nil, err
+			}
+			return messages, nil
+		}
+		if err := a.DB.ImportMessages(next); err != nil {
+			var invalid *importError
+			if errors.As(err, &invalid) {
+				ctx.AbortWithError(400, invalid.err)
+				return
+			}
+			var exceeded *MessageQuotaError
+			if errors.As(err, &exceeded) {
+				ctx.AbortWithError(http.StatusForbidden, err)
+				return
+			}
+			ctx.AbortWithError(500, err)
+			return
+		}
+		if expires && a.Reaper != nil {
+			a.Reaper.Reschedule()
+		}
+		ctx.JSON(200, result)
+	})
+}
+
+// importError is returned for invalid messages of an import.
+type importError struct {
+	err error
+}
+
+func (e *importError) Error() string {
+	return e.err.Error()
+}
+
+// spoolImport copies the request body to a temporary file, so that the messages
+// can be inserted in one transaction without waiting for the client.
+func spoolImport(ctx *gin.Context) (*os.File, error) {
+	file, err := os.CreateTemp("", "gotify-import-*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(file, http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBytes))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func toImportedMessage(app *model.Application, msg *model.MessageExternal, now time.Time) *model.Message {
+	priority := app.DefaultPriority
+	if msg.Priority != nil {
+		priority = *msg.Priority
+	}
+	date := msg.Date
+	if date.IsZero() {
+		date = now
+	}
+	message := &model.Message{
+		ApplicationID: app.ID,
+		Message:       msg.Message,
+		Title:         msg.Title,
+		Priority:      priority,
+		Date:          date.UTC(),
+		ExpiresAt:     msg.ExpiresAt,
+	}
+	if msg.Extras != nil {
+		message.Extras, _ = json.Marshal(msg.Extras)
+	}
+	return message
+}
+
+// messageReader reads the messages of an import one by one, it returns io.EOF after the last message.
+type messageReader interface {
+	Read() (*model.MessageExternal, error)
+}
+
+type ndjsonMessageReader struct {
+	decoder *json.Decoder
+}
+
+func newNDJSONMessageReader(r io.Reader) *ndjsonMessageReader {
+	return &ndjsonMessageReader{decoder: json.NewDecoder(r)}
+}
+
+func (r *ndjsonMessageReader) Read() (*model.MessageExternal, error) {
+	msg := &model.MessageExternal{}
+	if err := r.decoder.Decode(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+type csvMessageReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVMessageReader reads the header of the csv, a body without header contains no messages.
+func newCSVMessageReader(r io.Reader) (messageReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &csvMessageReader{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["message"]; !ok {
+		return nil, errors.New("the csv header must contain a message column")
+	}
+	return &csvMessageReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvMessageReader) Read() (*model.MessageExternal, error) {
+	if r.reader == nil {
+		return nil, io.EOF
+	}
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return fromCSVRecord(r.columns, record)
+}
+
+func fromCSVRecord(columns map[string]int, record []string) (*model.MessageExternal, error) {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	msg := &model.MessageExternal{Message: unescapeCSVText(value("message")), Title: unescapeCSVText(value("title"))}
+	if priority := value("priority"); priority != "" {
+		parsed, err := strconv.Atoi(priority)
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority %q", priority)
+		}
+		msg.Priority = &parsed
+	}
+	if date := value("date"); date != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", date)
+		}
+		msg.Date = parsed
+	}
+	if expiresAt := value("expiresAt"); expiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresAt %q", expiresAt)
+		}
+		msg.ExpiresAt = &parsed
+	}
+	if extras := value("extras"); extras != "" {
+		if err := json.Unmarshal([]byte(extras), &msg.Extras); err != nil {
+			return nil, fmt.Errorf("invalid extras: %s", err)
+		}
+	}
+	return msg, nil
+}
+
+func toCSVRecord(msg *model.Message) []string {
+	expiresAt := ""
+	if msg.ExpiresAt != nil {
+		expiresAt = msg.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	return []string{
+		strconv.FormatUint(uint64(msg.ID), 10),
+		strconv.FormatUint(uint64(msg.ApplicationID), 10),
+		msg.Date.Format(time.RFC3339Nano),
+		strconv.Itoa(msg.Priority),
+		escapeCSVText(msg.Title),
+		escapeCSVText(msg.Message),
+		string(msg.Extras),
+		expiresAt,
+	}
+}
+
+// csvFormulaPrefixes are the first characters spreadsheets interpret as formula.
+// The single quote is included, so that unescapeCSVText can tell escaped values apart.
+const csvFormulaPrefixes = "=+-@\t\r'"
+
+// escapeCSVText prefixes values which would be interpreted as formula by spreadsheets with a single quote.
+func escapeCSVText(value string) string {
+	if value != "" && strings.IndexByte(csvFormulaPrefixes, value[0]) >= 0 {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVText removes the prefix added by escapeCSVText.
+func unescapeCSVText(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.IndexByte(csvFormulaPrefixes, value[1]) >= 0 {
+		return value[1:]
+	}
+	return value
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestExportSuite(t *testing.T) {
+	suite.Run(t, new(ExportSuite))
+}
+
+type ExportSuite struct {
+	suite.Suite
+	db          *testdb.Database
+	a           *MessageAPI
+	ctx         *gin.Context
+	recorder    *httptest.ResponseRecorder
+	notified    []*model.MessageExternal
+	rescheduled bool
+}
+
+func (s *ExportSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.db = testdb.NewDB(s.T())
+	s.notified = nil
+	s.rescheduled = false
+	s.a = &MessageAPI{DB: s.db, Notifier: s, Reaper: s}
+
+	user := s.db.User(4)
+	user.App(7)
+	user.App(8)
+	s.db.User(5).App(9)
+}
+
+func (s *ExportSuite) AfterTest(string, string) {
+	s.db.Close()
+}
+
+func (s *ExportSuite) Notify(userID uint, msg *model.MessageExternal) {
+	s.notified = append(s.notified, msg)
+}
+
+func (s *ExportSuite) Reschedule() {
+	s.rescheduled = true
+}
+
+var exportDate = time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+
+func (s *ExportSuite) Test_ExportMessages_ndjson() {
+	s.db.CreateMessage(&model.Message{
+		ApplicationID: 7, Title: "backup", Message: "done", Priority: 3, Date: exportDate,
+		Extras: []byte(`{"client::display":{"contentType":"text/markdown"}}`),
+	})
+	s.db.CreateMessage(&model.Message{ApplicationID: 8, Message: "second", Priority: 5, Date: exportDate.Add(time.Minute)})
+	s.db.CreateMessage(&model.Message{ApplicationID: 9, Message: "foreign", Date: exportDate})
+
+	s.export("")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), "application/x-ndjson", s.recorder.Header().Get("Content-Type"))
+	assert.Equal(s.T(), `{"id":1,"appid":7,"message":"done","title":"backup","priority":3,"extras":{"client::display":{"contentType":"text/markdown"}},"date":"2024-01-05T12:00:00Z"}
+{"id":2,"appid":8,"message":"second","title":"","priority":5,"date":"2024-01-05T12:01:00Z"}
+`, s.recorder.Body.String())
+}
+
+func (s *ExportSuite) Test_ExportMessages_csv() {
+	s.db.CreateMessage(&model.Message{
+		ApplicationID: 7, Title: "backup", Message: "done, \"finally\"", Priority: 3, Date: exportDate,
+		Extras: []byte(`{"a::b":1}`),
+	})
+	s.db.CreateMessage(&model.Message{ApplicationID: 8, Message: "second", Priority: 5, Date: exportDate})
+
+	s.export("format=csv&appid=7")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), "text/csv; charset=utf-8", s.recorder.Header().Get("Content-Type"))
+	assert.Equal(s.T(), `id,appid,date,priority,title,message,extras,expiresAt
+1,7,2024-01-05T12:00:00Z,3,backup,"done, ""finally""","{""a::b"":1}",
+`, s.recorder.Body.String())
+}
+
+func (s *ExportSuite) Test_ExportMessages_multipleBatches() {
+	app := s.db.User(4).App(7)
+	for i := 1; i <= exportBatchSize+1; i++ {
+		app.NewMessage(uint(i))
+	}
+
+	s.export("order=desc")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	lines := strings.Split(strings.TrimSuffix(s.recorder.Body.String(), "\n"), "\n")
+	if assert.Len(s.T(), lines, exportBatchSize+1) {
+		assert.True(s.T(), strings.HasPrefix(lines[0], fmt.Sprintf(`{"id":%d,`, exportBatchSize+1)))
+		assert.True(s.T(), strings.HasPrefix(lines[exportBatchSize], `{"id":1,`))
+	}
+}
+
+func (s *ExportSuite) Test_ExportMessages_invalidFormat() {
+	s.export("format=xml")
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *ExportSuite) Test_ImportMessages_ndjson() {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	body := fmt.Sprintf(`{"id":1,"appid":3,"message":"done","title":"backup","priority":3,"extras":{"a::b":1},"date":"2024-01-05T13:00:00+01:00"}
+{"message":"default priority","expiresAt":"%s"}
+{"message":"expired","expiresAt":"2000-01-01T00:00:00Z"}
+`, expiresAt.Format(time.RFC3339))
+
+	s.importMessages("8", "", body)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &MessageImportResult{Imported: 2, Skipped: 1}, s.recorder)
+	assert.Empty(s.T(), s.notified)
+	assert.True(s.T(), s.rescheduled, "reaper must delete the imported message when it expires")
+	msgs, err := s.db.GetMessagesByApplication(8)
+	assert.NoError(s.T(), err)
+	if assert.Len(s.T(), msgs, 2) {
+		assert.Equal(s.T(), "done", msgs[1].Message)
+		assert.Equal(s.T(), "backup", msgs[1].Title)
+		assert.Equal(s.T(), 3, msgs[1].Priority)
+		assert.Equal(s.T(), `{"a::b":1}`, string(msgs[1].Extras))
+		assert.True(s.T(), exportDate.Equal(msgs[1].Date), msgs[1].Date)
+		assert.Equal(s.T(), "default priority", msgs[0].Message)
+		if assert.NotNil(s.T(), msgs[0].ExpiresAt) {
+			assert.True(s.T(), expiresAt.Equal(*msgs[0].ExpiresAt))
+		}
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_csvRoundTrip() {
+	s.db.CreateMessage(&model.Message{
+		ApplicationID: 7, Title: "backup", Message: "multi\nline, \"quoted\"", Priority: 3, Date: exportDate,
+		Extras: []byte(`{"a::b":1}`),
+	})
+	s.export("format=csv")
+	exported := s.recorder.Body.String()
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.importMessages("8", "format=csv", exported)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &MessageImportResult{Imported: 1}, s.recorder)
+	msgs, err := s.db.GetMessagesByApplication(8)
+	assert.NoError(s.T(), err)
+	if assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), "multi\nline, \"quoted\"", msgs[0].Message)
+		assert.Equal(s.T(), "backup", msgs[0].Title)
+		assert.Equal(s.T(), 3, msgs[0].Priority)
+		assert.Equal(s.T(), `{"a::b":1}`, string(msgs[0].Extras))
+		assert.True(s.T(), exportDate.Equal(msgs[0].Date))
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_withoutExpiry() {
+	s.importMessages("8", "", `{"message":"ok"}`)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.False(s.T(), s.rescheduled)
+}
+
+func (s *ExportSuite) Test_ImportMessages_csvFormulas() {
+	for i, message := range []string{"=HYPERLINK(\"http://evil\")", "+1", "-1", "@SUM(A1)", "'quoted", "plain"} {
+		s.db.CreateMessage(&model.Message{ApplicationID: 7, Title: message, Message: message, Date: exportDate.Add(time.Duration(i) * time.Second)})
+	}
+	s.export("format=csv")
+	exported := s.recorder.Body.String()
+
+	records, err := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	assert.NoError(s.T(), err)
+	titles := []string{}
+	for _, record := range records[1:] {
+		titles = append(titles, record[4])
+		assert.Equal(s.T(), record[4], record[5])
+	}
+	assert.Equal(s.T(), []string{"'=HYPERLINK(\"http://evil\")", "'+1", "'-1", "'@SUM(A1)", "''quoted", "plain"}, titles)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.importMessages("8", "format=csv", exported)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	msgs, err := s.db.GetMessagesByApplication(8)
+	assert.NoError(s.T(), err)
+	imported := []string{}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		imported = append(imported, msgs[i].Message)
+	}
+	assert.Equal(s.T(), []string{"=HYPERLINK(\"http://evil\")", "+1", "-1", "@SUM(A1)", "'quoted", "plain"}, imported)
+}
+
+func (s *ExportSuite) Test_ImportMessages_invalidInLaterBatch() {
+	var body strings.Builder
+	for i := 0; i < exportBatchSize+1; i++ {
+		body.WriteString(`{"message":"ok"}` + "\n")
+	}
+	body.WriteString(`{"title":"missing message"}`)
+
+	s.importMessages("8", "", body.String())
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs, "the import is atomic")
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_exceedsMessageQuota() {
+	s.a.Quota = &QuotaAPI{DB: s.db, Defaults: model.QuotaLimits{Messages: exportBatchSize + 1}}
+	s.db.CreateMessage(&model.Message{ApplicationID: 7, Message: "existing"})
+	var body strings.Builder
+	for i := 0; i < exportBatchSize+1; i++ {
+		body.WriteString(`{"message":"ok"}` + "\n")
+	}
+
+	s.importMessages("8", "", body.String())
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, fmt.Sprintf("messages quota exceeded, the user may have at most %d messages", exportBatchSize+1))
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs, "the import is atomic")
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_withinMessageQuota() {
+	s.a.Quota = &QuotaAPI{DB: s.db, Defaults: model.QuotaLimits{Messages: 3}}
+	s.db.CreateMessage(&model.Message{ApplicationID: 7, Message: "existing"})
+
+	s.importMessages("8", "", `{"message":"first"}`+"\n"+`{"message":"second"}`+"\n"+`{"message":"expired","expiresAt":"2000-01-01T00:00:00Z"}`)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 2, "skipped messages don't count")
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_tooLarge() {
+	old := maxImportBytes
+	maxImportBytes = 10
+	defer func() { maxImportBytes = old }()
+
+	s.importMessages("8", "", `{"message":"too large"}`)
+
+	assert.Equal(s.T(), 413, s.recorder.Code)
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_invalid() {
+	tests := []struct {
+		query string
+		body  string
+	}{
+		{body: `{"message":"ok"}` + "\n" + `{"title":"missing message"}`},
+		{body: `{"message":"ok"}` + "\n" + `{"message":`},
+		{query: "format=csv", body: "title\nmissing message column"},
+		{query: "format=csv", body: "message,priority\nok,high"},
+		{query: "format=csv", body: "message,extras\nok,{invalid"},
+		{query: "format=xml", body: `{"message":"ok"}`},
+	}
+	for _, tt := range tests {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		s.importMessages("8", tt.query, tt.body)
+
+		assert.Equal(s.T(), 400, s.recorder.Code, tt.body)
+	}
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_foreignApplication() {
+	s.importMessages("9", "", `{"message":"ok"}`)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if msgs, err := s.db.GetMessagesByApplication(9); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *ExportSuite) Test_ImportMessages_readShare() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 9, UserID: 4, Permission: model.SharePermissionRead})
+
+	s.importMessages("9", "", `{"message":"ok"}`)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ExportSuite) export(query string) {
+	test.WithUser(s.ctx, 4)
+	s.ctx.Request = httptest.NewRequest("GET", "/message/export?"+query, nil)
+	s.a.ExportMessages(s.ctx)
+}
+
+func (s *ExportSuite) importMessages(id, query, body string) {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", id)
+	s.ctx.Request = httptest.NewRequest("POST", "/application/"+id+"/message/import?"+query, strings.NewReader(body))
+	s.a.ImportMessages(s.ctx)
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+)
+
+// The GroupDatabase interface for encapsulating database access.
+type GroupDatabase interface {
+	GetGroupByID(id uint) (*model.Group, error)
+	GetGroupByName(name string) (*model.Group, error)
+	GetGroups() ([]*model.Group, error)
+	GetGroupsByUser(userID uint) ([]*model.Group, error)
+	CreateGroup(group *model.Group) error
+	UpdateGroup(group *model.Group) error
+	DeleteGroupByID(id uint) error
+	GetUserByID(id uint) (*model.User, error)
+}
+
+// The GroupAPI provides handlers for managing groups.
+type GroupAPI struct {
+	DB GroupDatabase
+}
+
+// Group Params Model
+//
+// Params allowed to create or update groups.
+//
+// swagger:model GroupParams
+type GroupParams struct {
+	// The name of the group.
+	//
+	// required: true
+	// example: ops
+	Name string `form:"name" query:"name" json:"name" binding:"required"`
+	// The ids of the members.
+	//
+	// example: [1, 2]
+	Members []uint `form:"members" query:"members" json:"members"`
+}
+
+// GetGroups returns all groups.
+// swagger:operation GET /group group getGroups
+//
+// Return all groups.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/Group"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) GetGroups(ctx *gin.Context) {
+	groups, err := a.DB.GetGroups()
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, nonNil(groups))
+}
+
+// GetCurrentUserGroups returns all groups of the current user.
+// swagger:operation GET /current/user/group group currentUserGroups
+//
+// Return all groups the current user is a member of.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/Group"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) GetCurrentUserGroups(ctx *gin.Context) {
+	groups, err := a.DB.GetGroupsByUser(auth.GetUserID(ctx))
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, nonNil(groups))
+}
+
+// CreateGroup creates a group.
+// swagger:operation POST /group group createGroup
+//
+// Create a group.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the group to add
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/GroupParams"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Group"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) CreateGroup(ctx *gin.Context) {
+	group := &model.Group{CreatedAt: timeNow()}
+	if !a.bindGroup(ctx, group) {
+		return
+	}
+	if success := successOrAbort(ctx, 500, a.DB.CreateGroup(group)); !success {
+		return
+	}
+	ctx.JSON(200, group)
+}
+
+// GetGroupByID returns the group by id.
+// swagger:operation GET /group/{id} group getGroup
+//
+// Get a group.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the group id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Group"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) GetGroupByID(ctx *gin.Context) {
+	a.withGroup(ctx, func(group *model.Group) {
+		ctx.JSON(200, group)
+	})
+}
+
+// UpdateGroupByID updates the group by id.
+// swagger:operation PUT /group/{id} group updateGroup
+//
+// Update the name and the members of a group.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the updated group
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/GroupParams"
+//	- name: id
+//	  in: path
+//	  description: the group id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Group"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) UpdateGroupByID(ctx *gin.Context) {
+	a.withGroup(ctx, func(group *model.Group) {
+		if !a.bindGroup(ctx, group) {
+			return
+		}
+		if success := successOrAbort(ctx, 500, a.DB.UpdateGroup(group)); !success {
+			return
+		}
+		ctx.JSON(200, group)
+	})
+}
+
+// DeleteGroupByID deletes the group by id.
+// swagger:operation DELETE /group/{id} group deleteGroup
+//
+// Delete a group.
+//
+// The applications of the group are kept by the users who created them.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the group id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *GroupAPI) DeleteGroupByID(ctx *gin.Context) {
+	a.withGroup(ctx, func(group *model.Group) {
+		successOrAbort(ctx, 500, a.DB.DeleteGroupByID(group.ID))
+	})
+}
+
+func (a *GroupAPI) withGroup(ctx *gin.Context, f func(group *model.Group)) {
+	withID(ctx, "id", func(id uint) {
+		group, err := a.DB.GetGroupByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if group == nil {
+			ctx.AbortWithError(404, fmt.Errorf("group with id %d doesn't exists", id))
+			return
+		}
+		f(group)
+	})
+}
+
+func (a *GroupAPI) bindGroup(ctx *gin.Context, group *model.Group) bool {
+	params := GroupParams{}
+	if err := ctx.Bind(&params); err != nil {
+		return false
+	}
+	existing, err := a.DB.GetGroupByName(params.Name)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	if existing != nil && existing.ID != group.ID {
+		ctx.AbortWithError(400, errors.New("group name already exists"))
+		return false
+	}
+
+	members := []uint{}
+	seen := map[uint]bool{}
+	for _, userID := range params.Members {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		user, err := a.DB.GetUserByID(userID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return false
+		}
+		if user == nil {
+			ctx.AbortWithError(400, fmt.Errorf("user with id %d doesn't exists", userID))
+			return false
+		}
+		members = append(members, userID)
+	}
+	group.Name = params.Name
+	group.Members = members
+	return true
+}
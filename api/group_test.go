@@ -0,0 +1,330 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestGroupSuite(t *testing.T) {
+	suite.Run(t, new(GroupSuite))
+}
+
+type GroupSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *GroupAPI
+	apps     *ApplicationAPI
+	m        *MessageAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	notified map[uint][]*model.MessageExternal
+}
+
+func (s *GroupSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.notified = map[uint][]*model.MessageExternal{}
+	s.a = &GroupAPI{DB: s.db}
+	s.apps = &ApplicationAPI{DB: s.db}
+	s.m = &MessageAPI{DB: s.db, Notifier: &ShareNotifier{DB: s.db, Notifier: s}}
+
+	s.db.User(4).App(8).Message(1).Message(2)
+	s.db.User(5)
+	s.db.User(6)
+	s.db.CreateGroup(&model.Group{Name: "ops", Members: []uint{4, 5}})
+	app, _ := s.db.GetApplicationByID(8)
+	app.GroupID = 1
+	s.db.UpdateApplication(app)
+}
+
+func (s *GroupSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+}
+
+func (s *GroupSuite) Notify(userID uint, msg *model.MessageExternal) {
+	s.notified[userID] = append(s.notified[userID], msg)
+}
+
+func (s *GroupSuite) Test_ensureGroupHasCorrectJsonRepresentation() {
+	actual := &model.Group{ID: 1, Name: "ops", Members: []uint{4, 5}, CreatedAt: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	test.JSONEquals(s.T(), actual, `{"id":1,"name":"ops","members":[4,5],"createdAt":"2024-01-05T00:00:00Z"}`)
+}
+
+func (s *GroupSuite) Test_GetGroups() {
+	s.db.CreateGroup(&model.Group{Name: "dev"})
+
+	s.ctx.Request = httptest.NewRequest("GET", "/group", nil)
+	s.a.GetGroups(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	groups, err := s.db.GetGroups()
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), groups, 2)
+	test.BodyEquals(s.T(), groups, s.recorder)
+}
+
+func (s *GroupSuite) Test_GetCurrentUserGroups() {
+	s.db.CreateGroup(&model.Group{Name: "dev", Members: []uint{5, 6}})
+
+	test.WithUser(s.ctx, 6)
+	s.ctx.Request = httptest.NewRequest("GET", "/current/user/group", nil)
+	s.a.GetCurrentUserGroups(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	group, _ := s.db.GetGroupByName("dev")
+	test.BodyEquals(s.T(), []*model.Group{group}, s.recorder)
+}
+
+func (s *GroupSuite) Test_CreateGroup() {
+	t := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	s.withJSON("POST", "/group", `{"name":"dev","members":[6,5,6]}`)
+	s.a.CreateGroup(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.Group{ID: 2, Name: "dev", Members: []uint{6, 5}, CreatedAt: t}, s.recorder)
+	if group, err := s.db.GetGroupByID(2); assert.NoError(s.T(), err) && assert.NotNil(s.T(), group) {
+		assert.Equal(s.T(), "dev", group.Name)
+		assert.Equal(s.T(), []uint{5, 6}, group.Members)
+	}
+}
+
+func (s *GroupSuite) Test_CreateGroup_invalid() {
+	tests := []string{
+		`{"members":[4]}`,
+		`{"name":"ops"}`,
+		`{"name":"dev","members":[99]}`,
+	}
+	for _, body := range tests {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		s.withJSON("POST", "/group", body)
+		s.a.CreateGroup(s.ctx)
+
+		assert.Equal(s.T(), 400, s.recorder.Code, body)
+	}
+	if groups, err := s.db.GetGroups(); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), groups, 1)
+	}
+}
+
+func (s *GroupSuite) Test_GetGroupByID_unknown() {
+	s.ctx.AddParam("id", "99")
+	s.ctx.Request = httptest.NewRequest("GET", "/group/99", nil)
+	s.a.GetGroupByID(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *GroupSuite) Test_UpdateGroupByID() {
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", "/group/1", `{"name":"ops","members":[6]}`)
+	s.a.UpdateGroupByID(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if group, err := s.db.GetGroupByID(1); assert.NoError(s.T(), err) && assert.NotNil(s.T(), group) {
+		assert.Equal(s.T(), "ops", group.Name)
+		assert.Equal(s.T(), []uint{6}, group.Members)
+		test.BodyEquals(s.T(), group, s.recorder)
+	}
+}
+
+func (s *GroupSuite) Test_UpdateGroupByID_duplicateName() {
+	s.db.CreateGroup(&model.Group{Name: "dev"})
+
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", "/group/1", `{"name":"dev"}`)
+	s.a.UpdateGroupByID(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if group, err := s.db.GetGroupByID(1); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "ops", group.Name)
+	}
+}
+
+func (s *GroupSuite) Test_DeleteGroupByID() {
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/group/1", nil)
+	s.a.DeleteGroupByID(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if group, err := s.db.GetGroupByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), group)
+	}
+	if app, err := s.db.GetApplicationByID(8); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), uint(0), app.GroupID)
+		assert.Equal(s.T(), uint(4), app.UserID)
+	}
+}
+
+func (s *GroupSuite) Test_CreateApplication_withGroup() {
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", "/application", `{"name":"deploy","groupId":1}`)
+	s.apps.CreateApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if apps, err := s.db.GetApplicationsByGroup(1); assert.NoError(s.T(), err) && assert.Len(s.T(), apps, 2) {
+		assert.Equal(s.T(), "deploy", apps[1].Name)
+		assert.Equal(s.T(), uint(5), apps[1].UserID)
+	}
+}
+
+func (s *GroupSuite) Test_CreateApplication_withGroup_notMember() {
+	test.WithUser(s.ctx, 6)
+	s.withJSON("POST", "/application", `{"name":"deploy","groupId":1}`)
+	s.apps.CreateApplication(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if apps, err := s.db.GetApplicationsByUser(6); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), apps)
+	}
+}
+
+func (s *GroupSuite) Test_GetApplications_includesGroupApplications() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("GET", "/application", nil)
+	s.apps.GetApplications(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	app, _ := s.db.GetApplicationByID(8)
+	app.Token = ""
+	app.Image = "static/defaultapp.png"
+	app.SharedPermission = model.SharePermissionManage
+	test.BodyEquals(s.T(), []*model.Application{app}, s.recorder)
+}
+
+func (s *GroupSuite) Test_UpdateApplication_groupMember() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8", `{"name":"renamed"}`)
+	s.apps.UpdateApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if app, err := s.db.GetApplicationByID(8); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "renamed", app.Name)
+	}
+}
+
+func (s *GroupSuite) Test_CreateMessage_notifiesMembers() {
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", "/message", `{"appid":8,"message":"deploy done"}`)
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	for _, userID := range []uint{4, 5} {
+		if assert.Len(s.T(), s.notified[userID], 1, "user %d", userID) {
+			assert.Equal(s.T(), "deploy done", s.notified[userID][0].Message)
+		}
+	}
+	assert.Empty(s.T(), s.notified[6])
+}
+
+func (s *GroupSuite) Test_CreateMessage_notMember() {
+	test.WithUser(s.ctx, 6)
+	s.withJSON("POST", "/message", `{"appid":8,"message":"deploy done"}`)
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.Empty(s.T(), s.notified)
+}
+
+func (s *GroupSuite) Test_DeleteMessage_onlyForCurrentMember() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.db.AssertMessageExist(1)
+	s.assertMessageIDs(5, 2)
+	s.assertMessageIDs(4, 2, 1)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *GroupSuite) Test_DeleteMessageWithApplication_onlyForCurrentMember() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/message", nil)
+	s.m.DeleteMessageWithApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.db.AssertMessageExist(1)
+	s.db.AssertMessageExist(2)
+	s.assertMessageIDs(4)
+	s.assertMessageIDs(5, 2, 1)
+}
+
+func (s *GroupSuite) Test_MarkMessageRead() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "2")
+	s.ctx.Request = httptest.NewRequest("POST", "/message/2/read", nil)
+	s.m.MarkMessageRead(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/message", nil)
+	s.m.GetMessagesWithApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Contains(s.T(), s.recorder.Body.String(), `"id":2,"appid":8`)
+	assert.Contains(s.T(), s.recorder.Body.String(), `"read":true`)
+	if read, err := s.db.GetReadMessageIDs(4, []uint{1, 2}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), read)
+	}
+}
+
+func (s *GroupSuite) Test_MarkMessageRead_notMember() {
+	test.WithUser(s.ctx, 6)
+	s.ctx.AddParam("id", "2")
+	s.ctx.Request = httptest.NewRequest("POST", "/message/2/read", nil)
+	s.m.MarkMessageRead(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if read, err := s.db.GetReadMessageIDs(6, []uint{2}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), read)
+	}
+}
+
+func (s *GroupSuite) assertMessageIDs(userID uint, ids ...uint) {
+	msgs, err := s.db.GetMessagesByUserSince(userID, 100, 0, model.MessageFilter{})
+	assert.NoError(s.T(), err)
+	actual := []uint{}
+	for _, msg := range msgs {
+		actual = append(actual, msg.ID)
+	}
+	if ids == nil {
+		ids = []uint{}
+	}
+	assert.Equal(s.T(), ids, actual, "user %d", userID)
+}
+
+func (s *GroupSuite) withJSON(method, url, body string) {
+	s.ctx.Request = httptest.NewRequest(method, url, strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/icon"
+)
+
+// The ImageAPI provides handlers for serving application images.
+type ImageAPI struct {
+	ImageDir string
+}
+
+// GetImage returns an application image.
+// swagger:operation GET /image/{name} application getAppImage
+//
+// Return an application image.
+//
+// Without size the image is returned with at most 256x256 pixels. Images uploaded by older versions
+// are scaled down on the first request, images with more than 4096x4096 pixels are returned unchanged.
+//
+//	---
+//	produces: [image/png, image/jpeg, image/gif]
+//	parameters:
+//	- name: name
+//	  in: path
+//	  description: the image name, the image field of an application without the image/ prefix
+//	  required: true
+//	  type: string
+//	- name: size
+//	  in: query
+//	  description: the edge length in pixels the image is scaled down to fit in, the aspect ratio is kept.
+//	  required: false
+//	  type: integer
+//	  enum: [64, 128, 256]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        type: file
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  500:
+//	    description: Server Error
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *ImageAPI) GetImage(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if name != filepath.Base(name) || !ValidApplicationImageExt(filepath.Ext(name)) || !exist(filepath.Join(a.ImageDir, name)) {
+		ctx.AbortWithError(404, errors.New("image does not exist"))
+		return
+	}
+
+	value, ok := ctx.GetQuery("size")
+	if !ok && icon.IsVariant(name) {
+		ctx.File(filepath.Join(a.ImageDir, name))
+		return
+	}
+	// the variant with the maximum size is the stored image, it is created for images uploaded by older versions.
+	size := icon.MaxSize
+	if ok {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || !icon.ValidSize(size) {
+			ctx.AbortWithError(400, fmt.Errorf("size must be one of %v", icon.Sizes))
+			return
+		}
+		if icon.IsVariant(name) {
+			ctx.AbortWithError(400, errors.New("size is not supported for a resized image"))
+			return
+		}
+	}
+	path, err := icon.Variant(a.ImageDir, name, size)
+	if errors.Is(err, icon.ErrTooLarge) {
+		// images uploaded by older versions weren't limited, they can't be scaled down and are served unchanged.
+		path, err = filepath.Join(a.ImageDir, name), nil
+	}
+	if err != nil {
+		ctx.AbortWithError(500, err)
+		return
+	}
+	ctx.File(path)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/icon"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestImageSuite(t *testing.T) {
+	suite.Run(t, new(ImageSuite))
+}
+
+type ImageSuite struct {
+	suite.Suite
+	a        *ImageAPI
+	ctx      *gin.Context
+	imageDir test.TmpDir
+	recorder *httptest.ResponseRecorder
+}
+
+func (s *ImageSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.imageDir = test.NewTmpDir("gotify_imagesuite")
+	s.a = &ImageAPI{ImageDir: s.imageDir.Path() + "/"}
+	fakeImage(s.T(), s.imageDir.Path("legacy.png"))
+}
+
+func (s *ImageSuite) AfterTest(suiteName, testName string) {
+	s.imageDir.Clean()
+}
+
+func (s *ImageSuite) getImage(name, query string) {
+	s.ctx.Request = httptest.NewRequest("GET", "/image/"+name+query, nil)
+	s.ctx.Params = gin.Params{{Key: "name", Value: name}}
+	s.a.GetImage(s.ctx)
+}
+
+func (s *ImageSuite) Test_GetImage() {
+	s.getImage("legacy.png", "")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), "image/png", s.recorder.Header().Get("Content-Type"))
+	assert.NoFileExists(s.T(), s.imageDir.Path("legacy@64.png"))
+}
+
+func (s *ImageSuite) Test_GetImage_legacyImageIsScaledDownOnce() {
+	writeImage(s.T(), s.imageDir.Path("large.jpg"), image.NewGray(image.Rect(0, 0, 1024, 512)))
+
+	s.getImage("large.jpg", "")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), "image/png", s.recorder.Header().Get("Content-Type"))
+	config, _, err := image.DecodeConfig(s.recorder.Body)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 256, config.Width)
+	assert.Equal(s.T(), 128, config.Height)
+	info, err := os.Stat(s.imageDir.Path("large@256.png"))
+	require.NoError(s.T(), err)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.getImage("large.jpg", "")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if again, err := os.Stat(s.imageDir.Path("large@256.png")); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), info.ModTime(), again.ModTime(), "the scaled down image is only created once")
+	}
+}
+
+func (s *ImageSuite) Test_GetImage_tooLargeLegacyImageIsServedUnchanged() {
+	writeImage(s.T(), s.imageDir.Path("huge.png"), image.NewGray(image.Rect(0, 0, 4097, 4096)))
+	expected, err := os.ReadFile(s.imageDir.Path("huge.png"))
+	require.NoError(s.T(), err)
+
+	s.getImage("huge.png", "")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), expected, s.recorder.Body.Bytes())
+	assert.NoFileExists(s.T(), s.imageDir.Path("huge@256.png"))
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.getImage("huge.png", "?size=64")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Equal(s.T(), expected, s.recorder.Body.Bytes())
+	assert.NoFileExists(s.T(), s.imageDir.Path("huge@64.png"))
+}
+
+func (s *ImageSuite) Test_GetImage_withSize_createsVariantLazily() {
+	s.getImage("legacy.png", "?size=64")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.FileExists(s.T(), s.imageDir.Path("legacy@64.png"))
+	config, _, err := image.DecodeConfig(s.recorder.Body)
+	require.NoError(s.T(), err)
+	assert.LessOrEqual(s.T(), config.Width, 64)
+	assert.LessOrEqual(s.T(), config.Height, 64)
+}
+
+func (s *ImageSuite) Test_GetImage_invalidSize() {
+	s.getImage("legacy.png", "?size=100")
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "size must be one of [64 128 256]")
+}
+
+func (s *ImageSuite) Test_GetImage_sizeOfVariant() {
+	fakeImage(s.T(), s.imageDir.Path("legacy@64.png"))
+
+	s.getImage("legacy@64.png", "?size=64")
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.NoFileExists(s.T(), s.imageDir.Path(icon.VariantName("legacy@64.png", 64)))
+}
+
+func (s *ImageSuite) Test_GetImage_notFound() {
+	s.getImage("unknown.png", "?size=64")
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ImageSuite) Test_GetImage_variantWithoutSize() {
+	fakeImage(s.T(), s.imageDir.Path("legacy@64.png"))
+
+	s.getImage("legacy@64.png", "")
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.NoFileExists(s.T(), s.imageDir.Path(icon.VariantName("legacy@64.png", icon.MaxSize)))
+}
+
+func (s *ImageSuite) Test_GetImage_invalidName() {
+	s.getImage("..", "")
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func writeImage(t *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	if filepath.Ext(path) == ".jpg" {
+		require.NoError(t, jpeg.Encode(file, img, nil))
+		return
+	}
+	require.NoError(t, png.Encode(file, img))
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+)
+
+// The MailForwardDatabase interface for encapsulating database access.
+type MailForwardDatabase interface {
+	GetMailForwardRuleByID(id uint) (*model.MailForwardRule, error)
+	GetMailForwardRulesByUser(userID uint) ([]*model.MailForwardRule, error)
+	CreateMailForwardRule(rule *model.MailForwardRule) error
+	UpdateMailForwardRule(rule *model.MailForwardRule) error
+	DeleteMailForwardRuleByID(id uint) error
+	GetApplicationByID(id uint) (*model.Application, error)
+}
+
+// The MailForwardAPI provides handlers for managing email forwarding rules.
+type MailForwardAPI struct {
+	DB MailForwardDatabase
+}
+
+// MailForwardRule Params Model
+//
+// Params allowed to create or update mail forward rules.
+//
+// swagger:model MailForwardRuleParams
+type MailForwardRuleParams struct {
+	// The email address the messages are forwarded to.
+	//
+	// required: true
+	// example: ops@example.com
+	Recipient string `form:"recipient" query:"recipient" json:"recipient" binding:"required"`
+	// The minimum priority a message must have to be forwarded.
+	//
+	// example: 8
+	MinPriority int `form:"minPriority" query:"minPriority" json:"minPriority"`
+	// Only forward messages of this application. 0 or omitted forwards messages of all applications.
+	//
+	// example: 0
+	ApplicationID uint `form:"appid" query:"appid" json:"appid"`
+	// Only forward messages while no client of the user is connected to the stream.
+	//
+	// example: true
+	OnlyWhenOffline bool `form:"onlyWhenOffline" query:"onlyWhenOffline" json:"onlyWhenOffline"`
+}
+
+// GetMailForwardRules returns all mail forward rules of a user.
+// swagger:operation GET /mail/forward mail getMailForwardRules
+//
+// Return all email forwarding rules.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/MailForwardRule"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MailForwardAPI) GetMailForwardRules(ctx *gin.Context) {
+	rules, err := a.DB.GetMailForwardRulesByUser(auth.GetUserID(ctx))
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, rules)
+}
+
+// CreateMailForwardRule creates a mail forward rule.
+// swagger:operation POST /mail/forward mail createMailForwardRule
+//
+// Create an email forwarding rule.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the rule to add
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/MailForwardRuleParams"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/MailForwardRule"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MailForwardAPI) CreateMailForwardRule(ctx *gin.Context) {
+	params := MailForwardRuleParams{}
+	if err := ctx.Bind(&params); err == nil {
+		rule := &model.MailForwardRule{UserID: auth.GetUserID(ctx)}
+		if !a.applyParams(ctx, rule, &params) {
+			return
+		}
+		if success := successOrAbort(ctx, 500, a.DB.CreateMailForwardRule(rule)); !success {
+			return
+		}
+		ctx.JSON(200, rule)
+	}
+}
+
+// UpdateMailForwardRule updates a mail forward rule by its id.
+// swagger:operation PUT /mail/forward/{id} mail updateMailForwardRule
+//
+// Update an email forwarding rule.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the rule to update
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/MailForwardRuleParams"
+//	- name: id
+//	  in: path
+//	  description: the rule id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/MailForwardRule"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MailForwardAPI) UpdateMailForwardRule(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		rule, err := a.DB.GetMailForwardRuleByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if rule == nil || rule.UserID != auth.GetUserID(ctx) {
+			ctx.AbortWithError(404, fmt.Errorf("mail forward rule with id %d doesn't exists", id))
+			return
+		}
+		params := MailForwardRuleParams{}
+		if err := ctx.Bind(&params); err == nil {
+			if !a.applyParams(ctx, rule, &params) {
+				return
+			}
+			if success := successOrAbort(ctx, 500, a.DB.UpdateMailForwardRule(rule)); !success {
+				return
+			}
+			ctx.JSON(200, rule)
+		}
+	})
+}
+
+// DeleteMailForwardRule deletes a mail forward rule by its id.
+// swagger:operation DELETE /mail/forward/{id} mail deleteMailForwardRule
+//
+// Delete an email forwarding rule.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the rule id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MailForwardAPI) DeleteMailForwardRule(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		rule, err := a.DB.GetMailForwardRuleByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if rule == nil || rule.UserID != auth.GetUserID(ctx) {
+			ctx.AbortWithError(404, fmt.Errorf("mail forward rule with id %d doesn't exists", id))
+			return
+		}
+		successOrAbort(ctx, 500, a.DB.DeleteMailForwardRuleByID(id))
+	})
+}
+
+func (a *MailForwardAPI) applyParams(ctx *gin.Context, rule *model.MailForwardRule, params *MailForwardRuleParams) bool {
+	address, err := mail.ParseAddress(params.Recipient)
+	if err != nil {
+		ctx.AbortWithError(400, errors.New("recipient is not a valid email address"))
+		return false
+	}
+	if params.ApplicationID != 0 {
+		app, err := a.DB.GetApplicationByID(params.ApplicationID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return false
+		}
+		if app == nil || app.UserID != rule.UserID {
+			ctx.AbortWithError(400, errors.New("appid not found"))
+			return false
+		}
+	}
+	rule.Recipient = address.Address
+	rule.MinPriority = params.MinPriority
+	rule.ApplicationID = params.ApplicationID
+	rule.OnlyWhenOffline = params.OnlyWhenOffline
+	return true
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMailForwardSuite(t *testing.T) {
+	suite.Run(t, new(MailForwardSuite))
+}
+
+type MailForwardSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *MailForwardAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+}
+
+func (s *MailForwardSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.a = &MailForwardAPI{DB: s.db}
+}
+
+func (s *MailForwardSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+}
+
+func (s *MailForwardSuite) Test_ensureMailForwardRuleHasCorrectJsonRepresentation() {
+	actual := &model.MailForwardRule{ID: 1, UserID: 2, Recipient: "ops@example.com", MinPriority: 8, ApplicationID: 3, OnlyWhenOffline: true, CreatedAt: testdb.Now}
+	test.JSONEquals(s.T(), actual, `{"id":1,"recipient":"ops@example.com","minPriority":8,"appid":3,"onlyWhenOffline":true,"createdAt":"2020-01-01T00:00:00Z"}`)
+}
+
+func (s *MailForwardSuite) Test_GetMailForwardRules() {
+	s.db.User(5)
+	s.db.User(6)
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: 5, Recipient: "ops@example.com"})
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: 6, Recipient: "other@example.com"})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("GET", "/mail/forward", nil)
+	s.a.GetMailForwardRules(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Contains(s.T(), s.recorder.Body.String(), "ops@example.com")
+	assert.NotContains(s.T(), s.recorder.Body.String(), "other@example.com")
+}
+
+func (s *MailForwardSuite) Test_CreateMailForwardRule() {
+	s.db.User(5).App(3)
+
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", `{"recipient":"Ops <ops@example.com>","minPriority":8,"appid":3,"onlyWhenOffline":true}`)
+	s.a.CreateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if rules, err := s.db.GetMailForwardRulesByUser(5); assert.NoError(s.T(), err) && assert.Len(s.T(), rules, 1) {
+		assert.Equal(s.T(), "ops@example.com", rules[0].Recipient)
+		assert.Equal(s.T(), 8, rules[0].MinPriority)
+		assert.Equal(s.T(), uint(3), rules[0].ApplicationID)
+		assert.True(s.T(), rules[0].OnlyWhenOffline)
+	}
+}
+
+func (s *MailForwardSuite) Test_CreateMailForwardRule_invalidRecipient() {
+	s.db.User(5)
+
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", `{"recipient":"not an address"}`)
+	s.a.CreateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *MailForwardSuite) Test_CreateMailForwardRule_missingRecipient() {
+	s.db.User(5)
+
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", `{"minPriority":8}`)
+	s.a.CreateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *MailForwardSuite) Test_CreateMailForwardRule_foreignApplication() {
+	s.db.User(5)
+	s.db.User(6).App(3)
+
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", `{"recipient":"ops@example.com","appid":3}`)
+	s.a.CreateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if rules, err := s.db.GetMailForwardRulesByUser(5); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+}
+
+func (s *MailForwardSuite) Test_UpdateMailForwardRule() {
+	s.db.User(5)
+	rule := &model.MailForwardRule{UserID: 5, Recipient: "ops@example.com"}
+	s.db.CreateMailForwardRule(rule)
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", `{"recipient":"new@example.com","minPriority":5}`)
+	s.a.UpdateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if updated, err := s.db.GetMailForwardRuleByID(rule.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "new@example.com", updated.Recipient)
+		assert.Equal(s.T(), 5, updated.MinPriority)
+	}
+}
+
+func (s *MailForwardSuite) Test_UpdateMailForwardRule_otherUser() {
+	s.db.User(5)
+	s.db.User(6)
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: 6, Recipient: "ops@example.com"})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", `{"recipient":"new@example.com"}`)
+	s.a.UpdateMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *MailForwardSuite) Test_DeleteMailForwardRule() {
+	s.db.User(5)
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: 5, Recipient: "ops@example.com"})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/mail/forward/1", nil)
+	s.a.DeleteMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if rule, err := s.db.GetMailForwardRuleByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule)
+	}
+}
+
+func (s *MailForwardSuite) Test_DeleteMailForwardRule_otherUser() {
+	s.db.User(5)
+	s.db.User(6)
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: 6, Recipient: "ops@example.com"})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/mail/forward/1", nil)
+	s.a.DeleteMailForwardRule(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if rule, err := s.db.GetMailForwardRuleByID(1); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), rule)
+	}
+}
+
+func (s *MailForwardSuite) withJSON(method, body string) {
+	s.ctx.Request = httptest.NewRequest(method, "/mail/forward", strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
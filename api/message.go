@@ -3,7 +3,6 @@ package api
 import (
 	"encoding/json"
 	"errors"
-	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -12,18 +11,31 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/gotify/server/v2/auth"
 	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
 )
 
 // The MessageDatabase interface for encapsulating database access.
 type MessageDatabase interface {
-	GetMessagesByApplicationSince(appID uint, limit int, since uint) ([]*model.Message, error)
+	GetVisibleMessagesByApplicationSince(appID, userID uint, limit int, since uint) ([]*model.Message, error)
 	GetApplicationByID(id uint) (*model.Application, error)
-	GetMessagesByUserSince(userID uint, limit int, since uint) ([]*model.Message, error)
+	GetMessagesByUserSince(userID uint, limit int, since uint, filter model.MessageFilter) ([]*model.Message, error)
 	DeleteMessageByID(id uint) error
 	GetMessageByID(id uint) (*model.Message, error)
 	DeleteMessagesByUser(userID uint) error
 	DeleteMessagesByApplication(applicationID uint) error
-	CreateMessage(message *model.Message) error
+	CreateMessageWithAttachments(message *model.Message, attachments []*model.Attachment) error
+	CreateMessages(messages []*model.Message, scheduled []*model.ScheduledMessage) error
+	ImportMessages(next func() ([]*model.Message, error)) error
+	CreateScheduledMessage(message *model.ScheduledMessage) error
+	GetScheduledMessageByID(id uint) (*model.ScheduledMessage, error)
+	GetScheduledMessagesByApplication(appID uint) ([]*model.ScheduledMessage, error)
+	DeleteScheduledMessageByID(id uint) error
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetReadMessageIDs(userID uint, ids []uint) ([]uint, error)
+	MarkMessageRead(messageID, userID uint) error
+	HideMessage(messageID, userID uint) error
+	HideMessagesByApplication(appID, userID uint) error
 }
 
 var timeNow = time.Now
@@ -33,10 +45,31 @@ type Notifier interface {
 	Notify(userID uint, message *model.MessageExternal)
 }
 
+// Notifiers is a Notifier which notifies all contained notifiers.
+type Notifiers []Notifier
+
+// Notify notifies all contained notifiers in order.
+func (n Notifiers) Notify(userID uint, message *model.MessageExternal) {
+	for _, notifier := range n {
+		notifier.Notify(userID, message)
+	}
+}
+
+// The Scheduler delivers scheduled messages.
+type Scheduler interface {
+	Reschedule()
+}
+
 // The MessageAPI provides handlers for managing messages.
 type MessageAPI struct {
-	DB       MessageDatabase
-	Notifier Notifier
+	DB        MessageDatabase
+	Notifier  Notifier
+	Scheduler Scheduler
+	// Reaper is rescheduled when imported messages expire.
+	Reaper      Scheduler
+	Rules       RuleEngine
+	Attachments *AttachmentAPI
+	Quota       *QuotaAPI
 }
 
 type pagingParams struct {
@@ -44,10 +77,33 @@ type pagingParams struct {
 	Since uint `form:"since" binding:"min=0"`
 }
 
+type messageFilterParams struct {
+	MinPriority *int       `form:"minPriority"`
+	MaxPriority *int       `form:"maxPriority"`
+	After       *time.Time `form:"after"`
+	Before      *time.Time `form:"before"`
+	AppIDs      []uint     `form:"appid"`
+	ExtrasKeys  []string   `form:"extrasKey"`
+	Order       string     `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+func (p *messageFilterParams) toFilter() model.MessageFilter {
+	return model.MessageFilter{
+		MinPriority:    p.MinPriority,
+		MaxPriority:    p.MaxPriority,
+		After:          p.After,
+		Before:         p.Before,
+		ApplicationIDs: p.AppIDs,
+		ExtrasKeys:     p.ExtrasKeys,
+		Ascending:      p.Order == "asc",
+	}
+}
+
 // GetMessages returns all messages from a user.
 // swagger:operation GET /message message getMessages
 //
-// Return all messages.
+// Return all messages including the messages of applications shared with the current user
+// and the messages of the applications of the groups of the current user.
 //
 //	---
 //	produces: [application/json]
@@ -63,11 +119,57 @@ type pagingParams struct {
 //	  type: integer
 //	- name: since
 //	  in: query
-//	  description: return all messages with an ID less than this value
+//	  description: return all messages with an ID less than this value, or greater than this value when ordering ascending
 //	  minimum: 0
 //	  required: false
 //	  type: integer
 //	  format: int64
+//	- name: minPriority
+//	  in: query
+//	  description: only return messages with a priority greater than or equal to this value
+//	  required: false
+//	  type: integer
+//	- name: maxPriority
+//	  in: query
+//	  description: only return messages with a priority less than or equal to this value
+//	  required: false
+//	  type: integer
+//	- name: after
+//	  in: query
+//	  description: only return messages created after this date (RFC 3339)
+//	  required: false
+//	  type: string
+//	  format: date-time
+//	- name: before
+//	  in: query
+//	  description: only return messages created before this date (RFC 3339)
+//	  required: false
+//	  type: string
+//	  format: date-time
+//	- name: appid
+//	  in: query
+//	  description: only return messages of these applications
+//	  required: false
+//	  type: array
+//	  items:
+//	    type: integer
+//	    format: int64
+//	  collectionFormat: multi
+//	- name: extrasKey
+//	  in: query
+//	  description: only return messages containing all of these keys in their extras
+//	  required: false
+//	  type: array
+//	  items:
+//	    type: string
+//	  collectionFormat: multi
+//	- name: order
+//	  in: query
+//	  description: the order of the messages by id
+//	  required: false
+//	  type: string
+//	  enum: [desc, asc]
+//	  default: desc
 //	responses:
 //	  200:
 //	    description: Ok
@@ -88,15 +190,45 @@ type pagingParams struct {
 func (a *MessageAPI) GetMessages(ctx *gin.Context) {
 	userID := auth.GetUserID(ctx)
 	withPaging(ctx, func(params *pagingParams) {
+		filter := &messageFilterParams{}
+		if err := ctx.MustBindWith(filter, binding.Query); err != nil {
+			return
+		}
 		// the +1 is used to check if there are more messages and will be removed on buildWithPaging
-		messages, err := a.DB.GetMessagesByUserSince(userID, params.Limit+1, params.Since)
+		messages, err := a.DB.GetMessagesByUserSince(userID, params.Limit+1, params.Since, filter.toFilter())
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		ctx.JSON(200, buildWithPaging(ctx, params, messages))
+		paged := buildWithPaging(ctx, params, messages)
+		if success := successOrAbort(ctx, 500, a.withReadState(userID, paged.Messages)); !success {
+			return
+		}
+		ctx.JSON(200, paged)
 	})
 }
 
+func (a *MessageAPI) withReadState(userID uint, messages []*model.MessageExternal) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	readIDs, err := a.DB.GetReadMessageIDs(userID, ids)
+	if err != nil {
+		return err
+	}
+	read := make(map[uint]bool, len(readIDs))
+	for _, id := range readIDs {
+		read[id] = true
+	}
+	for _, msg := range messages {
+		msg.Read = read[msg.ID]
+	}
+	return nil
+}
+
 func buildWithPaging(ctx *gin.Context, paging *pagingParams, messages []*model.Message) *model.PagedMessages {
 	next := ""
 	since := uint(0)
@@ -104,9 +236,10 @@ func buildWithPaging(ctx *gin.Context, paging *pagingParams, messages []*model.M
 	if len(messages) > paging.Limit {
 		useMessages = messages[:len(messages)-1]
 		since = useMessages[len(useMessages)-1].ID
-		query := url.Values{}
-		query.Add("limit", strconv.Itoa(paging.Limit))
-		query.Add("since", strconv.FormatUint(uint64(since), 10))
+		// keep the remaining query parameters like filters for the next page
+		query := ctx.Request.URL.Query()
+		query.Set("limit", strconv.Itoa(paging.Limit))
+		query.Set("since", strconv.FormatUint(uint64(since), 10))
 		next = ctx.Request.URL.Path + "?" + query.Encode()
 	}
 	return &model.PagedMessages{
@@ -180,13 +313,22 @@ func (a *MessageAPI) GetMessagesWithApplication(ctx *gin.Context) {
 			if success := successOrAbort(ctx, 500, err); !success {
 				return
 			}
-			if app != nil && app.UserID == auth.GetUserID(ctx) {
+			userID := auth.GetUserID(ctx)
+			permission, err := applicationPermission(a.DB, app, userID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if permission != "" {
 				// the +1 is used to check if there are more messages and will be removed on buildWithPaging
-				messages, err := a.DB.GetMessagesByApplicationSince(id, params.Limit+1, params.Since)
+				messages, err := a.DB.GetVisibleMessagesByApplicationSince(id, userID, params.Limit+1, params.Since)
 				if success := successOrAbort(ctx, 500, err); !success {
 					return
 				}
-				ctx.JSON(200, buildWithPaging(ctx, params, messages))
+				paged := buildWithPaging(ctx, params, messages)
+				if success := successOrAbort(ctx, 500, a.withReadState(userID, paged.Messages)); !success {
+					return
+				}
+				ctx.JSON(200, paged)
 			} else {
 				ctx.AbortWithError(404, errors.New("application does not exist"))
 			}
@@ -199,6 +341,8 @@ func (a *MessageAPI) GetMessagesWithApplication(ctx *gin.Context) {
 //
 // Delete all messages.
 //
+// Messages of group applications are only removed for the current user.
+//
 //	---
 //	produces: [application/json]
 //	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
@@ -215,7 +359,10 @@ func (a *MessageAPI) GetMessagesWithApplication(ctx *gin.Context) {
 //	        $ref: "#/definitions/Error"
 func (a *MessageAPI) DeleteMessages(ctx *gin.Context) {
 	userID := auth.GetUserID(ctx)
-	successOrAbort(ctx, 500, a.DB.DeleteMessagesByUser(userID))
+	attached := a.Attachments.attachedMessagesOfUser(userID)
+	if success := successOrAbort(ctx, 500, a.DB.DeleteMessagesByUser(userID)); success {
+		a.Attachments.deleteOrphaned(attached)
+	}
 }
 
 // DeleteMessageWithApplication deletes all messages from a specific application.
@@ -223,6 +370,8 @@ func (a *MessageAPI) DeleteMessages(ctx *gin.Context) {
 //
 // Delete all messages from a specific application.
 //
+// Messages of group applications are only removed for the current user.
+//
 //	---
 //	produces: [application/json]
 //	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
@@ -258,8 +407,19 @@ func (a *MessageAPI) DeleteMessageWithApplication(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if application != nil && application.UserID == auth.GetUserID(ctx) {
+		userID := auth.GetUserID(ctx)
+		permission, err := applicationPermission(a.DB, application, userID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == model.SharePermissionManage && application.GroupID != 0 {
+			attached := a.Attachments.attachedMessagesOfApplication(id)
+			successOrAbort(ctx, 500, a.DB.HideMessagesByApplication(id, userID))
+			a.Attachments.deleteOrphaned(attached)
+		} else if permission == model.SharePermissionManage {
+			attached := a.Attachments.attachedMessagesOfApplication(id)
 			successOrAbort(ctx, 500, a.DB.DeleteMessagesByApplication(id))
+			a.Attachments.deleteOrphaned(attached)
 		} else {
 			ctx.AbortWithError(404, errors.New("application does not exists"))
 		}
@@ -271,6 +431,8 @@ func (a *MessageAPI) DeleteMessageWithApplication(ctx *gin.Context) {
 //
 // Deletes a message with an id.
 //
+// Messages of group applications are only removed for the current user.
+//
 //	---
 //	produces: [application/json]
 //	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
@@ -314,14 +476,84 @@ func (a *MessageAPI) DeleteMessage(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if app != nil && app.UserID == auth.GetUserID(ctx) {
+		userID := auth.GetUserID(ctx)
+		permission, err := applicationPermission(a.DB, app, userID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == model.SharePermissionManage && app.GroupID != 0 {
+			successOrAbort(ctx, 500, a.DB.HideMessage(id, userID))
+			a.Attachments.deleteOrphaned([]uint{id})
+		} else if permission == model.SharePermissionManage {
 			successOrAbort(ctx, 500, a.DB.DeleteMessageByID(id))
+			a.Attachments.deleteOrphaned([]uint{id})
 		} else {
 			ctx.AbortWithError(404, errors.New("message does not exist"))
 		}
 	})
 }
 
+// MarkMessageRead marks a message as read.
+// swagger:operation POST /message/{id}/read message markMessageRead
+//
+// Marks a message as read for the current user.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the message id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) MarkMessageRead(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		msg, err := a.DB.GetMessageByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if msg == nil {
+			ctx.AbortWithError(404, errors.New("message does not exist"))
+			return
+		}
+		app, err := a.DB.GetApplicationByID(msg.ApplicationID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		userID := auth.GetUserID(ctx)
+		permission, err := applicationPermission(a.DB, app, userID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == "" {
+			ctx.AbortWithError(404, errors.New("message does not exist"))
+			return
+		}
+		successOrAbort(ctx, 500, a.DB.MarkMessageRead(id, userID))
+	})
+}
+
 // CreateMessage creates a message, authentication via application token, client token, or basic auth is required.
 // swagger:operation POST /message message createMessage
 //
@@ -332,8 +564,12 @@ func (a *MessageAPI) DeleteMessage(ctx *gin.Context) {
 // When authenticating with an application token, the application is derived from the
 // token and any "appid" in the body is ignored.
 //
+// Files can be attached by sending the message as multipart/form-data with one or more
+// "attachment" files. The attachments are referenced in the extras under client::attachments
+// and can be downloaded via /attachment/{file}. Scheduled messages cannot have attachments.
+//
 //	---
-//	consumes: [application/json]
+//	consumes: [application/json, multipart/form-data]
 //	produces: [application/json]
 //	security: [appTokenAuthorizationHeader: [], appTokenHeader: [], appTokenQuery: [], clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
 //	parameters:
@@ -348,6 +584,12 @@ func (a *MessageAPI) DeleteMessage(ctx *gin.Context) {
 //	    description: Ok
 //	    schema:
 //	      $ref: "#/definitions/Message"
+//	  202:
+//	    description: Accepted, the message is delivered at deliverAt
+//	    schema:
+//	      $ref: "#/definitions/ScheduledMessage"
+//	  204:
+//	    description: No Content, the message was dropped by a rule
 //	  400:
 //	    description: Bad Request
 //	    schema:
@@ -360,6 +602,10 @@ func (a *MessageAPI) DeleteMessage(ctx *gin.Context) {
 //	    description: Forbidden
 //	    schema:
 //	        $ref: "#/definitions/Error"
+//	  413:
+//	    description: Request Entity Too Large, an attachment is too large or the attachment quota is exceeded
+//	    schema:
+//	        $ref: "#/definitions/Error"
 func (a *MessageAPI) CreateMessage(ctx *gin.Context) {
 	message := model.CreateMessage{}
 	if err := ctx.Bind(&message); err != nil {
@@ -376,13 +622,90 @@ func (a *MessageAPI) CreateMessage(ctx *gin.Context) {
 		if success := successOrAbort(ctx, 500, err); !success {
 			return
 		}
-		if fetchedApp == nil || fetchedApp.UserID != auth.GetUserID(ctx) {
+		permission, err := applicationPermission(a.DB, fetchedApp, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission != model.SharePermissionManage {
 			ctx.AbortWithError(400, errors.New("appid not found"))
 			return
 		}
 		app = fetchedApp
 	}
 
+	var attachments []*model.Attachment
+	if form, err := ctx.MultipartForm(); err == nil && len(form.File["attachment"]) > 0 {
+		if a.Attachments == nil {
+			ctx.AbortWithError(400, errors.New("attachments are not supported"))
+			return
+		}
+		if message.DeliverAt != nil && message.DeliverAt.After(timeNow()) {
+			ctx.AbortWithError(400, errors.New("scheduled messages cannot have attachments"))
+			return
+		}
+		var success bool
+		if attachments, success = a.Attachments.save(ctx, app.UserID, form.File["attachment"]); !success {
+			return
+		}
+		withAttachmentExtras(&message, attachments)
+	}
+
+	a.createMessage(ctx, app, &message, attachments)
+}
+
+// createMessage stores the message for the application, notifies the owner
+// and writes the created message as response.
+// The stored files of the attachments are removed if the message is not created.
+func (a *MessageAPI) createMessage(ctx *gin.Context, app *model.Application, message *model.CreateMessage, attachments []*model.Attachment) {
+	if err := validateExpiry(message); err != nil {
+		a.Attachments.RemoveAttachments(attachments)
+		ctx.AbortWithError(400, err)
+		return
+	}
+	if ok := a.Quota.checkMessages(ctx, app.UserID, 1); !ok {
+		a.Attachments.RemoveAttachments(attachments)
+		return
+	}
+	applyApplicationDefaults(app, message)
+
+	if message.DeliverAt != nil && message.DeliverAt.After(timeNow()) {
+		scheduled := toScheduledMessage(message)
+		if success := successOrAbort(ctx, 500, a.DB.CreateScheduledMessage(scheduled)); !success {
+			return
+		}
+		if a.Scheduler != nil {
+			a.Scheduler.Reschedule()
+		}
+		ctx.JSON(202, toExternalScheduledMessage(scheduled))
+		return
+	}
+
+	msgInternal := toInternalMessage(message)
+	var result *rules.Result
+	if a.Rules != nil {
+		var err error
+		result, err = a.Rules.Evaluate(app.UserID, msgInternal)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if result.Drop {
+			a.Attachments.RemoveAttachments(attachments)
+			ctx.Status(204)
+			return
+		}
+	}
+	if success := successOrAbort(ctx, 500, a.DB.CreateMessageWithAttachments(msgInternal, attachments)); !success {
+		a.Attachments.RemoveAttachments(attachments)
+		return
+	}
+	a.Notifier.Notify(app.UserID, toExternalMessage(msgInternal))
+	if result != nil {
+		a.Rules.Dispatch(result, msgInternal)
+	}
+	ctx.JSON(200, toExternalMessage(msgInternal))
+}
+
+func applyApplicationDefaults(app *model.Application, message *model.CreateMessage) {
 	message.ApplicationID = app.ID
 	if strings.TrimSpace(message.Title) == "" {
 		message.Title = app.Name
@@ -392,12 +715,168 @@ func (a *MessageAPI) CreateMessage(ctx *gin.Context) {
 		message.Priority = &app.DefaultPriority
 	}
 
-	msgInternal := toInternalMessage(&message)
-	if success := successOrAbort(ctx, 500, a.DB.CreateMessage(msgInternal)); !success {
-		return
+	if message.ExpiresAt == nil && message.TTLSeconds == nil && app.DefaultTTLSeconds > 0 {
+		ttl := app.DefaultTTLSeconds
+		message.TTLSeconds = &ttl
 	}
-	a.Notifier.Notify(auth.GetUserID(ctx), toExternalMessage(msgInternal))
-	ctx.JSON(200, toExternalMessage(msgInternal))
+}
+
+func validateExpiry(message *model.CreateMessage) error {
+	if message.ExpiresAt == nil {
+		return nil
+	}
+	if message.TTLSeconds != nil {
+		return errors.New("expiresAt and ttlSeconds cannot be combined")
+	}
+	deliverAt := timeNow()
+	if message.DeliverAt != nil && message.DeliverAt.After(deliverAt) {
+		deliverAt = *message.DeliverAt
+	}
+	if !message.ExpiresAt.After(deliverAt) {
+		return errors.New("expiresAt must be after the delivery of the message")
+	}
+	return nil
+}
+
+// expiry returns the time a message delivered at the given date expires or nil if it doesn't expire.
+func expiry(expiresAt *time.Time, ttlSeconds int, date time.Time) *time.Time {
+	if expiresAt != nil {
+		res := expiresAt.UTC()
+		return &res
+	}
+	if ttlSeconds > 0 {
+		res := date.Add(time.Duration(ttlSeconds) * time.Second).UTC()
+		return &res
+	}
+	return nil
+}
+
+// GetScheduledMessages returns all scheduled messages of an application.
+// swagger:operation GET /application/{id}/scheduled message getScheduledMessages
+//
+// Return all scheduled messages of an application ordered by their delivery time.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/ScheduledMessage"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) GetScheduledMessages(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		app, err := a.DB.GetApplicationByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission == "" {
+			ctx.AbortWithError(404, errors.New("application does not exist"))
+			return
+		}
+		messages, err := a.DB.GetScheduledMessagesByApplication(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		ctx.JSON(200, toExternalScheduledMessages(messages))
+	})
+}
+
+// DeleteScheduledMessage cancels a scheduled message.
+// swagger:operation DELETE /application/{id}/scheduled/{scheduledId} message deleteScheduledMessage
+//
+// Cancel a scheduled message.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	- name: scheduledId
+//	  in: path
+//	  description: the scheduled message id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *MessageAPI) DeleteScheduledMessage(ctx *gin.Context) {
+	withID(ctx, "id", func(appID uint) {
+		withID(ctx, "scheduledId", func(id uint) {
+			scheduled, err := a.DB.GetScheduledMessageByID(id)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if scheduled == nil || scheduled.ApplicationID != appID {
+				ctx.AbortWithError(404, errors.New("scheduled message does not exist"))
+				return
+			}
+			app, err := a.DB.GetApplicationByID(appID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if permission != model.SharePermissionManage {
+				ctx.AbortWithError(404, errors.New("scheduled message does not exist"))
+				return
+			}
+			successOrAbort(ctx, 500, a.DB.DeleteScheduledMessageByID(id))
+		})
+	})
 }
 
 func toInternalMessage(msg *model.CreateMessage) *model.Message {
@@ -410,6 +889,11 @@ func toInternalMessage(msg *model.CreateMessage) *model.Message {
 	if msg.Priority != nil {
 		res.Priority = *msg.Priority
 	}
+	ttl := 0
+	if msg.TTLSeconds != nil {
+		ttl = *msg.TTLSeconds
+	}
+	res.ExpiresAt = expiry(msg.ExpiresAt, ttl, res.Date)
 
 	if msg.Extras != nil {
 		res.Extras, _ = json.Marshal(msg.Extras)
@@ -425,6 +909,7 @@ func toExternalMessage(msg *model.Message) *model.MessageExternal {
 		Title:         msg.Title,
 		Priority:      &msg.Priority,
 		Date:          msg.Date,
+		ExpiresAt:     msg.ExpiresAt,
 	}
 	if len(msg.Extras) != 0 {
 		res.Extras = make(map[string]any)
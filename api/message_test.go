@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http/httptest"
 	"net/url"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/gotify/server/v2/auth"
 	"github.com/gotify/server/v2/mode"
 	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
 	"github.com/gotify/server/v2/test"
 	"github.com/gotify/server/v2/test/testdb"
 	"github.com/stretchr/testify/assert"
@@ -28,6 +30,7 @@ type MessageSuite struct {
 	ctx             *gin.Context
 	recorder        *httptest.ResponseRecorder
 	notifiedMessage *model.MessageExternal
+	rescheduled     bool
 }
 
 func (s *MessageSuite) BeforeTest(suiteName, testName string) {
@@ -37,7 +40,8 @@ func (s *MessageSuite) BeforeTest(suiteName, testName string) {
 	s.ctx.Request = httptest.NewRequest("GET", "/irrelevant", nil)
 	s.db = testdb.NewDB(s.T())
 	s.notifiedMessage = nil
-	s.a = &MessageAPI{DB: s.db, Notifier: s}
+	s.rescheduled = false
+	s.a = &MessageAPI{DB: s.db, Notifier: s, Scheduler: s}
 }
 
 func (s *MessageSuite) AfterTest(string, string) {
@@ -48,6 +52,10 @@ func (s *MessageSuite) Notify(userID uint, msg *model.MessageExternal) {
 	s.notifiedMessage = msg
 }
 
+func (s *MessageSuite) Reschedule() {
+	s.rescheduled = true
+}
+
 func (s *MessageSuite) Test_ensureCorrectJsonRepresentation() {
 	t, _ := time.Parse("2006/01/02", "2017/01/02")
 
@@ -147,6 +155,72 @@ func (s *MessageSuite) Test_GetMessages_BadRequestOnInvalidLimit_Negative() {
 	assert.Equal(s.T(), 400, s.recorder.Code)
 }
 
+func (s *MessageSuite) Test_GetMessages_WithFilter() {
+	user := s.db.User(5)
+	user.App(1)
+	user.App(2)
+	date := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	s.db.CreateMessage(&model.Message{ID: 1, ApplicationID: 1, Message: "low", Priority: 1, Date: date})
+	s.db.CreateMessage(&model.Message{ID: 2, ApplicationID: 1, Message: "high", Priority: 8, Date: date, Extras: []byte(`{"client::notification":{}}`)})
+	s.db.CreateMessage(&model.Message{ID: 3, ApplicationID: 2, Message: "other app", Priority: 8, Date: date})
+	s.db.CreateMessage(&model.Message{ID: 4, ApplicationID: 1, Message: "old", Priority: 8, Date: date.Add(-48 * time.Hour)})
+
+	tests := map[string][]uint{
+		"minPriority=5":                      {4, 3, 2},
+		"maxPriority=5":                      {1},
+		"appid=1&minPriority=5":              {4, 2},
+		"appid=1&appid=2&maxPriority=8":      {4, 3, 2, 1},
+		"after=2024-01-04T00:00:00Z":         {3, 2, 1},
+		"before=2024-01-04T00:00:00%2B01:00": {4},
+		"extrasKey=client::notification":     {2},
+		"order=asc&since=1":                  {2, 3, 4},
+	}
+	for query, expected := range tests {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		s.ctx.Request = httptest.NewRequest("GET", "/message?"+query, nil)
+		test.WithUser(s.ctx, 5)
+		s.a.GetMessages(s.ctx)
+
+		assert.Equal(s.T(), 200, s.recorder.Code, query)
+		paged := &model.PagedMessages{}
+		assert.NoError(s.T(), json.NewDecoder(s.recorder.Body).Decode(paged))
+		ids := []uint{}
+		for _, msg := range paged.Messages {
+			ids = append(ids, msg.ID)
+		}
+		assert.Equal(s.T(), expected, ids, query)
+	}
+}
+
+func (s *MessageSuite) Test_GetMessages_WithFilter_NextKeepsFilter() {
+	app := s.db.User(5).App(1)
+	for i := 1; i <= 6; i++ {
+		app.NewMessage(uint(i))
+	}
+
+	s.withURL("http", "example.com", "/message", "limit=2&order=asc&appid=1")
+	test.WithUser(s.ctx, 5)
+	s.a.GetMessages(s.ctx)
+
+	paged := &model.PagedMessages{}
+	assert.NoError(s.T(), json.NewDecoder(s.recorder.Body).Decode(paged))
+	assert.Equal(s.T(), model.Paging{Limit: 2, Size: 2, Since: 2, Next: "/message?appid=1&limit=2&order=asc&since=2"}, paged.Paging)
+}
+
+func (s *MessageSuite) Test_GetMessages_BadRequestOnInvalidFilter() {
+	s.db.User(5)
+	for _, query := range []string{"order=random", "minPriority=high", "after=yesterday"} {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		s.ctx.Request = httptest.NewRequest("GET", "/message?"+query, nil)
+		test.WithUser(s.ctx, 5)
+		s.a.GetMessages(s.ctx)
+
+		assert.Equal(s.T(), 400, s.recorder.Code, query)
+	}
+}
+
 func (s *MessageSuite) Test_GetMessagesWithToken_InvalidLimit_BadRequest() {
 	s.db.User(4).App(2).NewMessage(1)
 
@@ -378,6 +452,48 @@ func (s *MessageSuite) Test_CreateMessage_WithTitle() {
 	assert.Equal(s.T(), expected, s.notifiedMessage)
 }
 
+func (s *MessageSuite) Test_CreateMessage_appliesRules() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	s.a.Rules = rules.NewEngine(s.db, s)
+	user := s.db.User(4)
+	user.App(6)
+	auth.RegisterApplication(s.ctx, user.NewAppWithToken(5, "app-token"))
+	s.db.CreateRule(&model.Rule{UserID: 4, TitlePattern: "disk", Action: model.RuleActionSetPriority, Priority: 9})
+	s.db.CreateRule(&model.Rule{UserID: 4, ApplicationID: 5, Action: model.RuleActionCopy, TargetApplicationID: 6})
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"title": "disk full", "message": "mymessage", "priority": 1}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	expected := &model.MessageExternal{ID: 1, ApplicationID: 5, Title: "disk full", Message: "mymessage", Date: t, Priority: intPtr(9)}
+	test.BodyEquals(s.T(), expected, s.recorder)
+	if msgs, err := s.db.GetMessagesByApplication(6); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), "disk full", msgs[0].Title)
+		assert.Equal(s.T(), 9, msgs[0].Priority)
+		assert.Equal(s.T(), uint(6), s.notifiedMessage.ApplicationID)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_droppedByRule() {
+	s.a.Rules = rules.NewEngine(s.db, s)
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(5, "app-token"))
+	s.db.CreateRule(&model.Rule{UserID: 4, TitlePattern: "^spam", Action: model.RuleActionDrop})
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"title": "spam", "message": "mymessage"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 204, s.ctx.Writer.Status())
+	if msgs, err := s.db.GetMessagesByApplication(5); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+	assert.Nil(s.T(), s.notifiedMessage)
+}
+
 func (s *MessageSuite) Test_CreateMessage_failWhenNoMessage() {
 	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(1, "app-token"))
 
@@ -657,3 +773,230 @@ func (s *MessageSuite) withURL(scheme, host, path, query string) {
 func intPtr(x int) *int {
 	return &x
 }
+
+func (s *MessageSuite) Test_CreateMessage_withDeliverAtInFuture_schedulesMessage() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithTokenAndDefaultPriority(8, "app-token", 5))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"title": "Reminder", "message": "renew cert", "deliverAt": "2017-01-06T09:00:00Z", "extras": {"a::b": 1}}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 202, s.recorder.Code)
+	assert.Nil(s.T(), s.notifiedMessage)
+	assert.True(s.T(), s.rescheduled)
+	s.db.AssertMessageNotExist(1)
+
+	scheduled, err := s.db.GetScheduledMessagesByApplication(8)
+	assert.NoError(s.T(), err)
+	if assert.Len(s.T(), scheduled, 1) {
+		expected := &model.ScheduledMessageExternal{
+			ID: 1, ApplicationID: 8, Title: "Reminder", Message: "renew cert", Priority: 5,
+			Extras: map[string]any{"a::b": float64(1)}, DeliverAt: time.Date(2017, 1, 6, 9, 0, 0, 0, time.UTC), CreatedAt: scheduled[0].CreatedAt,
+		}
+		assert.Equal(s.T(), expected, toExternalScheduledMessage(scheduled[0]))
+		test.BodyEquals(s.T(), expected, s.recorder)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_withDeliverAtInPast_deliversImmediately() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "deliverAt": "2016-01-01T00:00:00Z"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.NotNil(s.T(), s.notifiedMessage)
+	assert.False(s.T(), s.rescheduled)
+	s.db.AssertMessageExist(1)
+	if scheduled, err := s.db.GetScheduledMessagesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), scheduled)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_withTTLSeconds() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "ttlSeconds": 60}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	expiresAt := t.Add(time.Minute)
+	if msg, err := s.db.GetMessageByID(1); assert.NoError(s.T(), err) && assert.NotNil(s.T(), msg) {
+		assert.Equal(s.T(), expiresAt.Unix(), msg.ExpiresAt.Unix())
+	}
+	if assert.NotNil(s.T(), s.notifiedMessage) {
+		assert.Equal(s.T(), &expiresAt, s.notifiedMessage.ExpiresAt)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_withExpiresAt() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "expiresAt": "2017-01-02T02:00:00+01:00"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if assert.NotNil(s.T(), s.notifiedMessage) && assert.NotNil(s.T(), s.notifiedMessage.ExpiresAt) {
+		assert.Equal(s.T(), time.Date(2017, 1, 2, 1, 0, 0, 0, time.UTC), *s.notifiedMessage.ExpiresAt)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_withApplicationDefaultTTL() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	app := s.db.User(4).NewAppWithToken(8, "app-token")
+	app.DefaultTTLSeconds = 3600
+	auth.RegisterApplication(s.ctx, app)
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if assert.NotNil(s.T(), s.notifiedMessage) && assert.NotNil(s.T(), s.notifiedMessage.ExpiresAt) {
+		assert.Equal(s.T(), t.Add(time.Hour), *s.notifiedMessage.ExpiresAt)
+	}
+}
+
+func (s *MessageSuite) Test_CreateMessage_failWhenExpiresAtAndTTLSeconds() {
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "ttlSeconds": 60, "expiresAt": "2099-01-01T00:00:00Z"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.Nil(s.T(), s.notifiedMessage)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *MessageSuite) Test_CreateMessage_failWhenExpiresAtBeforeDelivery() {
+	t, _ := time.Parse("2006/01/02", "2017/01/02")
+
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "deliverAt": "2017-01-06T09:00:00Z", "expiresAt": "2017-01-05T00:00:00Z"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.False(s.T(), s.rescheduled)
+}
+
+func (s *MessageSuite) Test_CreateMessage_failWhenTTLSecondsNotPositive() {
+	auth.RegisterApplication(s.ctx, s.db.User(4).NewAppWithToken(8, "app-token"))
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "mymessage", "ttlSeconds": 0}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+
+	s.a.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *MessageSuite) Test_GetScheduledMessages() {
+	user := s.db.User(4)
+	user.App(8)
+	user.App(9)
+	deliverAt := time.Date(2017, 1, 6, 9, 0, 0, 0, time.UTC)
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "later", DeliverAt: deliverAt.Add(time.Hour)})
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "sooner", DeliverAt: deliverAt})
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 9, Message: "other", DeliverAt: deliverAt})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.a.GetScheduledMessages(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	body := s.recorder.Body.String()
+	assert.Regexp(s.T(), `"message":"sooner".*"message":"later"`, body)
+	assert.NotContains(s.T(), body, "other")
+}
+
+func (s *MessageSuite) Test_GetScheduledMessages_otherUser() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.a.GetScheduledMessages(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *MessageSuite) Test_DeleteScheduledMessage() {
+	s.db.User(4).App(8)
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "reminder", DeliverAt: time.Now().Add(time.Hour)})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("scheduledId", "1")
+	s.a.DeleteScheduledMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if scheduled, err := s.db.GetScheduledMessageByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), scheduled)
+	}
+}
+
+func (s *MessageSuite) Test_DeleteScheduledMessage_wrongApplication() {
+	user := s.db.User(4)
+	user.App(8)
+	user.App(9)
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "reminder", DeliverAt: time.Now().Add(time.Hour)})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "9")
+	s.ctx.AddParam("scheduledId", "1")
+	s.a.DeleteScheduledMessage(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if scheduled, err := s.db.GetScheduledMessageByID(1); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), scheduled)
+	}
+}
+
+func (s *MessageSuite) Test_DeleteScheduledMessage_otherUser() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "reminder", DeliverAt: time.Now().Add(time.Hour)})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("scheduledId", "1")
+	s.a.DeleteScheduledMessage(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if scheduled, err := s.db.GetScheduledMessageByID(1); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), scheduled)
+	}
+}
@@ -39,7 +39,7 @@ func (s *PluginSuite) BeforeTest(suiteName, testName string) {
 	mode.Set(mode.TestDev)
 	s.db = testdb.NewDB(s.T())
 	s.resetRecorder()
-	manager, err := plugin.NewManager(s.db, "", nil, s)
+	manager, err := plugin.NewManager(s.db, "", nil, s, nil, nil)
 	assert.Nil(s.T(), err)
 	s.manager = manager
 	withURL(s.ctx, "http", "example.com")
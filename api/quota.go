@@ -0,0 +1,422 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/icon"
+	"github.com/gotify/server/v2/model"
+)
+
+// The QuotaDatabase interface for encapsulating database access.
+type QuotaDatabase interface {
+	GetUserByID(id uint) (*model.User, error)
+	GetUserQuota(userID uint) (*model.UserQuota, error)
+	SaveUserQuota(quota *model.UserQuota) error
+	CountApplicationsByUser(userID uint) (int64, error)
+	CountClientsByUser(userID uint) (int64, error)
+	CountMessagesByUser(userID uint) (int64, error)
+	GetAttachmentSizeByUser(userID uint) (int64, error)
+	GetPluginStorageSizeByUser(userID uint) (int64, error)
+	GetApplicationsByUser(userID uint) ([]*model.Application, error)
+	GetPluginConfByID(id uint) (*model.PluginConf, error)
+}
+
+// The QuotaAPI provides handlers for the quotas of users and enforces them.
+// A nil QuotaAPI doesn't limit anything.
+type QuotaAPI struct {
+	DB       QuotaDatabase
+	ImageDir string
+	// Defaults are the limits of users without quota, 0 disables a limit.
+	Defaults model.QuotaLimits
+}
+
+// GetCurrentUserQuota returns the quota of the current user.
+// swagger:operation GET /current/user/quota user currentUserQuota
+//
+// Return the limits and the usage of the current user.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Quota"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *QuotaAPI) GetCurrentUserQuota(ctx *gin.Context) {
+	a.writeQuota(ctx, auth.GetUserID(ctx))
+}
+
+// GetUserQuota returns the quota of a user.
+// swagger:operation GET /user/{id}/quota user getUserQuota
+//
+// Return the limits and the usage of a user.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the user id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Quota"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *QuotaAPI) GetUserQuota(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		if exists := a.userExists(ctx, id); exists {
+			a.writeQuota(ctx, id)
+		}
+	})
+}
+
+// UpdateUserQuota updates the quota of a user.
+// swagger:operation PUT /user/{id}/quota user updateUserQuota
+//
+// Update the limits of a user.
+//
+// A limit of null uses the default of the server configuration, a limit of 0 disables the limit.
+// Existing applications, clients and messages are kept when the user is over the new limit.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the user id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	- name: body
+//	  in: body
+//	  description: the limits of the user
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/UserQuota"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Quota"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *QuotaAPI) UpdateUserQuota(ctx *gin.Context) {
+	withID(ctx, "id", func(id uint) {
+		quota := model.UserQuota{}
+		if err := ctx.Bind(&quota); err != nil {
+			return
+		}
+		for _, limit := range []*int64{quota.MaxApplications, quota.MaxClients, quota.MaxMessages, quota.MaxStorageBytes, quota.MaxPluginStorageBytes} {
+			if limit != nil && *limit < 0 {
+				ctx.AbortWithError(400, errors.New("limits must not be negative"))
+				return
+			}
+		}
+		if exists := a.userExists(ctx, id); !exists {
+			return
+		}
+		quota.UserID = id
+		if success := successOrAbort(ctx, 500, a.DB.SaveUserQuota(&quota)); !success {
+			return
+		}
+		a.writeQuota(ctx, id)
+	})
+}
+
+func (a *QuotaAPI) userExists(ctx *gin.Context, id uint) bool {
+	user, err := a.DB.GetUserByID(id)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	if user == nil {
+		ctx.AbortWithError(404, errors.New("user does not exist"))
+		return false
+	}
+	return true
+}
+
+func (a *QuotaAPI) writeQuota(ctx *gin.Context, userID uint) {
+	limits, err := a.limits(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	usage, err := a.usage(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, &model.Quota{Limits: limits, Usage: usage})
+}
+
+// limits returns the limits of the user, the defaults are used for limits the user has no quota for.
+func (a *QuotaAPI) limits(userID uint) (model.QuotaLimits, error) {
+	limits := a.Defaults
+	quota, err := a.DB.GetUserQuota(userID)
+	if err != nil || quota == nil {
+		return limits, err
+	}
+	override := func(target *int64, value *int64) {
+		if value != nil {
+			*target = *value
+		}
+	}
+	override(&limits.Applications, quota.MaxApplications)
+	override(&limits.Clients, quota.MaxClients)
+	override(&limits.Messages, quota.MaxMessages)
+	override(&limits.StorageBytes, quota.MaxStorageBytes)
+	override(&limits.PluginStorageBytes, quota.MaxPluginStorageBytes)
+	return limits, nil
+}
+
+func (a *QuotaAPI) usage(userID uint) (model.QuotaUsage, error) {
+	var usage model.QuotaUsage
+	var err error
+	if usage.Applications, err = a.DB.CountApplicationsByUser(userID); err != nil {
+		return usage, err
+	}
+	if usage.Clients, err = a.DB.CountClientsByUser(userID); err != nil {
+		return usage, err
+	}
+	if usage.Messages, err = a.DB.CountMessagesByUser(userID); err != nil {
+		return usage, err
+	}
+	if usage.StorageBytes, err = a.storageSize(userID); err != nil {
+		return usage, err
+	}
+	usage.PluginStorageBytes, err = a.DB.GetPluginStorageSizeByUser(userID)
+	return usage, err
+}
+
+// storageSize returns the size of the application images and the attachments of a user.
+func (a *QuotaAPI) storageSize(userID uint) (int64, error) {
+	size, err := a.DB.GetAttachmentSizeByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	apps, err := a.DB.GetApplicationsByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, app := range apps {
+		size += imageSize(a.ImageDir, app.Image)
+	}
+	return size, nil
+}
+
+// imageSize returns the size of an application image and its variants.
+func imageSize(dir, image string) int64 {
+	if image == "" {
+		return 0
+	}
+	size := int64(0)
+	files := []string{image}
+	for _, iconSize := range icon.Sizes {
+		files = append(files, icon.VariantName(image, iconSize))
+	}
+	for _, file := range files {
+		if info, err := os.Stat(dir + file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// checkCount aborts with 403 if adding n items exceeds the limit of the user.
+func (a *QuotaAPI) checkCount(ctx *gin.Context, userID uint, n int64, name string, limit func(model.QuotaLimits) int64, count func(userID uint) (int64, error)) bool {
+	if a == nil {
+		return true
+	}
+	limits, err := a.limits(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	allowed := limit(limits)
+	if allowed == 0 {
+		return true
+	}
+	used, err := count(userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	if used+n > allowed {
+		ctx.AbortWithError(http.StatusForbidden, fmt.Errorf("%s quota exceeded, the user may have at most %d %s", name, allowed, name))
+		return false
+	}
+	return true
+}
+
+func (a *QuotaAPI) checkApplications(ctx *gin.Context, userID uint) bool {
+	return a.checkCount(ctx, userID, 1, "applications", func(l model.QuotaLimits) int64 { return l.Applications },
+		func(userID uint) (int64, error) { return a.DB.CountApplicationsByUser(userID) })
+}
+
+func (a *QuotaAPI) checkClients(ctx *gin.Context, userID uint) bool {
+	return a.checkCount(ctx, userID, 1, "clients", func(l model.QuotaLimits) int64 { return l.Clients },
+		func(userID uint) (int64, error) { return a.DB.CountClientsByUser(userID) })
+}
+
+// MessageQuotaError is returned if creating messages exceeds the message limit of a user.
+type MessageQuotaError struct {
+	Limit int64
+}
+
+func (e *MessageQuotaError) Error() string {
+	return fmt.Sprintf("messages quota exceeded, the user may have at most %d messages", e.Limit)
+}
+
+// CheckMessages returns a *MessageQuotaError if creating n messages exceeds the message limit of the user.
+// Every message is checked against the limit of the owner of its application,
+// regardless whether it is created via the api, a plugin, a rule or a scheduled delivery.
+func (a *QuotaAPI) CheckMessages(userID uint, n int64) error {
+	limit, used, err := a.messageUsage(userID)
+	if err != nil {
+		return err
+	}
+	return checkMessageLimit(limit, used+n)
+}
+
+// messageUsage returns the message limit and the number of messages of the user, a limit of 0 is unlimited.
+func (a *QuotaAPI) messageUsage(userID uint) (limit, used int64, err error) {
+	if a == nil {
+		return 0, 0, nil
+	}
+	limits, err := a.limits(userID)
+	if err != nil || limits.Messages == 0 {
+		return 0, 0, err
+	}
+	used, err = a.DB.CountMessagesByUser(userID)
+	return limits.Messages, used, err
+}
+
+func checkMessageLimit(limit, messages int64) error {
+	if limit != 0 && messages > limit {
+		return &MessageQuotaError{Limit: limit}
+	}
+	return nil
+}
+
+// checkMessages aborts with 403 if creating n messages exceeds the message limit of the user.
+func (a *QuotaAPI) checkMessages(ctx *gin.Context, userID uint, n int64) bool {
+	err := a.CheckMessages(userID, n)
+	var exceeded *MessageQuotaError
+	if errors.As(err, &exceeded) {
+		ctx.AbortWithError(http.StatusForbidden, err)
+		return false
+	}
+	return successOrAbort(ctx, 500, err)
+}
+
+// StorageQuotaError is returned if storing files exceeds the storage limit of a user.
+type StorageQuotaError struct {
+	Limit int64
+	Used  int64
+}
+
+func (e *StorageQuotaError) Error() string {
+	return fmt.Sprintf("storage quota of %d bytes exceeded, %d bytes are used", e.Limit, e.Used)
+}
+
+// CheckStorage returns a *StorageQuotaError if adding bytes exceeds the storage limit of the user.
+func (a *QuotaAPI) CheckStorage(userID uint, bytes int64) error {
+	if a == nil {
+		return nil
+	}
+	limits, err := a.limits(userID)
+	if err != nil || limits.StorageBytes == 0 {
+		return err
+	}
+	used, err := a.storageSize(userID)
+	if err != nil {
+		return err
+	}
+	if used+bytes > limits.StorageBytes {
+		return &StorageQuotaError{Limit: limits.StorageBytes, Used: used}
+	}
+	return nil
+}
+
+// checkStorage aborts with 413 if adding bytes exceeds the storage limit of the user.
+func (a *QuotaAPI) checkStorage(ctx *gin.Context, userID uint, bytes int64) bool {
+	err := a.CheckStorage(userID, bytes)
+	var exceeded *StorageQuotaError
+	if errors.As(err, &exceeded) {
+		ctx.AbortWithError(http.StatusRequestEntityTooLarge, err)
+		return false
+	}
+	return successOrAbort(ctx, 500, err)
+}
+
+// CheckPluginStorage returns an error if replacing the storage of the plugin with size bytes exceeds the limit of the user.
+func (a *QuotaAPI) CheckPluginStorage(userID, pluginID uint, size int64) error {
+	if a == nil {
+		return nil
+	}
+	limits, err := a.limits(userID)
+	if err != nil || limits.PluginStorageBytes == 0 {
+		return err
+	}
+	used, err := a.DB.GetPluginStorageSizeByUser(userID)
+	if err != nil {
+		return err
+	}
+	conf, err := a.DB.GetPluginConfByID(pluginID)
+	if err != nil {
+		return err
+	}
+	if conf != nil {
+		used -= int64(len(conf.Storage))
+	}
+	if used+size > limits.PluginStorageBytes {
+		return fmt.Errorf("plugin storage quota of %d bytes exceeded", limits.PluginStorageBytes)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestQuotaSuite(t *testing.T) {
+	suite.Run(t, new(QuotaSuite))
+}
+
+type QuotaSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *QuotaAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	imageDir test.TmpDir
+}
+
+func (s *QuotaSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.imageDir = test.NewTmpDir("gotify_quotasuite")
+	s.a = &QuotaAPI{DB: s.db, ImageDir: s.imageDir.Path() + "/", Defaults: model.QuotaLimits{Applications: 2, Messages: 100}}
+}
+
+func (s *QuotaSuite) AfterTest(suiteName, testName string) {
+	s.imageDir.Clean()
+	s.db.Close()
+}
+
+func (s *QuotaSuite) Test_GetCurrentUserQuota() {
+	user := s.db.User(5)
+	user.App(1).Message(1).Message(2)
+	user.InternalApp(2)
+	user.Client(3)
+	s.db.User(6).App(4).Message(3)
+	require.NoError(s.T(), s.db.CreateAttachments([]*model.Attachment{{MessageID: 1, UserID: 5, File: "a.png", Size: 20}}))
+	app, err := s.db.GetApplicationByID(1)
+	require.NoError(s.T(), err)
+	app.Image = "icon.png"
+	require.NoError(s.T(), s.db.UpdateApplication(app))
+	require.NoError(s.T(), os.WriteFile(s.imageDir.Path("icon.png"), make([]byte, 30), 0o644))
+	require.NoError(s.T(), os.WriteFile(s.imageDir.Path("icon@64.png"), make([]byte, 7), 0o644))
+	require.NoError(s.T(), s.db.CreatePluginConf(&model.PluginConf{UserID: 5, ModulePath: "p", Token: "Pabc", Storage: []byte("12345")}))
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("GET", "/current/user/quota", nil)
+	s.a.GetCurrentUserQuota(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.Quota{
+		Limits: model.QuotaLimits{Applications: 2, Messages: 100},
+		Usage:  model.QuotaUsage{Applications: 1, Clients: 1, Messages: 2, StorageBytes: 57, PluginStorageBytes: 5},
+	}, s.recorder)
+}
+
+func (s *QuotaSuite) Test_UpdateUserQuota() {
+	s.db.User(5)
+
+	s.ctx.Params = gin.Params{{Key: "id", Value: "5"}}
+	s.ctx.Request = httptest.NewRequest("PUT", "/user/5/quota", strings.NewReader(`{"maxApplications": 0, "maxClients": 3}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+	s.a.UpdateUserQuota(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	quota := &model.Quota{}
+	require.NoError(s.T(), json.NewDecoder(s.recorder.Body).Decode(quota))
+	assert.Equal(s.T(), model.QuotaLimits{Applications: 0, Clients: 3, Messages: 100}, quota.Limits)
+
+	stored, err := s.db.GetUserQuota(5)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(3), *stored.MaxClients)
+	assert.Nil(s.T(), stored.MaxMessages)
+}
+
+func (s *QuotaSuite) Test_UpdateUserQuota_negative() {
+	s.db.User(5)
+
+	s.ctx.Params = gin.Params{{Key: "id", Value: "5"}}
+	s.ctx.Request = httptest.NewRequest("PUT", "/user/5/quota", strings.NewReader(`{"maxMessages": -1}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+	s.a.UpdateUserQuota(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "limits must not be negative")
+}
+
+func (s *QuotaSuite) Test_GetUserQuota_unknownUser() {
+	s.ctx.Params = gin.Params{{Key: "id", Value: "9"}}
+	s.ctx.Request = httptest.NewRequest("GET", "/user/9/quota", nil)
+	s.a.GetUserQuota(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *QuotaSuite) Test_CreateApplication_exceedsQuota() {
+	user := s.db.User(5)
+	user.App(1)
+	user.App(2)
+	user.InternalApp(3)
+	applications := &ApplicationAPI{DB: s.db, Quota: s.a}
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("POST", "/application", strings.NewReader("name=third"))
+	s.ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	applications.CreateApplication(s.ctx)
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "applications quota exceeded, the user may have at most 2 applications")
+	s.db.AssertAppNotExist(4)
+}
+
+func (s *QuotaSuite) Test_CreateApplication_unlimitedForUser() {
+	user := s.db.User(5)
+	user.App(1)
+	user.App(2)
+	unlimited := int64(0)
+	require.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: 5, MaxApplications: &unlimited}))
+	applications := &ApplicationAPI{DB: s.db, Quota: s.a}
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("POST", "/application", strings.NewReader("name=third"))
+	s.ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	applications.CreateApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.db.AssertAppExist(3)
+}
+
+func (s *QuotaSuite) Test_CreateClient_exceedsQuota() {
+	s.db.User(5).Client(1)
+	one := int64(1)
+	require.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: 5, MaxClients: &one}))
+	clients := &ClientAPI{DB: s.db, Quota: s.a}
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("POST", "/client", strings.NewReader("name=second"))
+	s.ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	clients.CreateClient(s.ctx)
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "clients quota exceeded, the user may have at most 1 clients")
+	s.db.AssertClientNotExist(2)
+}
+
+func (s *QuotaSuite) Test_CreateMessage_exceedsQuota() {
+	s.db.User(5).AppWithToken(1, "app-token").Message(1).Message(2)
+	two := int64(2)
+	require.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: 5, MaxMessages: &two}))
+	messages := &MessageAPI{DB: s.db, Quota: s.a}
+
+	app, err := s.db.GetApplicationByID(1)
+	require.NoError(s.T(), err)
+	auth.RegisterApplication(s.ctx, app)
+	s.ctx.Request = httptest.NewRequest("POST", "/message", strings.NewReader(`{"message": "third"}`))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+	messages.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 403, s.recorder.Code)
+	assert.EqualError(s.T(), s.ctx.Errors[0].Err, "messages quota exceeded, the user may have at most 2 messages")
+	s.db.AssertMessageNotExist(3)
+}
+
+func (s *QuotaSuite) Test_CheckPluginStorage() {
+	s.db.User(5)
+	limit := int64(10)
+	require.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: 5, MaxPluginStorageBytes: &limit}))
+	first := &model.PluginConf{UserID: 5, ModulePath: "first", Token: "Pfirst", Storage: []byte("1234")}
+	second := &model.PluginConf{UserID: 5, ModulePath: "second", Token: "Psecond", Storage: []byte("12345")}
+	require.NoError(s.T(), s.db.CreatePluginConf(first))
+	require.NoError(s.T(), s.db.CreatePluginConf(second))
+
+	assert.NoError(s.T(), s.a.CheckPluginStorage(5, first.ID, 5))
+	assert.EqualError(s.T(), s.a.CheckPluginStorage(5, first.ID, 6), "plugin storage quota of 10 bytes exceeded")
+	assert.NoError(s.T(), s.a.CheckPluginStorage(6, first.ID, 100), "the defaults don't limit the plugin storage")
+}
+
+func (s *QuotaSuite) Test_nilQuota() {
+	var quota *QuotaAPI
+	assert.NoError(s.T(), quota.CheckPluginStorage(5, 1, 100))
+	assert.NoError(s.T(), quota.CheckMessages(5, 100))
+}
+
+func (s *QuotaSuite) Test_CheckMessages() {
+	s.db.User(5).App(1).Message(1).Message(2)
+	two := int64(2)
+	require.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: 5, MaxMessages: &two}))
+
+	var exceeded *MessageQuotaError
+	assert.ErrorAs(s.T(), s.a.CheckMessages(5, 1), &exceeded)
+	assert.Equal(s.T(), int64(2), exceeded.Limit)
+	assert.NoError(s.T(), s.a.CheckMessages(6, 1), "the defaults don't limit the messages")
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	reaperMaxWait    = time.Hour
+	reaperRetryDelay = time.Minute
+	reaperBatchSize  = 500
+)
+
+// The ReaperDatabase interface for encapsulating database access.
+type ReaperDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	DeleteExpiredMessages(now time.Time, limit int) ([]*model.Message, error)
+	GetNextMessageExpiry() (*time.Time, error)
+}
+
+// DeletionNotifier notifies when messages were deleted.
+type DeletionNotifier interface {
+	NotifyDeletedMessages(userID uint, ids []uint)
+}
+
+// ApplicationDeletionNotifier notifies when messages of an application were deleted.
+type ApplicationDeletionNotifier interface {
+	NotifyDeletedApplicationMessages(app *model.Application, ids []uint)
+}
+
+// ApplicationDeletionNotifiers is an ApplicationDeletionNotifier which notifies all contained notifiers.
+type ApplicationDeletionNotifiers []ApplicationDeletionNotifier
+
+// NotifyDeletedApplicationMessages notifies all contained notifiers in order.
+func (n ApplicationDeletionNotifiers) NotifyDeletedApplicationMessages(app *model.Application, ids []uint) {
+	for _, notifier := range n {
+		notifier.NotifyDeletedApplicationMessages(app, ids)
+	}
+}
+
+// MessageReaper deletes expired messages and notifies about the deletion per application.
+type MessageReaper struct {
+	DB       ReaperDatabase
+	Notifier ApplicationDeletionNotifier
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewMessageReaper creates a MessageReaper and starts deleting expired messages.
+func NewMessageReaper(db ReaperDatabase, notifier ApplicationDeletionNotifier) *MessageReaper {
+	r := &MessageReaper{
+		DB:       db,
+		Notifier: notifier,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// Notify recalculates the next expiry if the created message expires.
+func (r *MessageReaper) Notify(userID uint, msg *model.MessageExternal) {
+	if msg.ExpiresAt != nil {
+		r.Reschedule()
+	}
+}
+
+// Reschedule must be called when expiring messages were added, so that the
+// next expiry is recalculated.
+func (r *MessageReaper) Reschedule() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the reaper.
+func (r *MessageReaper) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+}
+
+func (r *MessageReaper) run() {
+	defer r.wg.Done()
+	for {
+		timer := time.NewTimer(r.deleteExpired())
+		select {
+		case <-r.done:
+			timer.Stop()
+			return
+		case <-r.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deleteExpired deletes all expired messages and returns the duration until the next message expires.
+func (r *MessageReaper) deleteExpired() time.Duration {
+	now := timeNow()
+	for {
+		expired, err := r.DB.DeleteExpiredMessages(now, reaperBatchSize)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not delete expired messages")
+			return reaperRetryDelay
+		}
+		r.notify(expired)
+		if len(expired) < reaperBatchSize {
+			break
+		}
+	}
+
+	next, err := r.DB.GetNextMessageExpiry()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load next message expiry")
+		return reaperRetryDelay
+	}
+	if next == nil {
+		return reaperMaxWait
+	}
+	return min(max(next.Sub(timeNow()), 0), reaperMaxWait)
+}
+
+func (r *MessageReaper) notify(expired []*model.Message) {
+	idsByApp := map[uint][]uint{}
+	var appIDs []uint
+	for _, msg := range expired {
+		if _, ok := idsByApp[msg.ApplicationID]; !ok {
+			appIDs = append(appIDs, msg.ApplicationID)
+		}
+		idsByApp[msg.ApplicationID] = append(idsByApp[msg.ApplicationID], msg.ID)
+	}
+
+	for _, appID := range appIDs {
+		app, err := r.DB.GetApplicationByID(appID)
+		if err != nil {
+			log.Error().Err(err).Uint("app_id", appID).Msg("Could not notify about expired messages")
+			continue
+		}
+		if app == nil {
+			continue
+		}
+		r.Notifier.NotifyDeletedApplicationMessages(app, idsByApp[appID])
+	}
+}
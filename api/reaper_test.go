@@ -0,0 +1,131 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingDeletionNotifier struct {
+	mutex   sync.Mutex
+	deleted map[uint][]uint
+}
+
+func (n *recordingDeletionNotifier) NotifyDeletedMessages(userID uint, ids []uint) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.deleted == nil {
+		n.deleted = map[uint][]uint{}
+	}
+	n.deleted[userID] = append(n.deleted[userID], ids...)
+}
+
+func (n *recordingDeletionNotifier) get(userID uint) []uint {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]uint{}, n.deleted[userID]...)
+}
+
+func expiringMessage(appID uint, expiresAt time.Time) *model.Message {
+	return &model.Message{ApplicationID: appID, Message: "transient", Date: time.Now(), ExpiresAt: &expiresAt}
+}
+
+func TestMessageReaper_deletesExpiredMessagesOnStart(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	user := db.User(4)
+	user.App(8)
+	user.App(9)
+	db.User(5).App(10)
+	expired1 := expiringMessage(8, time.Now().Add(-time.Hour))
+	expired2 := expiringMessage(9, time.Now().Add(-time.Minute))
+	expired3 := expiringMessage(10, time.Now().Add(-time.Minute))
+	later := expiringMessage(8, time.Now().Add(time.Hour))
+	permanent := &model.Message{ApplicationID: 8, Message: "permanent", Date: time.Now()}
+	for _, msg := range []*model.Message{expired1, expired2, expired3, later, permanent} {
+		require.NoError(t, db.CreateMessage(msg))
+	}
+
+	notifier := &recordingDeletionNotifier{}
+	reaper := NewMessageReaper(db, &ShareDeletionNotifier{DB: db, Notifier: notifier})
+	defer reaper.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []uint{expired1.ID, expired2.ID}, notifier.get(4))
+	require.Eventually(t, func() bool { return len(notifier.get(5)) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []uint{expired3.ID}, notifier.get(5))
+
+	db.AssertMessageNotExist(expired1.ID, expired2.ID, expired3.ID)
+	db.AssertMessageExist(later.ID)
+	db.AssertMessageExist(permanent.ID)
+}
+
+func TestMessageReaper_deletesWhenExpired(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+
+	notifier := &recordingDeletionNotifier{}
+	reaper := NewMessageReaper(db, &ShareDeletionNotifier{DB: db, Notifier: notifier})
+	defer reaper.Close()
+
+	msg := expiringMessage(8, time.Now().Add(100*time.Millisecond))
+	require.NoError(t, db.CreateMessage(msg))
+	reaper.Notify(4, &model.MessageExternal{ID: msg.ID, ExpiresAt: msg.ExpiresAt})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, notifier.get(4))
+	db.AssertMessageExist(msg.ID)
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []uint{msg.ID}, notifier.get(4))
+	db.AssertMessageNotExist(msg.ID)
+}
+
+func TestMessageReaper_notifiesAllReaders(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4)
+	db.User(5)
+	db.User(6)
+	db.User(7)
+	group := &model.Group{Name: "ops", Members: []uint{4, 5}}
+	require.NoError(t, db.CreateGroup(group))
+	require.NoError(t, db.CreateApplication(&model.Application{ID: 8, UserID: 4, GroupID: group.ID, Token: "A8", Name: "production"}))
+	require.NoError(t, db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 6, Permission: model.SharePermissionRead}))
+	expired := expiringMessage(8, time.Now().Add(-time.Minute))
+	require.NoError(t, db.CreateMessage(expired))
+
+	notifier := &recordingDeletionNotifier{}
+	reaper := NewMessageReaper(db, &ShareDeletionNotifier{DB: db, Notifier: notifier})
+	defer reaper.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(6)) == 1 }, time.Second, 5*time.Millisecond)
+	for _, userID := range []uint{4, 5, 6} {
+		assert.Equal(t, []uint{expired.ID}, notifier.get(userID), "user %d", userID)
+	}
+	assert.Empty(t, notifier.get(7))
+}
+
+func TestMessageReaper_ignoresMessagesWithoutExpiry(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+
+	notifier := &recordingDeletionNotifier{}
+	reaper := NewMessageReaper(db, &ShareDeletionNotifier{DB: db, Notifier: notifier})
+	defer reaper.Close()
+
+	reaper.Notify(4, &model.MessageExternal{ID: 1})
+	assert.Empty(t, reaper.wake)
+}
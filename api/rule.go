@@ -0,0 +1,479 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+)
+
+// The RuleDatabase interface for encapsulating database access.
+type RuleDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetRuleByID(id uint) (*model.Rule, error)
+	GetRulesByUser(userID uint) ([]*model.Rule, error)
+	CreateRule(rule *model.Rule) error
+	UpdateRule(rule *model.Rule) error
+	DeleteRuleByID(id uint) error
+}
+
+// RuleEngine evaluates the rules of users against new messages.
+type RuleEngine interface {
+	Evaluate(userID uint, msg *model.Message) (*rules.Result, error)
+	Dispatch(result *rules.Result, msg *model.Message)
+}
+
+// The RuleAPI provides handlers for managing routing rules.
+type RuleAPI struct {
+	DB    RuleDatabase
+	Rules RuleEngine
+}
+
+// Rule Params Model
+//
+// Params allowed to create or update rules.
+//
+// swagger:model RuleParams
+type RuleParams struct {
+	// The name of the rule.
+	//
+	// required: true
+	// example: Copy disk alerts to ops
+	Name string `form:"name" query:"name" json:"name" binding:"required"`
+	// Only match messages of this application. 0 matches messages of all applications.
+	//
+	// example: 0
+	ApplicationID uint `form:"appid" query:"appid" json:"appid"`
+	// Only match messages with a title matching this regular expression.
+	//
+	// example: (?i)disk
+	TitlePattern string `form:"titlePattern" query:"titlePattern" json:"titlePattern"`
+	// Only match messages with a message matching this regular expression.
+	//
+	// example: full$
+	MessagePattern string `form:"messagePattern" query:"messagePattern" json:"messagePattern"`
+	// Only match messages with at least this priority.
+	//
+	// example: 5
+	MinPriority *int `form:"minPriority" query:"minPriority" json:"minPriority"`
+	// Only match messages with at most this priority.
+	//
+	// example: 10
+	MaxPriority *int `form:"maxPriority" query:"maxPriority" json:"maxPriority"`
+	// Only match messages which have this extras key.
+	//
+	// example: client::notification
+	ExtrasKey string `form:"extrasKey" query:"extrasKey" json:"extrasKey"`
+	// Only match messages received after this time of day (HH:MM, server time zone).
+	//
+	// example: 22:00
+	ActiveFrom string `form:"activeFrom" query:"activeFrom" json:"activeFrom"`
+	// Only match messages received before this time of day (HH:MM, server time zone).
+	//
+	// example: 07:00
+	ActiveUntil string `form:"activeUntil" query:"activeUntil" json:"activeUntil"`
+	// The action performed on matching messages.
+	//
+	// required: true
+	// enum: setPriority,copy,drop,tag,webhook
+	// example: copy
+	Action string `form:"action" query:"action" json:"action" binding:"required"`
+	// The new priority for the setPriority action.
+	//
+	// example: 2
+	Priority int `form:"priority" query:"priority" json:"priority"`
+	// The application the message is copied to for the copy action.
+	// Applications shared with the manage permission can be used as well.
+	//
+	// example: 7
+	TargetApplicationID uint `form:"targetAppid" query:"targetAppid" json:"targetAppid"`
+	// The tag added to the extras key server::tags for the tag action.
+	//
+	// example: infra
+	Tag string `form:"tag" query:"tag" json:"tag"`
+	// The url the message is posted to for the webhook action.
+	// Loopback, private and link-local addresses are rejected unless allowed by the server configuration.
+	//
+	// example: https://example.com/hook
+	WebhookURL string `form:"webhookUrl" query:"webhookUrl" json:"webhookUrl"`
+}
+
+// RuleTestParams Model
+//
+// A sample message the rules are tested against.
+//
+// swagger:model RuleTestParams
+type RuleTestParams struct {
+	// The application id of the sample message.
+	//
+	// required: true
+	// example: 5
+	ApplicationID uint `form:"appid" query:"appid" json:"appid" binding:"required"`
+	// The title of the sample message.
+	//
+	// example: Disk full
+	Title string `form:"title" query:"title" json:"title"`
+	// The message of the sample message.
+	//
+	// example: /dev/sda1 is full
+	Message string `form:"message" query:"message" json:"message"`
+	// The priority of the sample message.
+	//
+	// example: 8
+	Priority int `form:"priority" query:"priority" json:"priority"`
+	// The extras of the sample message.
+	Extras map[string]any `form:"-" query:"-" json:"extras"`
+}
+
+// RuleTestResult Model
+//
+// The outcome of testing the rules against a sample message.
+//
+// swagger:model RuleTestResult
+type RuleTestResult struct {
+	// The sample message after the rules were applied.
+	//
+	// required: true
+	Message *model.MessageExternal `json:"message"`
+	// The ids of the matched rules in evaluation order.
+	//
+	// required: true
+	// example: [1, 3]
+	Matched []uint `json:"matched"`
+	// Whether the message would be dropped.
+	//
+	// required: true
+	// example: false
+	Drop bool `json:"drop"`
+	// The ids of the applications the message would be copied to.
+	//
+	// required: true
+	// example: [7]
+	Copies []uint `json:"copies"`
+	// The urls the message would be posted to.
+	//
+	// required: true
+	// example: ["https://example.com/hook"]
+	Webhooks []string `json:"webhooks"`
+}
+
+// GetRules returns all rules of the current user.
+// swagger:operation GET /rule rule getRules
+//
+// Return all rules of the current user in evaluation order.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/Rule"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *RuleAPI) GetRules(ctx *gin.Context) {
+	userRules, err := a.DB.GetRulesByUser(auth.GetUserID(ctx))
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, userRules)
+}
+
+// CreateRule creates a rule.
+// swagger:operation POST /rule rule createRule
+//
+// Create a rule.
+//
+// Rules are evaluated in the order they were created against every new message
+// of the current user. A message is dropped by the first matching drop rule.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the rule to add
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/RuleParams"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Rule"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *RuleAPI) CreateRule(ctx *gin.Context) {
+	rule := &model.Rule{UserID: auth.GetUserID(ctx)}
+	if ok := a.bindRule(ctx, rule); !ok {
+		return
+	}
+	if success := successOrAbort(ctx, 500, a.DB.CreateRule(rule)); !success {
+		return
+	}
+	ctx.JSON(200, rule)
+}
+
+// UpdateRule updates a rule.
+// swagger:operation PUT /rule/{id} rule updateRule
+//
+// Update a rule.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the rule
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/RuleParams"
+//	- name: id
+//	  in: path
+//	  description: the rule id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Rule"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *RuleAPI) UpdateRule(ctx *gin.Context) {
+	a.withRule(ctx, func(rule *model.Rule) {
+		if ok := a.bindRule(ctx, rule); !ok {
+			return
+		}
+		if success := successOrAbort(ctx, 500, a.DB.UpdateRule(rule)); !success {
+			return
+		}
+		ctx.JSON(200, rule)
+	})
+}
+
+// DeleteRule deletes a rule.
+// swagger:operation DELETE /rule/{id} rule deleteRule
+//
+// Delete a rule.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the rule id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *RuleAPI) DeleteRule(ctx *gin.Context) {
+	a.withRule(ctx, func(rule *model.Rule) {
+		successOrAbort(ctx, 500, a.DB.DeleteRuleByID(rule.ID))
+	})
+}
+
+// TestRules evaluates the rules against a sample message.
+// swagger:operation POST /rule/test rule testRules
+//
+// Test the rules of the current user against a sample message.
+//
+// Nothing is stored, copied or posted to webhooks.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the sample message
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/RuleTestParams"
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/RuleTestResult"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *RuleAPI) TestRules(ctx *gin.Context) {
+	params := RuleTestParams{}
+	if err := ctx.Bind(&params); err != nil {
+		return
+	}
+	userID := auth.GetUserID(ctx)
+	if ok := a.checkApplication(ctx, userID, params.ApplicationID, "appid", model.SharePermissionRead); !ok {
+		return
+	}
+
+	msg := &model.Message{
+		ApplicationID: params.ApplicationID,
+		Title:         params.Title,
+		Message:       params.Message,
+		Priority:      params.Priority,
+		Date:          timeNow(),
+	}
+	if params.Extras != nil {
+		msg.Extras, _ = json.Marshal(params.Extras)
+	}
+	result, err := a.Rules.Evaluate(userID, msg)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	ctx.JSON(200, &RuleTestResult{
+		Message:  toExternalMessage(msg),
+		Matched:  nonNil(result.Matched),
+		Drop:     result.Drop,
+		Copies:   nonNil(result.Copies),
+		Webhooks: nonNil(result.Webhooks),
+	})
+}
+
+func (a *RuleAPI) bindRule(ctx *gin.Context, rule *model.Rule) bool {
+	params := RuleParams{}
+	if err := ctx.Bind(&params); err != nil {
+		return false
+	}
+	rule.Name = params.Name
+	rule.ApplicationID = params.ApplicationID
+	rule.TitlePattern = params.TitlePattern
+	rule.MessagePattern = params.MessagePattern
+	rule.MinPriority = params.MinPriority
+	rule.MaxPriority = params.MaxPriority
+	rule.ExtrasKey = params.ExtrasKey
+	rule.ActiveFrom = params.ActiveFrom
+	rule.ActiveUntil = params.ActiveUntil
+	rule.Action = params.Action
+	rule.Priority = params.Priority
+	rule.TargetApplicationID = params.TargetApplicationID
+	rule.Tag = params.Tag
+	rule.WebhookURL = params.WebhookURL
+
+	if _, err := rules.Compile(rule); err != nil {
+		ctx.AbortWithError(400, err)
+		return false
+	}
+	if rule.ApplicationID != 0 {
+		if ok := a.checkApplication(ctx, rule.UserID, rule.ApplicationID, "appid", model.SharePermissionRead); !ok {
+			return false
+		}
+	}
+	if rule.Action == model.RuleActionCopy {
+		if ok := a.checkApplication(ctx, rule.UserID, rule.TargetApplicationID, "targetAppid", model.SharePermissionManage); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkApplication checks that the user has access to the application, the copy target requires the manage permission.
+func (a *RuleAPI) checkApplication(ctx *gin.Context, userID, appID uint, field, required string) bool {
+	app, err := a.DB.GetApplicationByID(appID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	permission, err := applicationPermission(a.DB, app, userID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return false
+	}
+	if permission == "" || (required == model.SharePermissionManage && permission != model.SharePermissionManage) {
+		ctx.AbortWithError(400, fmt.Errorf("%s: app with id %d doesn't exists", field, appID))
+		return false
+	}
+	return true
+}
+
+func (a *RuleAPI) withRule(ctx *gin.Context, f func(rule *model.Rule)) {
+	withID(ctx, "id", func(id uint) {
+		rule, err := a.DB.GetRuleByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if rule == nil || rule.UserID != auth.GetUserID(ctx) {
+			ctx.AbortWithError(404, fmt.Errorf("rule with id %d doesn't exists", id))
+			return
+		}
+		f(rule)
+	})
+}
+
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestRuleSuite(t *testing.T) {
+	suite.Run(t, new(RuleSuite))
+}
+
+type RuleSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *RuleAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+}
+
+func (s *RuleSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.a = &RuleAPI{DB: s.db, Rules: rules.NewEngine(s.db, s)}
+}
+
+func (s *RuleSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+}
+
+func (s *RuleSuite) Notify(userID uint, msg *model.MessageExternal) {
+}
+
+func (s *RuleSuite) Test_ensureRuleHasCorrectJsonRepresentation() {
+	actual := &model.Rule{
+		ID: 1, UserID: 4, Name: "night", ApplicationID: 8, TitlePattern: "disk", MessagePattern: "full",
+		MinPriority: intPtr(5), ExtrasKey: "client::display", ActiveFrom: "22:00", ActiveUntil: "07:00",
+		Action: "setPriority", Priority: 2, CreatedAt: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+	}
+	test.JSONEquals(s.T(), actual, `{"id":1,"name":"night","appid":8,"titlePattern":"disk","messagePattern":"full","minPriority":5,"maxPriority":null,"extrasKey":"client::display","activeFrom":"22:00","activeUntil":"07:00","action":"setPriority","priority":2,"targetAppid":0,"tag":"","webhookUrl":"","createdAt":"2024-01-05T00:00:00Z"}`)
+}
+
+func (s *RuleSuite) Test_GetRules() {
+	s.db.User(4)
+	s.db.User(5)
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "a", Action: model.RuleActionDrop})
+	s.db.CreateRule(&model.Rule{UserID: 5, Name: "b", Action: model.RuleActionDrop})
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "c", Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.Request = httptest.NewRequest("GET", "/rule", nil)
+	s.a.GetRules(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	rules, err := s.db.GetRulesByUser(4)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), rules, 2)
+	test.BodyEquals(s.T(), rules, s.recorder)
+}
+
+func (s *RuleSuite) Test_CreateRule() {
+	s.db.User(4).App(8)
+	s.db.User(4).App(9)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON("POST", "/rule", `{"name":"copy disk","appid":8,"titlePattern":"(?i)disk","action":"copy","targetAppid":9}`)
+	s.a.CreateRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if rules, err := s.db.GetRulesByUser(4); assert.NoError(s.T(), err) && assert.Len(s.T(), rules, 1) {
+		rule := rules[0]
+		assert.Equal(s.T(), "copy disk", rule.Name)
+		assert.Equal(s.T(), uint(8), rule.ApplicationID)
+		assert.Equal(s.T(), "(?i)disk", rule.TitlePattern)
+		assert.Equal(s.T(), model.RuleActionCopy, rule.Action)
+		assert.Equal(s.T(), uint(9), rule.TargetApplicationID)
+		test.BodyEquals(s.T(), rule, s.recorder)
+	}
+}
+
+func (s *RuleSuite) Test_CreateRule_invalid() {
+	s.db.User(4).App(8)
+	s.db.User(5).App(9)
+
+	tests := []string{
+		`{"action":"drop"}`,
+		`{"name":"a"}`,
+		`{"name":"a","action":"explode"}`,
+		`{"name":"a","titlePattern":"(","action":"drop"}`,
+		`{"name":"a","activeFrom":"22:00","action":"drop"}`,
+		`{"name":"a","action":"webhook","webhookUrl":"file:///etc/passwd"}`,
+		`{"name":"a","appid":9,"action":"drop"}`,
+		`{"name":"a","action":"copy","targetAppid":9}`,
+		`{"name":"a","action":"copy","targetAppid":99}`,
+	}
+	for _, body := range tests {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		test.WithUser(s.ctx, 4)
+		s.withJSON("POST", "/rule", body)
+		s.a.CreateRule(s.ctx)
+
+		assert.Equal(s.T(), 400, s.recorder.Code, body)
+	}
+	if rules, err := s.db.GetRulesByUser(4); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+}
+
+func (s *RuleSuite) Test_CreateRule_sharedTarget() {
+	s.db.User(4).App(8)
+	s.db.User(5).App(9)
+	s.db.User(5).App(10)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 9, UserID: 4, Permission: model.SharePermissionManage})
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 10, UserID: 4, Permission: model.SharePermissionRead})
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON("POST", "/rule", `{"name":"copy to ops","action":"copy","targetAppid":9}`)
+	s.a.CreateRule(s.ctx)
+	assert.Equal(s.T(), 200, s.recorder.Code)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.withJSON("POST", "/rule", `{"name":"copy to read only","action":"copy","targetAppid":10}`)
+	s.a.CreateRule(s.ctx)
+	assert.Equal(s.T(), 400, s.recorder.Code)
+
+	msg := &model.Message{ApplicationID: 8, Date: time.Now()}
+	result, err := s.a.Rules.Evaluate(4, msg)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []uint{9}, result.Copies)
+
+	s.db.DeleteApplicationShare(9, 4)
+	result, err = s.a.Rules.Evaluate(4, msg)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), result.Copies, "no copies after the share was removed")
+}
+
+func (s *RuleSuite) Test_UpdateRule() {
+	s.db.User(4)
+	rule := &model.Rule{UserID: 4, Name: "a", Action: model.RuleActionDrop}
+	s.db.CreateRule(rule)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", "/rule/1", `{"name":"b","maxPriority":3,"action":"setPriority","priority":0}`)
+	s.a.UpdateRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if updated, err := s.db.GetRuleByID(rule.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "b", updated.Name)
+		assert.Equal(s.T(), intPtr(3), updated.MaxPriority)
+		assert.Equal(s.T(), model.RuleActionSetPriority, updated.Action)
+		assert.Equal(s.T(), uint(4), updated.UserID)
+	}
+}
+
+func (s *RuleSuite) Test_UpdateRule_otherUser() {
+	s.db.User(4)
+	s.db.User(5)
+	s.db.CreateRule(&model.Rule{UserID: 5, Name: "a", Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.withJSON("PUT", "/rule/1", `{"name":"b","action":"drop"}`)
+	s.a.UpdateRule(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if rule, err := s.db.GetRuleByID(1); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "a", rule.Name)
+	}
+}
+
+func (s *RuleSuite) Test_DeleteRule() {
+	s.db.User(4)
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "a", Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/rule/1", nil)
+	s.a.DeleteRule(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if rule, err := s.db.GetRuleByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule)
+	}
+}
+
+func (s *RuleSuite) Test_DeleteRule_otherUser() {
+	s.db.User(4)
+	s.db.User(5)
+	s.db.CreateRule(&model.Rule{UserID: 5, Name: "a", Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/rule/1", nil)
+	s.a.DeleteRule(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	if rule, err := s.db.GetRuleByID(1); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), rule)
+	}
+}
+
+func (s *RuleSuite) Test_TestRules() {
+	t := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	user := s.db.User(4)
+	user.App(8)
+	user.App(9)
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "a", TitlePattern: "disk", Action: model.RuleActionSetPriority, Priority: 10})
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "b", MinPriority: intPtr(10), Action: model.RuleActionCopy, TargetApplicationID: 9})
+	s.db.CreateRule(&model.Rule{UserID: 4, Name: "c", ApplicationID: 9, Action: model.RuleActionDrop})
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON("POST", "/rule/test", `{"appid":8,"title":"disk full","priority":1}`)
+	s.a.TestRules(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &RuleTestResult{
+		Message:  &model.MessageExternal{ApplicationID: 8, Title: "disk full", Priority: intPtr(10), Date: t},
+		Matched:  []uint{1, 2},
+		Copies:   []uint{9},
+		Webhooks: []string{},
+	}, s.recorder)
+	if msgs, err := s.db.GetMessagesByApplication(9); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
+
+func (s *RuleSuite) Test_TestRules_foreignApplication() {
+	s.db.User(4)
+	s.db.User(5).App(9)
+
+	test.WithUser(s.ctx, 4)
+	s.withJSON("POST", "/rule/test", `{"appid":9,"title":"disk full"}`)
+	s.a.TestRules(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *RuleSuite) withJSON(method, url, body string) {
+	s.ctx.Request = httptest.NewRequest(method, url, strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	schedulerMaxWait    = time.Hour
+	schedulerRetryDelay = time.Minute
+)
+
+// The SchedulerDatabase interface for encapsulating database access.
+type SchedulerDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetDueScheduledMessages(now time.Time) ([]*model.ScheduledMessage, error)
+	GetNextScheduledMessage() (*model.ScheduledMessage, error)
+	DeliverScheduledMessage(scheduledID uint, message *model.Message) (bool, error)
+	DeleteScheduledMessageByID(id uint) error
+}
+
+// MessageScheduler delivers scheduled messages when they are due.
+// Scheduled messages are stored in the database, so they survive restarts.
+type MessageScheduler struct {
+	DB       SchedulerDatabase
+	Notifier Notifier
+	Rules    RuleEngine
+	Quota    *QuotaAPI
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewMessageScheduler creates a MessageScheduler and starts delivering due messages.
+// The rules of the owner are evaluated on delivery if rules isn't nil.
+// Messages exceeding the message limit of the owner are dropped on delivery.
+func NewMessageScheduler(db SchedulerDatabase, notifier Notifier, rules RuleEngine, quota *QuotaAPI) *MessageScheduler {
+	s := &MessageScheduler{
+		DB:       db,
+		Notifier: notifier,
+		Rules:    rules,
+		Quota:    quota,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Reschedule must be called when scheduled messages were added, so that the
+// next delivery time is recalculated.
+func (s *MessageScheduler) Reschedule() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the scheduler.
+func (s *MessageScheduler) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+}
+
+func (s *MessageScheduler) run() {
+	defer s.wg.Done()
+	for {
+		timer := time.NewTimer(s.deliverDue())
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverDue delivers all due messages and returns the duration until the next message is due.
+func (s *MessageScheduler) deliverDue() time.Duration {
+	due, err := s.DB.GetDueScheduledMessages(timeNow())
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load scheduled messages")
+		return schedulerRetryDelay
+	}
+	for _, scheduled := range due {
+		if err := s.deliver(scheduled); err != nil {
+			log.Error().Err(err).Uint("scheduled_id", scheduled.ID).Msg("Could not deliver scheduled message")
+			return schedulerRetryDelay
+		}
+	}
+
+	next, err := s.DB.GetNextScheduledMessage()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not load scheduled messages")
+		return schedulerRetryDelay
+	}
+	if next == nil {
+		return schedulerMaxWait
+	}
+	return min(max(next.DeliverAt.Sub(timeNow()), 0), schedulerMaxWait)
+}
+
+func (s *MessageScheduler) deliver(scheduled *model.ScheduledMessage) error {
+	app, err := s.DB.GetApplicationByID(scheduled.ApplicationID)
+	if err != nil {
+		return err
+	}
+	if app == nil {
+		return s.DB.DeleteScheduledMessageByID(scheduled.ID)
+	}
+	if err := s.Quota.CheckMessages(app.UserID, 1); err != nil {
+		var exceeded *MessageQuotaError
+		if !errors.As(err, &exceeded) {
+			return err
+		}
+		log.Warn().Err(err).Uint("scheduled_id", scheduled.ID).Msg("Dropping scheduled message")
+		return s.DB.DeleteScheduledMessageByID(scheduled.ID)
+	}
+	msg := &model.Message{
+		ApplicationID: scheduled.ApplicationID,
+		Message:       scheduled.Message,
+		Title:         scheduled.Title,
+		Priority:      scheduled.Priority,
+		Extras:        scheduled.Extras,
+		Date:          timeNow(),
+	}
+	msg.ExpiresAt = expiry(scheduled.ExpiresAt, scheduled.TTLSeconds, msg.Date)
+	var result *rules.Result
+	if s.Rules != nil {
+		result, err = s.Rules.Evaluate(app.UserID, msg)
+		if err != nil {
+			return err
+		}
+		if result.Drop {
+			return s.DB.DeleteScheduledMessageByID(scheduled.ID)
+		}
+	}
+	delivered, err := s.DB.DeliverScheduledMessage(scheduled.ID, msg)
+	if err != nil || !delivered {
+		return err
+	}
+	s.Notifier.Notify(app.UserID, toExternalMessage(msg))
+	if result != nil {
+		s.Rules.Dispatch(result, msg)
+	}
+	return nil
+}
+
+func toScheduledMessage(msg *model.CreateMessage) *model.ScheduledMessage {
+	res := &model.ScheduledMessage{
+		ApplicationID: msg.ApplicationID,
+		Message:       msg.Message,
+		Title:         msg.Title,
+		DeliverAt:     *msg.DeliverAt,
+		ExpiresAt:     msg.ExpiresAt,
+	}
+	if msg.Priority != nil {
+		res.Priority = *msg.Priority
+	}
+	if msg.TTLSeconds != nil {
+		res.TTLSeconds = *msg.TTLSeconds
+	}
+	if msg.Extras != nil {
+		res.Extras, _ = json.Marshal(msg.Extras)
+	}
+	return res
+}
+
+func toExternalScheduledMessage(msg *model.ScheduledMessage) *model.ScheduledMessageExternal {
+	res := &model.ScheduledMessageExternal{
+		ID:            msg.ID,
+		ApplicationID: msg.ApplicationID,
+		Message:       msg.Message,
+		Title:         msg.Title,
+		Priority:      msg.Priority,
+		DeliverAt:     msg.DeliverAt,
+		ExpiresAt:     msg.ExpiresAt,
+		TTLSeconds:    msg.TTLSeconds,
+		CreatedAt:     msg.CreatedAt,
+	}
+	if len(msg.Extras) != 0 {
+		res.Extras = make(map[string]any)
+		json.Unmarshal(msg.Extras, &res.Extras)
+	}
+	return res
+}
+
+func toExternalScheduledMessages(msgs []*model.ScheduledMessage) []*model.ScheduledMessageExternal {
+	res := make([]*model.ScheduledMessageExternal, len(msgs))
+	for i := range msgs {
+		res[i] = toExternalScheduledMessage(msgs[i])
+	}
+	return res
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/rules"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	mutex    sync.Mutex
+	messages map[uint][]*model.MessageExternal
+}
+
+func (n *recordingNotifier) Notify(userID uint, msg *model.MessageExternal) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.messages == nil {
+		n.messages = map[uint][]*model.MessageExternal{}
+	}
+	n.messages[userID] = append(n.messages[userID], msg)
+}
+
+func (n *recordingNotifier) get(userID uint) []*model.MessageExternal {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]*model.MessageExternal{}, n.messages[userID]...)
+}
+
+func TestMessageScheduler_deliversPendingMessagesOnStart(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Title: "Reminder", Message: "renew cert", Priority: 5, DeliverAt: time.Now().Add(-time.Hour)})
+
+	notifier := &recordingNotifier{}
+	scheduler := NewMessageScheduler(db, notifier, nil, nil)
+	defer scheduler.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 1 }, time.Second, 5*time.Millisecond)
+	msg := notifier.get(4)[0]
+	assert.Equal(t, "renew cert", msg.Message)
+	assert.Equal(t, "Reminder", msg.Title)
+	assert.Equal(t, 5, *msg.Priority)
+	assert.Equal(t, uint(8), msg.ApplicationID)
+
+	if msgs, err := db.GetMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Len(t, msgs, 1)
+	}
+	if scheduled, err := db.GetScheduledMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Empty(t, scheduled)
+	}
+}
+
+func TestMessageScheduler_deliversWhenDue(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+
+	notifier := &recordingNotifier{}
+	scheduler := NewMessageScheduler(db, notifier, nil, nil)
+	defer scheduler.Close()
+
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "first", DeliverAt: time.Now().Add(100 * time.Millisecond)})
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "second", DeliverAt: time.Now().Add(200 * time.Millisecond)})
+	cancelled := &model.ScheduledMessage{ApplicationID: 8, Message: "cancelled", DeliverAt: time.Now().Add(150 * time.Millisecond)}
+	db.CreateScheduledMessage(cancelled)
+	scheduler.Reschedule()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, notifier.get(4))
+	db.DeleteScheduledMessageByID(cancelled.ID)
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "first", notifier.get(4)[0].Message)
+	assert.Equal(t, "second", notifier.get(4)[1].Message)
+}
+
+func TestMessageScheduler_dropsMessagesOfDeletedApplications(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4)
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "orphan", DeliverAt: time.Now().Add(-time.Minute)})
+
+	notifier := &recordingNotifier{}
+	scheduler := NewMessageScheduler(db, notifier, nil, nil)
+	defer scheduler.Close()
+
+	require.Eventually(t, func() bool {
+		next, err := db.GetNextScheduledMessage()
+		return err == nil && next == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, notifier.get(4))
+	db.AssertMessageNotExist(1)
+}
+
+func TestMessageScheduler_appliesTTLOnDelivery(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "transient", DeliverAt: time.Now().Add(-time.Hour), TTLSeconds: 60})
+
+	notifier := &recordingNotifier{}
+	before := time.Now()
+	scheduler := NewMessageScheduler(db, notifier, nil, nil)
+	defer scheduler.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 1 }, time.Second, 5*time.Millisecond)
+	expiresAt := notifier.get(4)[0].ExpiresAt
+	if assert.NotNil(t, expiresAt) {
+		assert.False(t, expiresAt.Before(before.Add(time.Minute).Truncate(time.Second)))
+		assert.False(t, expiresAt.After(time.Now().Add(time.Minute)))
+	}
+}
+
+func TestMessageScheduler_dropsMessagesExceedingTheQuota(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8).Message(1)
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "over quota", DeliverAt: time.Now().Add(-time.Minute)})
+
+	notifier := &recordingNotifier{}
+	scheduler := NewMessageScheduler(db, notifier, nil, &QuotaAPI{DB: db, Defaults: model.QuotaLimits{Messages: 1}})
+	defer scheduler.Close()
+
+	require.Eventually(t, func() bool {
+		next, err := db.GetNextScheduledMessage()
+		return err == nil && next == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, notifier.get(4))
+	if msgs, err := db.GetMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Len(t, msgs, 1)
+	}
+}
+
+func TestMessageScheduler_appliesRulesOnDelivery(t *testing.T) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	defer db.Close()
+	db.User(4).App(8)
+	db.CreateRule(&model.Rule{UserID: 4, MessagePattern: "^spam", Action: model.RuleActionDrop})
+	db.CreateRule(&model.Rule{UserID: 4, Action: model.RuleActionSetPriority, Priority: 7})
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "spam", DeliverAt: time.Now().Add(-time.Hour)})
+	db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: 8, Message: "renew cert", DeliverAt: time.Now().Add(-time.Minute)})
+
+	notifier := &recordingNotifier{}
+	scheduler := NewMessageScheduler(db, notifier, rules.NewEngine(db, notifier), nil)
+	defer scheduler.Close()
+
+	require.Eventually(t, func() bool { return len(notifier.get(4)) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "renew cert", notifier.get(4)[0].Message)
+	assert.Equal(t, 7, *notifier.get(4)[0].Priority)
+	if msgs, err := db.GetMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Len(t, msgs, 1)
+	}
+	if scheduled, err := db.GetScheduledMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Empty(t, scheduled)
+	}
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+// The ShareDatabase interface for encapsulating access to application shares and groups.
+type ShareDatabase interface {
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+}
+
+// The ShareNotifierDatabase interface for encapsulating database access.
+type ShareNotifierDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationSharesByApplication(appID uint) ([]*model.ApplicationShare, error)
+	GetGroupMemberIDs(groupID uint) ([]uint, error)
+}
+
+// ShareNotifier is a Notifier which additionally notifies all users an application is shared with
+// and all members of the group owning the application.
+type ShareNotifier struct {
+	DB       ShareNotifierDatabase
+	Notifier Notifier
+}
+
+// Notify notifies the owner and the members of the application of the message.
+// Messages for other users, like escalations to another user, are only delivered to that user.
+func (n *ShareNotifier) Notify(userID uint, msg *model.MessageExternal) {
+	app, err := n.DB.GetApplicationByID(msg.ApplicationID)
+	if err != nil || app == nil || app.UserID != userID {
+		n.Notifier.Notify(userID, msg)
+		return
+	}
+	readers, err := applicationReaders(n.DB, app)
+	if err != nil {
+		log.Error().Err(err).Uint("app_id", app.ID).Msg("Could not notify the members of the application")
+	}
+	for _, readerID := range readers {
+		n.Notifier.Notify(readerID, msg)
+	}
+}
+
+// ShareDeletionNotifier is an ApplicationDeletionNotifier which notifies all users who can read the application,
+// the owner, the users it is shared with and the members of its group.
+type ShareDeletionNotifier struct {
+	DB       ShareNotifierDatabase
+	Notifier DeletionNotifier
+}
+
+// NotifyDeletedApplicationMessages notifies the readers of the application about the deleted messages.
+func (n *ShareDeletionNotifier) NotifyDeletedApplicationMessages(app *model.Application, ids []uint) {
+	readers, err := applicationReaders(n.DB, app)
+	if err != nil {
+		log.Error().Err(err).Uint("app_id", app.ID).Msg("Could not notify the members of the application")
+	}
+	for _, readerID := range readers {
+		n.Notifier.NotifyDeletedMessages(readerID, ids)
+	}
+}
+
+// applicationReaders returns the ids of the users who can read the messages of the application:
+// the owner, the users the application is shared with and the members of its group.
+// On error the readers found so far are returned, at least the owner.
+func applicationReaders(db ShareNotifierDatabase, app *model.Application) ([]uint, error) {
+	readers := []uint{app.UserID}
+	seen := map[uint]bool{app.UserID: true}
+	add := func(userID uint) {
+		if !seen[userID] {
+			seen[userID] = true
+			readers = append(readers, userID)
+		}
+	}
+	shares, err := db.GetApplicationSharesByApplication(app.ID)
+	if err != nil {
+		return readers, err
+	}
+	for _, share := range shares {
+		add(share.UserID)
+	}
+	if app.GroupID == 0 {
+		return readers, nil
+	}
+	members, err := db.GetGroupMemberIDs(app.GroupID)
+	if err != nil {
+		return readers, err
+	}
+	for _, memberID := range members {
+		add(memberID)
+	}
+	return readers, nil
+}
+
+// ApplicationShare Params Model
+//
+// Params allowed to share an application.
+//
+// swagger:model ApplicationShareParams
+type ApplicationShareParams struct {
+	// The permission of the user.
+	//
+	// required: true
+	// enum: read,manage
+	// example: read
+	Permission string `form:"permission" query:"permission" json:"permission" binding:"required,oneof=read manage"`
+}
+
+// GetApplicationShares returns all users an application is shared with.
+// swagger:operation GET /application/{id}/share application getAppShares
+//
+// Return all users the application is shared with.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	      type: array
+//	      items:
+//	        $ref: "#/definitions/ApplicationShare"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *ApplicationAPI) GetApplicationShares(ctx *gin.Context) {
+	a.withOwnApplication(ctx, func(app *model.Application) {
+		shares, err := a.DB.GetApplicationSharesByApplication(app.ID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		ctx.JSON(200, shares)
+	})
+}
+
+// ShareApplication shares an application with a user.
+// swagger:operation PUT /application/{id}/share/{userId} application shareApp
+//
+// Share an application with a user or change the permission of the user.
+//
+// Only the owner of the application can share it.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the permission of the user
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/ApplicationShareParams"
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	- name: userId
+//	  in: path
+//	  description: the id of the user
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/ApplicationShare"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *ApplicationAPI) ShareApplication(ctx *gin.Context) {
+	a.withOwnApplication(ctx, func(app *model.Application) {
+		withID(ctx, "userId", func(userID uint) {
+			params := ApplicationShareParams{}
+			if err := ctx.Bind(&params); err != nil {
+				return
+			}
+			if userID == app.UserID {
+				ctx.AbortWithError(400, errors.New("cannot share an application with its owner"))
+				return
+			}
+			user, err := a.DB.GetUserByID(userID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if user == nil {
+				ctx.AbortWithError(404, fmt.Errorf("user with id %d doesn't exists", userID))
+				return
+			}
+
+			share, err := a.DB.GetApplicationShare(app.ID, userID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if share == nil {
+				share = &model.ApplicationShare{ApplicationID: app.ID, UserID: userID, CreatedAt: timeNow()}
+			}
+			share.Permission = params.Permission
+			if success := successOrAbort(ctx, 500, a.DB.SaveApplicationShare(share)); !success {
+				return
+			}
+			ctx.JSON(200, share)
+		})
+	})
+}
+
+// UnshareApplication stops sharing an application with a user.
+// swagger:operation DELETE /application/{id}/share/{userId} application unshareApp
+//
+// Stop sharing an application with a user.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	- name: userId
+//	  in: path
+//	  description: the id of the user
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *ApplicationAPI) UnshareApplication(ctx *gin.Context) {
+	a.withOwnApplication(ctx, func(app *model.Application) {
+		withID(ctx, "userId", func(userID uint) {
+			share, err := a.DB.GetApplicationShare(app.ID, userID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if share == nil {
+				ctx.AbortWithError(404, fmt.Errorf("app with id %d is not shared with user with id %d", app.ID, userID))
+				return
+			}
+			successOrAbort(ctx, 500, a.DB.DeleteApplicationShare(app.ID, userID))
+		})
+	})
+}
+
+func (a *ApplicationAPI) withOwnApplication(ctx *gin.Context, f func(app *model.Application)) {
+	withID(ctx, "id", func(id uint) {
+		app, err := a.DB.GetApplicationByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if app == nil || app.UserID != auth.GetUserID(ctx) {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exists", id))
+			return
+		}
+		f(app)
+	})
+}
+
+// applicationPermission returns the permission of the user for the application or an empty string if the user has no access.
+// Owners and members of the group owning the application have the manage permission.
+// For applications of other users SharedPermission of the application is set.
+func applicationPermission(db ShareDatabase, app *model.Application, userID uint) (string, error) {
+	if app == nil {
+		return "", nil
+	}
+	if app.UserID == userID {
+		return model.SharePermissionManage, nil
+	}
+	if app.GroupID != 0 {
+		member, err := db.IsGroupMember(app.GroupID, userID)
+		if err != nil {
+			return "", err
+		}
+		if member {
+			app.SharedPermission = model.SharePermissionManage
+			return model.SharePermissionManage, nil
+		}
+	}
+	share, err := db.GetApplicationShare(app.ID, userID)
+	if err != nil || share == nil {
+		return "", err
+	}
+	app.SharedPermission = share.Permission
+	return share.Permission, nil
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestShareSuite(t *testing.T) {
+	suite.Run(t, new(ShareSuite))
+}
+
+type ShareSuite struct {
+	suite.Suite
+	db       *testdb.Database
+	a        *ApplicationAPI
+	m        *MessageAPI
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	notified map[uint][]*model.MessageExternal
+}
+
+func (s *ShareSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.db = testdb.NewDB(s.T())
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.notified = map[uint][]*model.MessageExternal{}
+	s.a = &ApplicationAPI{DB: s.db}
+	s.m = &MessageAPI{DB: s.db, Notifier: &ShareNotifier{DB: s.db, Notifier: s}}
+
+	s.db.User(4).App(8).Message(1)
+	s.db.User(5)
+	s.db.User(6)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionRead})
+}
+
+func (s *ShareSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+}
+
+func (s *ShareSuite) Notify(userID uint, msg *model.MessageExternal) {
+	s.notified[userID] = append(s.notified[userID], msg)
+}
+
+func (s *ShareSuite) Test_ensureApplicationShareHasCorrectJsonRepresentation() {
+	actual := &model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: "read", CreatedAt: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	test.JSONEquals(s.T(), actual, `{"appid":8,"userId":5,"permission":"read","createdAt":"2024-01-05T00:00:00Z"}`)
+}
+
+func (s *ShareSuite) Test_ShareApplication() {
+	t := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return t }
+	defer func() { timeNow = time.Now }()
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("userId", "6")
+	s.withJSON("PUT", "/application/8/share/6", `{"permission":"manage"}`)
+	s.a.ShareApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.ApplicationShare{ApplicationID: 8, UserID: 6, Permission: "manage", CreatedAt: t}, s.recorder)
+	if share, err := s.db.GetApplicationShare(8, 6); assert.NoError(s.T(), err) && assert.NotNil(s.T(), share) {
+		assert.Equal(s.T(), model.SharePermissionManage, share.Permission)
+	}
+}
+
+func (s *ShareSuite) Test_ShareApplication_changePermission() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("userId", "5")
+	s.withJSON("PUT", "/application/8/share/5", `{"permission":"manage"}`)
+	s.a.ShareApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if shares, err := s.db.GetApplicationSharesByApplication(8); assert.NoError(s.T(), err) && assert.Len(s.T(), shares, 1) {
+		assert.Equal(s.T(), model.SharePermissionManage, shares[0].Permission)
+	}
+}
+
+func (s *ShareSuite) Test_ShareApplication_invalid() {
+	tests := []struct {
+		userID string
+		body   string
+		code   int
+	}{
+		{"6", `{"permission":"admin"}`, 400},
+		{"6", `{}`, 400},
+		{"4", `{"permission":"read"}`, 400},
+		{"99", `{"permission":"read"}`, 404},
+	}
+	for _, tt := range tests {
+		s.recorder = httptest.NewRecorder()
+		s.ctx, _ = gin.CreateTestContext(s.recorder)
+		test.WithUser(s.ctx, 4)
+		s.ctx.AddParam("id", "8")
+		s.ctx.AddParam("userId", tt.userID)
+		s.withJSON("PUT", "/application/8/share/"+tt.userID, tt.body)
+		s.a.ShareApplication(s.ctx)
+
+		assert.Equal(s.T(), tt.code, s.recorder.Code, tt.body)
+	}
+	if shares, err := s.db.GetApplicationSharesByApplication(8); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), shares, 1)
+	}
+}
+
+func (s *ShareSuite) Test_ShareApplication_notOwner() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 6, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 6)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("userId", "5")
+	s.withJSON("PUT", "/application/8/share/5", `{"permission":"manage"}`)
+	s.a.ShareApplication(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ShareSuite) Test_GetApplicationShares() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/share", nil)
+	s.a.GetApplicationShares(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	shares, _ := s.db.GetApplicationSharesByApplication(8)
+	test.BodyEquals(s.T(), shares, s.recorder)
+}
+
+func (s *ShareSuite) Test_UnshareApplication() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("userId", "5")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/share/5", nil)
+	s.a.UnshareApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if share, err := s.db.GetApplicationShare(8, 5); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), share)
+	}
+}
+
+func (s *ShareSuite) Test_UnshareApplication_notShared() {
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.AddParam("userId", "6")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/share/6", nil)
+	s.a.UnshareApplication(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ShareSuite) Test_GetApplications_includesSharedApplications() {
+	s.db.User(5).App(9)
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.Request = httptest.NewRequest("GET", "/application", nil)
+	s.a.GetApplications(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	own, _ := s.db.GetApplicationByID(9)
+	shared, _ := s.db.GetApplicationByID(8)
+	own.Token, shared.Token = "", ""
+	own.Image, shared.Image = "static/defaultapp.png", "static/defaultapp.png"
+	shared.SharedPermission = model.SharePermissionRead
+	test.BodyEquals(s.T(), []*model.Application{own, shared}, s.recorder)
+}
+
+func (s *ShareSuite) Test_UpdateApplication_readPermission() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8", `{"name":"renamed"}`)
+	s.a.UpdateApplication(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ShareSuite) Test_UpdateApplication_managePermission() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8", `{"name":"renamed"}`)
+	s.a.UpdateApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if app, err := s.db.GetApplicationByID(8); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), "renamed", app.Name)
+		assert.Equal(s.T(), uint(4), app.UserID)
+	}
+}
+
+func (s *ShareSuite) Test_DeleteApplication_managePermission() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8", nil)
+	s.a.DeleteApplication(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	s.db.AssertAppExist(8)
+}
+
+func (s *ShareSuite) Test_GetMessagesWithApplication_readPermission() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/message", nil)
+	s.m.GetMessagesWithApplication(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	assert.Contains(s.T(), s.recorder.Body.String(), `"id":1`)
+}
+
+func (s *ShareSuite) Test_GetMessagesWithApplication_notShared() {
+	test.WithUser(s.ctx, 6)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/message", nil)
+	s.m.GetMessagesWithApplication(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *ShareSuite) Test_DeleteMessage_readPermission() {
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	s.db.AssertMessageExist(1)
+}
+
+func (s *ShareSuite) Test_DeleteMessage_managePermission() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 5, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 5)
+	s.ctx.AddParam("id", "1")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/message/1", nil)
+	s.m.DeleteMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *ShareSuite) Test_CreateMessage_notifiesMembers() {
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 6, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 6)
+	s.withJSON("POST", "/message", `{"appid":8,"message":"deploy done"}`)
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	for _, userID := range []uint{4, 5, 6} {
+		if assert.Len(s.T(), s.notified[userID], 1, "user %d", userID) {
+			assert.Equal(s.T(), "deploy done", s.notified[userID][0].Message)
+		}
+	}
+}
+
+func (s *ShareSuite) Test_ShareNotifier_notOwner() {
+	notifier := &ShareNotifier{DB: s.db, Notifier: s}
+	notifier.Notify(6, &model.MessageExternal{ApplicationID: 8, Message: "escalated"})
+
+	assert.Len(s.T(), s.notified[6], 1)
+	assert.Empty(s.T(), s.notified[4])
+	assert.Empty(s.T(), s.notified[5])
+}
+
+func (s *ShareSuite) Test_CreateMessage_readPermission() {
+	test.WithUser(s.ctx, 5)
+	s.withJSON("POST", "/message", `{"appid":8,"message":"deploy done"}`)
+	s.m.CreateMessage(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.Empty(s.T(), s.notified)
+}
+
+func (s *ShareSuite) withJSON(method, url, body string) {
+	s.ctx.Request = httptest.NewRequest(method, url, strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
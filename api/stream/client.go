@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/gotify/server/v2/model"
 	"github.com/rs/zerolog/log"
 )
 
@@ -23,16 +22,17 @@ var writeJSON = func(conn *websocket.Conn, v any) error {
 type client struct {
 	conn    *websocket.Conn
 	onClose func(*client)
-	write   chan *model.MessageExternal
+	write   chan any
 	userID  uint
 	token   string
+	events  bool
 	once    once
 }
 
 func newClient(conn *websocket.Conn, userID uint, token string, onClose func(*client)) *client {
 	return &client{
 		conn:    conn,
-		write:   make(chan *model.MessageExternal, 1),
+		write:   make(chan any, 1),
 		userID:  userID,
 		token:   token,
 		onClose: onClose,
@@ -4,8 +4,10 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +22,7 @@ type API struct {
 	lock        sync.RWMutex
 	pingPeriod  time.Duration
 	pongTimeout time.Duration
-	upgrader    *websocket.Upgrader
+	upgrader    atomic.Pointer[websocket.Upgrader]
 }
 
 // New creates a new instance of API.
@@ -28,12 +30,18 @@ type API struct {
 // pongTimeout: is the duration after the connection will be terminated, when the client does not respond with the
 // pong command.
 func New(pingPeriod, pongTimeout time.Duration, allowedWebSocketOrigins []string) *API {
-	return &API{
+	a := &API{
 		clients:     make(map[uint][]*client),
 		pingPeriod:  pingPeriod,
 		pongTimeout: pingPeriod + pongTimeout,
-		upgrader:    newUpgrader(allowedWebSocketOrigins),
 	}
+	a.SetAllowedOrigins(allowedWebSocketOrigins)
+	return a
+}
+
+// SetAllowedOrigins replaces the allowed origins for new connections, existing connections are kept.
+func (a *API) SetAllowedOrigins(allowedWebSocketOrigins []string) {
+	a.upgrader.Store(newUpgrader(allowedWebSocketOrigins))
 }
 
 // CollectConnectedClientTokens returns all tokens of the connected clients.
@@ -49,6 +57,13 @@ func (a *API) CollectConnectedClientTokens() []string {
 	return uniq(clients)
 }
 
+// HasClients returns whether the user has at least one connected client.
+func (a *API) HasClients(userID uint) bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return len(a.clients[userID]) > 0
+}
+
 // NotifyDeletedUser closes existing connections for the given user.
 func (a *API) NotifyDeletedUser(userID uint) error {
 	a.lock.Lock()
@@ -89,6 +104,26 @@ func (a *API) Notify(userID uint, msg *model.MessageExternal) {
 	}
 }
 
+// NotifyDeletedMessages notifies the clients with the given userID, which subscribed to events, that messages were deleted.
+func (a *API) NotifyDeletedMessages(userID uint, ids []uint) {
+	a.notifyEvent(userID, &model.StreamEvent{Event: model.StreamEventMessagesDeleted, IDs: ids})
+}
+
+// NotifyAcknowledgedMessage notifies the clients with the given userID, which subscribed to events, that a message was acknowledged.
+func (a *API) NotifyAcknowledgedMessage(userID, id uint) {
+	a.notifyEvent(userID, &model.StreamEvent{Event: model.StreamEventMessageAcknowledged, IDs: []uint{id}})
+}
+
+func (a *API) notifyEvent(userID uint, event *model.StreamEvent) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	for _, c := range a.clients[userID] {
+		if c.events {
+			c.write <- event
+		}
+	}
+}
+
 func (a *API) remove(remove *client) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
@@ -114,10 +149,19 @@ func (a *API) register(client *client) {
 //
 // Websocket, return newly created messages.
 //
+// When the events parameter is set, the stream additionally contains StreamEvents,
+// for example when messages expired and were deleted or a message was acknowledged.
+//
 //	---
 //	schema: ws, wss
 //	produces: [application/json]
 //	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: events
+//	  in: query
+//	  description: whether to receive StreamEvents in addition to messages
+//	  required: false
+//	  type: boolean
 //	responses:
 //	  200:
 //	    description: Ok
@@ -140,7 +184,7 @@ func (a *API) register(client *client) {
 //	    schema:
 //	        $ref: "#/definitions/Error"
 func (a *API) Handle(ctx *gin.Context) {
-	conn, err := a.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	conn, err := a.upgrader.Load().Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
 		ctx.Error(err)
 		return
@@ -151,6 +195,7 @@ func (a *API) Handle(ctx *gin.Context) {
 		token = c.Token
 	}
 	client := newClient(conn, auth.GetUserID(ctx), token, a.remove)
+	client.events, _ = strconv.ParseBool(ctx.Query("events"))
 	a.register(client)
 	go client.startReading(a.pongTimeout)
 	go client.startWriteHandler(a.pingPeriod)
@@ -348,6 +348,8 @@ func TestCollectConnectedClientTokens(t *testing.T) {
 	ret := api.CollectConnectedClientTokens()
 	sort.Strings(ret)
 	assert.Equal(t, []string{"1-1", "1-2"}, ret)
+	assert.True(t, api.HasClients(1))
+	assert.False(t, api.HasClients(2))
 
 	userTwoConnOne := testClient(t, wsURL)
 	defer userTwoConnOne.conn.Close()
@@ -437,6 +439,39 @@ func TestMultipleClients(t *testing.T) {
 	expectNoMessage(userThree...)
 }
 
+func TestNotifyEvents(t *testing.T) {
+	mode.Set(mode.TestDev)
+
+	defer leaktest.Check(t)()
+	server, api := bootTestServer(staticUserID())
+	defer server.Close()
+	defer api.Close()
+
+	withEvents := createClient(t, wsURL(server.URL)+"?events=true")
+	defer withEvents.conn.Close()
+	withoutEvents := testClient(t, wsURL(server.URL))
+	defer withoutEvents.conn.Close()
+
+	waitForConnectedClients(api, 2)
+
+	api.NotifyDeletedMessages(2, []uint{5})
+	api.NotifyDeletedMessages(1, []uint{3, 4})
+
+	withEvents.conn.SetReadDeadline(time.Now().Add(time.Second))
+	event := &model.StreamEvent{}
+	if assert.NoError(t, withEvents.conn.ReadJSON(event)) {
+		assert.Equal(t, &model.StreamEvent{Event: "messagesDeleted", IDs: []uint{3, 4}}, event)
+	}
+	expectNoMessage(withoutEvents)
+
+	api.NotifyAcknowledgedMessage(1, 7)
+	event = &model.StreamEvent{}
+	if assert.NoError(t, withEvents.conn.ReadJSON(event)) {
+		assert.Equal(t, &model.StreamEvent{Event: "messageAcknowledged", IDs: []uint{7}}, event)
+	}
+	expectNoMessage(withoutEvents)
+}
+
 func Test_sameOrigin_returnsTrue(t *testing.T) {
 	mode.Set(mode.Prod)
 	req := httptest.NewRequest("GET", "http://example.com/stream", nil)
@@ -476,6 +511,18 @@ func Test_isAllowedOriginMatching(t *testing.T) {
 	assert.False(t, isAllowedOrigin(req, compiledAllowedOrigins))
 }
 
+func TestSetAllowedOrigins(t *testing.T) {
+	mode.Set(mode.Prod)
+	api := New(time.Second, time.Second, nil)
+	defer api.Close()
+	req := httptest.NewRequest("GET", "http://example.com/stream", nil)
+	req.Header.Set("Origin", "http://go.example.com")
+	assert.False(t, api.upgrader.Load().CheckOrigin(req))
+
+	api.SetAllowedOrigins([]string{"go\\.example\\.com"})
+	assert.True(t, api.upgrader.Load().CheckOrigin(req))
+}
+
 func Test_emptyOrigin_returnsTrue(t *testing.T) {
 	mode.Set(mode.Prod)
 	req := httptest.NewRequest("GET", "http://example.com/stream", nil)
@@ -9,3 +9,5 @@ var generateApplicationToken = auth.GenerateApplicationToken
 var generateClientToken = auth.GenerateClientToken
 
 var generateImageName = auth.GenerateImageName
+
+var generateAttachmentName = auth.GenerateImageName
@@ -0,0 +1,412 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/webhook"
+)
+
+const maxWebhookBodyBytes = 1 << 20
+
+// The WebhookDatabase interface for encapsulating database access.
+type WebhookDatabase interface {
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	GetWebhookTemplateByApplication(appID uint) (*model.WebhookTemplate, error)
+	SaveWebhookTemplate(tmpl *model.WebhookTemplate) error
+	DeleteWebhookTemplateByApplication(appID uint) error
+}
+
+// The WebhookAPI provides handlers for receiving webhooks and managing the webhook templates of applications.
+type WebhookAPI struct {
+	DB       WebhookDatabase
+	Messages *MessageAPI
+}
+
+// WebhookTemplate Params Model
+//
+// Params allowed to set a webhook template. Every field is a Go template
+// executed with the decoded JSON body of the webhook request as data.
+//
+// swagger:model WebhookTemplateParams
+type WebhookTemplateParams struct {
+	// The template for the message title. If empty or rendered empty, the application name is used.
+	//
+	// example: {{.repository.full_name}}
+	Title string `form:"title" query:"title" json:"title"`
+	// The template for the message.
+	//
+	// required: true
+	// example: {{.pusher.name}} pushed {{len .commits}} commits
+	Message string `form:"message" query:"message" json:"message" binding:"required"`
+	// The template for the priority. Must render to a number. If empty or rendered empty, the default priority of the application is used.
+	//
+	// example: {{if eq .ref "refs/heads/main"}}8{{else}}2{{end}}
+	Priority string `form:"priority" query:"priority" json:"priority"`
+	// The template for the extras. Must render to a JSON object. If empty or rendered empty, no extras are set.
+	//
+	// example: {"client::notification":{"click":{"url":{{json .compare}}}}}
+	Extras string `form:"extras" query:"extras" json:"extras"`
+}
+
+// WebhookTest Params Model
+//
+// Params for rendering a webhook template without creating a message.
+//
+// swagger:model WebhookTestParams
+type WebhookTestParams struct {
+	// The template to test. If omitted, the stored template of the application is used.
+	Template *WebhookTemplateParams `json:"template"`
+	// The sample webhook body.
+	//
+	// required: true
+	// example: {"repository":{"full_name":"gotify/server"},"pusher":{"name":"jmattheis"},"commits":[]}
+	Payload webhookPayload `json:"payload" binding:"required"`
+}
+
+// webhookPayload is a raw JSON value, it is decoded when rendering the template
+// so that numbers keep their precision.
+//
+// swagger:type object
+type webhookPayload json.RawMessage
+
+func (p *webhookPayload) UnmarshalJSON(data []byte) error {
+	return (*json.RawMessage)(p).UnmarshalJSON(data)
+}
+
+// ReceiveWebhook creates a message from a webhook request using the webhook template of the application.
+// swagger:operation POST /webhook/{token} webhook receiveWebhook
+//
+// Create a message from an arbitrary JSON body.
+//
+// The body is rendered with the webhook template of the application the token belongs to.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	parameters:
+//	- name: token
+//	  in: path
+//	  description: the application token
+//	  required: true
+//	  type: string
+//	- name: body
+//	  in: body
+//	  description: the webhook payload
+//	  required: true
+//	  schema:
+//	    type: object
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/Message"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *WebhookAPI) ReceiveWebhook(ctx *gin.Context) {
+	app := auth.GetApplication(ctx)
+	tmpl, err := a.DB.GetWebhookTemplateByApplication(app.ID)
+	if success := successOrAbort(ctx, 500, err); !success {
+		return
+	}
+	if tmpl == nil {
+		ctx.AbortWithError(404, errors.New("application has no webhook template"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		ctx.AbortWithError(400, fmt.Errorf("could not read body: %w", err))
+		return
+	}
+	message, ok := renderWebhook(ctx, tmpl, body)
+	if !ok {
+		return
+	}
+	a.Messages.createMessage(ctx, app, message, nil)
+}
+
+// GetWebhookTemplate returns the webhook template of an application.
+// swagger:operation GET /application/{id}/webhook webhook getWebhookTemplate
+//
+// Return the webhook template of an application.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/WebhookTemplate"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *WebhookAPI) GetWebhookTemplate(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		tmpl, err := a.DB.GetWebhookTemplateByApplication(app.ID)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if tmpl == nil {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d has no webhook template", app.ID))
+			return
+		}
+		ctx.JSON(200, tmpl)
+	})
+}
+
+// UpdateWebhookTemplate creates or replaces the webhook template of an application.
+// swagger:operation PUT /application/{id}/webhook webhook updateWebhookTemplate
+//
+// Create or replace the webhook template of an application.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the webhook template
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/WebhookTemplateParams"
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/WebhookTemplate"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *WebhookAPI) UpdateWebhookTemplate(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		params := WebhookTemplateParams{}
+		if err := ctx.Bind(&params); err == nil {
+			tmpl := params.toTemplate(app.ID)
+			if _, err := webhook.Compile(tmpl); err != nil {
+				ctx.AbortWithError(400, err)
+				return
+			}
+			if success := successOrAbort(ctx, 500, a.DB.SaveWebhookTemplate(tmpl)); !success {
+				return
+			}
+			ctx.JSON(200, tmpl)
+		}
+	})
+}
+
+// DeleteWebhookTemplate deletes the webhook template of an application.
+// swagger:operation DELETE /application/{id}/webhook webhook deleteWebhookTemplate
+//
+// Delete the webhook template of an application.
+//
+//	---
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *WebhookAPI) DeleteWebhookTemplate(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		successOrAbort(ctx, 500, a.DB.DeleteWebhookTemplateByApplication(app.ID))
+	})
+}
+
+// TestWebhookTemplate renders a webhook template without creating a message.
+// swagger:operation POST /application/{id}/webhook/test webhook testWebhookTemplate
+//
+// Render a webhook template against a sample body without creating a message.
+//
+//	---
+//	consumes: [application/json]
+//	produces: [application/json]
+//	security: [clientTokenAuthorizationHeader: [], clientTokenHeader: [], clientTokenQuery: [], basicAuth: []]
+//	parameters:
+//	- name: body
+//	  in: body
+//	  description: the template and sample body
+//	  required: true
+//	  schema:
+//	    $ref: "#/definitions/WebhookTestParams"
+//	- name: id
+//	  in: path
+//	  description: the application id
+//	  required: true
+//	  type: integer
+//	  format: int64
+//	responses:
+//	  200:
+//	    description: Ok
+//	    schema:
+//	        $ref: "#/definitions/CreateMessage"
+//	  400:
+//	    description: Bad Request
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  401:
+//	    description: Unauthorized
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  403:
+//	    description: Forbidden
+//	    schema:
+//	        $ref: "#/definitions/Error"
+//	  404:
+//	    description: Not Found
+//	    schema:
+//	        $ref: "#/definitions/Error"
+func (a *WebhookAPI) TestWebhookTemplate(ctx *gin.Context) {
+	a.withApplication(ctx, func(app *model.Application) {
+		params := WebhookTestParams{}
+		if err := ctx.ShouldBindJSON(&params); err != nil {
+			ctx.AbortWithError(400, err)
+			return
+		}
+
+		var tmpl *model.WebhookTemplate
+		if params.Template != nil {
+			tmpl = params.Template.toTemplate(app.ID)
+		} else {
+			stored, err := a.DB.GetWebhookTemplateByApplication(app.ID)
+			if success := successOrAbort(ctx, 500, err); !success {
+				return
+			}
+			if stored == nil {
+				ctx.AbortWithError(404, fmt.Errorf("app with id %d has no webhook template", app.ID))
+				return
+			}
+			tmpl = stored
+		}
+
+		message, ok := renderWebhook(ctx, tmpl, params.Payload)
+		if !ok {
+			return
+		}
+		applyApplicationDefaults(app, message)
+		ctx.JSON(200, message)
+	})
+}
+
+func (a *WebhookAPI) withApplication(ctx *gin.Context, f func(app *model.Application)) {
+	withID(ctx, "id", func(id uint) {
+		app, err := a.DB.GetApplicationByID(id)
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		permission, err := applicationPermission(a.DB, app, auth.GetUserID(ctx))
+		if success := successOrAbort(ctx, 500, err); !success {
+			return
+		}
+		if permission != model.SharePermissionManage {
+			ctx.AbortWithError(404, fmt.Errorf("app with id %d doesn't exists", id))
+			return
+		}
+		f(app)
+	})
+}
+
+func renderWebhook(ctx *gin.Context, tmpl *model.WebhookTemplate, body []byte) (*model.CreateMessage, bool) {
+	compiled, err := webhook.Compile(tmpl)
+	if err != nil {
+		ctx.AbortWithError(400, err)
+		return nil, false
+	}
+	message, err := compiled.Render(body)
+	if err != nil {
+		ctx.AbortWithError(400, err)
+		return nil, false
+	}
+	return message, true
+}
+
+func (p *WebhookTemplateParams) toTemplate(appID uint) *model.WebhookTemplate {
+	return &model.WebhookTemplate{
+		ApplicationID: appID,
+		Title:         p.Title,
+		Message:       p.Message,
+		Priority:      p.Priority,
+		Extras:        p.Extras,
+	}
+}
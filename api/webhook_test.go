@@ -0,0 +1,276 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestWebhookSuite(t *testing.T) {
+	suite.Run(t, new(WebhookSuite))
+}
+
+type WebhookSuite struct {
+	suite.Suite
+	db              *testdb.Database
+	a               *WebhookAPI
+	ctx             *gin.Context
+	recorder        *httptest.ResponseRecorder
+	notifiedMessage *model.MessageExternal
+}
+
+func (s *WebhookSuite) BeforeTest(suiteName, testName string) {
+	mode.Set(mode.TestDev)
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	s.db = testdb.NewDB(s.T())
+	s.notifiedMessage = nil
+	s.a = &WebhookAPI{DB: s.db, Messages: &MessageAPI{DB: s.db, Notifier: s}}
+}
+
+func (s *WebhookSuite) AfterTest(string, string) {
+	s.db.Close()
+}
+
+func (s *WebhookSuite) Notify(userID uint, msg *model.MessageExternal) {
+	s.notifiedMessage = msg
+}
+
+func (s *WebhookSuite) Test_ensureWebhookTemplateHasCorrectJsonRepresentation() {
+	actual := &model.WebhookTemplate{ApplicationID: 1, Title: "{{.a}}", Message: "{{.b}}", Priority: "5", Extras: "{}"}
+	test.JSONEquals(s.T(), actual, `{"appid":1,"title":"{{.a}}","message":"{{.b}}","priority":"5","extras":"{}"}`)
+}
+
+func (s *WebhookSuite) Test_ReceiveWebhook() {
+	app := s.db.User(4).NewAppWithTokenAndDefaultPriority(8, "app-token", 5)
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Title: "{{.repo}}", Message: "{{.user}} pushed"})
+
+	auth.RegisterApplication(s.ctx, app)
+	s.withJSON("POST", "/webhook/app-token", `{"repo":"gotify/server","user":"jmattheis"}`)
+	s.a.ReceiveWebhook(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if msgs, err := s.db.GetMessagesByApplication(8); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), "gotify/server", msgs[0].Title)
+		assert.Equal(s.T(), "jmattheis pushed", msgs[0].Message)
+		assert.Equal(s.T(), 5, msgs[0].Priority)
+	}
+	if assert.NotNil(s.T(), s.notifiedMessage) {
+		assert.Equal(s.T(), "jmattheis pushed", s.notifiedMessage.Message)
+	}
+}
+
+func (s *WebhookSuite) Test_ReceiveWebhook_withoutTemplate() {
+	app := s.db.User(4).NewAppWithToken(8, "app-token")
+
+	auth.RegisterApplication(s.ctx, app)
+	s.withJSON("POST", "/webhook/app-token", `{"user":"jmattheis"}`)
+	s.a.ReceiveWebhook(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+	assert.Nil(s.T(), s.notifiedMessage)
+}
+
+func (s *WebhookSuite) Test_ReceiveWebhook_invalidBody() {
+	app := s.db.User(4).NewAppWithToken(8, "app-token")
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Message: "{{.user}}"})
+
+	auth.RegisterApplication(s.ctx, app)
+	s.withJSON("POST", "/webhook/app-token", `user=jmattheis`)
+	s.a.ReceiveWebhook(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *WebhookSuite) Test_ReceiveWebhook_bodyTooLarge() {
+	app := s.db.User(4).NewAppWithToken(8, "app-token")
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Message: "{{.user}}"})
+
+	auth.RegisterApplication(s.ctx, app)
+	s.withJSON("POST", "/webhook/app-token", `{"user":"`+strings.Repeat("a", maxWebhookBodyBytes)+`"}`)
+	s.a.ReceiveWebhook(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	s.db.AssertMessageNotExist(1)
+}
+
+func (s *WebhookSuite) Test_UpdateWebhookTemplate() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/webhook", `{"title":"{{.repo}}","message":"{{.user}}","priority":"{{.level}}"}`)
+	s.a.UpdateWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if tmpl, err := s.db.GetWebhookTemplateByApplication(8); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), &model.WebhookTemplate{ApplicationID: 8, Title: "{{.repo}}", Message: "{{.user}}", Priority: "{{.level}}"}, tmpl)
+	}
+}
+
+func (s *WebhookSuite) Test_UpdateWebhookTemplate_invalidTemplate() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/webhook", `{"message":"{{.user"}`)
+	s.a.UpdateWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	if tmpl, err := s.db.GetWebhookTemplateByApplication(8); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), tmpl)
+	}
+}
+
+func (s *WebhookSuite) Test_UpdateWebhookTemplate_otherUser() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/webhook", `{"message":"{{.user}}"}`)
+	s.a.UpdateWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *WebhookSuite) Test_UpdateWebhookTemplate_managePermission() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 4, Permission: model.SharePermissionManage})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/webhook", `{"message":"{{.user}}"}`)
+	s.a.UpdateWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+}
+
+func (s *WebhookSuite) Test_UpdateWebhookTemplate_readPermission() {
+	s.db.User(4)
+	s.db.User(5).App(8)
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: 8, UserID: 4, Permission: model.SharePermissionRead})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("PUT", "/application/8/webhook", `{"message":"{{.user}}"}`)
+	s.a.UpdateWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *WebhookSuite) Test_GetWebhookTemplate() {
+	user := s.db.User(4)
+	user.App(8)
+	user.App(9)
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Message: "{{.user}}"})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/8/webhook", nil)
+	s.a.GetWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.WebhookTemplate{ApplicationID: 8, Message: "{{.user}}"}, s.recorder)
+
+	s.recorder = httptest.NewRecorder()
+	s.ctx, _ = gin.CreateTestContext(s.recorder)
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "9")
+	s.ctx.Request = httptest.NewRequest("GET", "/application/9/webhook", nil)
+	s.a.GetWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *WebhookSuite) Test_DeleteWebhookTemplate() {
+	s.db.User(4).App(8)
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Message: "{{.user}}"})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.ctx.Request = httptest.NewRequest("DELETE", "/application/8/webhook", nil)
+	s.a.DeleteWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	if tmpl, err := s.db.GetWebhookTemplateByApplication(8); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), tmpl)
+	}
+}
+
+func (s *WebhookSuite) Test_TestWebhookTemplate_withTemplate() {
+	s.db.User(4).NewAppWithTokenAndDefaultPriority(8, "app-token", 5)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("POST", "/application/8/webhook/test", `{"template":{"message":"{{.user}} pushed"},"payload":{"user":"jmattheis"}}`)
+	s.a.TestWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.CreateMessage{ApplicationID: 8, Message: "jmattheis pushed", Priority: intPtr(5)}, s.recorder)
+	s.db.AssertMessageNotExist(1)
+	assert.Nil(s.T(), s.notifiedMessage)
+}
+
+func (s *WebhookSuite) Test_TestWebhookTemplate_storedTemplate() {
+	s.db.User(4).App(8)
+	s.db.SaveWebhookTemplate(&model.WebhookTemplate{ApplicationID: 8, Title: "{{.repo}}", Message: "{{.user}}", Priority: "7"})
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("POST", "/application/8/webhook/test", `{"payload":{"user":"jmattheis","repo":"gotify/server"}}`)
+	s.a.TestWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 200, s.recorder.Code)
+	test.BodyEquals(s.T(), &model.CreateMessage{ApplicationID: 8, Message: "jmattheis", Title: "gotify/server", Priority: intPtr(7)}, s.recorder)
+}
+
+func (s *WebhookSuite) Test_TestWebhookTemplate_noStoredTemplate() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("POST", "/application/8/webhook/test", `{"payload":{"user":"jmattheis"}}`)
+	s.a.TestWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 404, s.recorder.Code)
+}
+
+func (s *WebhookSuite) Test_TestWebhookTemplate_renderError() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("POST", "/application/8/webhook/test", `{"template":{"message":"x","priority":"{{.user}}"},"payload":{"user":"jmattheis"}}`)
+	s.a.TestWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+	assert.Contains(s.T(), s.ctx.Errors.String(), `priority template must render to a number, got "jmattheis"`)
+}
+
+func (s *WebhookSuite) Test_TestWebhookTemplate_missingPayload() {
+	s.db.User(4).App(8)
+
+	test.WithUser(s.ctx, 4)
+	s.ctx.AddParam("id", "8")
+	s.withJSON("POST", "/application/8/webhook/test", `{"template":{"message":"x"}}`)
+	s.a.TestWebhookTemplate(s.ctx)
+
+	assert.Equal(s.T(), 400, s.recorder.Code)
+}
+
+func (s *WebhookSuite) withJSON(method, url, body string) {
+	s.ctx.Request = httptest.NewRequest(method, url, strings.NewReader(body))
+	s.ctx.Request.Header.Set("Content-Type", "application/json")
+}
@@ -62,6 +62,20 @@ func run(args []string, stdout, stderr io.Writer) int {
 			fmt.Fprintln(stdout, b)
 		}
 		return 0
+	case "backup":
+		return backupCommand(fs.Arg(1), stdout, stderr)
+	case "restore":
+		return restoreCommand(fs.Arg(1), stdout, stderr)
+	case "db":
+		return dbCommand(fs.Args()[1:], stdout, stderr)
+	case "config":
+		return configCommand(fs.Args()[1:], stdout, stderr)
+	case "send":
+		return sendCommand(fs.Args()[1:], stdout, stderr)
+	case "user":
+		return userCommand(fs.Args()[1:], stdout, stderr)
+	case "migrate-db":
+		return migrateDBCommand(fs.Args()[1:], stdout, stderr)
 	case "migrate-config":
 		content, err := migrate.Config(fs.Arg(1))
 		if err != nil {
@@ -83,7 +97,9 @@ func serve(vInfo *model.VersionInfo) int {
 	mode.Set(Mode)
 
 	conf, futureLogs := config.Get()
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339, NoColor: noColor(conf.NoColor)}).Level(zerolog.Level(conf.LogLevel))
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339, NoColor: noColor(conf.NoColor)})
+	// the global level is changed when the configuration is reloaded
+	zerolog.SetGlobalLevel(conf.LogLevel.AsZeroLogLevel())
 	log.Info().Str("version", vInfo.Version).Str("build_date", BuildDate).Msg("Gotify")
 
 	exit := false
@@ -105,29 +121,109 @@ func serve(vInfo *model.VersionInfo) int {
 		log.Error().Err(err).Str("dir", conf.UploadedImagesDir).Msg("Cannot create uploaded images directory")
 		return 1
 	}
+	if err := os.MkdirAll(conf.Attachments.Dir, 0o755); err != nil {
+		log.Error().Err(err).Str("dir", conf.Attachments.Dir).Msg("Cannot create attachments directory")
+		return 1
+	}
 
-	db, err := database.New(conf.Database.Dialect, conf.Database.Connection, conf.DefaultUser.Name, conf.DefaultUser.Pass, conf.PassStrength, true, time.Now)
+	db, err := database.New(conf.Database.Dialect, conf.Database.Connection, databasePool(conf), conf.DefaultUser.Name, conf.DefaultUser.Pass, conf.PassStrength, true, time.Now)
 	if err != nil {
 		log.Error().Err(err).Msg("Cannot initialize database")
 		return 1
 	}
 	defer db.Close()
 
-	engine, closeable := router.Create(db, vInfo, conf)
+	engine, closeable, reload := router.Create(db, vInfo, conf)
 	defer closeable()
 
-	if err := runner.Run(engine, conf); err != nil {
+	if err := runner.Run(engine, conf, reload); err != nil {
 		log.Error().Err(err).Msg("Server error")
 		return 1
 	}
 	return 0
 }
 
+// loadCommandConfig loads the config for commands other than serve, configuration errors are printed to stderr.
+func loadCommandConfig(stderr io.Writer) (*config.Configuration, bool) {
+	mode.Set(Mode)
+	conf, futureLogs := config.Get()
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: stderr, TimeFormat: time.RFC3339, NoColor: true}).Level(zerolog.WarnLevel)
+
+	ok := true
+	for _, futureLog := range futureLogs {
+		if futureLog.Level == zerolog.FatalLevel || futureLog.Level == zerolog.PanicLevel {
+			fmt.Fprintln(stderr, futureLog.Msg)
+			ok = false
+		}
+	}
+	return conf, ok
+}
+
+// openCommandDatabase loads the config and opens the migrated database for commands other than serve.
+func openCommandDatabase(stderr io.Writer) (*config.Configuration, *database.GormDatabase, bool) {
+	conf, ok := loadCommandConfig(stderr)
+	if !ok {
+		return nil, nil, false
+	}
+	db, err := database.New(conf.Database.Dialect, conf.Database.Connection, databasePool(conf), conf.DefaultUser.Name, conf.DefaultUser.Pass, conf.PassStrength, false, time.Now)
+	if err != nil {
+		fmt.Fprintln(stderr, "Cannot initialize database:", err)
+		return nil, nil, false
+	}
+	return conf, db, true
+}
+
+func databasePool(conf *config.Configuration) database.Pool {
+	return database.Pool{
+		MaxOpenConns:      conf.Database.MaxOpenConns,
+		MaxIdleConns:      conf.Database.MaxIdleConns,
+		ConnMaxLifetime:   time.Duration(conf.Database.ConnMaxLifetimeSeconds) * time.Second,
+		ConnMaxIdleTime:   time.Duration(conf.Database.ConnMaxIdleTimeSeconds) * time.Second,
+		SQLiteWAL:         conf.Database.SQLite.WAL,
+		SQLiteBusyTimeout: time.Duration(conf.Database.SQLite.BusyTimeoutMillis) * time.Millisecond,
+		SQLiteReadConns:   conf.Database.SQLite.ReadConns,
+	}
+}
+
 func printUsage(w io.Writer) {
 	fmt.Fprint(w, `Usage: gotify [flags] <command> [arguments]
 
 Commands:
   serve                       Start the Gotify server.
+  backup <file>               Write an archive of the database, the uploaded
+                              images and the attachments. Can be run while
+                              the server is running, use - for stdout.
+  restore <file>              Replace all data with the content of a backup
+                              archive. Stop the server before restoring.
+  db status                   Show the schema version and the migrations.
+  db migrate [--dry-run]      Apply the pending schema changes and migrations,
+                              with --dry-run only show them. Migrations are
+                              also applied on start of the server.
+  config check                Report invalid values, unknown GOTIFY_*
+                              variables and conflicting settings.
+  config print                Show the effective configuration with the
+                              source of every value, secrets are masked.
+  send [--app-token <token>|--app-id <id>] [--title <title>] [--priority <n>] [--url <url>] [message|-]
+                              Send a message to the running server, the
+                              message is read from stdin if it's - or not
+                              given. Without --url the server listener of the
+                              configuration is used, including unix sockets.
+                              With --app-id the application token is read
+                              from the configured database.
+  user list                   List all users.
+  user create [--admin] [--password <password>] <name>
+                              Create a user, the password is read from stdin
+                              if --password isn't set.
+  user set-password [--password <password>] <name>
+                              Change the password of a user.
+  user set-admin <name> true|false
+                              Grant or revoke the admin permission.
+  user delete <name>          Delete a user with all applications, clients
+                              and messages.
+  migrate-db --from <dialect>:<connection> --to <dialect>:<connection> [--force]
+                              Copy all data to another database, f.ex. from
+                              sqlite3 to postgres. Stop the server before
+                              migrating.
   migrate-config <file.yml>   Convert an old YAML config file to the new env
                               format and print it to stdout.
   version                     Show version information
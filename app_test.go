@@ -2,9 +2,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gotify/server/v2/auth/password"
+	"github.com/gotify/server/v2/database"
+	"github.com/gotify/server/v2/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRun(t *testing.T) {
@@ -29,3 +42,276 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestBackupAndRestoreCommands(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOTIFY_DATABASE_DIALECT", "sqlite3")
+	t.Setenv("GOTIFY_DATABASE_CONNECTION", filepath.Join(dir, "gotify.db"))
+	t.Setenv("GOTIFY_UPLOADEDIMAGESDIR", filepath.Join(dir, "images"))
+	t.Setenv("GOTIFY_ATTACHMENTS_DIR", filepath.Join(dir, "attachments"))
+	db, err := database.New("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, "admin", "pw", 5, true, time.Now)
+	require.NoError(t, err)
+	db.Close()
+	archive := filepath.Join(dir, "backup.tar.gz")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"backup", archive}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "Backup written to")
+	assert.Equal(t, 1, run([]string{"backup", archive}, &stdout, &stderr), "existing files are not overwritten")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "gotify.db")))
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 0, run([]string{"restore", archive}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "Restored backup")
+
+	db, err = database.New("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, "admin", "pw", 5, false, time.Now)
+	require.NoError(t, err)
+	defer db.Close()
+	user, err := db.GetUserByName("admin")
+	require.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func TestBackupAndRestoreCommands_invalidArguments(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"backup"}, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"restore"}, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"restore", filepath.Join(t.TempDir(), "missing.tar.gz")}, &stdout, &stderr))
+}
+
+func TestMigrateDBCommand(t *testing.T) {
+	dir := t.TempDir()
+	source, err := database.New("sqlite3", filepath.Join(dir, "source.db"), database.Pool{}, "admin", "pw", 5, true, time.Now)
+	require.NoError(t, err)
+	source.Close()
+	from := "--from=sqlite3:" + filepath.Join(dir, "source.db")
+	to := "--to=sqlite3:" + filepath.Join(dir, "target.db")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"migrate-db", from, to}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "users")
+	assert.Contains(t, stdout.String(), "Copied all tables from sqlite3 to sqlite3")
+
+	stderr.Reset()
+	assert.Equal(t, 1, run([]string{"migrate-db", from, to}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "--force")
+	assert.Equal(t, 0, run([]string{"migrate-db", from, to, "--force"}, &stdout, &stderr), stderr.String())
+
+	target, err := database.New("sqlite3", filepath.Join(dir, "target.db"), database.Pool{}, "", "", 5, false, time.Now)
+	require.NoError(t, err)
+	defer target.Close()
+	user, err := target.GetUserByName("admin")
+	require.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func TestMigrateDBCommand_invalidArguments(t *testing.T) {
+	dir := t.TempDir()
+	cases := [][]string{
+		{"migrate-db"},
+		{"migrate-db", "--from=sqlite3:a.db"},
+		{"migrate-db", "--from=oracle:a", "--to=sqlite3:b.db"},
+		{"migrate-db", "--from=sqlite3:a.db", "--to=sqlite3:a.db"},
+	}
+	for _, args := range cases {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(args, &stdout, &stderr), args)
+	}
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"migrate-db", "--from=sqlite3:" + filepath.Join(dir, "missing.db"), "--to=sqlite3:" + filepath.Join(dir, "target.db")}, &stdout, &stderr))
+	assert.NoFileExists(t, filepath.Join(dir, "missing.db"))
+}
+
+func TestDBCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOTIFY_DATABASE_DIALECT", "sqlite3")
+	t.Setenv("GOTIFY_DATABASE_CONNECTION", filepath.Join(dir, "gotify.db"))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"db", "status"}, &stdout, &stderr))
+	assert.NoFileExists(t, filepath.Join(dir, "gotify.db"))
+
+	old, err := database.Open("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, time.Now)
+	require.NoError(t, err)
+	require.NoError(t, old.DB.AutoMigrate(database.Models()...))
+	old.Close()
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"db", "status"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), fmt.Sprintf("Schema version: 0 (latest: %d)", database.LatestSchemaVersion()))
+	assert.Contains(t, stdout.String(), "pending")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"db", "migrate", "--dry-run"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "Would apply 1: fill missing application sort keys")
+	assert.Contains(t, stdout.String(), "Would create table schema_migrations")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"db", "migrate"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), fmt.Sprintf("Migrated to schema version %d", database.LatestSchemaVersion()))
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"db", "status"}, &stdout, &stderr), stderr.String())
+	assert.NotContains(t, stdout.String(), "pending")
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"db", "migrate", "--dry-run"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "No pending migrations.")
+
+	assert.Equal(t, 2, run([]string{"db"}, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"db", "drop"}, &stdout, &stderr))
+}
+
+func TestUserCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOTIFY_DATABASE_DIALECT", "sqlite3")
+	t.Setenv("GOTIFY_DATABASE_CONNECTION", filepath.Join(dir, "gotify.db"))
+	t.Setenv("GOTIFY_DEFAULTUSER_NAME", "admin")
+	t.Setenv("GOTIFY_DEFAULTUSER_PASS", "pw")
+	t.Setenv("GOTIFY_PLUGINSDIR", "")
+	db, err := database.New("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, "admin", "pw", 5, true, time.Now)
+	require.NoError(t, err)
+	db.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"user", "create", "--password", "secret", "alice"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "Created user alice with id 2")
+	assert.Equal(t, 1, run([]string{"user", "create", "--password", "secret", "alice"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "username already exists")
+
+	passwordInput = strings.NewReader("from-stdin\n")
+	defer func() { passwordInput = os.Stdin }()
+	assert.Equal(t, 0, run([]string{"user", "set-password", "alice"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, 0, run([]string{"user", "set-admin", "alice", "true"}, &stdout, &stderr), stderr.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"user", "list"}, &stdout, &stderr), stderr.String())
+	assert.Regexp(t, `1\s+admin\s+true`, stdout.String())
+	assert.Regexp(t, `2\s+alice\s+true`, stdout.String())
+
+	assert.Equal(t, 0, run([]string{"user", "delete", "admin"}, &stdout, &stderr), stderr.String())
+	stderr.Reset()
+	assert.Equal(t, 1, run([]string{"user", "set-admin", "alice", "false"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "cannot delete last admin")
+	assert.Equal(t, 1, run([]string{"user", "delete", "bob"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `user "bob" does not exist`)
+
+	db, err = database.New("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, "", "", 5, false, time.Now)
+	require.NoError(t, err)
+	defer db.Close()
+	users, err := db.GetUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Name)
+	assert.True(t, password.ComparePassword(users[0].Pass, []byte("from-stdin")))
+}
+
+func TestUserCommand_invalidArguments(t *testing.T) {
+	cases := [][]string{
+		{"user"},
+		{"user", "bogus"},
+		{"user", "create"},
+		{"user", "create", "alice", "bob"},
+		{"user", "set-admin", "alice"},
+		{"user", "set-admin", "alice", "maybe"},
+		{"user", "list", "alice"},
+	}
+	for _, args := range cases {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(args, &stdout, &stderr), args)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/message", r.URL.Path)
+		if r.Header.Get("X-Gotify-Key") != "app-token" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":"Unauthorized","errorCode":401,"errorDescription":"invalid token"}`))
+			return
+		}
+		received = map[string]any{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"send", "--url", server.URL, "--app-token", "app-token", "--title", "backup", "--priority", "0", "done"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "Sent message 7\n", stdout.String())
+	assert.Equal(t, map[string]any{"title": "backup", "message": "done", "priority": float64(0)}, received)
+
+	messageInput = strings.NewReader("from\nstdin\n")
+	defer func() { messageInput = os.Stdin }()
+	assert.Equal(t, 0, run([]string{"send", "--url", server.URL, "--app-token", "app-token", "-"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, map[string]any{"message": "from\nstdin"}, received, "the priority of the application is used")
+
+	assert.Equal(t, 1, run([]string{"send", "--url", server.URL, "--app-token", "wrong", "hello"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "401 Unauthorized: invalid token")
+}
+
+func TestSendCommand_unixSocketAndAppID(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "gotify.sock")
+	t.Setenv("GOTIFY_SERVER_LISTENADDR", "unix:"+socket)
+	t.Setenv("GOTIFY_DATABASE_DIALECT", "sqlite3")
+	t.Setenv("GOTIFY_DATABASE_CONNECTION", filepath.Join(dir, "gotify.db"))
+	db, err := database.New("sqlite3", filepath.Join(dir, "gotify.db"), database.Pool{}, "admin", "pw", 5, true, time.Now)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateApplication(&model.Application{UserID: 1, Token: "Afromdb", Name: "backup"}))
+	db.Close()
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Afromdb", r.Header.Get("X-Gotify-Key"))
+		w.Write([]byte(`{"id":3}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"send", "--app-id", "1", "hello"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "Sent message 3\n", stdout.String())
+	assert.Equal(t, 1, run([]string{"send", "--app-id", "2", "hello"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "application with id 2 does not exist")
+}
+
+func TestSendCommand_invalidArguments(t *testing.T) {
+	cases := [][]string{
+		{"send", "hello"},
+		{"send", "--app-token", "a", "--app-id", "1", "hello"},
+		{"send", "--app-token", "a", "hello", "world"},
+		{"send", "--app-token", "a", "--priority", "high", "hello"},
+	}
+	for _, args := range cases {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(args, &stdout, &stderr), args)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	t.Setenv("GOTIFY_SERVER_SSL_CERTFIEL", "cert.pem")
+	t.Setenv("GOTIFY_DEFAULTUSER_PASS", "secret")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"config", "check"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "warning: unknown variable GOTIFY_SERVER_SSL_CERTFIEL, did you mean GOTIFY_SERVER_SSL_CERTFILE?")
+	assert.Contains(t, stdout.String(), "The configuration is valid.")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"config", "print"}, &stdout, &stderr), stderr.String())
+	assert.Regexp(t, `GOTIFY_DEFAULTUSER_PASS\s+\*{8}\s+env`, stdout.String())
+	assert.Regexp(t, `GOTIFY_SERVER_PORT\s+80\s+default`, stdout.String())
+	assert.NotContains(t, stdout.String(), "secret")
+
+	t.Setenv("GOTIFY_SERVER_PORT", "http")
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"config", "check"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `error: invalid int for GOTIFY_SERVER_PORT ("http")`)
+
+	assert.Equal(t, 2, run([]string{"config"}, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"config", "lint"}, &stdout, &stderr))
+}
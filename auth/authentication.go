@@ -77,6 +77,15 @@ func (a *Auth) RequireApplicationToken(ctx *gin.Context) {
 	a.abort401(ctx)
 }
 
+// RequireApplicationTokenParam returns a gin middleware which requires an application token to be supplied as path parameter.
+func (a *Auth) RequireApplicationTokenParam(param string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		a.evaluateOr401(ctx, func(ctx *gin.Context) (authState, error) {
+			return a.handleApplicationToken(ctx, ctx.Param(param), false)
+		})
+	}
+}
+
 // RequireAny requires client, application, or basic auth.
 func (a *Auth) RequireApplicationOrClient(ctx *gin.Context) {
 	a.evaluateOr401(ctx, a.handleApplication, a.handleClient(), a.handleUser())
@@ -210,6 +219,10 @@ func (a *Auth) handleClient(checks ...func(*model.Client) (authState, error)) fu
 
 func (a *Auth) handleApplication(ctx *gin.Context) (authState, error) {
 	token, isCookie := a.readTokenFromRequest(ctx)
+	return a.handleApplicationToken(ctx, token, isCookie)
+}
+
+func (a *Auth) handleApplicationToken(ctx *gin.Context, token string, isCookie bool) (authState, error) {
 	originalToken := token
 	if token == "" {
 		return authStateSkip, nil
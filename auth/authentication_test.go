@@ -129,6 +129,33 @@ func (s *AuthenticationSuite) assertQueryRequest(key, value string, f fMiddlewar
 	return ctx
 }
 
+func (s *AuthenticationSuite) TestPathParamToken() {
+	s.assertParamRequest("ergerogerg", 401)
+	s.assertParamRequest("", 401)
+	s.assertParamRequest("clienttoken", 401)
+	if ctx := s.assertParamRequest("apptoken", 200); s.NotNil(GetApplication(ctx)) {
+		s.Equal("backup server1", GetApplication(ctx).Name)
+	}
+
+	// the token is only read from the path
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("POST", "/webhook/?token=apptoken", nil)
+	ctx.Request.Header.Set("X-Gotify-Key", "apptoken")
+	s.auth.RequireApplicationTokenParam("token")(ctx)
+	assert.Equal(s.T(), 401, recorder.Code)
+}
+
+func (s *AuthenticationSuite) assertParamRequest(token string, code int) (ctx *gin.Context) {
+	recorder := httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("POST", "/webhook/"+token, nil)
+	ctx.AddParam("token", token)
+	s.auth.RequireApplicationTokenParam("token")(ctx)
+	assert.Equal(s.T(), code, recorder.Code)
+	return ctx
+}
+
 func (s *AuthenticationSuite) TestNothingProvided() {
 	recorder := httptest.NewRecorder()
 	ctx, _ := gin.CreateTestContext(recorder)
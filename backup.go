@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gotify/server/v2/backup"
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/database"
+)
+
+func backupCommand(file string, stdout, stderr io.Writer) int {
+	if file == "" {
+		fmt.Fprintln(stderr, "gotify backup: missing archive file, use - to write to stdout")
+		return 2
+	}
+	conf, db, ok := openCommandDatabase(stderr)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	out := stdout
+	if file != "-" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify backup:", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := newBackup(conf, db).Write(out); err != nil {
+		fmt.Fprintln(stderr, "gotify backup:", err)
+		if file != "-" {
+			os.Remove(file)
+		}
+		return 1
+	}
+	if file != "-" {
+		fmt.Fprintln(stdout, "Backup written to", file)
+	}
+	return 0
+}
+
+func restoreCommand(file string, stdout, stderr io.Writer) int {
+	if file == "" {
+		fmt.Fprintln(stderr, "gotify restore: missing archive file, use - to read from stdin")
+		return 2
+	}
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify restore:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	conf, db, ok := openCommandDatabase(stderr)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	manifest, err := newBackup(conf, db).Restore(in)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify restore:", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Restored backup of Gotify %s created at %s\n", manifest.Version, manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	return 0
+}
+
+func newBackup(conf *config.Configuration, db *database.GormDatabase) *backup.Backup {
+	return &backup.Backup{
+		DB:             db.DB,
+		ImagesDir:      conf.UploadedImagesDir,
+		AttachmentsDir: conf.Attachments.Dir,
+		Version:        Version,
+	}
+}
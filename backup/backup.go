@@ -0,0 +1,385 @@
+// Package backup creates and restores archives containing all data of a gotify server.
+//
+// An archive is a gzip compressed tar file. It contains a manifest, one gob encoded stream of
+// rows per database table and the uploaded images and attachments. The rows are encoded with the
+// model types, therefore an archive can be restored into a database with a different dialect.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gotify/server/v2/database"
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// FormatVersion is the version of the archive format, it is increased on incompatible changes.
+const FormatVersion = 1
+
+const (
+	manifestFile      = "manifest.json"
+	tablesPrefix      = "tables/"
+	imagesPrefix      = "images/"
+	attachmentsPrefix = "attachments/"
+	restoreBatchSize  = 100
+)
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format    int       `json:"format"`
+	Version   string    `json:"version"`
+	Dialect   string    `json:"dialect"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Backup creates and restores archives of a database and the uploaded files.
+type Backup struct {
+	DB             *gorm.DB
+	ImagesDir      string
+	AttachmentsDir string
+	// Version is the gotify version written into the manifest.
+	Version string
+}
+
+// Write writes an archive of all tables and uploaded files to w.
+// The tables are read in one transaction, so the archive is consistent while the server is running.
+func (b *Backup) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	manifest, err := json.Marshal(&Manifest{Format: FormatVersion, Version: b.Version, Dialect: b.DB.Dialector.Name(), CreatedAt: now.UTC()})
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, manifestFile, now, manifest); err != nil {
+		return err
+	}
+
+	// the tables are spooled to temporary files and written after the transaction,
+	// otherwise a slow client would keep the transaction open.
+	var tables []*spooledTable
+	defer func() {
+		for _, table := range tables {
+			table.remove()
+		}
+	}()
+	var images, attachments []string
+	err = b.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range database.Models() {
+			name, err := database.TableName(tx, m)
+			if err != nil {
+				return err
+			}
+			table, err := spoolTable(tx, m, tablesPrefix+name+".gob")
+			if err != nil {
+				return fmt.Errorf("table %s: %w", name, err)
+			}
+			tables = append(tables, table)
+		}
+		if err := tx.Model(new(model.Application)).Where("image != ''").Pluck("image", &images).Error; err != nil {
+			return err
+		}
+		return tx.Model(new(model.Attachment)).Pluck("file", &attachments).Error
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: b.DB.Dialector.Name() != "sqlite"})
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := table.write(tw, now); err != nil {
+			return err
+		}
+	}
+	if err := writeFiles(tw, imagesPrefix, b.ImagesDir, images); err != nil {
+		return err
+	}
+	if err := writeFiles(tw, attachmentsPrefix, b.AttachmentsDir, attachments); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore replaces all tables with the content of the archive and stores the contained files.
+// The tables are replaced in one transaction, if the archive is invalid the database is left unchanged.
+func (b *Backup) Restore(r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestFile {
+		return nil, errors.New("not a backup archive: missing manifest")
+	}
+	manifest := &Manifest{}
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Format != FormatVersion {
+		return nil, fmt.Errorf("unsupported backup format %d, expected %d", manifest.Format, FormatVersion)
+	}
+
+	tables := map[string]any{}
+	for _, m := range database.Models() {
+		name, err := database.TableName(b.DB, m)
+		if err != nil {
+			return nil, err
+		}
+		tables[name] = m
+	}
+
+	// the files are moved into place after the tables were restored, a failed restore leaves no files behind.
+	staged := &stagedFiles{dirs: map[string]string{}, files: map[string]string{}}
+	defer staged.cleanup()
+	err = b.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range database.Models() {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(header.Name, tablesPrefix):
+				name := strings.TrimSuffix(strings.TrimPrefix(header.Name, tablesPrefix), ".gob")
+				m, ok := tables[name]
+				if !ok {
+					return fmt.Errorf("unknown table %s", name)
+				}
+				if err := restoreTable(tx, m, tr); err != nil {
+					return fmt.Errorf("table %s: %w", name, err)
+				}
+			case strings.HasPrefix(header.Name, imagesPrefix):
+				if err := staged.add(b.ImagesDir, strings.TrimPrefix(header.Name, imagesPrefix), tr); err != nil {
+					return err
+				}
+			case strings.HasPrefix(header.Name, attachmentsPrefix):
+				if err := staged.add(b.AttachmentsDir, strings.TrimPrefix(header.Name, attachmentsPrefix), tr); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected file %s", header.Name)
+			}
+		}
+		return database.ResetSequences(tx)
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	if err := staged.commit(); err != nil {
+		return nil, fmt.Errorf("the database was restored, but the files could not be moved: %w", err)
+	}
+	return manifest, nil
+}
+
+// spooledTable is a table encoded into a temporary file, because the size of a tar entry must be known
+// before its content is written.
+type spooledTable struct {
+	name string
+	file *os.File
+	size int64
+}
+
+func spoolTable(tx *gorm.DB, m any, name string) (*spooledTable, error) {
+	tmp, err := os.CreateTemp("", "gotify-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	table := &spooledTable{name: name, file: tmp}
+	if table.size, err = encodeRows(tx, m, tmp); err != nil {
+		table.remove()
+		return nil, err
+	}
+	return table, nil
+}
+
+func encodeRows(tx *gorm.DB, m any, w io.WriteSeeker) (int64, error) {
+	rows, err := tx.Model(m).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	encoder := gob.NewEncoder(w)
+	for rows.Next() {
+		row := newRow(m)
+		if err := tx.ScanRows(rows, row); err != nil {
+			return 0, err
+		}
+		if err := encoder.Encode(row); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return w.Seek(0, io.SeekCurrent)
+}
+
+func (t *spooledTable) write(tw *tar.Writer, modTime time.Time) error {
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: t.name, Mode: 0o644, Size: t.size, ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, t.file)
+	return err
+}
+
+func (t *spooledTable) remove() {
+	t.file.Close()
+	os.Remove(t.file.Name())
+}
+
+func restoreTable(tx *gorm.DB, m any, r io.Reader) error {
+	decoder := gob.NewDecoder(r)
+	batch := database.NewBatch(m, restoreBatchSize)
+	for {
+		// gob omits zero values, every row must be decoded into a new value.
+		row := newRow(m)
+		err := decoder.Decode(row)
+		if err == io.EOF {
+			return batch.Flush(tx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := batch.Add(tx, row); err != nil {
+			return err
+		}
+	}
+}
+
+// newRow returns a new value of the model type m points to.
+func newRow(m any) any {
+	return reflect.New(reflect.TypeOf(m).Elem()).Interface()
+}
+
+func writeEntry(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeFiles(tw *tar.Writer, prefix, dir string, files []string) error {
+	for _, file := range files {
+		if !validFileName(file) {
+			continue
+		}
+		if err := writeFile(tw, prefix+file, dir+file); err != nil {
+			if os.IsNotExist(err) {
+				// the file was deleted after the transaction ended or is missing since before.
+				log.Warn().Str("file", dir+file).Msg("Skipping missing file in backup")
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// stagedFiles holds restored files in temporary directories next to their target directories.
+type stagedFiles struct {
+	// dirs maps the target directories to their staging directories.
+	dirs map[string]string
+	// files maps the staged files to their targets.
+	files map[string]string
+}
+
+func (s *stagedFiles) add(dir, name string, r io.Reader) error {
+	if !validFileName(name) {
+		return fmt.Errorf("invalid file name %s", name)
+	}
+	staging, ok := s.dirs[dir]
+	if !ok {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		var err error
+		if staging, err = os.MkdirTemp(dir, ".restore-"); err != nil {
+			return err
+		}
+		s.dirs[dir] = staging
+	}
+	file := filepath.Join(staging, name)
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	s.files[file] = dir + name
+	return f.Close()
+}
+
+// commit moves the staged files to their target directories.
+func (s *stagedFiles) commit() error {
+	for file, target := range s.files {
+		if err := os.Rename(file, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanup removes the staging directories and the files which weren't moved.
+func (s *stagedFiles) cleanup() {
+	for _, staging := range s.dirs {
+		os.RemoveAll(staging)
+	}
+}
+
+// validFileName prevents files outside of the target directory from being written.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && path.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/database"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	sourceDir := test.NewTmpDir("gotify_backup_source")
+	defer sourceDir.Clean()
+	targetDir := test.NewTmpDir("gotify_backup_target")
+	defer targetDir.Clean()
+
+	source := testdb.NewDBWithDefaultUser(t)
+	defer source.Close()
+	fillDatabase(t, source)
+	require.NoError(t, os.WriteFile(sourceDir.Path("icon.png"), []byte("icon"), 0o644))
+	require.NoError(t, os.WriteFile(sourceDir.Path("file.pdf"), []byte("attachment"), 0o644))
+	require.NoError(t, os.WriteFile(sourceDir.Path("unreferenced.png"), []byte("unreferenced"), 0o644))
+
+	var archive bytes.Buffer
+	sourceBackup := &Backup{DB: source.DB, ImagesDir: sourceDir.Path() + "/", AttachmentsDir: sourceDir.Path() + "/", Version: "2.0.0"}
+	require.NoError(t, sourceBackup.Write(&archive))
+
+	target := testdb.NewDBWithDefaultUser(t)
+	defer target.Close()
+	target.User(7).App(9).Message(12)
+	targetBackup := &Backup{DB: target.DB, ImagesDir: targetDir.Path("images") + "/", AttachmentsDir: targetDir.Path("attachments") + "/"}
+	manifest, err := targetBackup.Restore(&archive)
+	require.NoError(t, err)
+	assert.Equal(t, FormatVersion, manifest.Format)
+	assert.Equal(t, "2.0.0", manifest.Version)
+	assert.Equal(t, "sqlite", manifest.Dialect)
+
+	for _, m := range database.Models() {
+		assert.Equal(t, findAll(t, source.DB, m), findAll(t, target.DB, m), "%T", m)
+	}
+	assertFileContent(t, targetDir.Path("images", "icon.png"), "icon")
+	assertFileContent(t, targetDir.Path("attachments", "file.pdf"), "attachment")
+	assert.NoFileExists(t, targetDir.Path("images", "unreferenced.png"))
+
+	app, err := target.GetApplicationByToken("Aapp")
+	require.NoError(t, err)
+	assert.Equal(t, "a0", app.SortKey)
+	require.NoError(t, target.CreateMessage(&model.Message{ApplicationID: app.ID, Message: "after restore"}))
+}
+
+func TestRestore_invalidArchiveKeepsDatabase(t *testing.T) {
+	dir := test.NewTmpDir("gotify_backup_invalid")
+	defer dir.Clean()
+	db := testdb.NewDBWithDefaultUser(t)
+	defer db.Close()
+	db.User(7).App(9).Message(12)
+	b := &Backup{DB: db.DB, ImagesDir: dir.Path() + "/", AttachmentsDir: dir.Path() + "/"}
+
+	archives := map[string][]byte{
+		"no gzip":        []byte("plain"),
+		"no manifest":    tarArchive(t, map[string]string{"tables/users.gob": ""}),
+		"unknown format": tarArchive(t, map[string]string{"manifest.json": `{"format":99}`}),
+		"unknown table":  tarArchive(t, map[string]string{"manifest.json": `{"format":1}`, "tables/unknown.gob": ""}),
+		"broken table":   tarArchive(t, map[string]string{"manifest.json": `{"format":1}`, "tables/users.gob": "broken"}),
+		"path traversal": tarArchive(t, map[string]string{"manifest.json": `{"format":1}`, "images/../escape.png": "x"}),
+	}
+	for name, archive := range archives {
+		_, err := b.Restore(bytes.NewReader(archive))
+		assert.Error(t, err, name)
+	}
+	db.AssertMessageExist(12)
+	assert.NoFileExists(t, dir.Path("..", "escape.png"))
+}
+
+func TestRestore_failedRestoreLeavesNoFiles(t *testing.T) {
+	dir := test.NewTmpDir("gotify_backup_failed")
+	defer dir.Clean()
+	db := testdb.NewDBWithDefaultUser(t)
+	defer db.Close()
+	b := &Backup{DB: db.DB, ImagesDir: dir.Path("images") + "/", AttachmentsDir: dir.Path("attachments") + "/"}
+
+	archive := tarArchive(t, map[string]string{
+		"manifest.json":    `{"format":1}`,
+		"images/icon.png":  "icon",
+		"tables/users.gob": "broken",
+	})
+	_, err := b.Restore(bytes.NewReader(archive))
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(dir.Path("images"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "staged files are removed")
+}
+
+func TestWrite_closesTransactionBeforeWriting(t *testing.T) {
+	db := testdb.NewDBWithDefaultUser(t)
+	defer db.Close()
+	fillDatabase(t, db)
+	dir := test.NewTmpDir("gotify_backup_write")
+	defer dir.Clean()
+	b := &Backup{DB: db.DB, ImagesDir: dir.Path() + "/", AttachmentsDir: dir.Path() + "/"}
+
+	w := &writableCheck{t: t, db: db}
+	require.NoError(t, b.Write(w))
+	assert.True(t, w.written)
+}
+
+// writableCheck fails the test if the database can't be written while the archive is written.
+type writableCheck struct {
+	t       *testing.T
+	db      *testdb.Database
+	written bool
+}
+
+func (w *writableCheck) Write(p []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		done := make(chan error, 1)
+		go func() {
+			done <- w.db.CreateMessage(&model.Message{ApplicationID: 1, Message: "during backup"})
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(w.t, err)
+		case <-time.After(5 * time.Second):
+			w.t.Error("the database is locked while writing the archive")
+		}
+	}
+	return len(p), nil
+}
+
+func fillDatabase(t *testing.T, db *testdb.Database) {
+	user := &model.User{Name: "jmattheis", Pass: []byte{1, 2}, Admin: true, CreatedAt: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, db.CreateUser(user))
+	app := &model.Application{UserID: user.ID, Token: "Aapp", Name: "backup", Image: "icon.png", SortKey: "a0", DefaultPriority: 4}
+	require.NoError(t, db.CreateApplication(app))
+	require.NoError(t, db.CreateClient(&model.Client{UserID: user.ID, Token: "Cclient", Name: "phone"}))
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.CreateMessage(&model.Message{
+		ApplicationID: app.ID, Title: "done", Message: "backup done", Priority: 4,
+		Extras: []byte(`{"a::b":1}`), Date: time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC), ExpiresAt: &expiresAt,
+	}))
+	require.NoError(t, db.CreatePluginConf(&model.PluginConf{UserID: user.ID, ModulePath: "github.com/gotify/plugin", Token: "Pplugin", Config: []byte("key: value"), Storage: []byte("stored"), Enabled: true}))
+	require.NoError(t, db.CreateGroup(&model.Group{Name: "ops", Members: []uint{1, user.ID}}))
+	require.NoError(t, db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: app.ID, UserID: 1, Permission: model.SharePermissionRead}))
+	require.NoError(t, db.MarkMessageRead(1, 1))
+	require.NoError(t, db.CreateAttachments([]*model.Attachment{{MessageID: 1, UserID: user.ID, Name: "report.pdf", File: "file.pdf", ContentType: "application/pdf", Size: 10}}))
+}
+
+func findAll(t *testing.T, db *gorm.DB, m any) any {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(m)))
+	require.NoError(t, db.Model(m).Find(rows.Interface()).Error)
+	return rows.Elem().Interface()
+}
+
+func assertFileContent(t *testing.T, file, expected string) {
+	content, err := os.ReadFile(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, string(content))
+	}
+}
+
+func tarArchive(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gz)
+	// the manifest must be the first entry
+	names := []string{}
+	if _, ok := files[manifestFile]; ok {
+		names = append(names, manifestFile)
+	}
+	var entries []string
+	for name := range files {
+		if name != manifestFile {
+			entries = append(entries, name)
+		}
+	}
+	sort.Strings(entries)
+	names = append(names, entries...)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name]))}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buffer.Bytes()
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"maps"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -48,9 +51,20 @@ type Server struct {
 	SecureCookie           bool
 }
 
+type SQLite struct {
+	WAL               bool
+	BusyTimeoutMillis int
+	ReadConns         int
+}
+
 type Database struct {
-	Dialect    string
-	Connection string
+	Dialect                string
+	Connection             string
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeSeconds int
+	ConnMaxIdleTimeSeconds int
+	SQLite                 SQLite
 }
 
 type DefaultUser struct {
@@ -70,6 +84,57 @@ type OIDC struct {
 	Scopes         []string
 }
 
+type SMTPServer struct {
+	Enabled           bool
+	ListenAddr        string
+	Port              int
+	Domain            string
+	MaxMessageBytes   int
+	Username          string
+	Password          string
+	CertFile          string
+	CertKey           string
+	AllowInsecureAuth bool
+}
+
+type SMTP struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	From       string
+	Encryption string
+}
+
+type MQTT struct {
+	Enabled       bool
+	Broker        string
+	ClientID      string
+	Username      string
+	Password      string
+	QoS           int
+	PublishTopic  string
+	Subscriptions map[string]string
+}
+
+type Attachments struct {
+	Dir            string
+	MaxBytes       int
+	UserQuotaBytes int
+}
+
+type Quota struct {
+	MaxApplications       int
+	MaxClients            int
+	MaxMessages           int
+	MaxStorageBytes       int
+	MaxPluginStorageBytes int
+}
+
+type Rules struct {
+	AllowPrivateWebhooks bool
+}
+
 type Configuration struct {
 	LogLevel          LogLevel
 	Server            Server
@@ -77,14 +142,38 @@ type Configuration struct {
 	DefaultUser       DefaultUser
 	PassStrength      int
 	UploadedImagesDir string
+	Attachments       Attachments
+	Quota             Quota
 	PluginsDir        string
 	Registration      bool
 	OIDC              OIDC
+	SMTPServer        SMTPServer
+	SMTP              SMTP
+	MQTT              MQTT
+	Rules             Rules
 	NoColor           string
 }
 
 // Get returns the configuration extracted from env variables.
 func Get() (*Configuration, []FutureLog) {
+	c, logs, _ := load()
+	return c, logs
+}
+
+// Inspect returns the configuration like Get and the effective value and the source of every setting.
+func Inspect() (*Configuration, []FutureLog, []Setting) {
+	c, logs, l := load()
+	settings := l.result()
+	for i := range settings {
+		if settings[i].Env == EnvDatabaseConnection && c.Database.Dialect == "sqlite3" {
+			// the path to the sqlite database contains no credentials
+			settings[i].Secret = false
+		}
+	}
+	return c, logs, settings
+}
+
+func load() (*Configuration, []FutureLog, *loader) {
 	c := &Configuration{
 		LogLevel: LogLevel(zerolog.InfoLevel),
 		Server: Server{
@@ -101,8 +190,15 @@ func Get() (*Configuration, []FutureLog) {
 			},
 		},
 		Database: Database{
-			Dialect:    "sqlite3",
-			Connection: "data/gotify.db",
+			Dialect:      "sqlite3",
+			Connection:   "data/gotify.db",
+			MaxOpenConns: 10,
+			MaxIdleConns: 2,
+			SQLite: SQLite{
+				WAL:               false,
+				BusyTimeoutMillis: 5000,
+				ReadConns:         4,
+			},
 		},
 		DefaultUser: DefaultUser{
 			Name: "admin",
@@ -110,15 +206,35 @@ func Get() (*Configuration, []FutureLog) {
 		},
 		PassStrength:      10,
 		UploadedImagesDir: "data/images",
-		PluginsDir:        "data/plugins",
+		Attachments: Attachments{
+			Dir:      "data/attachments",
+			MaxBytes: 10 * 1024 * 1024,
+		},
+		PluginsDir: "data/plugins",
 		OIDC: OIDC{
 			UsernameClaim: "preferred_username",
 			AutoRegister:  true,
 			Scopes:        []string{"openid", "profile", "email"},
 		},
+		SMTPServer: SMTPServer{
+			Port:            25,
+			Domain:          "gotify.local",
+			MaxMessageBytes: 10 * 1024 * 1024,
+		},
+		SMTP: SMTP{
+			Port:       587,
+			From:       "gotify@localhost",
+			Encryption: "starttls",
+		},
+		MQTT: MQTT{
+			Broker:       "tcp://localhost:1883",
+			ClientID:     "gotify",
+			PublishTopic: "gotify/user/{userid}/message",
+		},
 	}
 
-	logs := loadFiles()
+	logs, fromFiles := loadFiles()
+	l := &loader{fromFiles: fromFiles}
 
 	add := func(err error) {
 		if err != nil {
@@ -126,67 +242,165 @@ func Get() (*Configuration, []FutureLog) {
 		}
 	}
 
-	add(parseLogLevel(&c.LogLevel, EnvLogLevel))
+	add(l.parseLogLevel(&c.LogLevel, EnvLogLevel))
 
-	add(parseInt(&c.Server.KeepAlivePeriodSeconds, EnvServerKeepAlivePeriodSeconds))
-	add(parseString(&c.Server.ListenAddr, EnvServerListenAddr))
-	add(parseInt(&c.Server.Port, EnvServerPort))
+	add(l.parseInt(&c.Server.KeepAlivePeriodSeconds, EnvServerKeepAlivePeriodSeconds))
+	add(l.parseString(&c.Server.ListenAddr, EnvServerListenAddr))
+	add(l.parseInt(&c.Server.Port, EnvServerPort))
 
-	add(parseBool(&c.Server.SSL.Enabled, EnvServerSSLEnabled))
-	add(parseBool(&c.Server.SSL.RedirectToHTTPS, EnvServerSSLRedirectToHTTPS))
-	add(parseString(&c.Server.SSL.ListenAddr, EnvServerSSLListenAddr))
-	add(parseInt(&c.Server.SSL.Port, EnvServerSSLPort))
-	add(parseString(&c.Server.SSL.CertFile, EnvServerSSLCertFile))
-	add(parseString(&c.Server.SSL.CertKey, EnvServerSSLCertKey))
+	add(l.parseBool(&c.Server.SSL.Enabled, EnvServerSSLEnabled))
+	add(l.parseBool(&c.Server.SSL.RedirectToHTTPS, EnvServerSSLRedirectToHTTPS))
+	add(l.parseString(&c.Server.SSL.ListenAddr, EnvServerSSLListenAddr))
+	add(l.parseInt(&c.Server.SSL.Port, EnvServerSSLPort))
+	add(l.parseString(&c.Server.SSL.CertFile, EnvServerSSLCertFile))
+	add(l.parseString(&c.Server.SSL.CertKey, EnvServerSSLCertKey))
 
-	add(parseBool(&c.Server.SSL.LetsEncrypt.Enabled, EnvServerSSLLetsEncryptEnabled))
-	add(parseBool(&c.Server.SSL.LetsEncrypt.AcceptTOS, EnvServerSSLLetsEncryptAcceptTOS))
-	add(parseString(&c.Server.SSL.LetsEncrypt.Cache, EnvServerSSLLetsEncryptCache))
-	add(parseString(&c.Server.SSL.LetsEncrypt.DirectoryURL, EnvServerSSLLetsEncryptDirectoryURL))
-	add(parseList(&c.Server.SSL.LetsEncrypt.Hosts, EnvServerSSLLetsEncryptHosts))
+	add(l.parseBool(&c.Server.SSL.LetsEncrypt.Enabled, EnvServerSSLLetsEncryptEnabled))
+	add(l.parseBool(&c.Server.SSL.LetsEncrypt.AcceptTOS, EnvServerSSLLetsEncryptAcceptTOS))
+	add(l.parseString(&c.Server.SSL.LetsEncrypt.Cache, EnvServerSSLLetsEncryptCache))
+	add(l.parseString(&c.Server.SSL.LetsEncrypt.DirectoryURL, EnvServerSSLLetsEncryptDirectoryURL))
+	add(l.parseList(&c.Server.SSL.LetsEncrypt.Hosts, EnvServerSSLLetsEncryptHosts))
 
-	add(parseMap(&c.Server.ResponseHeaders, EnvServerResponseHeaders))
+	add(l.parseMap(&c.Server.ResponseHeaders, EnvServerResponseHeaders))
 
-	add(parseInt(&c.Server.Stream.PingPeriodSeconds, EnvServerStreamPingPeriodSeconds))
-	add(parseList(&c.Server.Stream.AllowedOrigins, EnvServerStreamAllowedOrigins))
+	add(l.parseInt(&c.Server.Stream.PingPeriodSeconds, EnvServerStreamPingPeriodSeconds))
+	add(l.parseList(&c.Server.Stream.AllowedOrigins, EnvServerStreamAllowedOrigins))
 
-	add(parseList(&c.Server.Cors.AllowOrigins, EnvServerCorsAllowOrigins))
-	add(parseList(&c.Server.Cors.AllowMethods, EnvServerCorsAllowMethods))
-	add(parseList(&c.Server.Cors.AllowHeaders, EnvServerCorsAllowHeaders))
+	add(l.parseList(&c.Server.Cors.AllowOrigins, EnvServerCorsAllowOrigins))
+	add(l.parseList(&c.Server.Cors.AllowMethods, EnvServerCorsAllowMethods))
+	add(l.parseList(&c.Server.Cors.AllowHeaders, EnvServerCorsAllowHeaders))
+
+	add(l.parseList(&c.Server.TrustedProxies, EnvServerTrustedProxies))
+	add(l.parseBool(&c.Server.SecureCookie, EnvServerSecureCookie))
+
+	add(l.parseString(&c.Database.Dialect, EnvDatabaseDialect))
+	add(l.parseString(&c.Database.Connection, EnvDatabaseConnection))
+	add(l.parseInt(&c.Database.MaxOpenConns, EnvDatabaseMaxOpenConns))
+	add(l.parseInt(&c.Database.MaxIdleConns, EnvDatabaseMaxIdleConns))
+	add(l.parseInt(&c.Database.ConnMaxLifetimeSeconds, EnvDatabaseConnMaxLifetimeSeconds))
+	add(l.parseInt(&c.Database.ConnMaxIdleTimeSeconds, EnvDatabaseConnMaxIdleTimeSeconds))
+	add(l.parseBool(&c.Database.SQLite.WAL, EnvDatabaseSQLiteWAL))
+	add(l.parseInt(&c.Database.SQLite.BusyTimeoutMillis, EnvDatabaseSQLiteBusyTimeoutMillis))
+	add(l.parseInt(&c.Database.SQLite.ReadConns, EnvDatabaseSQLiteReadConns))
+	if c.Database.MaxOpenConns < 1 {
+		add(fmt.Errorf("invalid value for %s (%d): must be at least 1", EnvDatabaseMaxOpenConns, c.Database.MaxOpenConns))
+	}
+	nonNegative := func(value int, env string) {
+		if value < 0 {
+			add(fmt.Errorf("invalid value for %s (%d): must not be negative", env, value))
+		}
+	}
+	nonNegative(c.Database.MaxIdleConns, EnvDatabaseMaxIdleConns)
+	nonNegative(c.Database.ConnMaxLifetimeSeconds, EnvDatabaseConnMaxLifetimeSeconds)
+	nonNegative(c.Database.ConnMaxIdleTimeSeconds, EnvDatabaseConnMaxIdleTimeSeconds)
+	nonNegative(c.Database.SQLite.BusyTimeoutMillis, EnvDatabaseSQLiteBusyTimeoutMillis)
+	nonNegative(c.Database.SQLite.ReadConns, EnvDatabaseSQLiteReadConns)
 
-	add(parseList(&c.Server.TrustedProxies, EnvServerTrustedProxies))
-	add(parseBool(&c.Server.SecureCookie, EnvServerSecureCookie))
+	add(l.parseString(&c.DefaultUser.Name, EnvDefaultUserName))
+	add(l.parseString(&c.DefaultUser.Pass, EnvDefaultUserPass))
 
-	add(parseString(&c.Database.Dialect, EnvDatabaseDialect))
-	add(parseString(&c.Database.Connection, EnvDatabaseConnection))
+	add(l.parseInt(&c.PassStrength, EnvPassStrength))
+	add(l.parseString(&c.UploadedImagesDir, EnvUploadedImagesDir))
+	add(l.parseString(&c.Attachments.Dir, EnvAttachmentsDir))
+	add(l.parseInt(&c.Attachments.MaxBytes, EnvAttachmentsMaxBytes))
+	add(l.parseInt(&c.Attachments.UserQuotaBytes, EnvAttachmentsUserQuotaBytes))
+	add(l.parseInt(&c.Quota.MaxApplications, EnvQuotaMaxApplications))
+	add(l.parseInt(&c.Quota.MaxClients, EnvQuotaMaxClients))
+	add(l.parseInt(&c.Quota.MaxMessages, EnvQuotaMaxMessages))
+	add(l.parseInt(&c.Quota.MaxStorageBytes, EnvQuotaMaxStorageBytes))
+	add(l.parseInt(&c.Quota.MaxPluginStorageBytes, EnvQuotaMaxPluginStorageBytes))
+	add(l.parseString(&c.PluginsDir, EnvPluginsDir))
+	add(l.parseBool(&c.Registration, EnvRegistration))
 
-	add(parseString(&c.DefaultUser.Name, EnvDefaultUserName))
-	add(parseString(&c.DefaultUser.Pass, EnvDefaultUserPass))
+	add(l.parseBool(&c.OIDC.Enabled, EnvOIDCEnabled))
+	add(l.parseString(&c.OIDC.Issuer, EnvOIDCIssuer))
+	add(l.parseString(&c.OIDC.ClientID, EnvOIDCClientID))
+	add(l.parseString(&c.OIDC.ClientSecret, EnvOIDCClientSecret))
+	add(l.parseString(&c.OIDC.UsernameClaim, EnvOIDCUsernameClaim))
+	add(l.parseString(&c.OIDC.RedirectURL, EnvOIDCRedirectURL))
+	add(l.parseBool(&c.OIDC.AutoRegister, EnvOIDCAutoRegister))
+	add(l.parseBool(&c.OIDC.LinkByUsername, EnvOIDCLinkByUsername))
+	add(l.parseList(&c.OIDC.Scopes, EnvOIDCScopes))
 
-	add(parseInt(&c.PassStrength, EnvPassStrength))
-	add(parseString(&c.UploadedImagesDir, EnvUploadedImagesDir))
-	add(parseString(&c.PluginsDir, EnvPluginsDir))
-	add(parseBool(&c.Registration, EnvRegistration))
+	add(l.parseBool(&c.SMTPServer.Enabled, EnvSMTPServerEnabled))
+	add(l.parseString(&c.SMTPServer.ListenAddr, EnvSMTPServerListenAddr))
+	add(l.parseInt(&c.SMTPServer.Port, EnvSMTPServerPort))
+	add(l.parseString(&c.SMTPServer.Domain, EnvSMTPServerDomain))
+	add(l.parseInt(&c.SMTPServer.MaxMessageBytes, EnvSMTPServerMaxMessageBytes))
+	add(l.parseString(&c.SMTPServer.Username, EnvSMTPServerUsername))
+	add(l.parseString(&c.SMTPServer.Password, EnvSMTPServerPassword))
+	add(l.parseString(&c.SMTPServer.CertFile, EnvSMTPServerCertFile))
+	add(l.parseString(&c.SMTPServer.CertKey, EnvSMTPServerCertKey))
+	add(l.parseBool(&c.SMTPServer.AllowInsecureAuth, EnvSMTPServerAllowInsecureAuth))
 
-	add(parseBool(&c.OIDC.Enabled, EnvOIDCEnabled))
-	add(parseString(&c.OIDC.Issuer, EnvOIDCIssuer))
-	add(parseString(&c.OIDC.ClientID, EnvOIDCClientID))
-	add(parseString(&c.OIDC.ClientSecret, EnvOIDCClientSecret))
-	add(parseString(&c.OIDC.UsernameClaim, EnvOIDCUsernameClaim))
-	add(parseString(&c.OIDC.RedirectURL, EnvOIDCRedirectURL))
-	add(parseBool(&c.OIDC.AutoRegister, EnvOIDCAutoRegister))
-	add(parseBool(&c.OIDC.LinkByUsername, EnvOIDCLinkByUsername))
-	add(parseList(&c.OIDC.Scopes, EnvOIDCScopes))
+	add(l.parseString(&c.SMTP.Host, EnvSMTPHost))
+	add(l.parseInt(&c.SMTP.Port, EnvSMTPPort))
+	add(l.parseString(&c.SMTP.Username, EnvSMTPUsername))
+	add(l.parseString(&c.SMTP.Password, EnvSMTPPassword))
+	add(l.parseString(&c.SMTP.From, EnvSMTPFrom))
+	add(l.parseString(&c.SMTP.Encryption, EnvSMTPEncryption))
+	if c.SMTP.Encryption != "starttls" && c.SMTP.Encryption != "tls" && c.SMTP.Encryption != "none" {
+		add(fmt.Errorf("invalid value for %s (%q): must be starttls, tls or none", EnvSMTPEncryption, c.SMTP.Encryption))
+	}
 
-	add(parseString(&c.NoColor, EnvNoColor))
+	add(l.parseBool(&c.MQTT.Enabled, EnvMQTTEnabled))
+	add(l.parseString(&c.MQTT.Broker, EnvMQTTBroker))
+	add(l.parseString(&c.MQTT.ClientID, EnvMQTTClientID))
+	add(l.parseString(&c.MQTT.Username, EnvMQTTUsername))
+	add(l.parseString(&c.MQTT.Password, EnvMQTTPassword))
+	add(l.parseInt(&c.MQTT.QoS, EnvMQTTQoS))
+	add(l.parseString(&c.MQTT.PublishTopic, EnvMQTTPublishTopic))
+	add(l.parseMap(&c.MQTT.Subscriptions, EnvMQTTSubscriptions))
+	if c.MQTT.QoS < 0 || c.MQTT.QoS > 2 {
+		add(fmt.Errorf("invalid QoS for %s (%d): must be 0, 1 or 2", EnvMQTTQoS, c.MQTT.QoS))
+	}
+	if c.MQTT.Enabled && c.MQTT.PublishTopic != "" {
+		published := strings.ReplaceAll(c.MQTT.PublishTopic, "{userid}", "+")
+		for _, topic := range slices.Sorted(maps.Keys(c.MQTT.Subscriptions)) {
+			if mqttTopicsOverlap(topic, published) {
+				add(fmt.Errorf("invalid topic for %s (%q): overlaps with %s, published messages would be received again", EnvMQTTSubscriptions, topic, EnvMQTTPublishTopic))
+			}
+		}
+	}
+
+	add(l.parseBool(&c.Rules.AllowPrivateWebhooks, EnvRulesAllowPrivateWebhooks))
+
+	add(l.parseString(&c.NoColor, EnvNoColor))
 
 	addTrailingSlashToPaths(c)
+	envByFieldOnce.Do(func() { envByField = l.envByField(c) })
 
-	return c, logs
+	return c, logs, l
 }
 
 func addTrailingSlashToPaths(conf *Configuration) {
 	if !strings.HasSuffix(conf.UploadedImagesDir, "/") && !strings.HasSuffix(conf.UploadedImagesDir, "\\") {
 		conf.UploadedImagesDir += string(filepath.Separator)
 	}
+	if !strings.HasSuffix(conf.Attachments.Dir, "/") && !strings.HasSuffix(conf.Attachments.Dir, "\\") {
+		conf.Attachments.Dir += string(filepath.Separator)
+	}
+}
+
+// mqttTopicsOverlap returns whether a topic exists which matches both topic filters.
+func mqttTopicsOverlap(a, b string) bool {
+	levelsA, levelsB := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(levelsA) && i < len(levelsB); i++ {
+		if levelsA[i] == "#" || levelsB[i] == "#" {
+			return true
+		}
+		if levelsA[i] != "+" && levelsB[i] != "+" && levelsA[i] != levelsB[i] {
+			return false
+		}
+	}
+	if len(levelsA) == len(levelsB) {
+		return true
+	}
+	// "a/#" also matches "a"
+	longer := levelsA
+	if len(levelsB) > len(levelsA) {
+		longer = levelsB
+	}
+	shorter := min(len(levelsA), len(levelsB))
+	return len(longer) == shorter+1 && longer[shorter] == "#"
 }
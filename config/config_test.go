@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/gotify/server/v2/mode"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -61,6 +62,31 @@ func TestFile(t *testing.T) {
 	assert.Equal(t, []string{"a.example.com", "b.example.com"}, conf.Server.SSL.LetsEncrypt.Hosts)
 }
 
+func TestFile_errors(t *testing.T) {
+	mode.Set(mode.TestDev)
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	assert.Nil(t, os.WriteFile(secretPath, []byte("postgres://gotify:secret@db/gotify"), 0o600))
+
+	t.Setenv("GOTIFY_DATABASE_CONNECTION", "other.db")
+	t.Setenv("GOTIFY_DATABASE_CONNECTION_FILE", secretPath)
+	t.Setenv("GOTIFY_OIDC_CLIENTSECRET_FILE", filepath.Join(dir, "missing"))
+
+	conf, logs := Get()
+	fatal := fatalLogs(logs)
+	if assert.Len(t, fatal, 2) {
+		assert.Equal(t, "GOTIFY_DATABASE_CONNECTION and GOTIFY_DATABASE_CONNECTION_FILE must not be set both", fatal[0].Msg)
+		assert.Contains(t, fatal[1].Msg, "read file for GOTIFY_OIDC_CLIENTSECRET_FILE ("+filepath.Join(dir, "missing")+")")
+	}
+	assert.Equal(t, "data/gotify.db", conf.Database.Connection, "the default is kept")
+
+	os.Unsetenv("GOTIFY_DATABASE_CONNECTION")
+	os.Unsetenv("GOTIFY_OIDC_CLIENTSECRET_FILE")
+	conf, logs = Get()
+	assert.Empty(t, fatalLogs(logs))
+	assert.Equal(t, "postgres://gotify:secret@db/gotify", conf.Database.Connection)
+}
+
 func TestGotifyConfigFile(t *testing.T) {
 	mode.Set(mode.TestDev)
 	dir := t.TempDir()
@@ -74,11 +100,49 @@ func TestGotifyConfigFile(t *testing.T) {
 	assert.Equal(t, "fromfile", conf.DefaultUser.Name)
 }
 
+func TestDatabasePool(t *testing.T) {
+	mode.Set(mode.TestDev)
+	conf, _ := Get()
+	assert.Equal(t, 10, conf.Database.MaxOpenConns)
+	assert.Equal(t, 2, conf.Database.MaxIdleConns)
+	assert.Equal(t, SQLite{WAL: false, BusyTimeoutMillis: 5000, ReadConns: 4}, conf.Database.SQLite)
+
+	t.Setenv("GOTIFY_DATABASE_MAXOPENCONNS", "20")
+	t.Setenv("GOTIFY_DATABASE_CONNMAXLIFETIMESECONDS", "300")
+	t.Setenv("GOTIFY_DATABASE_SQLITE_WAL", "true")
+	t.Setenv("GOTIFY_DATABASE_SQLITE_READCONNS", "0")
+	conf, logs := Get()
+	assert.Empty(t, fatalLogs(logs))
+	assert.Equal(t, 20, conf.Database.MaxOpenConns)
+	assert.Equal(t, 300, conf.Database.ConnMaxLifetimeSeconds)
+	assert.True(t, conf.Database.SQLite.WAL)
+	assert.Equal(t, 0, conf.Database.SQLite.ReadConns)
+
+	t.Setenv("GOTIFY_DATABASE_MAXOPENCONNS", "0")
+	t.Setenv("GOTIFY_DATABASE_SQLITE_BUSYTIMEOUTMILLIS", "-1")
+	_, logs = Get()
+	assert.Equal(t, []FutureLog{
+		futureFatal("invalid value for GOTIFY_DATABASE_MAXOPENCONNS (0): must be at least 1"),
+		futureFatal("invalid value for GOTIFY_DATABASE_SQLITE_BUSYTIMEOUTMILLIS (-1): must not be negative"),
+	}, fatalLogs(logs))
+}
+
+func fatalLogs(logs []FutureLog) []FutureLog {
+	var fatal []FutureLog
+	for _, log := range logs {
+		if log.Level == zerolog.FatalLevel {
+			fatal = append(fatal, log)
+		}
+	}
+	return fatal
+}
+
 func TestAddSlash(t *testing.T) {
 	mode.Set(mode.TestDev)
 	os.Setenv("GOTIFY_UPLOADEDIMAGESDIR", "../data/images")
 	conf, _ := Get()
 	assert.Equal(t, "../data/images"+string(filepath.Separator), conf.UploadedImagesDir)
+	assert.Equal(t, "data/attachments"+string(filepath.Separator), conf.Attachments.Dir)
 	os.Unsetenv("GOTIFY_UPLOADEDIMAGESDIR")
 }
 
@@ -114,3 +178,34 @@ func TestParseList(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidSMTPEncryption(t *testing.T) {
+	mode.Set(mode.TestDev)
+	t.Setenv("GOTIFY_SMTP_ENCRYPTION", "ssl")
+
+	_, futureLogs := Get()
+	assert.Contains(t, futureLogs, FutureLog{Level: zerolog.FatalLevel, Msg: `invalid value for GOTIFY_SMTP_ENCRYPTION ("ssl"): must be starttls, tls or none`})
+}
+
+func TestMQTTTopicsOverlap(t *testing.T) {
+	assert.True(t, mqttTopicsOverlap("gotify/#", "gotify/user/+/message"))
+	assert.True(t, mqttTopicsOverlap("gotify/user/1/message", "gotify/user/+/message"))
+	assert.True(t, mqttTopicsOverlap("+/+/+/+", "gotify/user/+/message"))
+	assert.True(t, mqttTopicsOverlap("gotify/user/+/message/#", "gotify/user/+/message"))
+	assert.True(t, mqttTopicsOverlap("#", "a"))
+	assert.False(t, mqttTopicsOverlap("alerts/#", "gotify/user/+/message"))
+	assert.False(t, mqttTopicsOverlap("gotify/user/+", "gotify/user/+/message"))
+	assert.False(t, mqttTopicsOverlap("gotify/user/+/message/extra", "gotify/user/+/message"))
+}
+
+func TestMQTTSubscriptionOverlapsPublishTopic(t *testing.T) {
+	mode.Set(mode.TestDev)
+	t.Setenv("GOTIFY_MQTT_ENABLED", "true")
+	t.Setenv("GOTIFY_MQTT_SUBSCRIPTIONS", `{"gotify/#":"Atoken","sensors/door":"Btoken"}`)
+
+	_, futureLogs := Get()
+	assert.Contains(t, futureLogs, FutureLog{Level: zerolog.FatalLevel, Msg: `invalid topic for GOTIFY_MQTT_SUBSCRIPTIONS ("gotify/#"): overlaps with GOTIFY_MQTT_PUBLISHTOPIC, published messages would be received again`})
+	for _, futureLog := range futureLogs {
+		assert.NotContains(t, futureLog.Msg, "sensors/door")
+	}
+}
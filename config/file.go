@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
@@ -11,21 +12,45 @@ import (
 
 var osStat = os.Stat
 
-func loadFiles() []FutureLog {
-	if configFile := os.Getenv("GOTIFY_CONFIG_FILE"); configFile != "" {
-		log, _ := loadFile(configFile)
-		return []FutureLog{log}
+var (
+	fileEnvLock sync.Mutex
+	// fileEnv contains the variables set from config files and their values.
+	fileEnv = map[string]string{}
+)
+
+// loadFiles sets the variables of the first existing config file which aren't set in the environment.
+// The variables set by a previous call are unset first, so that changes of the file are applied on reload.
+// It returns the names of the variables set from the file.
+func loadFiles() ([]FutureLog, map[string]bool) {
+	fileEnvLock.Lock()
+	defer fileEnvLock.Unlock()
+	for key, value := range fileEnv {
+		// a changed value was set outside of the config files and takes precedence
+		if current, ok := os.LookupEnv(key); ok && current == value {
+			os.Unsetenv(key)
+		}
 	}
+	fileEnv = map[string]string{}
 
 	var logs []FutureLog
-	for _, file := range getFiles() {
-		log, found := loadFile(file)
+	if configFile := os.Getenv("GOTIFY_CONFIG_FILE"); configFile != "" {
+		log, _ := loadFile(configFile)
 		logs = append(logs, log)
-		if found {
-			break
+	} else {
+		for _, file := range getFiles() {
+			log, found := loadFile(file)
+			logs = append(logs, log)
+			if found {
+				break
+			}
 		}
 	}
-	return logs
+
+	fromFiles := map[string]bool{}
+	for key := range fileEnv {
+		fromFiles[key] = true
+	}
+	return logs, fromFiles
 }
 
 func loadFile(file string) (log FutureLog, found bool) {
@@ -35,9 +60,17 @@ func loadFile(file string) (log FutureLog, found bool) {
 		}
 		return futureFatal(fmt.Sprintf("cannot read file %s: %s", file, err)), true
 	}
-	if err := godotenv.Load(file); err != nil {
+	values, err := godotenv.Read(file)
+	if err != nil {
 		return futureFatal(fmt.Sprintf("cannot load file %s: %s", file, err)), true
 	}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		os.Setenv(key, value)
+		fileEnv[key] = value
+	}
 	return FutureLog{Level: zerolog.InfoLevel, Msg: fmt.Sprintf("Loading file %s", file)}, true
 }
 
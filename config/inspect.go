@@ -0,0 +1,314 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Source is the origin of a configuration value.
+type Source string
+
+const (
+	// SourceDefault is used for values which aren't configured.
+	SourceDefault Source = "default"
+	// SourceFile is used for values of a config file.
+	SourceFile Source = "file"
+	// SourceEnv is used for values of environment variables set outside of config files.
+	SourceEnv Source = "env"
+)
+
+// Setting is the effective value of an environment variable.
+type Setting struct {
+	Env    string
+	Value  string
+	Source Source
+	// FromFile is the file of the value if it was read via the _FILE variant of Env.
+	FromFile string
+	Secret   bool
+}
+
+// MaskedValue returns the value with secrets replaced.
+func (s Setting) MaskedValue() string {
+	if s.Secret && s.Value != "" {
+		return "********"
+	}
+	return s.Value
+}
+
+var secretEnvs = map[string]bool{
+	EnvDatabaseConnection: true,
+	EnvDefaultUserPass:    true,
+	EnvOIDCClientSecret:   true,
+	EnvSMTPServerPassword: true,
+	EnvSMTPPassword:       true,
+	EnvMQTTPassword:       true,
+	EnvMQTTSubscriptions:  true,
+}
+
+type trackedSetting struct {
+	env    string
+	target any
+}
+
+// loader records the settings read by Get, to report their values and sources.
+type loader struct {
+	fromFiles map[string]bool
+	settings  []trackedSetting
+}
+
+func (l *loader) track(target any, env string) {
+	l.settings = append(l.settings, trackedSetting{env: env, target: target})
+}
+
+func (l *loader) parseString(target *string, env string) error {
+	l.track(target, env)
+	return parseString(target, env)
+}
+
+func (l *loader) parseInt(target *int, env string) error {
+	l.track(target, env)
+	return parseInt(target, env)
+}
+
+func (l *loader) parseBool(target *bool, env string) error {
+	l.track(target, env)
+	return parseBool(target, env)
+}
+
+func (l *loader) parseList(target *[]string, env string) error {
+	l.track(target, env)
+	return parseList(target, env)
+}
+
+func (l *loader) parseMap(target *map[string]string, env string) error {
+	l.track(target, env)
+	return parseMap(target, env)
+}
+
+func (l *loader) parseLogLevel(target *LogLevel, env string) error {
+	l.track(target, env)
+	return parseLogLevel(target, env)
+}
+
+func (l *loader) result() []Setting {
+	result := make([]Setting, 0, len(l.settings))
+	for _, tracked := range l.settings {
+		setting := Setting{Env: tracked.env, Value: formatValue(tracked.target), Source: SourceDefault, Secret: secretEnvs[tracked.env]}
+		if _, ok := os.LookupEnv(tracked.env); ok {
+			setting.Source = l.source(tracked.env)
+		} else if path, ok := os.LookupEnv(tracked.env + "_FILE"); ok {
+			setting.Source = l.source(tracked.env + "_FILE")
+			setting.FromFile = path
+		}
+		result = append(result, setting)
+	}
+	return result
+}
+
+func (l *loader) source(env string) Source {
+	if l.fromFiles[env] {
+		return SourceFile
+	}
+	return SourceEnv
+}
+
+var (
+	envByFieldOnce sync.Once
+	// envByField maps the paths of the Configuration fields like Server.Port to their variables.
+	envByField map[string]string
+)
+
+func (l *loader) envByField(c *Configuration) map[string]string {
+	paths := map[uintptr]string{}
+	walkFields(reflect.ValueOf(c).Elem(), "", nil, func(path string, _ []int, field reflect.Value) {
+		paths[field.Addr().Pointer()] = path
+	})
+	result := map[string]string{}
+	for _, tracked := range l.settings {
+		result[paths[reflect.ValueOf(tracked.target).Pointer()]] = tracked.env
+	}
+	return result
+}
+
+// walkFields calls f for every field of the struct value which isn't a struct itself.
+func walkFields(value reflect.Value, prefix string, index []int, f func(path string, index []int, field reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		path := prefix + value.Type().Field(i).Name
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, path+".", fieldIndex, f)
+		} else {
+			f(path, fieldIndex, field)
+		}
+	}
+}
+
+// Changed returns the variables of the settings which differ between the configurations,
+// it requires that the configuration was loaded before.
+func Changed(old, new *Configuration) []string {
+	newValue := reflect.ValueOf(new).Elem()
+	var changed []string
+	walkFields(reflect.ValueOf(old).Elem(), "", nil, func(path string, index []int, field reflect.Value) {
+		if !reflect.DeepEqual(field.Interface(), newValue.FieldByIndex(index).Interface()) {
+			if env, ok := envByField[path]; ok {
+				changed = append(changed, env)
+			}
+		}
+	})
+	return changed
+}
+
+func formatValue(target any) string {
+	switch value := target.(type) {
+	case *string:
+		return *value
+	case *int:
+		return strconv.Itoa(*value)
+	case *bool:
+		return strconv.FormatBool(*value)
+	case *[]string:
+		return strings.Join(*value, ",")
+	case *map[string]string:
+		if len(*value) == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(*value)
+		return string(data)
+	case *LogLevel:
+		return value.AsZeroLogLevel().String()
+	default:
+		return fmt.Sprint(target)
+	}
+}
+
+// Check returns problems of the configuration which don't prevent the start of the server
+// but are likely mistakes, like unknown GOTIFY_* variables or incomplete settings.
+func Check(c *Configuration, settings []Setting) []FutureLog {
+	var logs []FutureLog
+	warn := func(format string, args ...any) {
+		logs = append(logs, FutureLog{Level: zerolog.WarnLevel, Msg: fmt.Sprintf(format, args...)})
+	}
+	fail := func(format string, args ...any) {
+		logs = append(logs, FutureLog{Level: zerolog.ErrorLevel, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	known := map[string]bool{"GOTIFY_CONFIG_FILE": true}
+	for _, setting := range settings {
+		known[setting.Env] = true
+		known[setting.Env+"_FILE"] = true
+	}
+	var unknown []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(key, "GOTIFY_") && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		if suggestion := closestEnv(key, settings); suggestion != "" {
+			warn("unknown variable %s, did you mean %s?", key, suggestion)
+		} else {
+			warn("unknown variable %s", key)
+		}
+	}
+
+	if c.Server.SSL.Enabled && !c.Server.SSL.LetsEncrypt.Enabled {
+		if c.Server.SSL.CertFile == "" || c.Server.SSL.CertKey == "" {
+			fail("%s is enabled without Let's Encrypt, but %s or %s isn't set", EnvServerSSLEnabled, EnvServerSSLCertFile, EnvServerSSLCertKey)
+		}
+		for _, file := range []string{c.Server.SSL.CertFile, c.Server.SSL.CertKey} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				fail("cannot read the certificate: %s", err)
+			}
+		}
+	}
+	if c.Server.SSL.Enabled && c.Server.SSL.LetsEncrypt.Enabled {
+		if !c.Server.SSL.LetsEncrypt.AcceptTOS {
+			fail("%s is enabled, but %s isn't", EnvServerSSLLetsEncryptEnabled, EnvServerSSLLetsEncryptAcceptTOS)
+		}
+		if len(c.Server.SSL.LetsEncrypt.Hosts) == 0 {
+			warn("%s is enabled without %s, certificates are requested for every host", EnvServerSSLLetsEncryptEnabled, EnvServerSSLLetsEncryptHosts)
+		}
+	}
+	if !c.Server.SSL.Enabled && (c.Server.SSL.CertFile != "" || c.Server.SSL.LetsEncrypt.Enabled) {
+		warn("TLS settings are set, but %s isn't enabled", EnvServerSSLEnabled)
+	}
+	if c.OIDC.Enabled {
+		required := []struct{ env, value string }{
+			{EnvOIDCIssuer, c.OIDC.Issuer},
+			{EnvOIDCClientID, c.OIDC.ClientID},
+			{EnvOIDCRedirectURL, c.OIDC.RedirectURL},
+		}
+		for _, setting := range required {
+			if setting.value == "" {
+				fail("%s is enabled, but %s isn't set", EnvOIDCEnabled, setting.env)
+			}
+		}
+	}
+	if c.SMTPServer.Enabled && (c.SMTPServer.Username == "") != (c.SMTPServer.Password == "") {
+		fail("%s and %s must be set together", EnvSMTPServerUsername, EnvSMTPServerPassword)
+	}
+	if c.SMTPServer.Enabled && (c.SMTPServer.CertFile == "") != (c.SMTPServer.CertKey == "") {
+		fail("%s and %s must be set together", EnvSMTPServerCertFile, EnvSMTPServerCertKey)
+	}
+	if c.SMTPServer.Enabled && c.SMTPServer.Username != "" && c.SMTPServer.CertFile == "" && !c.SMTPServer.AllowInsecureAuth {
+		fail("%s is set, but authentication requires TLS, please set %s and %s or enable %s", EnvSMTPServerUsername, EnvSMTPServerCertFile, EnvSMTPServerCertKey, EnvSMTPServerAllowInsecureAuth)
+	}
+	if c.Attachments.UserQuotaBytes > 0 && c.Quota.MaxStorageBytes > 0 && c.Attachments.UserQuotaBytes >= c.Quota.MaxStorageBytes {
+		warn("%s has no effect for users without their own storage quota, %s is lower", EnvAttachmentsUserQuotaBytes, EnvQuotaMaxStorageBytes)
+	}
+	if c.MQTT.Enabled && c.MQTT.Broker == "" {
+		fail("%s is enabled, but %s isn't set", EnvMQTTEnabled, EnvMQTTBroker)
+	}
+	if c.Database.Dialect != "sqlite3" && c.Database.Dialect != "mysql" && c.Database.Dialect != "postgres" {
+		fail("invalid value for %s (%q): must be sqlite3, mysql or postgres", EnvDatabaseDialect, c.Database.Dialect)
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Level > logs[j].Level })
+	return logs
+}
+
+// closestEnv returns the known variable with the smallest edit distance to key, if it's likely a typo.
+func closestEnv(key string, settings []Setting) string {
+	best, bestDistance := "", 4
+	for _, setting := range settings {
+		for _, candidate := range []string{setting.Env, setting.Env + "_FILE"} {
+			if distance := editDistance(key, candidate); distance < bestDistance {
+				best, bestDistance = candidate, distance
+			}
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
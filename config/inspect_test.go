@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotify/server/v2/mode"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	mode.Set(mode.TestDev)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "custom.env")
+	secretPath := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(configPath, []byte("GOTIFY_SMTP_HOST=mail.example.com\n"), 0o600))
+	require.NoError(t, os.WriteFile(secretPath, []byte("hunter2"), 0o600))
+	t.Setenv("GOTIFY_CONFIG_FILE", configPath)
+	t.Setenv("GOTIFY_SERVER_PORT", "8080")
+	t.Setenv("GOTIFY_SMTP_PASSWORD_FILE", secretPath)
+	t.Setenv("GOTIFY_MQTT_SUBSCRIPTIONS", `{"home/alarm/#":"Atoken"}`)
+	t.Cleanup(func() { os.Unsetenv("GOTIFY_SMTP_HOST") })
+
+	_, _, settings := Inspect()
+	byEnv := map[string]Setting{}
+	for _, setting := range settings {
+		byEnv[setting.Env] = setting
+	}
+
+	assert.Equal(t, Setting{Env: EnvServerPort, Value: "8080", Source: SourceEnv}, byEnv[EnvServerPort])
+	assert.Equal(t, Setting{Env: EnvSMTPHost, Value: "mail.example.com", Source: SourceFile}, byEnv[EnvSMTPHost])
+	assert.Equal(t, Setting{Env: EnvSMTPPort, Value: "587", Source: SourceDefault}, byEnv[EnvSMTPPort])
+	assert.Equal(t, Setting{Env: EnvSMTPPassword, Value: "hunter2", Source: SourceEnv, FromFile: secretPath, Secret: true}, byEnv[EnvSMTPPassword])
+	assert.Equal(t, "********", byEnv[EnvSMTPPassword].MaskedValue())
+	assert.Equal(t, "********", byEnv[EnvMQTTSubscriptions].MaskedValue(), "subscriptions contain application tokens")
+	assert.Equal(t, "data/gotify.db", byEnv[EnvDatabaseConnection].MaskedValue(), "sqlite paths contain no credentials")
+	assert.Equal(t, "info", byEnv[EnvLogLevel].Value)
+}
+
+func TestCheck_unknownVariables(t *testing.T) {
+	mode.Set(mode.TestDev)
+	t.Setenv("GOTIFY_SERVER_SSL_CERTFIEL", "cert.pem")
+	t.Setenv("GOTIFY_SOMETHING_ELSE_ENTIRELY", "1")
+	t.Setenv("GOTIFY_DEFAULTUSER_PASS_FILE", "/dev/null")
+
+	conf, _, settings := Inspect()
+	assert.Equal(t, []FutureLog{
+		{Level: zerolog.WarnLevel, Msg: "unknown variable GOTIFY_SERVER_SSL_CERTFIEL, did you mean GOTIFY_SERVER_SSL_CERTFILE?"},
+		{Level: zerolog.WarnLevel, Msg: "unknown variable GOTIFY_SOMETHING_ELSE_ENTIRELY"},
+	}, Check(conf, settings))
+}
+
+func TestCheck_conflictingSettings(t *testing.T) {
+	mode.Set(mode.TestDev)
+	t.Setenv("GOTIFY_SERVER_SSL_ENABLED", "true")
+	t.Setenv("GOTIFY_SERVER_SSL_CERTFILE", filepath.Join(t.TempDir(), "missing.pem"))
+	t.Setenv("GOTIFY_OIDC_ENABLED", "true")
+	t.Setenv("GOTIFY_OIDC_CLIENTID", "gotify")
+	t.Setenv("GOTIFY_OIDC_REDIRECTURL", "https://push.example.com/auth/oidc/callback")
+
+	conf, _, settings := Inspect()
+	logs := Check(conf, settings)
+	var msgs []string
+	for _, log := range logs {
+		assert.Equal(t, zerolog.ErrorLevel, log.Level)
+		msgs = append(msgs, log.Msg)
+	}
+	assert.Len(t, msgs, 3)
+	assert.Contains(t, msgs, "GOTIFY_SERVER_SSL_ENABLED is enabled without Let's Encrypt, but GOTIFY_SERVER_SSL_CERTFILE or GOTIFY_SERVER_SSL_CERTKEY isn't set")
+	assert.Contains(t, msgs, "GOTIFY_OIDC_ENABLED is enabled, but GOTIFY_OIDC_ISSUER isn't set")
+}
+
+func TestCheck_overlappingStorageQuotas(t *testing.T) {
+	mode.Set(mode.TestDev)
+	t.Setenv("GOTIFY_ATTACHMENTS_USERQUOTABYTES", "2000")
+	t.Setenv("GOTIFY_QUOTA_MAXSTORAGEBYTES", "1000")
+
+	conf, _, settings := Inspect()
+	assert.Equal(t, []FutureLog{
+		{Level: zerolog.WarnLevel, Msg: "GOTIFY_ATTACHMENTS_USERQUOTABYTES has no effect for users without their own storage quota, GOTIFY_QUOTA_MAXSTORAGEBYTES is lower"},
+	}, Check(conf, settings))
+
+	t.Setenv("GOTIFY_QUOTA_MAXSTORAGEBYTES", "3000")
+	conf, _, settings = Inspect()
+	assert.Empty(t, Check(conf, settings))
+}
+
+func TestCheck_valid(t *testing.T) {
+	mode.Set(mode.TestDev)
+	conf, _, settings := Inspect()
+	assert.Empty(t, Check(conf, settings))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("abc", "abc"))
+	assert.Equal(t, 2, editDistance("CERTFIEL", "CERTFILE"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+	assert.Equal(t, 1, editDistance("PORT", "PORTS"))
+}
+
+func TestReloadFile(t *testing.T) {
+	mode.Set(mode.TestDev)
+	configPath := filepath.Join(t.TempDir(), "custom.env")
+	require.NoError(t, os.WriteFile(configPath, []byte("GOTIFY_SMTP_HOST=old.example.com\nGOTIFY_SMTP_PORT=25\nGOTIFY_SMTP_FROM=file@example.com\n"), 0o600))
+	t.Setenv("GOTIFY_CONFIG_FILE", configPath)
+	t.Setenv("GOTIFY_SMTP_FROM", "env@example.com")
+	t.Cleanup(func() {
+		os.Unsetenv("GOTIFY_SMTP_HOST")
+		os.Unsetenv("GOTIFY_SMTP_PORT")
+	})
+
+	old, _ := Get()
+	assert.Equal(t, "old.example.com", old.SMTP.Host)
+	assert.Equal(t, 25, old.SMTP.Port)
+	assert.Equal(t, "env@example.com", old.SMTP.From, "the environment takes precedence")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("GOTIFY_SMTP_HOST=new.example.com\nGOTIFY_SMTP_FROM=file@example.com\n"), 0o600))
+	reloaded, _ := Get()
+	assert.Equal(t, "new.example.com", reloaded.SMTP.Host)
+	assert.Equal(t, 587, reloaded.SMTP.Port, "removed settings use the default")
+	assert.Equal(t, "env@example.com", reloaded.SMTP.From)
+
+	assert.Equal(t, []string{EnvSMTPHost, EnvSMTPPort}, Changed(old, reloaded))
+	assert.Empty(t, Changed(reloaded, reloaded))
+}
@@ -26,10 +26,25 @@ const (
 	EnvServerSecureCookie               = "GOTIFY_SERVER_SECURECOOKIE"
 	EnvDatabaseDialect                  = "GOTIFY_DATABASE_DIALECT"
 	EnvDatabaseConnection               = "GOTIFY_DATABASE_CONNECTION"
+	EnvDatabaseMaxOpenConns             = "GOTIFY_DATABASE_MAXOPENCONNS"
+	EnvDatabaseMaxIdleConns             = "GOTIFY_DATABASE_MAXIDLECONNS"
+	EnvDatabaseConnMaxLifetimeSeconds   = "GOTIFY_DATABASE_CONNMAXLIFETIMESECONDS"
+	EnvDatabaseConnMaxIdleTimeSeconds   = "GOTIFY_DATABASE_CONNMAXIDLETIMESECONDS"
+	EnvDatabaseSQLiteWAL                = "GOTIFY_DATABASE_SQLITE_WAL"
+	EnvDatabaseSQLiteBusyTimeoutMillis  = "GOTIFY_DATABASE_SQLITE_BUSYTIMEOUTMILLIS"
+	EnvDatabaseSQLiteReadConns          = "GOTIFY_DATABASE_SQLITE_READCONNS"
 	EnvDefaultUserName                  = "GOTIFY_DEFAULTUSER_NAME"
 	EnvDefaultUserPass                  = "GOTIFY_DEFAULTUSER_PASS"
 	EnvPassStrength                     = "GOTIFY_PASSSTRENGTH"
 	EnvUploadedImagesDir                = "GOTIFY_UPLOADEDIMAGESDIR"
+	EnvAttachmentsDir                   = "GOTIFY_ATTACHMENTS_DIR"
+	EnvAttachmentsMaxBytes              = "GOTIFY_ATTACHMENTS_MAXBYTES"
+	EnvAttachmentsUserQuotaBytes        = "GOTIFY_ATTACHMENTS_USERQUOTABYTES"
+	EnvQuotaMaxApplications             = "GOTIFY_QUOTA_MAXAPPLICATIONS"
+	EnvQuotaMaxClients                  = "GOTIFY_QUOTA_MAXCLIENTS"
+	EnvQuotaMaxMessages                 = "GOTIFY_QUOTA_MAXMESSAGES"
+	EnvQuotaMaxStorageBytes             = "GOTIFY_QUOTA_MAXSTORAGEBYTES"
+	EnvQuotaMaxPluginStorageBytes       = "GOTIFY_QUOTA_MAXPLUGINSTORAGEBYTES"
 	EnvPluginsDir                       = "GOTIFY_PLUGINSDIR"
 	EnvRegistration                     = "GOTIFY_REGISTRATION"
 	EnvOIDCEnabled                      = "GOTIFY_OIDC_ENABLED"
@@ -41,5 +56,30 @@ const (
 	EnvOIDCAutoRegister                 = "GOTIFY_OIDC_AUTOREGISTER"
 	EnvOIDCLinkByUsername               = "GOTIFY_OIDC_LINK_BY_USERNAME"
 	EnvOIDCScopes                       = "GOTIFY_OIDC_SCOPES"
+	EnvSMTPServerEnabled                = "GOTIFY_SMTPSERVER_ENABLED"
+	EnvSMTPServerListenAddr             = "GOTIFY_SMTPSERVER_LISTENADDR"
+	EnvSMTPServerPort                   = "GOTIFY_SMTPSERVER_PORT"
+	EnvSMTPServerDomain                 = "GOTIFY_SMTPSERVER_DOMAIN"
+	EnvSMTPServerMaxMessageBytes        = "GOTIFY_SMTPSERVER_MAXMESSAGEBYTES"
+	EnvSMTPServerUsername               = "GOTIFY_SMTPSERVER_USERNAME"
+	EnvSMTPServerPassword               = "GOTIFY_SMTPSERVER_PASSWORD"
+	EnvSMTPServerCertFile               = "GOTIFY_SMTPSERVER_CERTFILE"
+	EnvSMTPServerCertKey                = "GOTIFY_SMTPSERVER_CERTKEY"
+	EnvSMTPServerAllowInsecureAuth      = "GOTIFY_SMTPSERVER_ALLOWINSECUREAUTH"
+	EnvSMTPHost                         = "GOTIFY_SMTP_HOST"
+	EnvSMTPPort                         = "GOTIFY_SMTP_PORT"
+	EnvSMTPUsername                     = "GOTIFY_SMTP_USERNAME"
+	EnvSMTPPassword                     = "GOTIFY_SMTP_PASSWORD"
+	EnvSMTPFrom                         = "GOTIFY_SMTP_FROM"
+	EnvSMTPEncryption                   = "GOTIFY_SMTP_ENCRYPTION"
+	EnvMQTTEnabled                      = "GOTIFY_MQTT_ENABLED"
+	EnvMQTTBroker                       = "GOTIFY_MQTT_BROKER"
+	EnvMQTTClientID                     = "GOTIFY_MQTT_CLIENTID"
+	EnvMQTTUsername                     = "GOTIFY_MQTT_USERNAME"
+	EnvMQTTPassword                     = "GOTIFY_MQTT_PASSWORD"
+	EnvMQTTQoS                          = "GOTIFY_MQTT_QOS"
+	EnvMQTTPublishTopic                 = "GOTIFY_MQTT_PUBLISHTOPIC"
+	EnvMQTTSubscriptions                = "GOTIFY_MQTT_SUBSCRIPTIONS"
+	EnvRulesAllowPrivateWebhooks        = "GOTIFY_RULES_ALLOWPRIVATEWEBHOOKS"
 	EnvNoColor                          = "NOCOLOR"
 )
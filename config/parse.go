@@ -10,11 +10,15 @@ import (
 )
 
 func lookupEnv(env string) (string, bool, error) {
-	if raw, ok := os.LookupEnv(env); ok {
+	raw, rawOk := os.LookupEnv(env)
+	path, pathOk := os.LookupEnv(env + "_FILE")
+	if rawOk && pathOk {
+		return "", false, fmt.Errorf("%s and %s_FILE must not be set both", env, env)
+	}
+	if rawOk {
 		return raw, true, nil
 	}
-	path, ok := os.LookupEnv(env + "_FILE")
-	if !ok {
+	if !pathOk {
 		return "", false, nil
 	}
 	data, err := os.ReadFile(path)
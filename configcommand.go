@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/mode"
+	"github.com/rs/zerolog"
+)
+
+func configCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 || (args[0] != "check" && args[0] != "print") {
+		fmt.Fprintln(stderr, "gotify config: expected check or print")
+		return 2
+	}
+	mode.Set(Mode)
+	conf, futureLogs, settings := config.Inspect()
+
+	if args[0] == "print" {
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VARIABLE\tVALUE\tSOURCE")
+		for _, setting := range settings {
+			source := string(setting.Source)
+			if setting.FromFile != "" {
+				source += " via " + setting.FromFile
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Env, setting.MaskedValue(), source)
+		}
+		w.Flush()
+		return 0
+	}
+
+	failed := false
+	for _, futureLog := range append(futureLogs, config.Check(conf, settings)...) {
+		switch {
+		case futureLog.Level >= zerolog.ErrorLevel:
+			fmt.Fprintln(stdout, "error:", futureLog.Msg)
+			failed = true
+		case futureLog.Level == zerolog.WarnLevel:
+			fmt.Fprintln(stdout, "warning:", futureLog.Msg)
+		case futureLog.Level == zerolog.InfoLevel:
+			fmt.Fprintln(stdout, futureLog.Msg)
+		}
+	}
+	if failed {
+		return 1
+	}
+	fmt.Fprintln(stdout, "The configuration is valid.")
+	return 0
+}
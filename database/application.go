@@ -57,6 +57,12 @@ func (d *GormDatabase) CreateApplication(application *model.Application) error {
 // DeleteApplicationByID deletes an application by its id.
 func (d *GormDatabase) DeleteApplicationByID(id uint) error {
 	d.DeleteMessagesByApplication(id)
+	d.DB.Where("application_id = ?", id).Delete(&model.MailForwardRule{})
+	d.DB.Where("application_id = ? OR target_application_id = ?", id, id).Delete(&model.Rule{})
+	d.DeleteWebhookTemplateByApplication(id)
+	d.DeleteScheduledMessagesByApplication(id)
+	d.DeleteEscalationPolicyByApplication(id)
+	d.DB.Where("application_id = ?", id).Delete(&model.ApplicationShare{})
 	return d.DB.Where("id = ?", id).Delete(&model.Application{}).Error
 }
 
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetAttachmentByFile returns the attachment stored in the given file or nil.
+func (d *GormDatabase) GetAttachmentByFile(file string) (*model.Attachment, error) {
+	attachment := new(model.Attachment)
+	err := d.DB.Where("file = ?", file).Find(attachment).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if attachment.File == file && file != "" {
+		return attachment, err
+	}
+	return nil, err
+}
+
+// GetAttachmentsByMessage returns all attachments of a message.
+func (d *GormDatabase) GetAttachmentsByMessage(messageID uint) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	err := d.DB.Where("message_id = ?", messageID).Order("id ASC").Find(&attachments).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return attachments, err
+}
+
+// GetOrphanedAttachments returns up to limit attachments whose message was deleted.
+func (d *GormDatabase) GetOrphanedAttachments(limit int) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	err := d.DB.Where("message_id NOT IN (?)", d.DB.Model(&model.Message{}).Select("id")).
+		Order("id ASC").Limit(limit).Find(&attachments).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return attachments, err
+}
+
+// GetOrphanedAttachmentsByMessages returns the attachments of the given messages which were deleted.
+func (d *GormDatabase) GetOrphanedAttachmentsByMessages(messageIDs []uint) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+	err := d.DB.Where("message_id IN ?", messageIDs).
+		Where("message_id NOT IN (?)", d.DB.Model(&model.Message{}).Select("id").Where("id IN ?", messageIDs)).
+		Order("id ASC").Find(&attachments).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return attachments, err
+}
+
+// GetAttachedMessageIDsByApplication returns the ids of the messages of an application which have attachments.
+func (d *GormDatabase) GetAttachedMessageIDsByApplication(appID uint) ([]uint, error) {
+	ids := []uint{}
+	err := d.DB.Model(&model.Attachment{}).Distinct("message_id").
+		Where("message_id IN (?)", d.DB.Model(&model.Message{}).Select("id").Where("application_id = ?", appID)).
+		Pluck("message_id", &ids).Error
+	return ids, err
+}
+
+// GetAttachedMessageIDsByUser returns the ids of the messages with attachments of the applications
+// owned by the user and of the groups of the user.
+func (d *GormDatabase) GetAttachedMessageIDsByUser(userID uint) ([]uint, error) {
+	ids := []uint{}
+	groups := d.DB.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+	apps := d.DB.Model(&model.Application{}).Select("id").Where("user_id = ? OR group_id IN (?)", userID, groups)
+	err := d.DB.Model(&model.Attachment{}).Distinct("message_id").
+		Where("message_id IN (?)", d.DB.Model(&model.Message{}).Select("id").Where("application_id IN (?)", apps)).
+		Pluck("message_id", &ids).Error
+	return ids, err
+}
+
+// GetAttachmentSizeByUser returns the total size in bytes of the attachments of a user.
+func (d *GormDatabase) GetAttachmentSizeByUser(userID uint) (int64, error) {
+	var size int64
+	err := d.DB.Model(&model.Attachment{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").Scan(&size).Error
+	return size, err
+}
+
+// CreateAttachments creates the attachments.
+func (d *GormDatabase) CreateAttachments(attachments []*model.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	return d.DB.Create(&attachments).Error
+}
+
+// CreateMessageWithAttachments creates the message and its attachments in one transaction.
+func (d *GormDatabase) CreateMessageWithAttachments(message *model.Message, attachments []*model.Attachment) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		toUTC(message)
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		if len(attachments) == 0 {
+			return nil
+		}
+		for _, attachment := range attachments {
+			attachment.MessageID = message.ID
+		}
+		return tx.Create(&attachments).Error
+	})
+}
+
+// DeleteAttachmentByID deletes an attachment by its id.
+func (d *GormDatabase) DeleteAttachmentByID(id uint) error {
+	return d.DB.Where("id = ?", id).Delete(&model.Attachment{}).Error
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestAttachment() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "ci"}
+	s.db.CreateApplication(app)
+	msg := &model.Message{ApplicationID: app.ID, Message: "ui test failed"}
+	s.db.CreateMessage(msg)
+	other := &model.Message{ApplicationID: app.ID, Message: "build failed"}
+	s.db.CreateMessage(other)
+
+	if attachment, err := s.db.GetAttachmentByFile("screenshot.png"); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), attachment, "not existing attachment")
+	}
+	if size, err := s.db.GetAttachmentSizeByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), int64(0), size)
+	}
+	assert.NoError(s.T(), s.db.CreateAttachments(nil))
+
+	assert.NoError(s.T(), s.db.CreateAttachments([]*model.Attachment{
+		{MessageID: msg.ID, UserID: user.ID, Name: "a.png", File: "screenshot.png", ContentType: "image/png", Size: 100},
+		{MessageID: msg.ID, UserID: user.ID, Name: "b.pdf", File: "report.pdf", ContentType: "application/pdf", Size: 50},
+		{MessageID: other.ID, UserID: user.ID, Name: "c.png", File: "log.png", ContentType: "image/png", Size: 7},
+	}))
+	if attachment, err := s.db.GetAttachmentByFile("screenshot.png"); assert.NoError(s.T(), err) && assert.NotNil(s.T(), attachment) {
+		assert.Equal(s.T(), msg.ID, attachment.MessageID)
+		assert.Equal(s.T(), "a.png", attachment.Name)
+	}
+	if attachments, err := s.db.GetAttachmentsByMessage(msg.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), attachments, 2)
+	}
+	if size, err := s.db.GetAttachmentSizeByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), int64(157), size)
+	}
+	if orphaned, err := s.db.GetOrphanedAttachments(10); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), orphaned)
+	}
+
+	if ids, err := s.db.GetAttachedMessageIDsByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.ElementsMatch(s.T(), []uint{msg.ID, other.ID}, ids)
+	}
+	if ids, err := s.db.GetAttachedMessageIDsByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.ElementsMatch(s.T(), []uint{msg.ID, other.ID}, ids)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteMessageByID(msg.ID))
+	if orphaned, err := s.db.GetOrphanedAttachmentsByMessages([]uint{msg.ID, other.ID}); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), orphaned, 2)
+	}
+	if orphaned, err := s.db.GetOrphanedAttachmentsByMessages([]uint{other.ID}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), orphaned)
+	}
+	if orphaned, err := s.db.GetOrphanedAttachments(1); assert.NoError(s.T(), err) && assert.Len(s.T(), orphaned, 1) {
+		assert.Equal(s.T(), "screenshot.png", orphaned[0].File)
+		assert.NoError(s.T(), s.db.DeleteAttachmentByID(orphaned[0].ID))
+	}
+	if orphaned, err := s.db.GetOrphanedAttachments(10); assert.NoError(s.T(), err) && assert.Len(s.T(), orphaned, 1) {
+		assert.Equal(s.T(), "report.pdf", orphaned[0].File)
+	}
+	if size, err := s.db.GetAttachmentSizeByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), int64(57), size)
+	}
+}
+
+func (s *DatabaseSuite) TestCreateMessageWithAttachments() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "ci"}
+	s.db.CreateApplication(app)
+	s.db.CreateAttachments([]*model.Attachment{{MessageID: 99, UserID: user.ID, File: "screenshot.png"}})
+
+	msg := &model.Message{ApplicationID: app.ID, Message: "ui test failed"}
+	attachments := []*model.Attachment{{UserID: user.ID, File: "report.pdf"}}
+	assert.NoError(s.T(), s.db.CreateMessageWithAttachments(msg, attachments))
+	if actual, err := s.db.GetAttachmentsByMessage(msg.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), actual, 1) {
+		assert.Equal(s.T(), "report.pdf", actual[0].File)
+	}
+
+	failing := &model.Message{ApplicationID: app.ID, Message: "build failed"}
+	assert.Error(s.T(), s.db.CreateMessageWithAttachments(failing, []*model.Attachment{{UserID: user.ID, File: "screenshot.png"}}), "duplicate file")
+	if actual, err := s.db.GetMessageByID(failing.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual, "message is rolled back")
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// Models returns the models of all tables.
+func Models() []any {
+	return []any{
+		new(model.User),
+		new(model.Application),
+		new(model.Message),
+		new(model.Client),
+		new(model.PluginConf),
+		new(model.MailForwardRule),
+		new(model.WebhookTemplate),
+		new(model.ScheduledMessage),
+		new(model.EscalationPolicy),
+		new(model.Escalation),
+		new(model.Rule),
+		new(model.ApplicationShare),
+		new(model.Group),
+		new(model.GroupMember),
+		new(model.MessageState),
+		new(model.Attachment),
+		new(model.UserQuota),
+	}
+}
+
+// TableName returns the name of the table of a model.
+func TableName(db *gorm.DB, m any) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+// ErrTargetNotEmpty is returned when copying into a database which already contains rows.
+var ErrTargetNotEmpty = errors.New("the target database is not empty")
+
+// TableCount is the amount of rows of a table.
+type TableCount struct {
+	Table string
+	Rows  int64
+}
+
+// CopyTo copies all rows of all tables to the target database, the ids are preserved.
+// The target must be empty, unless force is set, then its rows are deleted first.
+// The rows are copied in one transaction, if the row counts don't match afterwards the target is left unchanged.
+func (d *GormDatabase) CopyTo(target *GormDatabase, force bool, batchSize int) ([]TableCount, error) {
+	if !force {
+		for _, m := range Models() {
+			count := int64(0)
+			if err := target.DB.Model(m).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				name, _ := TableName(target.DB, m)
+				return nil, fmt.Errorf("%w, table %s contains %d rows", ErrTargetNotEmpty, name, count)
+			}
+		}
+	}
+
+	var counts []TableCount
+	err := d.DB.Transaction(func(source *gorm.DB) error {
+		return target.DB.Transaction(func(tx *gorm.DB) error {
+			for _, m := range Models() {
+				name, err := TableName(tx, m)
+				if err != nil {
+					return err
+				}
+				if force {
+					if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(m).Error; err != nil {
+						return err
+					}
+				}
+				copied, err := copyTable(source, tx, m, batchSize)
+				if err != nil {
+					return fmt.Errorf("table %s: %w", name, err)
+				}
+
+				sourceCount, targetCount := int64(0), int64(0)
+				if err := source.Model(m).Count(&sourceCount).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(m).Count(&targetCount).Error; err != nil {
+					return err
+				}
+				if sourceCount != targetCount || copied != targetCount {
+					return fmt.Errorf("table %s: row count mismatch, source has %d rows, copied %d rows, target has %d rows",
+						name, sourceCount, copied, targetCount)
+				}
+				counts = append(counts, TableCount{Table: name, Rows: targetCount})
+			}
+			return ResetSequences(tx)
+		}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func copyTable(source, target *gorm.DB, m any, batchSize int) (int64, error) {
+	rows, err := source.Model(m).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	copied := int64(0)
+	batch := NewBatch(m, batchSize)
+	for rows.Next() {
+		row := reflect.New(reflect.TypeOf(m).Elem())
+		if err := source.ScanRows(rows, row.Interface()); err != nil {
+			return copied, err
+		}
+		if err := batch.Add(target, row.Interface()); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	if err := rows.Err(); err != nil {
+		return copied, err
+	}
+	return copied, batch.Flush(target)
+}
+
+// Batch collects rows of a model and inserts them together.
+type Batch struct {
+	rows reflect.Value
+	size int
+}
+
+// NewBatch creates a batch for rows of the model type m points to, inserting size rows at once.
+func NewBatch(m any, size int) *Batch {
+	if size < 1 {
+		size = 1
+	}
+	return &Batch{rows: reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(m)), 0, size), size: size}
+}
+
+// Add adds a row, the rows are inserted once the batch is full.
+func (b *Batch) Add(tx *gorm.DB, row any) error {
+	if message, ok := row.(*model.Message); ok {
+		toUTC(message)
+	}
+	b.rows = reflect.Append(b.rows, reflect.ValueOf(row))
+	if b.rows.Len() < b.size {
+		return nil
+	}
+	return b.Flush(tx)
+}
+
+// Flush inserts the collected rows.
+func (b *Batch) Flush(tx *gorm.DB) error {
+	if b.rows.Len() == 0 {
+		return nil
+	}
+	err := tx.Create(b.rows.Interface()).Error
+	b.rows = reflect.MakeSlice(b.rows.Type(), 0, b.size)
+	return err
+}
+
+// ResetSequences sets the id sequences of postgres to the highest inserted ids.
+// Inserting rows with ids doesn't advance the sequences, the other dialects do this on insert.
+func ResetSequences(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, m := range Models() {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		field := stmt.Schema.PrioritizedPrimaryField
+		if field == nil || !field.AutoIncrement {
+			continue
+		}
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', '%[2]s'), COALESCE(MAX(%[2]s), 1), MAX(%[2]s) IS NOT NULL) FROM %[1]s",
+			stmt.Schema.Table, field.DBName)
+		if err := tx.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
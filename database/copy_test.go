@@ -0,0 +1,71 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *DatabaseSuite) TestCopyTo() {
+	user := &model.User{Name: "jmattheis", Pass: []byte{1}}
+	require.NoError(s.T(), s.db.CreateUser(user))
+	app := &model.Application{UserID: user.ID, Token: "Aapp", Name: "backup", SortKey: "a0"}
+	require.NoError(s.T(), s.db.CreateApplication(app))
+	for i := 0; i < 7; i++ {
+		require.NoError(s.T(), s.db.CreateMessage(&model.Message{ApplicationID: app.ID, Message: "msg", Extras: []byte(`{"a::b":1}`)}))
+	}
+	require.NoError(s.T(), s.db.DeleteMessageByID(2))
+	require.NoError(s.T(), s.db.CreateGroup(&model.Group{Name: "ops", Members: []uint{1, user.ID}}))
+
+	target, err := New("sqlite3", s.tmpDir.Path("target.db"), Pool{}, "", "", 5, false, fixedNow)
+	require.NoError(s.T(), err)
+	defer target.Close()
+
+	counts, err := s.db.CopyTo(target, false, 3)
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), counts, TableCount{Table: "users", Rows: 2})
+	assert.Contains(s.T(), counts, TableCount{Table: "messages", Rows: 6})
+	assert.Contains(s.T(), counts, TableCount{Table: "group_members", Rows: 2})
+	assert.Len(s.T(), counts, len(Models()))
+
+	sourceMessages, err := s.db.GetMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	targetMessages, err := target.GetMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), sourceMessages, targetMessages)
+	targetApp, err := target.GetApplicationByToken("Aapp")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "a0", targetApp.SortKey)
+	group, err := target.GetGroupByName("ops")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []uint{1, user.ID}, group.Members)
+
+	msg := &model.Message{ApplicationID: app.ID, Message: "new"}
+	require.NoError(s.T(), target.CreateMessage(msg))
+	assert.Equal(s.T(), uint(8), msg.ID)
+}
+
+func (s *DatabaseSuite) TestCopyTo_nonEmptyTarget() {
+	target, err := New("sqlite3", s.tmpDir.Path("target.db"), Pool{}, "admin", "pw", 5, true, fixedNow)
+	require.NoError(s.T(), err)
+	defer target.Close()
+	require.NoError(s.T(), target.CreateUser(&model.User{Name: "other"}))
+
+	_, err = s.db.CopyTo(target, false, 10)
+	assert.True(s.T(), errors.Is(err, ErrTargetNotEmpty))
+	if user, err := target.GetUserByName("other"); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), user)
+	}
+
+	counts, err := s.db.CopyTo(target, true, 10)
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), counts, TableCount{Table: "users", Rows: 1})
+	if user, err := target.GetUserByName("other"); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), user)
+	}
+	if user, err := target.GetUserByName("defaultUser"); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), user)
+	}
+}
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"database/sql"
 	"errors"
 	"math"
 	"os"
@@ -29,8 +28,40 @@ func (gormLogWriter) Printf(format string, args ...any) {
 
 var mkdirAll = os.MkdirAll
 
-// New creates a new wrapper for the gorm database framework.
-func New(dialect, connection, defaultUser, defaultPass string, strength int, createDefaultUserIfNotExist bool, now func() time.Time) (*GormDatabase, error) {
+// New creates a new wrapper for the gorm database framework and migrates the schema to the latest version.
+func New(dialect, connection string, pool Pool, defaultUser, defaultPass string, strength int, createDefaultUserIfNotExist bool, now func() time.Time) (*GormDatabase, error) {
+	d, err := Open(dialect, connection, pool, now)
+	if err != nil {
+		return nil, err
+	}
+	db := d.DB
+
+	// a newer gotify version may have changed the schema, AutoMigrate must not touch it
+	if err := d.checkSchemaVersion(); err != nil {
+		d.Close()
+		return nil, err
+	}
+	if err := db.AutoMigrate(migratedModels()...); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	userCount := int64(0)
+	db.Find(new(model.User)).Count(&userCount)
+	if createDefaultUserIfNotExist && userCount == 0 {
+		db.Create(&model.User{Name: defaultUser, Pass: password.CreatePassword(defaultPass, strength), Admin: true})
+	}
+
+	if _, err := d.Migrate(now(), false); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Open creates a new wrapper for the gorm database framework without migrating the schema.
+func Open(dialect, connection string, pool Pool, now func() time.Time) (*GormDatabase, error) {
 	createDirectoryIfSqlite(dialect, connection)
 
 	dbLogger := logger.New(gormLogWriter{}, logger.Config{
@@ -46,6 +77,19 @@ func New(dialect, connection, defaultUser, defaultPass string, strength int, cre
 		NowFunc:                                  now,
 	}
 
+	if dialect == "sqlite3" {
+		conn, err := openSqlite(connection, pool)
+		if err != nil {
+			return nil, err
+		}
+		db, err := gorm.Open(sqlite.New(sqlite.Config{Conn: conn}), gormConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &GormDatabase{DB: db, sqlite: conn}, nil
+	}
+
 	var db *gorm.DB
 	err := errors.New("unsupported dialect: " + dialect)
 
@@ -54,8 +98,6 @@ func New(dialect, connection, defaultUser, defaultPass string, strength int, cre
 		db, err = gorm.Open(mysql.Open(connection), gormConfig)
 	case "postgres":
 		db, err = gorm.Open(postgres.Open(connection), gormConfig)
-	case "sqlite3":
-		db, err = gorm.Open(sqlite.Open(connection), gormConfig)
 	}
 
 	if err != nil {
@@ -67,43 +109,21 @@ func New(dialect, connection, defaultUser, defaultPass string, strength int, cre
 		return nil, err
 	}
 
-	// We normally don't need that much connections, so we limit them. F.ex. mysql complains about
-	// "too many connections", while load testing Gotify.
-	sqldb.SetMaxOpenConns(10)
-
-	if dialect == "sqlite3" {
-		// We use the database connection inside the handlers from the http
-		// framework, therefore concurrent access occurs. Sqlite cannot handle
-		// concurrent writes, so we limit sqlite to one connection.
-		// see https://github.com/mattn/go-sqlite3/issues/274
-		sqldb.SetMaxOpenConns(1)
-	}
-
-	if dialect == "mysql" {
+	if dialect == "mysql" && pool.ConnMaxLifetime == 0 {
 		// Mysql has a setting called wait_timeout, which defines the duration
 		// after which a connection may not be used anymore.
 		// The default for this setting on mariadb is 10 minutes.
 		// See https://github.com/docker-library/mariadb/issues/113
-		sqldb.SetConnMaxLifetime(9 * time.Minute)
-	}
-
-	if err := db.AutoMigrate(new(model.User), new(model.Application), new(model.Message), new(model.Client), new(model.PluginConf)); err != nil {
-		return nil, err
-	}
-
-	userCount := int64(0)
-	db.Find(new(model.User)).Count(&userCount)
-	if createDefaultUserIfNotExist && userCount == 0 {
-		db.Create(&model.User{Name: defaultUser, Pass: password.CreatePassword(defaultPass, strength), Admin: true})
-	}
-
-	if err := db.Transaction(fillMissingSortKeys, &sql.TxOptions{Isolation: sql.LevelSerializable}); err != nil {
-		return nil, err
+		pool.ConnMaxLifetime = 9 * time.Minute
 	}
 
-	if err := db.Transaction(func(tx *gorm.DB) error { return fillMissingCreatedAt(tx, now()) }, &sql.TxOptions{Isolation: sql.LevelSerializable}); err != nil {
-		return nil, err
+	// We normally don't need that much connections, so we limit them. F.ex. mysql complains about
+	// "too many connections", while load testing Gotify.
+	maxOpenConns := pool.MaxOpenConns
+	if maxOpenConns == 0 {
+		maxOpenConns = defaultMaxOpenConns
 	}
+	pool.apply(sqldb, maxOpenConns)
 
 	return &GormDatabase{DB: db}, nil
 }
@@ -123,6 +143,33 @@ func fillMissingCreatedAt(db *gorm.DB, now time.Time) error {
 	return nil
 }
 
+// messageDatesToUTC rewrites the dates of messages which were stored with the local offset in utc.
+// Only sqlite stores the offset, the dates are compared as text there and therefore must all be in utc.
+func messageDatesToUTC(db *gorm.DB) error {
+	if db.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	var messages []*model.Message
+	return db.Select("id", "date", "expires_at").FindInBatches(&messages, 1000, func(tx *gorm.DB, _ int) error {
+		for _, message := range messages {
+			_, dateOffset := message.Date.Zone()
+			expiresOffset := 0
+			if message.ExpiresAt != nil {
+				_, expiresOffset = message.ExpiresAt.Zone()
+			}
+			if dateOffset == 0 && expiresOffset == 0 {
+				continue
+			}
+			toUTC(message)
+			err := db.Model(message).UpdateColumns(map[string]any{"date": message.Date, "expires_at": message.ExpiresAt}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
 func fillMissingSortKeys(db *gorm.DB) error {
 	missingSort := int64(0)
 	if err := db.Model(new(model.Application)).Where("sort_key IS NULL OR sort_key = ''").Count(&missingSort).Error; err != nil {
@@ -168,11 +215,16 @@ func createDirectoryIfSqlite(dialect, connection string) {
 
 // GormDatabase is a wrapper for the gorm framework.
 type GormDatabase struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	sqlite *sqlitePool
 }
 
 // Close closes the gorm database connection.
 func (d *GormDatabase) Close() {
+	if d.sqlite != nil {
+		d.sqlite.Close()
+		return
+	}
 	sqldb, err := d.DB.DB()
 	if err != nil {
 		return
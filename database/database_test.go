@@ -10,6 +10,7 @@ import (
 	"github.com/gotify/server/v2/model"
 	"github.com/gotify/server/v2/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
 )
@@ -30,7 +31,7 @@ type DatabaseSuite struct {
 
 func (s *DatabaseSuite) BeforeTest(suiteName, testName string) {
 	s.tmpDir = test.NewTmpDir("gotify_databasesuite")
-	db, err := New("sqlite3", s.tmpDir.Path("testdb.db"), "defaultUser", "defaultPass", 5, true, fixedNow)
+	db, err := New("sqlite3", s.tmpDir.Path("testdb.db"), Pool{}, "defaultUser", "defaultPass", 5, true, fixedNow)
 	assert.Nil(s.T(), err)
 	s.db = db
 }
@@ -43,7 +44,7 @@ func (s *DatabaseSuite) AfterTest(suiteName, testName string) {
 func TestInvalidDialect(t *testing.T) {
 	tmpDir := test.NewTmpDir("gotify_testinvaliddialect")
 	defer tmpDir.Clean()
-	_, err := New("asdf", tmpDir.Path("testdb.db"), "defaultUser", "defaultPass", 5, true, fixedNow)
+	_, err := New("asdf", tmpDir.Path("testdb.db"), Pool{}, "defaultUser", "defaultPass", 5, true, fixedNow)
 	assert.Error(t, err)
 }
 
@@ -51,7 +52,7 @@ func TestCreateSqliteFolder(t *testing.T) {
 	tmpDir := test.NewTmpDir("gotify_testcreatesqlitefolder")
 	defer tmpDir.Clean()
 
-	db, err := New("sqlite3", tmpDir.Path("somepath/testdb.db"), "defaultUser", "defaultPass", 5, true, fixedNow)
+	db, err := New("sqlite3", tmpDir.Path("somepath/testdb.db"), Pool{}, "defaultUser", "defaultPass", 5, true, fixedNow)
 	assert.Nil(t, err)
 	assert.DirExists(t, tmpDir.Path("somepath"))
 	db.Close()
@@ -61,7 +62,7 @@ func TestWithAlreadyExistingSqliteFolder(t *testing.T) {
 	tmpDir := test.NewTmpDir("gotify_testwithexistingfolder")
 	defer tmpDir.Clean()
 
-	db, err := New("sqlite3", tmpDir.Path("somepath/testdb.db"), "defaultUser", "defaultPass", 5, true, fixedNow)
+	db, err := New("sqlite3", tmpDir.Path("somepath/testdb.db"), Pool{}, "defaultUser", "defaultPass", 5, true, fixedNow)
 	assert.Nil(t, err)
 	assert.DirExists(t, tmpDir.Path("somepath"))
 	db.Close()
@@ -74,12 +75,12 @@ func TestPanicsOnMkdirError(t *testing.T) {
 		return errors.New("ERROR")
 	}
 	assert.Panics(t, func() {
-		New("sqlite3", tmpDir.Path("somepath/test.db"), "defaultUser", "defaultPass", 5, true, fixedNow)
+		New("sqlite3", tmpDir.Path("somepath/test.db"), Pool{}, "defaultUser", "defaultPass", 5, true, fixedNow)
 	})
 }
 
 func TestMigrateSortKey(t *testing.T) {
-	db, err := New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), "admin", "pw", 5, true, fixedNow)
+	db, err := New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), Pool{}, "admin", "pw", 5, true, fixedNow)
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 
@@ -116,3 +117,36 @@ func TestMigrateSortKey(t *testing.T) {
 	assert.Equal(t, apps[0].Name, "one-other")
 	assert.Equal(t, apps[0].SortKey, "a0")
 }
+
+func TestMigrateMessageDatesToUTC(t *testing.T) {
+	db, err := New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), Pool{}, "admin", "pw", 5, true, fixedNow)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.CreateApplication(&model.Application{Name: "one", Token: "one", UserID: 1}))
+
+	sydney := time.FixedZone("AEST", 10*60*60)
+	local := time.Date(2024, 1, 5, 9, 0, 0, 0, sydney)
+	expires := local.Add(time.Hour)
+	// messages were created with the local offset before dates were stored in utc.
+	require.NoError(t, db.DB.Create(&model.Message{ApplicationID: 1, Message: "local", Date: local, ExpiresAt: &expires}).Error)
+	require.NoError(t, db.CreateMessage(&model.Message{ApplicationID: 1, Message: "utc", Date: local.Add(2 * time.Hour)}))
+
+	require.NoError(t, messageDatesToUTC(db.DB))
+
+	after := local.Add(-time.Minute).UTC()
+	messages, err := db.GetMessagesByUserSince(1, 10, 0, model.MessageFilter{After: &after})
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+	before := local.Add(time.Minute).UTC()
+	messages, err = db.GetMessagesByUserSince(1, 10, 0, model.MessageFilter{Before: &before})
+	require.NoError(t, err)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "local", messages[0].Message)
+		assert.True(t, local.Equal(messages[0].Date))
+		_, offset := messages[0].Date.Zone()
+		assert.Equal(t, 0, offset)
+		if assert.NotNil(t, messages[0].ExpiresAt) {
+			assert.True(t, expires.Equal(*messages[0].ExpiresAt))
+		}
+	}
+}
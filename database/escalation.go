@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetEscalationPolicyByApplication returns the escalation policy of the application or nil.
+func (d *GormDatabase) GetEscalationPolicyByApplication(appID uint) (*model.EscalationPolicy, error) {
+	policy := new(model.EscalationPolicy)
+	err := d.DB.Where("application_id = ?", appID).Find(policy).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if policy.ApplicationID == appID {
+		return policy, err
+	}
+	return nil, err
+}
+
+// SaveEscalationPolicy creates or replaces the escalation policy of an application.
+func (d *GormDatabase) SaveEscalationPolicy(policy *model.EscalationPolicy) error {
+	return d.DB.Save(policy).Error
+}
+
+// DeleteEscalationPolicyByApplication deletes the escalation policy and all pending escalations of an application.
+func (d *GormDatabase) DeleteEscalationPolicyByApplication(appID uint) error {
+	if err := d.DB.Where("application_id = ?", appID).Delete(&model.Escalation{}).Error; err != nil {
+		return err
+	}
+	return d.DB.Where("application_id = ?", appID).Delete(&model.EscalationPolicy{}).Error
+}
+
+// GetEscalationByMessage returns the pending escalation of the message or nil.
+func (d *GormDatabase) GetEscalationByMessage(messageID uint) (*model.Escalation, error) {
+	escalation := new(model.Escalation)
+	err := d.DB.Where("message_id = ?", messageID).Find(escalation).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if escalation.MessageID == messageID {
+		return escalation, err
+	}
+	return nil, err
+}
+
+// CreateEscalation creates the escalation of a message.
+func (d *GormDatabase) CreateEscalation(escalation *model.Escalation) error {
+	escalation.NextAt = escalation.NextAt.UTC()
+	return d.DB.Create(escalation).Error
+}
+
+// UpdateEscalation updates the escalation of a message. Escalations which were deleted in the meantime are not recreated.
+func (d *GormDatabase) UpdateEscalation(escalation *model.Escalation) error {
+	escalation.NextAt = escalation.NextAt.UTC()
+	return d.DB.Model(escalation).Select("*").Updates(escalation).Error
+}
+
+// GetDueEscalations returns all escalations which should be repeated at the given time.
+func (d *GormDatabase) GetDueEscalations(now time.Time) ([]*model.Escalation, error) {
+	var escalations []*model.Escalation
+	err := d.DB.Where("next_at <= ?", now.UTC()).Order("next_at, message_id ASC").Find(&escalations).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return escalations, err
+}
+
+// GetNextEscalation returns the escalation which is due next or nil.
+func (d *GormDatabase) GetNextEscalation() (*model.Escalation, error) {
+	var escalations []*model.Escalation
+	err := d.DB.Order("next_at, message_id ASC").Limit(1).Find(&escalations).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if len(escalations) == 0 {
+		return nil, err
+	}
+	return escalations[0], err
+}
+
+// DeleteEscalationByMessage deletes the escalation of a message.
+func (d *GormDatabase) DeleteEscalationByMessage(messageID uint) error {
+	return d.DB.Where("message_id = ?", messageID).Delete(&model.Escalation{}).Error
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestEscalationPolicy() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	oncall := &model.User{Name: "oncall", Pass: []byte{1}}
+	s.db.CreateUser(oncall)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "pager"}
+	s.db.CreateApplication(app)
+
+	if policy, err := s.db.GetEscalationPolicyByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), policy, "not existing policy")
+	}
+
+	policy := &model.EscalationPolicy{ApplicationID: app.ID, MinPriority: 10, IntervalMinutes: 5, EscalateAfter: 3, EscalateToUserID: oncall.ID}
+	assert.NoError(s.T(), s.db.SaveEscalationPolicy(policy))
+	if actual, err := s.db.GetEscalationPolicyByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), policy, actual)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteUserByID(oncall.ID))
+	if actual, err := s.db.GetEscalationPolicyByApplication(app.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), actual) {
+		assert.Zero(s.T(), actual.EscalateToUserID, "escalation to deleted user")
+	}
+
+	s.db.CreateEscalation(&model.Escalation{MessageID: 1, ApplicationID: app.ID, NextAt: time.Now()})
+	assert.NoError(s.T(), s.db.DeleteEscalationPolicyByApplication(app.ID))
+	if actual, err := s.db.GetEscalationPolicyByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual)
+	}
+	if actual, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual, "pending escalation of deleted policy")
+	}
+
+	s.db.SaveEscalationPolicy(policy)
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	if actual, err := s.db.GetEscalationPolicyByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual)
+	}
+}
+
+func (s *DatabaseSuite) TestEscalation() {
+	if escalation, err := s.db.GetEscalationByMessage(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), escalation, "not existing escalation")
+	}
+	if escalation, err := s.db.GetNextEscalation(); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), escalation)
+	}
+
+	now := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)
+	later := &model.Escalation{MessageID: 1, ApplicationID: 1, NextAt: now.Add(time.Hour)}
+	soon := &model.Escalation{MessageID: 2, ApplicationID: 1, NextAt: now.Add(time.Minute).In(time.FixedZone("CET", 3600))}
+	assert.NoError(s.T(), s.db.CreateEscalation(later))
+	assert.NoError(s.T(), s.db.CreateEscalation(soon))
+
+	if next, err := s.db.GetNextEscalation(); assert.NoError(s.T(), err) && assert.NotNil(s.T(), next) {
+		assert.Equal(s.T(), soon.MessageID, next.MessageID)
+	}
+	if due, err := s.db.GetDueEscalations(now); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), due)
+	}
+	if due, err := s.db.GetDueEscalations(now.Add(30 * time.Minute)); assert.NoError(s.T(), err) && assert.Len(s.T(), due, 1) {
+		assert.Equal(s.T(), soon.MessageID, due[0].MessageID)
+	}
+
+	soon.Attempts = 1
+	soon.NextAt = now.Add(2 * time.Hour)
+	assert.NoError(s.T(), s.db.UpdateEscalation(soon))
+	if actual, err := s.db.GetEscalationByMessage(soon.MessageID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), actual) {
+		assert.Equal(s.T(), 1, actual.Attempts)
+		assert.True(s.T(), now.Add(2*time.Hour).Equal(actual.NextAt))
+	}
+	if next, err := s.db.GetNextEscalation(); assert.NoError(s.T(), err) && assert.NotNil(s.T(), next) {
+		assert.Equal(s.T(), later.MessageID, next.MessageID)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteEscalationByMessage(later.MessageID))
+	if actual, err := s.db.GetEscalationByMessage(later.MessageID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual)
+	}
+	assert.NoError(s.T(), s.db.UpdateEscalation(later))
+	if actual, err := s.db.GetEscalationByMessage(later.MessageID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual, "update must not recreate a deleted escalation")
+	}
+}
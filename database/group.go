@@ -0,0 +1,160 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetGroupByID returns the group with its members for the given id or nil.
+func (d *GormDatabase) GetGroupByID(id uint) (*model.Group, error) {
+	group := new(model.Group)
+	err := d.DB.Find(group, id).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if err != nil || group.ID != id {
+		return nil, err
+	}
+	group.Members, err = d.GetGroupMemberIDs(id)
+	return group, err
+}
+
+// GetGroupByName returns the group with its members for the given name or nil.
+func (d *GormDatabase) GetGroupByName(name string) (*model.Group, error) {
+	group := new(model.Group)
+	err := d.DB.Where("name = ?", name).Find(group).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if err != nil || group.Name != name {
+		return nil, err
+	}
+	group.Members, err = d.GetGroupMemberIDs(group.ID)
+	return group, err
+}
+
+// GetGroups returns all groups with their members.
+func (d *GormDatabase) GetGroups() ([]*model.Group, error) {
+	var groups []*model.Group
+	if err := d.DB.Order("id ASC").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, d.loadGroupMembers(groups)
+}
+
+// GetGroupsByUser returns all groups the user is a member of.
+func (d *GormDatabase) GetGroupsByUser(userID uint) ([]*model.Group, error) {
+	var groups []*model.Group
+	err := d.DB.Where("id IN (?)", d.DB.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("id ASC").Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, d.loadGroupMembers(groups)
+}
+
+// GetGroupMemberIDs returns the ids of the members of a group.
+func (d *GormDatabase) GetGroupMemberIDs(groupID uint) ([]uint, error) {
+	ids := []uint{}
+	err := d.DB.Model(&model.GroupMember{}).Where("group_id = ?", groupID).Order("user_id ASC").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// IsGroupMember returns whether the user is a member of the group.
+func (d *GormDatabase) IsGroupMember(groupID, userID uint) (bool, error) {
+	count := int64(0)
+	err := d.DB.Model(&model.GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateGroup creates a group with its members.
+func (d *GormDatabase) CreateGroup(group *model.Group) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		return createGroupMembers(tx, group)
+	})
+}
+
+// UpdateGroup updates the name and replaces the members of a group.
+func (d *GormDatabase) UpdateGroup(group *model.Group) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Update("name", group.Name).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&model.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return createGroupMembers(tx, group)
+	})
+}
+
+// DeleteGroupByID deletes a group. The applications of the group are kept by the users who created them,
+// messages the creator deleted are removed and the message states of the other members are dropped.
+func (d *GormDatabase) DeleteGroupByID(id uint) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		var apps []*model.Application
+		if err := tx.Where("group_id = ?", id).Find(&apps).Error; err != nil {
+			return err
+		}
+		for _, app := range apps {
+			messages := tx.Model(&model.Message{}).Select("id").Where("application_id = ?", app.ID)
+			hidden := tx.Model(&model.MessageState{}).Select("message_id").
+				Where(&model.MessageState{UserID: app.UserID, Deleted: true}).Where("message_id IN (?)", messages)
+			var hiddenIDs []uint
+			if err := hidden.Pluck("message_id", &hiddenIDs).Error; err != nil {
+				return err
+			}
+			if len(hiddenIDs) > 0 {
+				if err := tx.Where("message_id IN ?", hiddenIDs).Delete(&model.MessageState{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("id IN ?", hiddenIDs).Delete(&model.Message{}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("user_id <> ?", app.UserID).Where("message_id IN (?)", messages).Delete(&model.MessageState{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&model.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Application{}).Where("group_id = ?", id).Update("group_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&model.Group{}).Error
+	})
+}
+
+// GetApplicationsByGroup returns all applications of a group.
+func (d *GormDatabase) GetApplicationsByGroup(groupID uint) ([]*model.Application, error) {
+	var apps []*model.Application
+	err := d.DB.Where("group_id = ?", groupID).Order("sort_key, id ASC").Find(&apps).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return apps, err
+}
+
+func (d *GormDatabase) loadGroupMembers(groups []*model.Group) error {
+	for _, group := range groups {
+		var err error
+		if group.Members, err = d.GetGroupMemberIDs(group.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createGroupMembers(tx *gorm.DB, group *model.Group) error {
+	if len(group.Members) == 0 {
+		return nil
+	}
+	members := make([]*model.GroupMember, len(group.Members))
+	for i, userID := range group.Members {
+		members[i] = &model.GroupMember{GroupID: group.ID, UserID: userID}
+	}
+	return tx.Create(&members).Error
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestGroup() {
+	alice := &model.User{Name: "alice", Pass: []byte{1}}
+	s.db.CreateUser(alice)
+	bob := &model.User{Name: "bob", Pass: []byte{1}}
+	s.db.CreateUser(bob)
+
+	if group, err := s.db.GetGroupByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), group, "not existing group")
+	}
+
+	ops := &model.Group{Name: "ops", Members: []uint{alice.ID, bob.ID}}
+	assert.NoError(s.T(), s.db.CreateGroup(ops))
+	dev := &model.Group{Name: "dev", Members: []uint{}}
+	assert.NoError(s.T(), s.db.CreateGroup(dev))
+	assert.Error(s.T(), s.db.CreateGroup(&model.Group{Name: "ops"}), "duplicate name")
+
+	if group, err := s.db.GetGroupByName("ops"); assert.NoError(s.T(), err) && assert.NotNil(s.T(), group) {
+		assert.Equal(s.T(), ops.ID, group.ID)
+		assert.Equal(s.T(), []uint{alice.ID, bob.ID}, group.Members)
+	}
+	if groups, err := s.db.GetGroups(); assert.NoError(s.T(), err) && assert.Len(s.T(), groups, 2) {
+		assert.Equal(s.T(), "dev", groups[1].Name)
+		assert.Empty(s.T(), groups[1].Members)
+	}
+
+	ops.Name = "operations"
+	ops.Members = []uint{alice.ID}
+	assert.NoError(s.T(), s.db.UpdateGroup(ops))
+	if group, err := s.db.GetGroupByID(ops.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), group) {
+		assert.Equal(s.T(), "operations", group.Name)
+		assert.Equal(s.T(), []uint{alice.ID}, group.Members)
+	}
+	if groups, err := s.db.GetGroupsByUser(bob.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), groups)
+	}
+	if member, err := s.db.IsGroupMember(ops.ID, alice.ID); assert.NoError(s.T(), err) {
+		assert.True(s.T(), member)
+	}
+
+	app := &model.Application{UserID: alice.ID, GroupID: ops.ID, Token: "A0000000000", Name: "production"}
+	s.db.CreateApplication(app)
+	if apps, err := s.db.GetApplicationsByGroup(ops.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), apps, 1) {
+		assert.Equal(s.T(), app.ID, apps[0].ID)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteGroupByID(ops.ID))
+	if group, err := s.db.GetGroupByID(ops.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), group)
+	}
+	if actual, err := s.db.GetApplicationByID(app.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), actual) {
+		assert.Zero(s.T(), actual.GroupID, "application is kept by its creator")
+	}
+
+	s.db.UpdateGroup(&model.Group{ID: dev.ID, Name: "dev", Members: []uint{bob.ID}})
+	assert.NoError(s.T(), s.db.DeleteUserByID(bob.ID))
+	if members, err := s.db.GetGroupMemberIDs(dev.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), members, "membership of deleted user")
+	}
+}
+
+func (s *DatabaseSuite) TestGroupMessageState() {
+	alice := &model.User{Name: "alice", Pass: []byte{1}}
+	s.db.CreateUser(alice)
+	bob := &model.User{Name: "bob", Pass: []byte{1}}
+	s.db.CreateUser(bob)
+	group := &model.Group{Name: "ops", Members: []uint{alice.ID, bob.ID}}
+	s.db.CreateGroup(group)
+	app := &model.Application{UserID: alice.ID, GroupID: group.ID, Token: "A0000000000", Name: "production"}
+	s.db.CreateApplication(app)
+	first := &model.Message{ApplicationID: app.ID, Message: "first"}
+	s.db.CreateMessage(first)
+	second := &model.Message{ApplicationID: app.ID, Message: "second"}
+	s.db.CreateMessage(second)
+
+	if msgs, err := s.db.GetMessagesByUserSince(bob.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 2, "messages of group applications")
+	}
+
+	assert.NoError(s.T(), s.db.MarkMessageRead(first.ID, bob.ID))
+	assert.NoError(s.T(), s.db.MarkMessageRead(first.ID, bob.ID))
+	if read, err := s.db.GetReadMessageIDs(bob.ID, []uint{first.ID, second.ID}); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), []uint{first.ID}, read)
+	}
+	if read, err := s.db.GetReadMessageIDs(alice.ID, []uint{first.ID, second.ID}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), read, "read state is per user")
+	}
+
+	assert.NoError(s.T(), s.db.HideMessage(first.ID, bob.ID))
+	if msgs, err := s.db.GetMessagesByUserSince(bob.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), second.ID, msgs[0].ID)
+	}
+	if msgs, err := s.db.GetVisibleMessagesByApplicationSince(app.ID, bob.ID, 10, 0); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 1)
+	}
+	if msgs, err := s.db.GetMessagesByUserSince(alice.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 2, "deleted for bob only")
+	}
+	if read, err := s.db.GetReadMessageIDs(bob.ID, []uint{first.ID}); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), []uint{first.ID}, read, "read state is kept when deleting")
+	}
+
+	assert.NoError(s.T(), s.db.HideMessage(first.ID, alice.ID))
+	if msg, err := s.db.GetMessageByID(first.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg, "deleted by all members")
+	}
+
+	assert.NoError(s.T(), s.db.DeleteMessagesByUser(alice.ID))
+	if msg, err := s.db.GetMessageByID(second.ID); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), msg, "still visible for bob")
+	}
+	if msgs, err := s.db.GetMessagesByUserSince(alice.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+	assert.NoError(s.T(), s.db.HideMessagesByApplication(app.ID, bob.ID))
+	if msg, err := s.db.GetMessageByID(second.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg, "deleted by all members")
+	}
+}
+
+func (s *DatabaseSuite) TestDeleteGroupByID_messageStates() {
+	alice := &model.User{Name: "alice", Pass: []byte{1}}
+	s.db.CreateUser(alice)
+	bob := &model.User{Name: "bob", Pass: []byte{1}}
+	s.db.CreateUser(bob)
+	group := &model.Group{Name: "ops", Members: []uint{alice.ID, bob.ID}}
+	s.db.CreateGroup(group)
+	app := &model.Application{UserID: alice.ID, GroupID: group.ID, Token: "A0000000000", Name: "production"}
+	s.db.CreateApplication(app)
+	first := &model.Message{ApplicationID: app.ID, Message: "first"}
+	s.db.CreateMessage(first)
+	second := &model.Message{ApplicationID: app.ID, Message: "second"}
+	s.db.CreateMessage(second)
+	s.db.MarkMessageRead(first.ID, alice.ID)
+	s.db.MarkMessageRead(first.ID, bob.ID)
+	s.db.HideMessage(second.ID, alice.ID)
+
+	assert.NoError(s.T(), s.db.DeleteGroupByID(group.ID))
+
+	if msg, err := s.db.GetMessageByID(second.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg, "deleted by the creator")
+	}
+	if msgs, err := s.db.GetMessagesByUserSince(alice.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), first.ID, msgs[0].ID)
+	}
+	if read, err := s.db.GetReadMessageIDs(alice.ID, []uint{first.ID}); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), []uint{first.ID}, read, "state of the creator is kept")
+	}
+	var states int64
+	s.db.DB.Model(&model.MessageState{}).Where("user_id = ?", bob.ID).Count(&states)
+	assert.Zero(s.T(), states)
+}
+
+func (s *DatabaseSuite) TestDeleteUserByID_groupApplications() {
+	alice := &model.User{Name: "alice", Pass: []byte{1}}
+	s.db.CreateUser(alice)
+	bob := &model.User{Name: "bob", Pass: []byte{1}}
+	s.db.CreateUser(bob)
+	group := &model.Group{Name: "ops", Members: []uint{alice.ID, bob.ID}}
+	s.db.CreateGroup(group)
+	solo := &model.Group{Name: "solo", Members: []uint{alice.ID}}
+	s.db.CreateGroup(solo)
+	app := &model.Application{UserID: alice.ID, GroupID: group.ID, Token: "A0000000000", Name: "production"}
+	s.db.CreateApplication(app)
+	soloApp := &model.Application{UserID: alice.ID, GroupID: solo.ID, Token: "A0000000001", Name: "staging"}
+	s.db.CreateApplication(soloApp)
+	first := &model.Message{ApplicationID: app.ID, Message: "first"}
+	s.db.CreateMessage(first)
+	second := &model.Message{ApplicationID: app.ID, Message: "second"}
+	s.db.CreateMessage(second)
+	s.db.HideMessage(second.ID, bob.ID)
+
+	assert.NoError(s.T(), s.db.DeleteUserByID(alice.ID))
+
+	if actual, err := s.db.GetApplicationByID(app.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), actual) {
+		assert.Equal(s.T(), bob.ID, actual.UserID, "passed on to the remaining member")
+		assert.Equal(s.T(), group.ID, actual.GroupID)
+	}
+	if msg, err := s.db.GetMessageByID(first.ID); assert.NoError(s.T(), err) {
+		assert.NotNil(s.T(), msg)
+	}
+	if msg, err := s.db.GetMessageByID(second.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg, "deleted by all remaining members")
+	}
+	if actual, err := s.db.GetApplicationByID(soloApp.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual, "no other member")
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetMailForwardRuleByID returns the mail forward rule for the given id or nil.
+func (d *GormDatabase) GetMailForwardRuleByID(id uint) (*model.MailForwardRule, error) {
+	rule := new(model.MailForwardRule)
+	err := d.DB.Where("id = ?", id).Find(rule).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if rule.ID == id {
+		return rule, err
+	}
+	return nil, err
+}
+
+// GetMailForwardRulesByUser returns all mail forward rules of a user.
+func (d *GormDatabase) GetMailForwardRulesByUser(userID uint) ([]*model.MailForwardRule, error) {
+	var rules []*model.MailForwardRule
+	err := d.DB.Where("user_id = ?", userID).Order("id ASC").Find(&rules).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return rules, err
+}
+
+// CreateMailForwardRule creates a mail forward rule.
+func (d *GormDatabase) CreateMailForwardRule(rule *model.MailForwardRule) error {
+	return d.DB.Create(rule).Error
+}
+
+// UpdateMailForwardRule updates a mail forward rule.
+func (d *GormDatabase) UpdateMailForwardRule(rule *model.MailForwardRule) error {
+	return d.DB.Save(rule).Error
+}
+
+// DeleteMailForwardRuleByID deletes a mail forward rule by its id.
+func (d *GormDatabase) DeleteMailForwardRuleByID(id uint) error {
+	return d.DB.Where("id = ?", id).Delete(&model.MailForwardRule{}).Error
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestMailForwardRule() {
+	if rule, err := s.db.GetMailForwardRuleByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule, "not existing rule")
+	}
+
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "backup"}
+	s.db.CreateApplication(app)
+
+	if rules, err := s.db.GetMailForwardRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+
+	rule := &model.MailForwardRule{UserID: user.ID, Recipient: "ops@example.com", MinPriority: 8}
+	assert.NoError(s.T(), s.db.CreateMailForwardRule(rule))
+	appRule := &model.MailForwardRule{UserID: user.ID, Recipient: "backup@example.com", ApplicationID: app.ID}
+	assert.NoError(s.T(), s.db.CreateMailForwardRule(appRule))
+
+	if rules, err := s.db.GetMailForwardRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), rules, 2)
+	}
+
+	rule.OnlyWhenOffline = true
+	assert.NoError(s.T(), s.db.UpdateMailForwardRule(rule))
+	if updated, err := s.db.GetMailForwardRuleByID(rule.ID); assert.NoError(s.T(), err) {
+		assert.True(s.T(), updated.OnlyWhenOffline)
+		assert.Equal(s.T(), "ops@example.com", updated.Recipient)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	if rules, err := s.db.GetMailForwardRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), rules, 1)
+		assert.Equal(s.T(), rule.ID, rules[0].ID)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteMailForwardRuleByID(rule.ID))
+	if rule, err := s.db.GetMailForwardRuleByID(rule.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule)
+	}
+
+	s.db.CreateMailForwardRule(&model.MailForwardRule{UserID: user.ID, Recipient: "ops@example.com"})
+	assert.NoError(s.T(), s.db.DeleteUserByID(user.ID))
+	if rules, err := s.db.GetMailForwardRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+}
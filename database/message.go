@@ -1,8 +1,12 @@
 package database
 
 import (
+	"strings"
+	"time"
+
 	"github.com/gotify/server/v2/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GetMessageByID returns the messages for the given id or nil.
@@ -20,9 +24,54 @@ func (d *GormDatabase) GetMessageByID(id uint) (*model.Message, error) {
 
 // CreateMessage creates a message.
 func (d *GormDatabase) CreateMessage(message *model.Message) error {
+	toUTC(message)
 	return d.DB.Create(message).Error
 }
 
+// CreateMessages creates the messages and scheduled messages in one transaction.
+func (d *GormDatabase) CreateMessages(messages []*model.Message, scheduled []*model.ScheduledMessage) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for _, message := range messages {
+			toUTC(message)
+		}
+		for _, msg := range scheduled {
+			msg.DeliverAt = msg.DeliverAt.UTC()
+			msg.ExpiresAt = utc(msg.ExpiresAt)
+		}
+		if len(messages) > 0 {
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+		if len(scheduled) > 0 {
+			return tx.Create(&scheduled).Error
+		}
+		return nil
+	})
+}
+
+// ImportMessages creates the messages returned by next in one transaction.
+// next is called until it returns no messages, the transaction is rolled back if it returns an error.
+func (d *GormDatabase) ImportMessages(next func() ([]*model.Message, error)) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for {
+			messages, err := next()
+			if err != nil {
+				return err
+			}
+			if len(messages) == 0 {
+				return nil
+			}
+			for _, message := range messages {
+				toUTC(message)
+			}
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+	})
+}
+
 // GetMessagesByUser returns all messages from a user.
 func (d *GormDatabase) GetMessagesByUser(userID uint) ([]*model.Message, error) {
 	var messages []*model.Message
@@ -34,15 +83,29 @@ func (d *GormDatabase) GetMessagesByUser(userID uint) ([]*model.Message, error)
 	return messages, err
 }
 
-// GetMessagesByUserSince returns limited messages from a user.
+// GetMessagesByUserSince returns limited messages from a user including the messages of applications shared with the user
+// and of the groups of the user matching the filter. Messages the user deleted from group applications are excluded.
 // If since is 0 it will be ignored.
-func (d *GormDatabase) GetMessagesByUserSince(userID uint, limit int, since uint) ([]*model.Message, error) {
+func (d *GormDatabase) GetMessagesByUserSince(userID uint, limit int, since uint, filter model.MessageFilter) ([]*model.Message, error) {
 	var messages []*model.Message
-	db := d.DB.Joins("JOIN applications ON applications.user_id = ?", userID).
-		Where("messages.application_id = applications.id").Order("messages.id desc").Limit(limit)
-	if since != 0 {
-		db = db.Where("messages.id < ?", since)
+	db := d.DB.Joins("JOIN applications ON applications.id = messages.application_id").
+		Where("applications.user_id = ? OR applications.id IN (?) OR applications.group_id IN (?)", userID,
+			d.DB.Model(&model.ApplicationShare{}).Select("application_id").Where("user_id = ?", userID),
+			d.DB.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Where("messages.id NOT IN (?)", d.hiddenMessageIDs(userID)).
+		Limit(limit)
+	if filter.Ascending {
+		db = db.Order("messages.id asc")
+		if since != 0 {
+			db = db.Where("messages.id > ?", since)
+		}
+	} else {
+		db = db.Order("messages.id desc")
+		if since != 0 {
+			db = db.Where("messages.id < ?", since)
+		}
 	}
+	db = d.applyMessageFilter(db, filter)
 	err := db.Find(&messages).Error
 	if err == gorm.ErrRecordNotFound {
 		err = nil
@@ -50,6 +113,47 @@ func (d *GormDatabase) GetMessagesByUserSince(userID uint, limit int, since uint
 	return messages, err
 }
 
+func (d *GormDatabase) applyMessageFilter(db *gorm.DB, filter model.MessageFilter) *gorm.DB {
+	if filter.MinPriority != nil {
+		db = db.Where("messages.priority >= ?", *filter.MinPriority)
+	}
+	if filter.MaxPriority != nil {
+		db = db.Where("messages.priority <= ?", *filter.MaxPriority)
+	}
+	if filter.After != nil {
+		db = db.Where("messages.date > ?", filter.After.UTC())
+	}
+	if filter.Before != nil {
+		db = db.Where("messages.date < ?", filter.Before.UTC())
+	}
+	if len(filter.ApplicationIDs) > 0 {
+		db = db.Where("messages.application_id IN ?", filter.ApplicationIDs)
+	}
+	for _, key := range filter.ExtrasKeys {
+		db = d.whereExtrasHasKey(db, key)
+	}
+	return db
+}
+
+// whereExtrasHasKey restricts the query to messages with the key at the top level of their extras.
+// Messages without valid json extras don't match.
+func (d *GormDatabase) whereExtrasHasKey(db *gorm.DB, key string) *gorm.DB {
+	switch d.DB.Dialector.Name() {
+	case "postgres":
+		return db.Where("CASE WHEN length(messages.extras) > 0 THEN jsonb_exists(convert_from(messages.extras, 'UTF8')::jsonb, ?) ELSE false END", key)
+	case "mysql":
+		return db.Where("CASE WHEN JSON_VALID(CAST(messages.extras AS CHAR)) THEN JSON_CONTAINS_PATH(CAST(messages.extras AS CHAR), 'one', ?) ELSE 0 END = 1", extrasKeyPath(key))
+	default:
+		// json_type returns the type 'null' for keys with a null value and NULL for missing keys.
+		return db.Where("CASE WHEN json_valid(CAST(messages.extras AS TEXT)) THEN json_type(CAST(messages.extras AS TEXT), ?) END IS NOT NULL", extrasKeyPath(key))
+	}
+}
+
+// extrasKeyPath returns the json path of the key at the top level of the extras.
+func extrasKeyPath(key string) string {
+	return `$."` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+}
+
 // GetMessagesByApplication returns all messages from an application.
 func (d *GormDatabase) GetMessagesByApplication(tokenID uint) ([]*model.Message, error) {
 	var messages []*model.Message
@@ -75,21 +179,204 @@ func (d *GormDatabase) GetMessagesByApplicationSince(appID uint, limit int, sinc
 	return messages, err
 }
 
+// GetVisibleMessagesByApplicationSince returns limited messages from an application
+// excluding the messages the user deleted from a group application.
+// If since is 0 it will be ignored.
+func (d *GormDatabase) GetVisibleMessagesByApplicationSince(appID, userID uint, limit int, since uint) ([]*model.Message, error) {
+	var messages []*model.Message
+	db := d.DB.Where("application_id = ?", appID).Where("messages.id NOT IN (?)", d.hiddenMessageIDs(userID)).
+		Order("messages.id desc").Limit(limit)
+	if since != 0 {
+		db = db.Where("messages.id < ?", since)
+	}
+	err := db.Find(&messages).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return messages, err
+}
+
 // DeleteMessageByID deletes a message by its id.
 func (d *GormDatabase) DeleteMessageByID(id uint) error {
+	d.DB.Where("message_id = ?", id).Delete(&model.MessageState{})
 	return d.DB.Where("id = ?", id).Delete(&model.Message{}).Error
 }
 
 // DeleteMessagesByApplication deletes all messages from an application.
 func (d *GormDatabase) DeleteMessagesByApplication(applicationID uint) error {
+	d.DB.Where("message_id IN (?)", d.DB.Model(&model.Message{}).Select("id").Where("application_id = ?", applicationID)).
+		Delete(&model.MessageState{})
 	return d.DB.Where("application_id = ?", applicationID).Delete(&model.Message{}).Error
 }
 
 // DeleteMessagesByUser deletes all messages from a user.
+// Messages of group applications are only deleted for the user.
 func (d *GormDatabase) DeleteMessagesByUser(userID uint) error {
-	app, _ := d.GetApplicationsByUser(userID)
-	for _, app := range app {
-		d.DeleteMessagesByApplication(app.ID)
+	apps, _ := d.GetApplicationsByUser(userID)
+	groups, err := d.GetGroupsByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		groupApps, err := d.GetApplicationsByGroup(group.ID)
+		if err != nil {
+			return err
+		}
+		apps = append(apps, groupApps...)
+	}
+	done := map[uint]bool{}
+	for _, app := range apps {
+		if done[app.ID] {
+			continue
+		}
+		done[app.ID] = true
+		if app.GroupID == 0 {
+			d.DeleteMessagesByApplication(app.ID)
+		} else if err := d.HideMessagesByApplication(app.ID, userID); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// GetReadMessageIDs returns the ids of the given messages the user marked as read.
+func (d *GormDatabase) GetReadMessageIDs(userID uint, ids []uint) ([]uint, error) {
+	read := []uint{}
+	if len(ids) == 0 {
+		return read, nil
+	}
+	err := d.DB.Model(&model.MessageState{}).Where(&model.MessageState{UserID: userID, Read: true}).
+		Where("message_id IN ?", ids).Pluck("message_id", &read).Error
+	return read, err
+}
+
+// MarkMessageRead marks a message as read for the user.
+func (d *GormDatabase) MarkMessageRead(messageID, userID uint) error {
+	return d.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"is_read"}),
+	}).Create(&model.MessageState{MessageID: messageID, UserID: userID, Read: true}).Error
+}
+
+// HideMessage deletes a message of a group application for the user.
+// The message is deleted once all members of the group deleted it.
+func (d *GormDatabase) HideMessage(messageID, userID uint) error {
+	msg, err := d.GetMessageByID(messageID)
+	if err != nil || msg == nil {
+		return err
+	}
+	if err := d.hideMessages(userID, []uint{messageID}); err != nil {
+		return err
+	}
+	return d.deleteMessagesHiddenByAllMembers(msg.ApplicationID)
+}
+
+// HideMessagesByApplication deletes all messages of a group application for the user.
+// Messages are deleted once all members of the group deleted them.
+func (d *GormDatabase) HideMessagesByApplication(appID, userID uint) error {
+	ids := []uint{}
+	err := d.DB.Model(&model.Message{}).Where("application_id = ?", appID).
+		Where("id NOT IN (?)", d.hiddenMessageIDs(userID)).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if err := d.hideMessages(userID, ids); err != nil {
+		return err
+	}
+	return d.deleteMessagesHiddenByAllMembers(appID)
+}
+
+func (d *GormDatabase) hiddenMessageIDs(userID uint) *gorm.DB {
+	return d.DB.Model(&model.MessageState{}).Select("message_id").Where(&model.MessageState{UserID: userID, Deleted: true})
+}
+
+func (d *GormDatabase) hideMessages(userID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	states := make([]*model.MessageState, len(ids))
+	for i, id := range ids {
+		states[i] = &model.MessageState{MessageID: id, UserID: userID, Deleted: true}
+	}
+	return d.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"is_deleted"}),
+	}).CreateInBatches(states, 500).Error
+}
+
+func (d *GormDatabase) deleteMessagesHiddenByAllMembers(appID uint) error {
+	app, err := d.GetApplicationByID(appID)
+	if err != nil || app == nil || app.GroupID == 0 {
+		return err
+	}
+	members, err := d.GetGroupMemberIDs(app.GroupID)
+	if err != nil || len(members) == 0 {
+		return err
+	}
+	ids := []uint{}
+	err = d.DB.Model(&model.MessageState{}).Select("message_id").
+		Where(&model.MessageState{Deleted: true}).Where("user_id IN ?", members).
+		Where("message_id IN (?)", d.DB.Model(&model.Message{}).Select("id").Where("application_id = ?", appID)).
+		Group("message_id").Having("COUNT(*) >= ?", len(members)).Pluck("message_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id IN ?", ids).Delete(&model.MessageState{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.Message{}).Error
+	})
+}
+
+// DeleteExpiredMessages deletes up to limit messages which are expired at the given time and returns them.
+func (d *GormDatabase) DeleteExpiredMessages(now time.Time, limit int) ([]*model.Message, error) {
+	var messages []*model.Message
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("expires_at <= ?", now.UTC()).Order("expires_at, id ASC").Limit(limit).Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+		ids := make([]uint, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		if err := tx.Where("message_id IN ?", ids).Delete(&model.MessageState{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.Message{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetNextMessageExpiry returns the time the next message expires or nil.
+func (d *GormDatabase) GetNextMessageExpiry() (*time.Time, error) {
+	var messages []*model.Message
+	err := d.DB.Where("expires_at IS NOT NULL").Order("expires_at ASC").Limit(1).Find(&messages).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if len(messages) == 0 {
+		return nil, err
+	}
+	return messages[0].ExpiresAt, err
+}
+
+// toUTC converts the dates of the message to utc before storing it.
+// Sqlite stores dates as text with their offset and compares them as text,
+// so dates with different offsets can't be compared.
+func toUTC(message *model.Message) {
+	message.Date = message.Date.UTC()
+	message.ExpiresAt = utc(message.ExpiresAt)
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -162,22 +163,22 @@ func (s *DatabaseSuite) TestGetMessagesSince() {
 		s.db.CreateMessage(&model.Message{ApplicationID: app2.ID, Message: "abc", Date: curDate.Add(time.Duration(i) * time.Second)})
 	}
 
-	actual, err := s.db.GetMessagesByUserSince(user.ID, 50, 0)
+	actual, err := s.db.GetMessagesByUserSince(user.ID, 50, 0, model.MessageFilter{})
 	require.NoError(s.T(), err)
 	assert.Len(s.T(), actual, 50)
 	hasIDInclusiveBetween(s.T(), actual, 1000, 951, 1)
 
-	actual, err = s.db.GetMessagesByUserSince(user.ID, 50, 951)
+	actual, err = s.db.GetMessagesByUserSince(user.ID, 50, 951, model.MessageFilter{})
 	require.NoError(s.T(), err)
 	assert.Len(s.T(), actual, 50)
 	hasIDInclusiveBetween(s.T(), actual, 950, 901, 1)
 
-	actual, err = s.db.GetMessagesByUserSince(user.ID, 100, 951)
+	actual, err = s.db.GetMessagesByUserSince(user.ID, 100, 951, model.MessageFilter{})
 	require.NoError(s.T(), err)
 	assert.Len(s.T(), actual, 100)
 	hasIDInclusiveBetween(s.T(), actual, 950, 851, 1)
 
-	actual, err = s.db.GetMessagesByUserSince(user.ID, 100, 51)
+	actual, err = s.db.GetMessagesByUserSince(user.ID, 100, 51, model.MessageFilter{})
 	require.NoError(s.T(), err)
 	assert.Len(s.T(), actual, 50)
 	hasIDInclusiveBetween(s.T(), actual, 50, 1, 1)
@@ -223,6 +224,226 @@ func (s *DatabaseSuite) TestGetMessagesSince() {
 	hasIDInclusiveBetween(s.T(), actual, 100, 2, 2)
 }
 
+func (s *DatabaseSuite) TestGetMessagesSince_withFilter() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	require.NoError(s.T(), s.db.CreateUser(user))
+	app := &model.Application{UserID: user.ID, Token: "A0000000000"}
+	app2 := &model.Application{UserID: user.ID, Token: "A0000000001"}
+	require.NoError(s.T(), s.db.CreateApplication(app))
+	require.NoError(s.T(), s.db.CreateApplication(app2))
+
+	date := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	messages := []*model.Message{
+		{ApplicationID: app.ID, Message: "low", Priority: 1, Date: date},
+		{ApplicationID: app.ID, Message: "high", Priority: 8, Date: date, Extras: []byte(`{"client::display":{"contentType":"text/markdown"}}`)},
+		{ApplicationID: app2.ID, Message: "other app", Priority: 5, Date: date, Extras: []byte(`{"client_display":{}}`)},
+		{ApplicationID: app.ID, Message: "old", Priority: 5, Date: date.Add(-48 * time.Hour)},
+	}
+	for _, msg := range messages {
+		require.NoError(s.T(), s.db.CreateMessage(msg))
+	}
+	after := date.Add(-time.Hour)
+	before := date.Add(-time.Hour)
+	five := 5
+
+	tests := []struct {
+		filter   model.MessageFilter
+		since    uint
+		expected []uint
+	}{
+		{filter: model.MessageFilter{MinPriority: &five}, expected: []uint{4, 3, 2}},
+		{filter: model.MessageFilter{MaxPriority: &five}, expected: []uint{4, 3, 1}},
+		{filter: model.MessageFilter{MinPriority: &five, MaxPriority: &five}, expected: []uint{4, 3}},
+		{filter: model.MessageFilter{After: &after}, expected: []uint{3, 2, 1}},
+		{filter: model.MessageFilter{Before: &before}, expected: []uint{4}},
+		{filter: model.MessageFilter{ApplicationIDs: []uint{app2.ID}}, expected: []uint{3}},
+		{filter: model.MessageFilter{ApplicationIDs: []uint{app.ID, app2.ID}}, since: 4, expected: []uint{3, 2, 1}},
+		{filter: model.MessageFilter{ExtrasKeys: []string{"client::display"}}, expected: []uint{2}},
+		{filter: model.MessageFilter{ExtrasKeys: []string{"client_display"}}, expected: []uint{3}},
+		{filter: model.MessageFilter{ExtrasKeys: []string{"client::display", "unknown"}}, expected: []uint{}},
+		{filter: model.MessageFilter{Ascending: true}, expected: []uint{1, 2, 3, 4}},
+		{filter: model.MessageFilter{Ascending: true, MinPriority: &five}, since: 2, expected: []uint{3, 4}},
+	}
+	for _, tt := range tests {
+		actual, err := s.db.GetMessagesByUserSince(user.ID, 10, tt.since, tt.filter)
+		require.NoError(s.T(), err)
+		ids := []uint{}
+		for _, msg := range actual {
+			ids = append(ids, msg.ID)
+		}
+		assert.Equal(s.T(), tt.expected, ids, "%+v", tt.filter)
+	}
+}
+
+func (s *DatabaseSuite) TestGetMessagesSince_withDateFilterAndLocalDates() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	require.NoError(s.T(), s.db.CreateUser(user))
+	app := &model.Application{UserID: user.ID, Token: "A0000000000"}
+	require.NoError(s.T(), s.db.CreateApplication(app))
+
+	// 09:00+10:00 is 23:00 UTC of the previous day, as text it would sort after 12:00Z.
+	sydney := time.FixedZone("AEST", 10*60*60)
+	date := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	messages := []*model.Message{
+		{ApplicationID: app.ID, Message: "early", Date: time.Date(2024, 1, 5, 9, 0, 0, 0, sydney)},
+		{ApplicationID: app.ID, Message: "late", Date: date.Add(time.Hour).In(time.FixedZone("EST", -5*60*60))},
+	}
+	for _, msg := range messages {
+		require.NoError(s.T(), s.db.CreateMessage(msg))
+	}
+
+	tests := []struct {
+		filter   model.MessageFilter
+		expected []uint
+	}{
+		{filter: model.MessageFilter{After: &date}, expected: []uint{2}},
+		{filter: model.MessageFilter{Before: &date}, expected: []uint{1}},
+	}
+	for _, tt := range tests {
+		actual, err := s.db.GetMessagesByUserSince(user.ID, 10, 0, tt.filter)
+		require.NoError(s.T(), err)
+		ids := []uint{}
+		for _, msg := range actual {
+			ids = append(ids, msg.ID)
+		}
+		assert.Equal(s.T(), tt.expected, ids, "%+v", tt.filter)
+	}
+	if msg, err := s.db.GetMessageByID(1); assert.NoError(s.T(), err) {
+		assert.True(s.T(), messages[0].Date.Equal(msg.Date))
+	}
+}
+
+func (s *DatabaseSuite) TestGetMessagesSince_withExtrasKeyFilter() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	require.NoError(s.T(), s.db.CreateUser(user))
+	app := &model.Application{UserID: user.ID, Token: "A0000000000"}
+	require.NoError(s.T(), s.db.CreateApplication(app))
+
+	messages := []*model.Message{
+		{ApplicationID: app.ID, Message: "top level", Extras: []byte(`{"client::display":{"contentType":"text/markdown"}}`)},
+		{ApplicationID: app.ID, Message: "nested", Extras: []byte(`{"home::sensor":{"client::display":{}}}`)},
+		{ApplicationID: app.ID, Message: "string value", Extras: []byte(`{"note":"\"client::display\":{}"}`)},
+		{ApplicationID: app.ID, Message: "without extras"},
+		{ApplicationID: app.ID, Message: "null value", Extras: []byte(`{"a.b":null,"quote\"d":1}`)},
+	}
+	for _, msg := range messages {
+		require.NoError(s.T(), s.db.CreateMessage(msg))
+	}
+
+	tests := []struct {
+		key      string
+		expected []uint
+	}{
+		{key: "client::display", expected: []uint{1}},
+		{key: "home::sensor", expected: []uint{2}},
+		{key: "contentType", expected: []uint{}},
+		{key: "a.b", expected: []uint{5}},
+		{key: `quote"d`, expected: []uint{5}},
+		{key: "%", expected: []uint{}},
+	}
+	for _, tt := range tests {
+		actual, err := s.db.GetMessagesByUserSince(user.ID, 10, 0, model.MessageFilter{ExtrasKeys: []string{tt.key}})
+		require.NoError(s.T(), err)
+		ids := []uint{}
+		for _, msg := range actual {
+			ids = append(ids, msg.ID)
+		}
+		assert.Equal(s.T(), tt.expected, ids, tt.key)
+	}
+}
+
+func (s *DatabaseSuite) TestExpiredMessages() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "backupserver"}
+	s.db.CreateApplication(app)
+
+	next, err := s.db.GetNextMessageExpiry()
+	require.NoError(s.T(), err)
+	assert.Nil(s.T(), next)
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	permanent := &model.Message{ApplicationID: app.ID, Message: "permanent", Date: now}
+	expired1 := &model.Message{ApplicationID: app.ID, Message: "expired1", Date: now, ExpiresAt: at(-2 * time.Minute)}
+	expired2 := &model.Message{ApplicationID: app.ID, Message: "expired2", Date: now, ExpiresAt: at(-time.Minute)}
+	expired3 := &model.Message{ApplicationID: app.ID, Message: "expired3", Date: now, ExpiresAt: at(-time.Second)}
+	later := &model.Message{ApplicationID: app.ID, Message: "later", Date: now, ExpiresAt: at(time.Hour)}
+	for _, msg := range []*model.Message{permanent, expired1, expired2, expired3, later} {
+		require.NoError(s.T(), s.db.CreateMessage(msg))
+	}
+
+	next, err = s.db.GetNextMessageExpiry()
+	require.NoError(s.T(), err)
+	if assert.NotNil(s.T(), next) {
+		assert.Equal(s.T(), expired1.ExpiresAt.Unix(), next.Unix())
+	}
+
+	deleted, err := s.db.DeleteExpiredMessages(now, 2)
+	require.NoError(s.T(), err)
+	if assert.Len(s.T(), deleted, 2) {
+		assert.Equal(s.T(), expired1.ID, deleted[0].ID)
+		assert.Equal(s.T(), expired2.ID, deleted[1].ID)
+	}
+	deleted, err = s.db.DeleteExpiredMessages(now, 2)
+	require.NoError(s.T(), err)
+	if assert.Len(s.T(), deleted, 1) {
+		assert.Equal(s.T(), expired3.ID, deleted[0].ID)
+	}
+	deleted, err = s.db.DeleteExpiredMessages(now, 2)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), deleted)
+
+	msgs, err := s.db.GetMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	if assert.Len(s.T(), msgs, 2) {
+		assert.Equal(s.T(), later.ID, msgs[0].ID)
+		assert.Equal(s.T(), permanent.ID, msgs[1].ID)
+	}
+
+	next, err = s.db.GetNextMessageExpiry()
+	require.NoError(s.T(), err)
+	if assert.NotNil(s.T(), next) {
+		assert.Equal(s.T(), later.ExpiresAt.Unix(), next.Unix())
+	}
+}
+
+func (s *DatabaseSuite) TestCreateMessages() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "logshipper"}
+	s.db.CreateApplication(app)
+
+	require.NoError(s.T(), s.db.CreateMessages(nil, nil))
+
+	now := time.Now()
+	messages := []*model.Message{
+		{ApplicationID: app.ID, Message: "first", Date: now},
+		{ApplicationID: app.ID, Message: "second", Date: now},
+	}
+	scheduled := []*model.ScheduledMessage{{ApplicationID: app.ID, Message: "later", DeliverAt: now.Add(time.Hour)}}
+	require.NoError(s.T(), s.db.CreateMessages(messages, scheduled))
+	assert.NotZero(s.T(), messages[0].ID)
+	assert.Greater(s.T(), messages[1].ID, messages[0].ID)
+	assert.NotZero(s.T(), scheduled[0].ID)
+
+	msgs, err := s.db.GetMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), msgs, 2)
+	pending, err := s.db.GetScheduledMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), pending, 1)
+
+	invalid := []*model.Message{{ApplicationID: app.ID, Message: "third", Date: now}, {ID: messages[0].ID, ApplicationID: app.ID, Message: "duplicate"}}
+	assert.Error(s.T(), s.db.CreateMessages(invalid, nil))
+	msgs, err = s.db.GetMessagesByApplication(app.ID)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), msgs, 2, "the batch is rolled back")
+}
+
 func hasIDInclusiveBetween(t *testing.T, msgs []*model.Message, from, to, decrement int) {
 	index := 0
 	for expectedID := from; expectedID >= to; expectedID -= decrement {
@@ -240,3 +461,40 @@ func assertEquals(t *testing.T, left, right *model.Message) {
 	left.Date = right.Date
 	assert.Equal(t, left, right)
 }
+
+func (s *DatabaseSuite) TestImportMessages() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "backupserver"}
+	s.db.CreateApplication(app)
+
+	batches := [][]*model.Message{
+		{{ApplicationID: app.ID, Message: "first"}, {ApplicationID: app.ID, Message: "second"}},
+		{{ApplicationID: app.ID, Message: "third"}},
+	}
+	next := func() ([]*model.Message, error) {
+		if len(batches) == 0 {
+			return nil, nil
+		}
+		batch := batches[0]
+		batches = batches[1:]
+		return batch, nil
+	}
+	assert.NoError(s.T(), s.db.ImportMessages(next))
+	if msgs, err := s.db.GetMessagesByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 3)
+	}
+
+	calls := 0
+	failing := func() ([]*model.Message, error) {
+		calls++
+		if calls == 1 {
+			return []*model.Message{{ApplicationID: app.ID, Message: "rolled back"}}, nil
+		}
+		return nil, errors.New("invalid message")
+	}
+	assert.EqualError(s.T(), s.db.ImportMessages(failing), "invalid message")
+	if msgs, err := s.db.GetMessagesByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 3)
+	}
+}
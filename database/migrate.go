@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned change of the database.
+//
+// New tables and columns are still created by AutoMigrate, migrations are used for changes
+// AutoMigrate can't do, f.ex. backfilling, renaming or dropping columns.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB, now time.Time) error
+}
+
+// migrations are applied in order. Released migrations must not be changed, add a new migration instead.
+var migrations = []Migration{
+	{Version: 1, Name: "fill missing application sort keys", Up: func(tx *gorm.DB, _ time.Time) error { return fillMissingSortKeys(tx) }},
+	{Version: 2, Name: "fill missing created at", Up: fillMissingCreatedAt},
+	{Version: 3, Name: "store message dates in utc", Up: func(tx *gorm.DB, _ time.Time) error { return messageDatesToUTC(tx) }},
+}
+
+// MigrationStatus is a migration and the date it was applied.
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LatestSchemaVersion returns the version of the latest migration.
+func LatestSchemaVersion() uint {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the latest applied migration, 0 if no migration was applied.
+func (d *GormDatabase) SchemaVersion() (uint, error) {
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := uint(0)
+	for _, migration := range applied {
+		if migration.Version > version {
+			version = migration.Version
+		}
+	}
+	return version, nil
+}
+
+// MigrationStatus returns all known migrations and whether they were applied.
+func (d *GormDatabase) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[uint]time.Time{}
+	for _, migration := range applied {
+		appliedAt[migration.Version] = migration.AppliedAt
+	}
+	status := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		status[i] = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// Migrate applies the pending migrations and returns them. With dryRun the pending migrations are only returned.
+// Every migration is applied in its own transaction together with its record in the migrations table.
+// Mysql commits schema changes implicitly, therefore a failed migration may be partially applied on mysql.
+func (d *GormDatabase) Migrate(now time.Time, dryRun bool) ([]Migration, error) {
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkApplied(applied); err != nil {
+		return nil, err
+	}
+	done := map[uint]bool{}
+	for _, migration := range applied {
+		done[migration.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	if dryRun {
+		return pending, nil
+	}
+
+	for _, migration := range pending {
+		log.Info().Uint("version", migration.Version).Str("name", migration.Name).Msg("Applying database migration")
+		err := d.DB.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx, now); err != nil {
+				return err
+			}
+			return tx.Create(&model.SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: now.UTC()}).Error
+		}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// PendingSchemaChanges returns the tables, columns and indexes AutoMigrate would create.
+// Changed column types aren't detected.
+func (d *GormDatabase) PendingSchemaChanges() ([]string, error) {
+	migrator := d.DB.Migrator()
+	var changes []string
+	for _, m := range migratedModels() {
+		stmt := &gorm.Statement{DB: d.DB}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+		if !migrator.HasTable(m) {
+			changes = append(changes, "create table "+table)
+			continue
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !migrator.HasColumn(m, column) {
+				changes = append(changes, fmt.Sprintf("add column %s.%s", table, column))
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(m, index.Name) {
+				changes = append(changes, fmt.Sprintf("create index %s on %s", index.Name, table))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// migratedModels returns the models AutoMigrate creates the tables for.
+func migratedModels() []any {
+	return append(Models(), new(model.SchemaMigration))
+}
+
+func (d *GormDatabase) checkSchemaVersion() error {
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	return checkApplied(applied)
+}
+
+// checkApplied returns an error if a migration of a newer gotify version was applied.
+func checkApplied(applied []*model.SchemaMigration) error {
+	for _, migration := range applied {
+		if migration.Version > LatestSchemaVersion() {
+			return fmt.Errorf("the database schema version %d is newer than the latest version %d known by this gotify version",
+				migration.Version, LatestSchemaVersion())
+		}
+	}
+	return nil
+}
+
+func (d *GormDatabase) appliedMigrations() ([]*model.SchemaMigration, error) {
+	if !d.DB.Migrator().HasTable(new(model.SchemaMigration)) {
+		return nil, nil
+	}
+	var applied []*model.SchemaMigration
+	err := d.DB.Order("version").Find(&applied).Error
+	return applied, err
+}
@@ -1,11 +1,15 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gotify/server/v2/model"
 	"github.com/gotify/server/v2/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -43,7 +47,7 @@ func (s *MigrationSuite) AfterTest(suiteName, testName string) {
 }
 
 func (s *MigrationSuite) TestMigration() {
-	db, err := New("sqlite3", s.tmpDir.Path("test_obsolete.db"), "admin", "admin", 6, true, fixedNow)
+	db, err := New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
 	assert.Nil(s.T(), err)
 	defer db.Close()
 
@@ -72,3 +76,110 @@ func (s *MigrationSuite) TestMigration() {
 		assert.Equal(s.T(), "test application", app.Name)
 	}
 }
+
+func (s *MigrationSuite) TestMigration_recordsVersions() {
+	db, err := Open("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, fixedNow)
+	require.NoError(s.T(), err)
+	version, err := db.SchemaVersion()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(0), version)
+	pending, err := db.Migrate(fixedNow(), true)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), pending, len(migrations))
+	changes, err := db.PendingSchemaChanges()
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), changes, "create table applications")
+	assert.NotContains(s.T(), changes, "create table users")
+	require.NoError(s.T(), db.DB.Migrator().DropColumn(new(model.User), "admin"))
+	changes, err = db.PendingSchemaChanges()
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), changes, "add column users.admin")
+	assert.False(s.T(), db.DB.Migrator().HasTable(new(model.SchemaMigration)), "dry run must not change the database")
+	db.Close()
+
+	db, err = New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
+	require.NoError(s.T(), err)
+	defer db.Close()
+
+	version, err = db.SchemaVersion()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), LatestSchemaVersion(), version)
+	status, err := db.MigrationStatus()
+	require.NoError(s.T(), err)
+	for _, migration := range status {
+		if assert.NotNil(s.T(), migration.AppliedAt, migration.Name) {
+			assert.True(s.T(), now.Equal(*migration.AppliedAt))
+		}
+	}
+	pending, err = db.Migrate(fixedNow(), false)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), pending)
+	changes, err = db.PendingSchemaChanges()
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), changes)
+}
+
+func (s *MigrationSuite) TestMigration_appliesOnlyPendingMigrations() {
+	db, err := New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
+	require.NoError(s.T(), err)
+	defer db.Close()
+
+	defer func(original []Migration) { migrations = original }(migrations)
+	calls := 0
+	up := func(tx *gorm.DB, _ time.Time) error {
+		calls++
+		return tx.Model(new(model.User)).Where("name = ?", "test_user").Update("admin", false).Error
+	}
+	migrations = append(migrations, Migration{Version: LatestSchemaVersion() + 1, Name: "demote test user", Up: up})
+
+	pending, err := db.Migrate(fixedNow(), false)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), pending, 1)
+	pending, err = db.Migrate(fixedNow(), false)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), pending)
+	assert.Equal(s.T(), 1, calls)
+	if user, err := db.GetUserByName("test_user"); assert.NoError(s.T(), err) {
+		assert.False(s.T(), user.Admin)
+	}
+}
+
+func (s *MigrationSuite) TestMigration_failedMigrationIsRolledBack() {
+	db, err := New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
+	require.NoError(s.T(), err)
+	defer db.Close()
+
+	defer func(original []Migration) { migrations = original }(migrations)
+	version := LatestSchemaVersion() + 1
+	migrations = append(migrations, Migration{Version: version, Name: "broken", Up: func(tx *gorm.DB, _ time.Time) error {
+		if err := tx.Model(new(model.User)).Where("name = ?", "test_user").Update("admin", false).Error; err != nil {
+			return err
+		}
+		return errors.New("broken")
+	}})
+
+	_, err = db.Migrate(fixedNow(), false)
+	assert.EqualError(s.T(), err, fmt.Sprintf("migration %d (broken): broken", version))
+	if user, err := db.GetUserByName("test_user"); assert.NoError(s.T(), err) {
+		assert.True(s.T(), user.Admin)
+	}
+	current, err := db.SchemaVersion()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), version-1, current)
+}
+
+func (s *MigrationSuite) TestMigration_newerSchemaVersion() {
+	db, err := New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), db.DB.Create(&model.SchemaMigration{Version: LatestSchemaVersion() + 1, Name: "future"}).Error)
+	require.NoError(s.T(), db.DB.Migrator().DropTable(new(model.Rule)))
+	db.Close()
+
+	_, err = New("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, "admin", "admin", 6, true, fixedNow)
+	assert.ErrorContains(s.T(), err, "is newer than the latest version")
+
+	db, err = Open("sqlite3", s.tmpDir.Path("test_obsolete.db"), Pool{}, fixedNow)
+	require.NoError(s.T(), err)
+	defer db.Close()
+	assert.False(s.T(), db.DB.Migrator().HasTable(new(model.Rule)), "the schema must not be changed")
+}
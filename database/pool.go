@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pool configures the database connections. Zero values use the defaults.
+//
+// Sqlite uses a single connection for writes and SQLiteReadConns connections for queries,
+// the idle connections and the lifetimes apply to the read only pool.
+type Pool struct {
+	// MaxOpenConns defaults to 10.
+	MaxOpenConns int
+	// MaxIdleConns defaults to 2.
+	MaxIdleConns int
+	// ConnMaxLifetime defaults to unlimited, and 9 minutes for mysql.
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime defaults to unlimited.
+	ConnMaxIdleTime time.Duration
+
+	// SQLiteWAL enables the write-ahead log, then reads don't block writes and writes don't block reads.
+	SQLiteWAL bool
+	// SQLiteBusyTimeout is the duration sqlite waits for a lock before failing with "database is locked".
+	SQLiteBusyTimeout time.Duration
+	// SQLiteReadConns is the size of the read only pool for queries, 0 disables it.
+	// Without it, queries wait for running writes as they share the single writer connection.
+	SQLiteReadConns int
+}
+
+const defaultMaxOpenConns = 10
+
+func (p Pool) apply(db *sql.DB, maxOpenConns int) {
+	db.SetMaxOpenConns(maxOpenConns)
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// openSqlite opens the single writer connection and, if configured, the read only pool.
+func openSqlite(connection string, pool Pool) (*sqlitePool, error) {
+	memory := isSqliteMemory(connection)
+
+	params := url.Values{}
+	if pool.SQLiteBusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(pool.SQLiteBusyTimeout.Milliseconds(), 10))
+	}
+	writeParams := url.Values{}
+	for key, value := range params {
+		writeParams[key] = value
+	}
+	if !memory {
+		// the journal mode is stored in the database, DELETE switches a database back from WAL.
+		writeParams.Set("_journal_mode", "DELETE")
+		if pool.SQLiteWAL {
+			writeParams.Set("_journal_mode", "WAL")
+		}
+	}
+
+	write, err := sql.Open("sqlite3", withSqliteParams(connection, writeParams))
+	if err != nil {
+		return nil, err
+	}
+	// We use the database connection inside the handlers from the http
+	// framework, therefore concurrent access occurs. Sqlite cannot handle
+	// concurrent writes, so we limit sqlite to one writer connection.
+	// see https://github.com/mattn/go-sqlite3/issues/274
+	write.SetMaxOpenConns(1)
+	// Opening the connection applies the journal mode before the readers connect.
+	if err := write.Ping(); err != nil {
+		write.Close()
+		return nil, err
+	}
+
+	if pool.SQLiteReadConns == 0 || memory {
+		return &sqlitePool{write: write}, nil
+	}
+
+	params.Set("_query_only", "1")
+	read, err := sql.Open("sqlite3", withSqliteParams(connection, params))
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+	pool.apply(read, pool.SQLiteReadConns)
+	return &sqlitePool{write: write, read: read}, nil
+}
+
+func withSqliteParams(connection string, params url.Values) string {
+	if len(params) == 0 {
+		return connection
+	}
+	// parameters already set in the connection take precedence, the sqlite driver uses the first value.
+	if strings.Contains(connection, "?") {
+		return connection + "&" + params.Encode()
+	}
+	return connection + "?" + params.Encode()
+}
+
+func isSqliteMemory(connection string) bool {
+	return strings.HasPrefix(connection, ":memory:") || strings.Contains(connection, "mode=memory")
+}
+
+// sqlitePool sends queries to the read only pool and everything else, including transactions,
+// to the writer connection. It implements gorm.ConnPool.
+type sqlitePool struct {
+	write *sql.DB
+	read  *sql.DB
+}
+
+func (p *sqlitePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.write.PrepareContext(ctx, query)
+}
+
+func (p *sqlitePool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return p.write.ExecContext(ctx, query, args...)
+}
+
+func (p *sqlitePool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return p.forQuery(query).QueryContext(ctx, query, args...)
+}
+
+func (p *sqlitePool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.forQuery(query).QueryRowContext(ctx, query, args...)
+}
+
+func (p *sqlitePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.write.BeginTx(ctx, opts)
+}
+
+// GetDBConn is used by gorm.DB.DB().
+func (p *sqlitePool) GetDBConn() (*sql.DB, error) {
+	return p.write, nil
+}
+
+func (p *sqlitePool) forQuery(query string) *sql.DB {
+	// inserts, updates and deletes with a RETURNING clause are executed as query too.
+	if p.read != nil && isSelect(query) {
+		return p.read
+	}
+	return p.write
+}
+
+func (p *sqlitePool) Close() error {
+	if p.read != nil {
+		p.read.Close()
+	}
+	return p.write.Close()
+}
+
+func isSelect(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	return len(query) >= 6 && strings.EqualFold(query[:6], "SELECT")
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlitePool(t *testing.T) {
+	tmpDir := test.NewTmpDir("gotify_testsqlitepool")
+	defer tmpDir.Clean()
+
+	pool := Pool{SQLiteWAL: true, SQLiteBusyTimeout: time.Second, SQLiteReadConns: 2}
+	db, err := New("sqlite3", tmpDir.Path("testdb.db"), pool, "admin", "pw", 5, true, fixedNow)
+	require.NoError(t, err)
+	defer db.Close()
+
+	journalMode := ""
+	require.NoError(t, db.DB.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+	busyTimeout := 0
+	require.NoError(t, db.sqlite.read.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 1000, busyTimeout)
+
+	_, err = db.sqlite.read.Exec("DELETE FROM users")
+	assert.Error(t, err, "the read pool must be read only")
+
+	tx := db.DB.Begin()
+	require.NoError(t, tx.Create(&model.User{Name: "uncommitted"}).Error)
+
+	// the query would wait for the transaction, if it used the single writer connection.
+	users, err := db.GetUsers()
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	require.NoError(t, tx.Commit().Error)
+	users, err = db.GetUsers()
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+}
+
+func TestSqlitePool_withoutWAL(t *testing.T) {
+	tmpDir := test.NewTmpDir("gotify_testsqlitepool")
+	defer tmpDir.Clean()
+
+	db, err := New("sqlite3", tmpDir.Path("testdb.db"), Pool{SQLiteWAL: true}, "admin", "pw", 5, true, fixedNow)
+	require.NoError(t, err)
+	db.Close()
+
+	db, err = New("sqlite3", tmpDir.Path("testdb.db"), Pool{SQLiteReadConns: 2}, "admin", "pw", 5, true, fixedNow)
+	require.NoError(t, err)
+	defer db.Close()
+	journalMode := ""
+	require.NoError(t, db.DB.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "delete", journalMode)
+}
+
+func TestSqlitePool_memory(t *testing.T) {
+	db, err := New("sqlite3", "file:pooltest?mode=memory&cache=shared", Pool{SQLiteWAL: true, SQLiteReadConns: 2}, "admin", "pw", 5, true, fixedNow)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Nil(t, db.sqlite.read, "a separate pool would not share the in-memory database")
+}
+
+func TestWithSqliteParams(t *testing.T) {
+	params := map[string][]string{"_busy_timeout": {"100"}}
+	assert.Equal(t, "data/gotify.db", withSqliteParams("data/gotify.db", nil))
+	assert.Equal(t, "data/gotify.db?_busy_timeout=100", withSqliteParams("data/gotify.db", params))
+	assert.Equal(t, "file:gotify.db?cache=shared&_busy_timeout=100", withSqliteParams("file:gotify.db?cache=shared", params))
+}
+
+func TestIsSelect(t *testing.T) {
+	assert.True(t, isSelect("SELECT * FROM users"))
+	assert.True(t, isSelect(" \n(select count(*) FROM users)"))
+	assert.False(t, isSelect("INSERT INTO users (name) VALUES (?) RETURNING id"))
+	assert.False(t, isSelect("PRAGMA journal_mode"))
+	assert.False(t, isSelect("SEL"))
+}
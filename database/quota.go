@@ -0,0 +1,52 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetUserQuota returns the quota of a user, nil if the user uses the defaults.
+func (d *GormDatabase) GetUserQuota(userID uint) (*model.UserQuota, error) {
+	quota := new(model.UserQuota)
+	err := d.DB.Where("user_id = ?", userID).Take(quota).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return quota, err
+}
+
+// SaveUserQuota creates or updates the quota of a user.
+func (d *GormDatabase) SaveUserQuota(quota *model.UserQuota) error {
+	return d.DB.Save(quota).Error
+}
+
+// CountApplicationsByUser returns the amount of non-internal applications of a user.
+func (d *GormDatabase) CountApplicationsByUser(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&model.Application{}).Where("user_id = ? AND internal = ?", userID, false).Count(&count).Error
+	return count, err
+}
+
+// CountClientsByUser returns the amount of clients of a user.
+func (d *GormDatabase) CountClientsByUser(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&model.Client{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// CountMessagesByUser returns the amount of messages in the applications of a user.
+// It is called for every created message of users with a message limit, the count uses the index on the application id.
+func (d *GormDatabase) CountMessagesByUser(userID uint) (int64, error) {
+	var count int64
+	apps := d.DB.Model(&model.Application{}).Select("id").Where("user_id = ?", userID)
+	err := d.DB.Model(&model.Message{}).Where("application_id IN (?)", apps).Count(&count).Error
+	return count, err
+}
+
+// GetPluginStorageSizeByUser returns the total size in bytes of the plugin storage of a user.
+func (d *GormDatabase) GetPluginStorageSizeByUser(userID uint) (int64, error) {
+	var size int64
+	err := d.DB.Model(&model.PluginConf{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(LENGTH(storage)), 0)").Scan(&size).Error
+	return size, err
+}
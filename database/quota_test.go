@@ -0,0 +1,74 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestUserQuota() {
+	user := &model.User{Name: "quota", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	other := &model.User{Name: "other", Pass: []byte{1}}
+	s.db.CreateUser(other)
+
+	if quota, err := s.db.GetUserQuota(user.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), quota, "not existing quota")
+	}
+
+	ten := int64(10)
+	assert.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: user.ID, MaxMessages: &ten}))
+	if quota, err := s.db.GetUserQuota(user.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), quota) {
+		assert.Equal(s.T(), int64(10), *quota.MaxMessages)
+		assert.Nil(s.T(), quota.MaxClients)
+	}
+
+	zero := int64(0)
+	assert.NoError(s.T(), s.db.SaveUserQuota(&model.UserQuota{UserID: user.ID, MaxClients: &zero}))
+	if quota, err := s.db.GetUserQuota(user.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), quota) {
+		assert.Nil(s.T(), quota.MaxMessages, "saving replaces all limits")
+		assert.Equal(s.T(), int64(0), *quota.MaxClients)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteUserByID(user.ID))
+	if quota, err := s.db.GetUserQuota(user.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), quota, "deleted with the user")
+	}
+}
+
+func (s *DatabaseSuite) TestQuotaUsage() {
+	user := &model.User{Name: "usage", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	other := &model.User{Name: "other", Pass: []byte{1}}
+	s.db.CreateUser(other)
+
+	count := func(f func(uint) (int64, error), userID uint) int64 {
+		value, err := f(userID)
+		assert.NoError(s.T(), err)
+		return value
+	}
+	assert.Equal(s.T(), int64(0), count(s.db.CountApplicationsByUser, user.ID))
+	assert.Equal(s.T(), int64(0), count(s.db.CountClientsByUser, user.ID))
+	assert.Equal(s.T(), int64(0), count(s.db.CountMessagesByUser, user.ID))
+	assert.Equal(s.T(), int64(0), count(s.db.GetPluginStorageSizeByUser, user.ID))
+
+	app := &model.Application{UserID: user.ID, Token: "Aquota1", Name: "app"}
+	s.db.CreateApplication(app)
+	s.db.CreateApplication(&model.Application{UserID: user.ID, Token: "Aquota2", Name: "internal", Internal: true})
+	otherApp := &model.Application{UserID: other.ID, Token: "Aquota3", Name: "other"}
+	s.db.CreateApplication(otherApp)
+	s.db.CreateClient(&model.Client{UserID: user.ID, Token: "Cquota1"})
+	s.db.CreateClient(&model.Client{UserID: other.ID, Token: "Cquota2"})
+	s.db.CreateMessage(&model.Message{ApplicationID: app.ID, Message: "one"})
+	s.db.CreateMessage(&model.Message{ApplicationID: app.ID, Message: "two"})
+	s.db.CreateMessage(&model.Message{ApplicationID: otherApp.ID, Message: "three"})
+	s.db.CreatePluginConf(&model.PluginConf{UserID: user.ID, ModulePath: "a", Token: "Pquota1", Storage: []byte("1234")})
+	s.db.CreatePluginConf(&model.PluginConf{UserID: user.ID, ModulePath: "b", Token: "Pquota2", Storage: []byte("56")})
+	s.db.CreatePluginConf(&model.PluginConf{UserID: other.ID, ModulePath: "a", Token: "Pquota3", Storage: []byte("789")})
+
+	assert.Equal(s.T(), int64(1), count(s.db.CountApplicationsByUser, user.ID), "internal applications are not counted")
+	assert.Equal(s.T(), int64(1), count(s.db.CountClientsByUser, user.ID))
+	assert.Equal(s.T(), int64(2), count(s.db.CountMessagesByUser, user.ID))
+	assert.True(s.T(), s.db.DB.Migrator().HasIndex(new(model.Message), "ApplicationID"), "messages are counted by application id")
+	assert.Equal(s.T(), int64(6), count(s.db.GetPluginStorageSizeByUser, user.ID))
+	assert.Equal(s.T(), int64(3), count(s.db.GetPluginStorageSizeByUser, other.ID))
+}
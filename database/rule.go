@@ -0,0 +1,44 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetRuleByID returns the rule for the given id or nil.
+func (d *GormDatabase) GetRuleByID(id uint) (*model.Rule, error) {
+	rule := new(model.Rule)
+	err := d.DB.Where("id = ?", id).Find(rule).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if rule.ID == id {
+		return rule, err
+	}
+	return nil, err
+}
+
+// GetRulesByUser returns all rules of a user in evaluation order.
+func (d *GormDatabase) GetRulesByUser(userID uint) ([]*model.Rule, error) {
+	var rules []*model.Rule
+	err := d.DB.Where("user_id = ?", userID).Order("id ASC").Find(&rules).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return rules, err
+}
+
+// CreateRule creates a rule.
+func (d *GormDatabase) CreateRule(rule *model.Rule) error {
+	return d.DB.Create(rule).Error
+}
+
+// UpdateRule updates a rule.
+func (d *GormDatabase) UpdateRule(rule *model.Rule) error {
+	return d.DB.Save(rule).Error
+}
+
+// DeleteRuleByID deletes a rule by its id.
+func (d *GormDatabase) DeleteRuleByID(id uint) error {
+	return d.DB.Where("id = ?", id).Delete(&model.Rule{}).Error
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestRule() {
+	if rule, err := s.db.GetRuleByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule, "not existing rule")
+	}
+
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	ops := &model.User{Name: "ops", Pass: []byte{1}}
+	s.db.CreateUser(ops)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "backup"}
+	s.db.CreateApplication(app)
+	infra := &model.Application{UserID: ops.ID, Token: "A0000000001", Name: "infra"}
+	s.db.CreateApplication(infra)
+
+	if rules, err := s.db.GetRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+
+	rule := &model.Rule{UserID: user.ID, Name: "tag", TitlePattern: "disk", Action: model.RuleActionTag, Tag: "infra"}
+	assert.NoError(s.T(), s.db.CreateRule(rule))
+	appRule := &model.Rule{UserID: user.ID, Name: "quiet", ApplicationID: app.ID, Action: model.RuleActionSetPriority, Priority: 2}
+	assert.NoError(s.T(), s.db.CreateRule(appRule))
+	copyRule := &model.Rule{UserID: user.ID, Name: "copy", Action: model.RuleActionCopy, TargetApplicationID: infra.ID}
+	assert.NoError(s.T(), s.db.CreateRule(copyRule))
+
+	if rules, err := s.db.GetRulesByUser(user.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), rules, 3) {
+		assert.Equal(s.T(), rule.ID, rules[0].ID)
+		assert.Equal(s.T(), appRule.ID, rules[1].ID)
+		assert.Equal(s.T(), copyRule.ID, rules[2].ID)
+	}
+
+	minPriority := 5
+	rule.MinPriority = &minPriority
+	assert.NoError(s.T(), s.db.UpdateRule(rule))
+	if updated, err := s.db.GetRuleByID(rule.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), updated.MinPriority) {
+		assert.Equal(s.T(), 5, *updated.MinPriority)
+		assert.Equal(s.T(), "disk", updated.TitlePattern)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(infra.ID))
+	if rules, err := s.db.GetRulesByUser(user.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), rules, 1) {
+		assert.Equal(s.T(), rule.ID, rules[0].ID)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteRuleByID(rule.ID))
+	if rule, err := s.db.GetRuleByID(rule.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), rule)
+	}
+
+	s.db.CreateRule(&model.Rule{UserID: user.ID, Name: "drop", Action: model.RuleActionDrop})
+	assert.NoError(s.T(), s.db.DeleteUserByID(user.ID))
+	if rules, err := s.db.GetRulesByUser(user.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), rules)
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetScheduledMessageByID returns the scheduled message for the given id or nil.
+func (d *GormDatabase) GetScheduledMessageByID(id uint) (*model.ScheduledMessage, error) {
+	msg := new(model.ScheduledMessage)
+	err := d.DB.Find(msg, id).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if msg.ID == id {
+		return msg, err
+	}
+	return nil, err
+}
+
+// CreateScheduledMessage creates a scheduled message.
+func (d *GormDatabase) CreateScheduledMessage(msg *model.ScheduledMessage) error {
+	msg.DeliverAt = msg.DeliverAt.UTC()
+	msg.ExpiresAt = utc(msg.ExpiresAt)
+	return d.DB.Create(msg).Error
+}
+
+// GetScheduledMessagesByApplication returns all scheduled messages of an application ordered by their delivery time.
+func (d *GormDatabase) GetScheduledMessagesByApplication(appID uint) ([]*model.ScheduledMessage, error) {
+	var messages []*model.ScheduledMessage
+	err := d.DB.Where("application_id = ?", appID).Order("deliver_at, id ASC").Find(&messages).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return messages, err
+}
+
+// GetDueScheduledMessages returns all scheduled messages which should be delivered at the given time.
+func (d *GormDatabase) GetDueScheduledMessages(now time.Time) ([]*model.ScheduledMessage, error) {
+	var messages []*model.ScheduledMessage
+	err := d.DB.Where("deliver_at <= ?", now.UTC()).Order("deliver_at, id ASC").Find(&messages).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return messages, err
+}
+
+// GetNextScheduledMessage returns the scheduled message which is due next or nil.
+func (d *GormDatabase) GetNextScheduledMessage() (*model.ScheduledMessage, error) {
+	var messages []*model.ScheduledMessage
+	err := d.DB.Order("deliver_at, id ASC").Limit(1).Find(&messages).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if len(messages) == 0 {
+		return nil, err
+	}
+	return messages[0], err
+}
+
+// DeliverScheduledMessage removes the scheduled message and creates the message in one transaction.
+// It returns false if the scheduled message was already removed.
+func (d *GormDatabase) DeliverScheduledMessage(scheduledID uint, message *model.Message) (bool, error) {
+	delivered := false
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", scheduledID).Delete(&model.ScheduledMessage{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		delivered = true
+		toUTC(message)
+		return tx.Create(message).Error
+	})
+	return delivered && err == nil, err
+}
+
+// DeleteScheduledMessageByID deletes a scheduled message by its id.
+func (d *GormDatabase) DeleteScheduledMessageByID(id uint) error {
+	return d.DB.Where("id = ?", id).Delete(&model.ScheduledMessage{}).Error
+}
+
+// DeleteScheduledMessagesByApplication deletes all scheduled messages of an application.
+func (d *GormDatabase) DeleteScheduledMessagesByApplication(appID uint) error {
+	return d.DB.Where("application_id = ?", appID).Delete(&model.ScheduledMessage{}).Error
+}
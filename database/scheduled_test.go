@@ -0,0 +1,67 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestScheduledMessage() {
+	if msg, err := s.db.GetScheduledMessageByID(1); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg, "not existing scheduled message")
+	}
+	if msg, err := s.db.GetNextScheduledMessage(); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg)
+	}
+
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "reminder"}
+	s.db.CreateApplication(app)
+
+	now := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)
+	later := &model.ScheduledMessage{ApplicationID: app.ID, Message: "later", DeliverAt: now.Add(time.Hour)}
+	soon := &model.ScheduledMessage{ApplicationID: app.ID, Message: "soon", DeliverAt: now.Add(time.Minute).In(time.FixedZone("CET", 3600))}
+	assert.NoError(s.T(), s.db.CreateScheduledMessage(later))
+	assert.NoError(s.T(), s.db.CreateScheduledMessage(soon))
+
+	if msgs, err := s.db.GetScheduledMessagesByApplication(app.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 2) {
+		assert.Equal(s.T(), "soon", msgs[0].Message)
+		assert.Equal(s.T(), "later", msgs[1].Message)
+	}
+	if next, err := s.db.GetNextScheduledMessage(); assert.NoError(s.T(), err) && assert.NotNil(s.T(), next) {
+		assert.Equal(s.T(), soon.ID, next.ID)
+		assert.True(s.T(), now.Add(time.Minute).Equal(next.DeliverAt))
+	}
+
+	if due, err := s.db.GetDueScheduledMessages(now); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), due)
+	}
+	if due, err := s.db.GetDueScheduledMessages(now.Add(30 * time.Minute)); assert.NoError(s.T(), err) && assert.Len(s.T(), due, 1) {
+		assert.Equal(s.T(), soon.ID, due[0].ID)
+	}
+
+	msg := &model.Message{ApplicationID: app.ID, Message: "soon", Date: now}
+	if delivered, err := s.db.DeliverScheduledMessage(soon.ID, msg); assert.NoError(s.T(), err) {
+		assert.True(s.T(), delivered)
+		assert.NotZero(s.T(), msg.ID)
+	}
+	if delivered, err := s.db.DeliverScheduledMessage(soon.ID, &model.Message{ApplicationID: app.ID, Message: "soon", Date: now}); assert.NoError(s.T(), err) {
+		assert.False(s.T(), delivered, "already delivered")
+	}
+	if msgs, err := s.db.GetMessagesByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 1)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteScheduledMessageByID(later.ID))
+	if msg, err := s.db.GetScheduledMessageByID(later.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), msg)
+	}
+
+	s.db.CreateScheduledMessage(&model.ScheduledMessage{ApplicationID: app.ID, Message: "x", DeliverAt: now})
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	if msgs, err := s.db.GetScheduledMessagesByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+}
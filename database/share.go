@@ -0,0 +1,49 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetApplicationShare returns the share of the application with the user or nil.
+func (d *GormDatabase) GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error) {
+	share := new(model.ApplicationShare)
+	err := d.DB.Where("application_id = ? AND user_id = ?", appID, userID).Find(share).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if share.ApplicationID == appID && share.UserID == userID {
+		return share, err
+	}
+	return nil, err
+}
+
+// GetApplicationSharesByApplication returns all shares of an application.
+func (d *GormDatabase) GetApplicationSharesByApplication(appID uint) ([]*model.ApplicationShare, error) {
+	var shares []*model.ApplicationShare
+	err := d.DB.Where("application_id = ?", appID).Order("user_id ASC").Find(&shares).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return shares, err
+}
+
+// GetApplicationSharesByUser returns all shares of applications with the user.
+func (d *GormDatabase) GetApplicationSharesByUser(userID uint) ([]*model.ApplicationShare, error) {
+	var shares []*model.ApplicationShare
+	err := d.DB.Where("user_id = ?", userID).Order("application_id ASC").Find(&shares).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return shares, err
+}
+
+// SaveApplicationShare creates or replaces the share of an application with a user.
+func (d *GormDatabase) SaveApplicationShare(share *model.ApplicationShare) error {
+	return d.DB.Save(share).Error
+}
+
+// DeleteApplicationShare deletes the share of an application with a user.
+func (d *GormDatabase) DeleteApplicationShare(appID, userID uint) error {
+	return d.DB.Where("application_id = ? AND user_id = ?", appID, userID).Delete(&model.ApplicationShare{}).Error
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestApplicationShare() {
+	owner := &model.User{Name: "owner", Pass: []byte{1}}
+	s.db.CreateUser(owner)
+	member := &model.User{Name: "member", Pass: []byte{1}}
+	s.db.CreateUser(member)
+	other := &model.User{Name: "other", Pass: []byte{1}}
+	s.db.CreateUser(other)
+	app := &model.Application{UserID: owner.ID, Token: "A0000000000", Name: "production"}
+	s.db.CreateApplication(app)
+	private := &model.Application{UserID: owner.ID, Token: "A0000000001", Name: "private"}
+	s.db.CreateApplication(private)
+	s.db.CreateMessage(&model.Message{ApplicationID: app.ID, Message: "shared"})
+	s.db.CreateMessage(&model.Message{ApplicationID: private.ID, Message: "private"})
+
+	if share, err := s.db.GetApplicationShare(app.ID, member.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), share, "not existing share")
+	}
+	if msgs, err := s.db.GetMessagesByUserSince(member.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), msgs)
+	}
+
+	assert.NoError(s.T(), s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: app.ID, UserID: member.ID, Permission: model.SharePermissionRead}))
+	assert.NoError(s.T(), s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: app.ID, UserID: other.ID, Permission: model.SharePermissionRead}))
+	if share, err := s.db.GetApplicationShare(app.ID, member.ID); assert.NoError(s.T(), err) && assert.NotNil(s.T(), share) {
+		assert.Equal(s.T(), model.SharePermissionRead, share.Permission)
+		share.Permission = model.SharePermissionManage
+		assert.NoError(s.T(), s.db.SaveApplicationShare(share))
+	}
+	if shares, err := s.db.GetApplicationSharesByApplication(app.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), shares, 2) {
+		assert.Equal(s.T(), member.ID, shares[0].UserID)
+		assert.Equal(s.T(), model.SharePermissionManage, shares[0].Permission)
+		assert.Equal(s.T(), other.ID, shares[1].UserID)
+	}
+	if shares, err := s.db.GetApplicationSharesByUser(member.ID); assert.NoError(s.T(), err) && assert.Len(s.T(), shares, 1) {
+		assert.Equal(s.T(), app.ID, shares[0].ApplicationID)
+	}
+
+	if msgs, err := s.db.GetMessagesByUserSince(member.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) && assert.Len(s.T(), msgs, 1) {
+		assert.Equal(s.T(), "shared", msgs[0].Message)
+	}
+	if msgs, err := s.db.GetMessagesByUserSince(owner.ID, 10, 0, model.MessageFilter{}); assert.NoError(s.T(), err) {
+		assert.Len(s.T(), msgs, 2, "owner messages must not be duplicated by shares")
+	}
+
+	assert.NoError(s.T(), s.db.DeleteApplicationShare(app.ID, other.ID))
+	if share, err := s.db.GetApplicationShare(app.ID, other.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), share)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteUserByID(member.ID))
+	if shares, err := s.db.GetApplicationSharesByUser(member.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), shares, "shares of deleted user")
+	}
+
+	s.db.SaveApplicationShare(&model.ApplicationShare{ApplicationID: app.ID, UserID: other.ID, Permission: model.SharePermissionRead})
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	if shares, err := s.db.GetApplicationSharesByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Empty(s.T(), shares, "shares of deleted application")
+	}
+}
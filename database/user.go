@@ -65,9 +65,20 @@ func (d *GormDatabase) GetUsers() ([]*model.User, error) {
 }
 
 // DeleteUserByID deletes a user by its id.
+// Group applications created by the user are passed on to another member of the group.
 func (d *GormDatabase) DeleteUserByID(id uint) error {
+	groups, err := d.GetGroupsByUser(id)
+	if err != nil {
+		return err
+	}
 	apps, _ := d.GetApplicationsByUser(id)
 	for _, app := range apps {
+		if owner := otherGroupMember(groups, app.GroupID, id); owner != 0 {
+			if err := d.DB.Model(app).Update("user_id", owner).Error; err != nil {
+				return err
+			}
+			continue
+		}
 		d.DeleteApplicationByID(app.ID)
 	}
 	clients, _ := d.GetClientsByUser(id)
@@ -78,7 +89,43 @@ func (d *GormDatabase) DeleteUserByID(id uint) error {
 	for _, conf := range pluginConfs {
 		d.DeletePluginConfByID(conf.ID)
 	}
-	return d.DB.Where("id = ?", id).Delete(&model.User{}).Error
+	d.DB.Where("user_id = ?", id).Delete(&model.MailForwardRule{})
+	d.DB.Where("user_id = ?", id).Delete(&model.Rule{})
+	d.DB.Where("user_id = ?", id).Delete(&model.ApplicationShare{})
+	d.DB.Where("user_id = ?", id).Delete(&model.GroupMember{})
+	d.DB.Where("user_id = ?", id).Delete(&model.MessageState{})
+	d.DB.Where("user_id = ?", id).Delete(&model.UserQuota{})
+	d.DB.Model(&model.EscalationPolicy{}).Where("escalate_to_user_id = ?", id).Update("escalate_to_user_id", 0)
+	if err := d.DB.Where("id = ?", id).Delete(&model.User{}).Error; err != nil {
+		return err
+	}
+	// messages hidden by all remaining members can be deleted now.
+	for _, group := range groups {
+		groupApps, err := d.GetApplicationsByGroup(group.ID)
+		if err != nil {
+			return err
+		}
+		for _, app := range groupApps {
+			if err := d.deleteMessagesHiddenByAllMembers(app.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func otherGroupMember(groups []*model.Group, groupID, userID uint) uint {
+	for _, group := range groups {
+		if group.ID != groupID {
+			continue
+		}
+		for _, member := range group.Members {
+			if member != userID {
+				return member
+			}
+		}
+	}
+	return 0
 }
 
 // UpdateUser updates a user.
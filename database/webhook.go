@@ -0,0 +1,29 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"gorm.io/gorm"
+)
+
+// GetWebhookTemplateByApplication returns the webhook template of the application or nil.
+func (d *GormDatabase) GetWebhookTemplateByApplication(appID uint) (*model.WebhookTemplate, error) {
+	tmpl := new(model.WebhookTemplate)
+	err := d.DB.Where("application_id = ?", appID).Find(tmpl).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	if tmpl.ApplicationID == appID {
+		return tmpl, err
+	}
+	return nil, err
+}
+
+// SaveWebhookTemplate creates or replaces the webhook template of an application.
+func (d *GormDatabase) SaveWebhookTemplate(tmpl *model.WebhookTemplate) error {
+	return d.DB.Save(tmpl).Error
+}
+
+// DeleteWebhookTemplateByApplication deletes the webhook template of an application.
+func (d *GormDatabase) DeleteWebhookTemplateByApplication(appID uint) error {
+	return d.DB.Where("application_id = ?", appID).Delete(&model.WebhookTemplate{}).Error
+}
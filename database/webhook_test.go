@@ -0,0 +1,40 @@
+package database
+
+import (
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestWebhookTemplate() {
+	user := &model.User{Name: "test", Pass: []byte{1}}
+	s.db.CreateUser(user)
+	app := &model.Application{UserID: user.ID, Token: "A0000000000", Name: "github"}
+	s.db.CreateApplication(app)
+
+	if tmpl, err := s.db.GetWebhookTemplateByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), tmpl, "not existing template")
+	}
+
+	tmpl := &model.WebhookTemplate{ApplicationID: app.ID, Message: "{{.message}}"}
+	assert.NoError(s.T(), s.db.SaveWebhookTemplate(tmpl))
+	if actual, err := s.db.GetWebhookTemplateByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), tmpl, actual)
+	}
+
+	replaced := &model.WebhookTemplate{ApplicationID: app.ID, Title: "{{.title}}", Message: "{{.text}}", Priority: "5"}
+	assert.NoError(s.T(), s.db.SaveWebhookTemplate(replaced))
+	if actual, err := s.db.GetWebhookTemplateByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Equal(s.T(), replaced, actual)
+	}
+
+	assert.NoError(s.T(), s.db.DeleteWebhookTemplateByApplication(app.ID))
+	if actual, err := s.db.GetWebhookTemplateByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual)
+	}
+
+	s.db.SaveWebhookTemplate(tmpl)
+	assert.NoError(s.T(), s.db.DeleteApplicationByID(app.ID))
+	if actual, err := s.db.GetWebhookTemplateByApplication(app.ID); assert.NoError(s.T(), err) {
+		assert.Nil(s.T(), actual)
+	}
+}
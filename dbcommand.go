@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gotify/server/v2/database"
+)
+
+func dbCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gotify db", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dryRun := fs.Bool("dry-run", false, "only show the pending migrations")
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "gotify db: missing subcommand, expected status or migrate")
+		return 2
+	}
+	subcommand := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if subcommand != "status" && subcommand != "migrate" {
+		fmt.Fprintf(stderr, "gotify db: unknown subcommand %q, expected status or migrate\n", subcommand)
+		return 2
+	}
+
+	conf, ok := loadCommandConfig(stderr)
+	if !ok {
+		return 1
+	}
+	if conf.Database.Dialect == "sqlite3" {
+		// database.Open would create an empty database
+		if _, err := os.Stat(conf.Database.Connection); err != nil {
+			fmt.Fprintln(stderr, "gotify db: cannot open database:", err)
+			return 1
+		}
+	}
+	db, err := database.Open(conf.Database.Dialect, conf.Database.Connection, databasePool(conf), time.Now)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify db: cannot open database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	if subcommand == "status" {
+		return dbStatus(db, stdout, stderr)
+	}
+	if *dryRun {
+		pending, err := db.Migrate(time.Now(), true)
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify db:", err)
+			return 1
+		}
+		changes, err := db.PendingSchemaChanges()
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify db:", err)
+			return 1
+		}
+		if len(pending) == 0 && len(changes) == 0 {
+			fmt.Fprintln(stdout, "No pending migrations.")
+		}
+		for _, change := range changes {
+			fmt.Fprintf(stdout, "Would %s\n", change)
+		}
+		for _, migration := range pending {
+			fmt.Fprintf(stdout, "Would apply %d: %s\n", migration.Version, migration.Name)
+		}
+		return 0
+	}
+
+	db.Close()
+	migrated, err := database.New(conf.Database.Dialect, conf.Database.Connection, databasePool(conf), conf.DefaultUser.Name, conf.DefaultUser.Pass, conf.PassStrength, false, time.Now)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify db:", err)
+		return 1
+	}
+	defer migrated.Close()
+	version, err := migrated.SchemaVersion()
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify db:", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "Migrated to schema version", version)
+	return 0
+}
+
+func dbStatus(db *database.GormDatabase, stdout, stderr io.Writer) int {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify db:", err)
+		return 1
+	}
+	status, err := db.MigrationStatus()
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify db:", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Schema version: %d (latest: %d)\n\n", version, database.LatestSchemaVersion())
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, migration := range status {
+		applied := "pending"
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, applied)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,177 @@
+package icon
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"  // register the gif decoder
+	_ "image/jpeg" // register the jpeg decoder
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Sizes are the edge lengths in pixels of the stored icon variants.
+var Sizes = []int{64, 128, 256}
+
+// MaxSize is the largest edge length of a stored icon.
+const MaxSize = 256
+
+// maxPixels limits the decoded image size, a small compressed file may decode to a huge image.
+const maxPixels = 4096 * 4096
+
+// ErrTooLarge is returned for images with more than 4096x4096 pixels.
+var ErrTooLarge = errors.New("the image must not have more than 4096x4096 pixels")
+
+// Decode decodes a png, jpeg or gif image, only the first frame of an animated gif is used.
+func Decode(r io.ReadSeeker) (image.Image, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// Resize scales the image down to fit into size x size pixels, the aspect ratio is kept.
+// Every pixel of the result is the average of the source pixels it covers.
+func Resize(img image.Image, size int) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			dstWidth, dstHeight = size, max(1, height*size/width)
+		} else {
+			dstWidth, dstHeight = max(1, width*size/height), size
+		}
+	}
+
+	// premultiplied alpha, so transparent pixels don't bleed their color into the average.
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			if a == 0 {
+				continue
+			}
+			// un-premultiply: color = sum(color*alpha) / sum(alpha)
+			d[0] = uint8(r * 255 / a)
+			d[1] = uint8(g * 255 / a)
+			d[2] = uint8(b * 255 / a)
+			d[3] = uint8(a / uint64((y1-y0)*(x1-x0)))
+		}
+	}
+	return dst
+}
+
+// VariantName returns the file name of the variant of the image with the given size.
+func VariantName(name string, size int) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "@" + strconv.Itoa(size) + ".png"
+}
+
+// IsVariant returns whether name is the file name of a variant, generated image names don't contain an @.
+func IsVariant(name string) bool {
+	return strings.Contains(name, "@")
+}
+
+// ValidSize returns whether size is one of Sizes.
+func ValidSize(size int) bool {
+	return slices.Contains(Sizes, size)
+}
+
+// Save re-encodes the image as png with at most MaxSize pixels as name and writes the variants for all Sizes.
+// Metadata of the source image isn't preserved.
+func Save(dir, name string, img image.Image) error {
+	resized := Resize(img, MaxSize)
+	if err := write(filepath.Join(dir, name), resized); err != nil {
+		return err
+	}
+	for _, size := range Sizes {
+		if err := write(filepath.Join(dir, VariantName(name, size)), Resize(resized, size)); err != nil {
+			Remove(dir, name)
+			return err
+		}
+	}
+	return nil
+}
+
+// Variant returns the path of the variant of the image with the given size, it is created from the image if it
+// doesn't exist yet. Images uploaded before icons were resized don't have variants.
+func Variant(dir, name string, size int) (string, error) {
+	if !ValidSize(size) {
+		return "", fmt.Errorf("invalid size %d", size)
+	}
+	if IsVariant(name) {
+		return "", fmt.Errorf("%s is already a variant", name)
+	}
+	path := filepath.Join(dir, VariantName(name, size))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	img, err := Decode(file)
+	if err != nil {
+		return "", err
+	}
+	return path, write(path, Resize(img, size))
+}
+
+// Remove deletes the image and its variants.
+func Remove(dir, name string) {
+	os.Remove(filepath.Join(dir, name))
+	for _, size := range Sizes {
+		os.Remove(filepath.Join(dir, VariantName(name, size)))
+	}
+}
+
+// write writes the png to a temporary file first, so concurrent requests never serve a partially written image.
+func write(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".icon-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,95 @@
+package icon
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if x%2 == 0 {
+				img.Set(x, y, color.NRGBA{R: 255, A: 255})
+			}
+		}
+	}
+
+	resized := Resize(img, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), resized.Bounds())
+	// half red, half transparent: the color stays red, only the alpha is averaged.
+	assert.Equal(t, color.NRGBA{R: 255, A: 127}, resized.NRGBAAt(10, 10))
+}
+
+func TestResize_keepsSmallImages(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 30))
+	img.Set(3, 4, color.NRGBA{G: 200, A: 255})
+
+	resized := Resize(img, 64)
+	assert.Equal(t, image.Rect(0, 0, 20, 30), resized.Bounds())
+	assert.Equal(t, color.NRGBA{G: 200, A: 255}, resized.NRGBAAt(3, 4))
+}
+
+func TestDecode_tooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4097, 4096))))
+
+	_, err := Decode(bytes.NewReader(buf.Bytes()))
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestDecode_invalid(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte("no image")))
+	assert.Error(t, err)
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, Save(dir, "app.png", image.NewNRGBA(image.Rect(0, 0, 1000, 500))))
+	assert.Equal(t, image.Point{X: 256, Y: 128}, imageSize(t, filepath.Join(dir, "app.png")))
+	assert.Equal(t, image.Point{X: 64, Y: 32}, imageSize(t, filepath.Join(dir, "app@64.png")))
+	assert.Equal(t, image.Point{X: 128, Y: 64}, imageSize(t, filepath.Join(dir, "app@128.png")))
+	assert.Equal(t, image.Point{X: 256, Y: 128}, imageSize(t, filepath.Join(dir, "app@256.png")))
+
+	Remove(dir, "app.png")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestVariant(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "legacy.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(file, image.NewNRGBA(image.Rect(0, 0, 300, 300))))
+	require.NoError(t, file.Close())
+
+	path, err := Variant(dir, "legacy.png", 128)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "legacy@128.png"), path)
+	assert.Equal(t, image.Point{X: 128, Y: 128}, imageSize(t, path))
+	assert.Equal(t, image.Point{X: 300, Y: 300}, imageSize(t, filepath.Join(dir, "legacy.png")))
+
+	_, err = Variant(dir, "legacy.png", 100)
+	assert.EqualError(t, err, "invalid size 100")
+	_, err = Variant(dir, "legacy@128.png", 64)
+	assert.EqualError(t, err, "legacy@128.png is already a variant")
+}
+
+func imageSize(t *testing.T, path string) image.Point {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	config, err := png.DecodeConfig(file)
+	require.NoError(t, err)
+	return image.Point{X: config.Width, Y: config.Height}
+}
@@ -0,0 +1,71 @@
+// Package loopback creates messages by passing requests to the gotify http
+// handler without leaving the process. Integrations like the SMTP server or
+// the MQTT bridge use it so the same authentication and processing as for
+// messages created over HTTP applies.
+package loopback
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+)
+
+// Response is the result of a loopback request.
+type Response struct {
+	Status int
+	Body   []byte
+}
+
+// ErrorDescription returns the errorDescription of an error response.
+func (r *Response) ErrorDescription() string {
+	var resp struct {
+		ErrorDescription string `json:"errorDescription"`
+	}
+	if json.Unmarshal(r.Body, &resp) != nil || resp.ErrorDescription == "" {
+		return "unknown error"
+	}
+	return resp.ErrorDescription
+}
+
+// CreateMessage sends msg as json to the POST /message endpoint of the handler
+// using the given application token.
+func CreateMessage(handler http.Handler, token, remoteAddr string, msg any) (*Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/message", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	req.RemoteAddr = remoteAddr
+	// The request never leaves the process, so it must not be redirected to HTTPS.
+	req.TLS = &tls.ConnectionState{}
+
+	recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	handler.ServeHTTP(recorder, req)
+	return &Response{Status: recorder.status, Body: recorder.body.Bytes()}, nil
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
@@ -0,0 +1,39 @@
+package loopback
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMessage(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"Bad Request","errorCode":400,"errorDescription":"oops"}`))
+	})
+
+	resp, err := CreateMessage(handler, "Atoken", "1.2.3.4:25", map[string]any{"message": "hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, request.Method)
+	assert.Equal(t, "/message", request.URL.Path)
+	assert.Equal(t, "Atoken", request.Header.Get("X-Gotify-Key"))
+	assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	assert.Equal(t, "1.2.3.4:25", request.RemoteAddr)
+	assert.NotNil(t, request.TLS)
+	assert.JSONEq(t, `{"message":"hello"}`, string(body))
+
+	assert.Equal(t, 400, resp.Status)
+	assert.Equal(t, "oops", resp.ErrorDescription())
+}
+
+func TestResponse_ErrorDescription_unknown(t *testing.T) {
+	assert.Equal(t, "unknown error", (&Response{Status: 500, Body: []byte("boom")}).ErrorDescription())
+}
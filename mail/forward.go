@@ -0,0 +1,271 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	forwardQueueSize   = 100
+	forwardWorkers     = 4
+	forwardMaxAttempts = 5
+	forwardRetryDelay  = 30 * time.Second
+	forwardDialTimeout = 30 * time.Second
+	forwardSendTimeout = time.Minute
+)
+
+var errNoStartTLS = errors.New("the mail server doesn't support STARTTLS")
+
+// The ForwardDatabase interface for encapsulating database access.
+type ForwardDatabase interface {
+	GetMailForwardRulesByUser(userID uint) ([]*model.MailForwardRule, error)
+	GetApplicationByID(id uint) (*model.Application, error)
+}
+
+type forwardJob struct {
+	userID    uint
+	message   *model.MessageExternal
+	offline   bool
+	recipient string
+}
+
+type delivery struct {
+	recipient string
+	content   []byte
+	attempts  int
+}
+
+// Forwarder forwards messages via email according to the mail forward rules
+// of the user. Emails are sent asynchronously by a fixed number of workers,
+// so a slow mail server doesn't stall the whole queue, and failed deliveries
+// are retried with an exponential backoff.
+type Forwarder struct {
+	conf       config.SMTP
+	db         ForwardDatabase
+	connected  func(userID uint) bool
+	jobs       chan forwardJob
+	deliveries chan *delivery
+	done       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// NewForwarder creates a Forwarder and starts its queue. connected is used to
+// check whether a user has clients connected to the stream.
+func NewForwarder(conf config.SMTP, db ForwardDatabase, connected func(userID uint) bool) *Forwarder {
+	f := &Forwarder{
+		conf:        conf,
+		db:          db,
+		connected:   connected,
+		jobs:        make(chan forwardJob, forwardQueueSize),
+		deliveries:  make(chan *delivery, forwardQueueSize),
+		done:        make(chan struct{}),
+		maxAttempts: forwardMaxAttempts,
+		retryDelay:  forwardRetryDelay,
+	}
+	f.wg.Add(forwardWorkers)
+	for range forwardWorkers {
+		go f.run()
+	}
+	return f
+}
+
+// Notify queues the message for forwarding, it never blocks.
+func (f *Forwarder) Notify(userID uint, message *model.MessageExternal) {
+	job := forwardJob{userID: userID, message: message, offline: !f.connected(userID)}
+	select {
+	case <-f.done:
+	case f.jobs <- job:
+	default:
+		log.Warn().Uint("user_id", userID).Uint("message_id", message.ID).Msg("Mail forward queue is full, dropping message")
+	}
+}
+
+// Send queues the message for delivery to the recipient regardless of the
+// mail forward rules, it never blocks.
+func (f *Forwarder) Send(recipient string, message *model.MessageExternal) {
+	select {
+	case <-f.done:
+	case f.jobs <- forwardJob{message: message, recipient: recipient}:
+	default:
+		log.Warn().Str("recipient", recipient).Uint("message_id", message.ID).Msg("Mail forward queue is full, dropping message")
+	}
+}
+
+// Close stops the queue, pending deliveries are dropped.
+func (f *Forwarder) Close() {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	f.wg.Wait()
+}
+
+func (f *Forwarder) run() {
+	defer f.wg.Done()
+	for {
+		select {
+		case <-f.done:
+			return
+		case job := <-f.jobs:
+			f.process(job)
+		case d := <-f.deliveries:
+			f.attempt(d)
+		}
+	}
+}
+
+func (f *Forwarder) process(job forwardJob) {
+	if job.recipient != "" {
+		f.attempt(&delivery{recipient: job.recipient, content: f.buildMail(job.recipient, job.message)})
+		return
+	}
+
+	rules, err := f.db.GetMailForwardRulesByUser(job.userID)
+	if err != nil {
+		log.Error().Err(err).Uint("user_id", job.userID).Msg("Could not load mail forward rules")
+		return
+	}
+
+	priority := 0
+	if job.message.Priority != nil {
+		priority = *job.message.Priority
+	}
+	sent := map[string]bool{}
+	for _, rule := range rules {
+		if sent[rule.Recipient] || !rule.Matches(job.message.ApplicationID, priority, job.offline) {
+			continue
+		}
+		sent[rule.Recipient] = true
+		f.attempt(&delivery{recipient: rule.Recipient, content: f.buildMail(rule.Recipient, job.message)})
+	}
+}
+
+func (f *Forwarder) attempt(d *delivery) {
+	d.attempts++
+	err := f.send(d.recipient, d.content)
+	if err == nil {
+		return
+	}
+
+	var protoErr *textproto.Error
+	permanent := errors.Is(err, errNoStartTLS) || (errors.As(err, &protoErr) && protoErr.Code >= 500)
+	if permanent || d.attempts >= f.maxAttempts {
+		log.Error().Err(err).Str("recipient", d.recipient).Int("attempts", d.attempts).Msg("Could not forward message via email, giving up")
+		return
+	}
+
+	delay := f.retryDelay << (d.attempts - 1)
+	log.Warn().Err(err).Str("recipient", d.recipient).Str("retry_in", delay.String()).Msg("Could not forward message via email")
+	time.AfterFunc(delay, func() {
+		select {
+		case <-f.done:
+		case f.deliveries <- d:
+		}
+	})
+}
+
+func (f *Forwarder) buildMail(recipient string, message *model.MessageExternal) []byte {
+	subject := message.Title
+	if app, err := f.db.GetApplicationByID(message.ApplicationID); err == nil && app != nil && app.Name != subject {
+		subject = fmt.Sprintf("[%s] %s", app.Name, subject)
+	}
+	priority := 0
+	if message.Priority != nil {
+		priority = *message.Priority
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", f.conf.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", recipient)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", message.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "%s: %d\r\n", priorityHeader, priority)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	body.Write([]byte(strings.ReplaceAll(message.Message, "\n", "\r\n")))
+	fmt.Fprintf(body, "\r\n\r\n-- \r\nPriority: %d\r\n", priority)
+	body.Close()
+	return buf.Bytes()
+}
+
+func (f *Forwarder) send(recipient string, content []byte) error {
+	from, err := mail.ParseAddress(f.conf.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	addr := net.JoinHostPort(f.conf.Host, strconv.Itoa(f.conf.Port))
+	tlsConfig := &tls.Config{ServerName: f.conf.Host}
+	var conn net.Conn
+	if f.conf.Encryption == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: forwardDialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, forwardDialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(forwardSendTimeout))
+
+	client, err := smtp.NewClient(conn, f.conf.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if f.conf.Encryption == "starttls" {
+		// never fall back to plain text, the credentials and the message would be sent unencrypted
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errNoStartTLS
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if f.conf.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", f.conf.Username, f.conf.Password, f.conf.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,252 @@
+package mail
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMail struct {
+	From string
+	To   []string
+	Mail *parsedMail
+}
+
+// standIn is a local SMTP server which records the received mails.
+type standIn struct {
+	mutex    sync.Mutex
+	mails    []sentMail
+	failures []error
+	// hold blocks the delivery to slow@example.com until it's closed
+	hold chan struct{}
+}
+
+func (s *standIn) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &standInSession{server: s}, nil
+}
+
+func (s *standIn) received() []sentMail {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]sentMail{}, s.mails...)
+}
+
+type standInSession struct {
+	server *standIn
+	from   string
+	to     []string
+}
+
+func (s *standInSession) Mail(from string, opts *smtp.MailOptions) error {
+	s.from = from
+	return nil
+}
+
+func (s *standInSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	s.to = append(s.to, to)
+	return nil
+}
+
+func (s *standInSession) Data(r io.Reader) error {
+	if s.server.hold != nil && len(s.to) > 0 && s.to[0] == "slow@example.com" {
+		<-s.server.hold
+	}
+	s.server.mutex.Lock()
+	defer s.server.mutex.Unlock()
+	if len(s.server.failures) > 0 {
+		err := s.server.failures[0]
+		s.server.failures = s.server.failures[1:]
+		io.Copy(io.Discard, r)
+		return err
+	}
+	mail, err := parseMail(r)
+	if err != nil {
+		return err
+	}
+	s.server.mails = append(s.server.mails, sentMail{From: s.from, To: s.to, Mail: mail})
+	return nil
+}
+
+func (s *standInSession) Reset()        {}
+func (s *standInSession) Logout() error { return nil }
+
+type forwardDB struct {
+	rules map[uint][]*model.MailForwardRule
+}
+
+func (d *forwardDB) GetMailForwardRulesByUser(userID uint) ([]*model.MailForwardRule, error) {
+	return d.rules[userID], nil
+}
+
+func (d *forwardDB) GetApplicationByID(id uint) (*model.Application, error) {
+	return &model.Application{ID: id, Name: "Backup"}, nil
+}
+
+func startStandIn(t *testing.T, failures ...error) (*standIn, config.SMTP) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend := &standIn{failures: failures}
+	server := smtp.NewServer(backend)
+	server.Domain = "localhost"
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return backend, config.SMTP{Host: host, Port: portNumber, From: "Gotify <gotify@example.com>", Encryption: "none"}
+}
+
+func newTestForwarder(conf config.SMTP, db ForwardDatabase, connected bool) *Forwarder {
+	f := NewForwarder(conf, db, func(uint) bool { return connected })
+	f.retryDelay = 10 * time.Millisecond
+	return f
+}
+
+func message(appID uint, priority int) *model.MessageExternal {
+	return &model.MessageExternal{
+		ID:            1,
+		ApplicationID: appID,
+		Title:         "Backup failed",
+		Message:       "Disk full",
+		Priority:      &priority,
+		Date:          time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestForwarder_forwardsMatchingMessages(t *testing.T) {
+	server, conf := startStandIn(t)
+	db := &forwardDB{rules: map[uint][]*model.MailForwardRule{
+		1: {
+			{UserID: 1, Recipient: "ops@example.com", MinPriority: 8},
+			{UserID: 1, Recipient: "backup@example.com", MinPriority: 0, ApplicationID: 5},
+		},
+	}}
+	f := newTestForwarder(conf, db, true)
+	defer f.Close()
+
+	f.Notify(1, message(5, 2))
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"backup@example.com"}, server.received()[0].To)
+
+	f.Notify(1, message(3, 9))
+	require.Eventually(t, func() bool { return len(server.received()) == 2 }, time.Second, 5*time.Millisecond)
+	mail := server.received()[1]
+	assert.Equal(t, "gotify@example.com", mail.From)
+	assert.Equal(t, []string{"ops@example.com"}, mail.To)
+	assert.Equal(t, "[Backup] Backup failed", mail.Mail.Title)
+	assert.Contains(t, mail.Mail.Message, "Disk full")
+	if assert.NotNil(t, mail.Mail.Priority) {
+		assert.Equal(t, 9, *mail.Mail.Priority)
+	}
+
+	f.Notify(2, message(3, 9))
+	f.Notify(1, message(3, 1))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, server.received(), 2)
+}
+
+func TestForwarder_onlyWhenOffline(t *testing.T) {
+	server, conf := startStandIn(t)
+	db := &forwardDB{rules: map[uint][]*model.MailForwardRule{
+		1: {{UserID: 1, Recipient: "ops@example.com", MinPriority: 8, OnlyWhenOffline: true}},
+	}}
+
+	online := newTestForwarder(conf, db, true)
+	online.Notify(1, message(1, 10))
+	time.Sleep(50 * time.Millisecond)
+	online.Close()
+	assert.Empty(t, server.received())
+
+	offline := newTestForwarder(conf, db, false)
+	defer offline.Close()
+	offline.Notify(1, message(1, 10))
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestForwarder_retriesTemporaryFailures(t *testing.T) {
+	temporary := &smtp.SMTPError{Code: 451, Message: "try again"}
+	server, conf := startStandIn(t, temporary, temporary)
+	db := &forwardDB{rules: map[uint][]*model.MailForwardRule{
+		1: {{UserID: 1, Recipient: "ops@example.com"}},
+	}}
+	f := newTestForwarder(conf, db, true)
+	defer f.Close()
+
+	f.Notify(1, message(1, 0))
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestForwarder_givesUpOnPermanentFailure(t *testing.T) {
+	permanent := &smtp.SMTPError{Code: 550, Message: "no such user"}
+	server, conf := startStandIn(t, permanent)
+	db := &forwardDB{rules: map[uint][]*model.MailForwardRule{
+		1: {{UserID: 1, Recipient: "ops@example.com"}},
+	}}
+	f := newTestForwarder(conf, db, true)
+	defer f.Close()
+
+	f.Notify(1, message(1, 0))
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, server.received())
+}
+
+func TestForwarder_givesUpAfterMaxAttempts(t *testing.T) {
+	temporary := &smtp.SMTPError{Code: 451, Message: "try again"}
+	server, conf := startStandIn(t, temporary, temporary, temporary)
+	db := &forwardDB{rules: map[uint][]*model.MailForwardRule{
+		1: {{UserID: 1, Recipient: "ops@example.com"}},
+	}}
+	f := newTestForwarder(conf, db, true)
+	f.maxAttempts = 2
+	defer f.Close()
+
+	f.Notify(1, message(1, 0))
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, server.received())
+}
+
+func TestForwarder_sendIgnoresRules(t *testing.T) {
+	server, conf := startStandIn(t)
+	f := newTestForwarder(conf, &forwardDB{}, true)
+	defer f.Close()
+
+	f.Send("oncall@example.com", message(1, 10))
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"oncall@example.com"}, server.received()[0].To)
+	assert.Equal(t, "[Backup] Backup failed", server.received()[0].Mail.Title)
+}
+
+func TestForwarder_slowServerDoesNotStallQueue(t *testing.T) {
+	server, conf := startStandIn(t)
+	server.hold = make(chan struct{})
+	f := newTestForwarder(conf, &forwardDB{}, true)
+	defer f.Close()
+
+	f.Send("slow@example.com", message(1, 5))
+	f.Send("ops@example.com", message(1, 5))
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"ops@example.com"}, server.received()[0].To)
+
+	close(server.hold)
+	require.Eventually(t, func() bool { return len(server.received()) == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestForwarder_starttlsRequired(t *testing.T) {
+	server, conf := startStandIn(t)
+	conf.Encryption = "starttls"
+	f := newTestForwarder(conf, &forwardDB{}, true)
+	defer f.Close()
+
+	err := f.send("ops@example.com", []byte("Subject: Backup\r\n\r\nDisk full\r\n"))
+	assert.ErrorIs(t, err, errNoStartTLS)
+	assert.Empty(t, server.received())
+}
@@ -0,0 +1,133 @@
+package mail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	multipleNewlines = regexp.MustCompile(`\n{3,}`)
+	whitespace       = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// htmlToMarkdown converts the subset of html typically used in notification
+// emails to markdown. Unknown tags are dropped and only their text is kept.
+func htmlToMarkdown(input string) string {
+	var out strings.Builder
+	var links []string
+	skip := 0
+	pre := 0
+	tokenizer := html.NewTokenizer(strings.NewReader(input))
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			result := multipleNewlines.ReplaceAllString(out.String(), "\n\n")
+			return strings.TrimSpace(result)
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := string(tokenizer.Text())
+			if pre == 0 {
+				text = whitespace.ReplaceAllString(text, " ")
+				if strings.HasSuffix(out.String(), "\n") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			out.WriteString(text)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				skip++
+			case "br":
+				out.WriteString("\n")
+			case "p", "div", "table", "tr", "ul", "ol":
+				out.WriteString("\n\n")
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				out.WriteString("\n\n" + strings.Repeat("#", int(name[1]-'0')) + " ")
+			case "li":
+				out.WriteString("\n- ")
+			case "td", "th":
+				out.WriteString(" ")
+			case "hr":
+				out.WriteString("\n\n---\n\n")
+			case "b", "strong":
+				out.WriteString("**")
+			case "i", "em":
+				out.WriteString("*")
+			case "code":
+				if pre == 0 {
+					out.WriteString("`")
+				}
+			case "pre":
+				pre++
+				out.WriteString("\n\n```\n")
+			case "a":
+				href := ""
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = tokenizer.TagAttr()
+					if string(key) == "href" {
+						href = string(value)
+					}
+				}
+				links = append(links, href)
+				if href != "" {
+					out.WriteString("[")
+				}
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "table", "ul", "ol", "h1", "h2", "h3", "h4", "h5", "h6":
+				out.WriteString("\n\n")
+			case "tr":
+				out.WriteString("\n")
+			case "b", "strong":
+				out.WriteString("**")
+			case "i", "em":
+				out.WriteString("*")
+			case "code":
+				if pre == 0 {
+					out.WriteString("`")
+				}
+			case "pre":
+				if pre > 0 {
+					pre--
+				}
+				out.WriteString("\n```\n\n")
+			case "a":
+				if len(links) == 0 {
+					continue
+				}
+				href := links[len(links)-1]
+				links = links[:len(links)-1]
+				if href != "" {
+					out.WriteString("](" + escapeLinkDestination(href) + ")")
+				}
+			}
+		}
+	}
+}
+
+// escapeLinkDestination percent-encodes the characters which would end or break a markdown link destination.
+func escapeLinkDestination(href string) string {
+	var out strings.Builder
+	for _, b := range []byte(href) {
+		if b <= ' ' || b == 0x7f || strings.IndexByte("()<>\\", b) >= 0 {
+			fmt.Fprintf(&out, "%%%02X", b)
+			continue
+		}
+		out.WriteByte(b)
+	}
+	return out.String()
+}
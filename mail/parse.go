@@ -0,0 +1,143 @@
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const priorityHeader = "X-Gotify-Priority"
+
+type parsedMail struct {
+	Title    string
+	Message  string
+	Priority *int
+	Markdown bool
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func parseMail(r io.Reader) (*parsedMail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &parsedMail{Title: decodeHeader(msg.Header.Get("Subject"))}
+	if raw := strings.TrimSpace(msg.Header.Get(priorityHeader)); raw != "" {
+		if priority, err := strconv.Atoi(raw); err == nil {
+			result.Priority = &priority
+		}
+	}
+
+	text, html, err := readPart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.TrimSpace(text) != "":
+		result.Message = strings.TrimSpace(text)
+	case strings.TrimSpace(html) != "":
+		result.Message = htmlToMarkdown(html)
+		result.Markdown = true
+	}
+	if result.Message == "" {
+		result.Message = result.Title
+	}
+	if result.Message == "" {
+		return nil, errors.New("empty subject and body")
+	}
+	return result, nil
+}
+
+// readPart returns the first text/plain and text/html content of the part,
+// attachments are ignored.
+func readPart(header textproto.MIMEHeader, body io.Reader) (text, html string, err error) {
+	if disposition, _, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && disposition == "attachment" {
+		return "", "", nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return text, html, nil
+			}
+			if err != nil {
+				return "", "", err
+			}
+			partText, partHTML, err := readPart(part.Header, part)
+			if err != nil {
+				return "", "", err
+			}
+			if text == "" {
+				text = partText
+			}
+			if html == "" {
+				html = partHTML
+			}
+		}
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", "", nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if charset := params["charset"]; charset != "" {
+		if body, err = charsetReader(charset, body); err != nil {
+			return "", "", err
+		}
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", err
+	}
+	if mediaType == "text/html" {
+		return "", string(content), nil
+	}
+	return strings.ReplaceAll(string(content), "\r\n", "\n"), "", nil
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// charsetReader supports utf-8 and its subsets, latin1 which is still used
+// by some older devices and windows-1252 which is used by outlook.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1":
+		return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252.NewDecoder().Reader(input), nil
+	default:
+		return nil, errors.New("unsupported charset " + charset)
+	}
+}
@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMail_plain(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: =?utf-8?q?Sicherung_abgeschlossen_=E2=9C=93?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Gr=C3=B6=C3=9Fe: 5 GB\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Sicherung abgeschlossen ✓", mail.Title)
+	assert.Equal(t, "Größe: 5 GB", mail.Message)
+	assert.False(t, mail.Markdown)
+	assert.Nil(t, mail.Priority)
+}
+
+func TestParseMail_latin1Base64(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: UPS\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"U3Ryb21hdXNmYWxs/A==\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Stromausfallü", mail.Message)
+}
+
+func TestParseMail_windows1252(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: =?windows-1252?Q?Rechnung_=80?=\r\n" +
+		"Content-Type: text/plain; charset=windows-1252\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"=93Betrag=94 =96 100 =80\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Rechnung €", mail.Title)
+	assert.Equal(t, "“Betrag” – 100 €", mail.Message)
+}
+
+func TestParseMail_multipartPrefersText(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: Report\r\n" +
+		"Content-Type: multipart/alternative; boundary=XYZ\r\n" +
+		"\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>html</p>\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"text\r\n" +
+		"--XYZ--\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "text", mail.Message)
+	assert.False(t, mail.Markdown)
+}
+
+func TestParseMail_htmlOnly_ignoresAttachments(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: Report\r\n" +
+		"Content-Type: multipart/mixed; boundary=XYZ\r\n" +
+		"\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=log.txt\r\n" +
+		"\r\n" +
+		"attached log\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Job <b>failed</b></p>\r\n" +
+		"--XYZ--\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Job **failed**", mail.Message)
+	assert.True(t, mail.Markdown)
+}
+
+func TestParseMail_priority(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: Report\r\nX-Gotify-Priority: 7\r\n\r\nbody\r\n"))
+	require.NoError(t, err)
+	if assert.NotNil(t, mail.Priority) {
+		assert.Equal(t, 7, *mail.Priority)
+	}
+}
+
+func TestParseMail_emptyBodyUsesSubject(t *testing.T) {
+	mail, err := parseMail(strings.NewReader("Subject: Door opened\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Door opened", mail.Message)
+
+	_, err = parseMail(strings.NewReader("From: a@b.c\r\n\r\n"))
+	assert.Error(t, err)
+}
+
+func TestParseMail_unsupportedCharset(t *testing.T) {
+	_, err := parseMail(strings.NewReader("Subject: x\r\nContent-Type: text/plain; charset=koi8-r\r\n\r\nbody\r\n"))
+	assert.Error(t, err)
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	cases := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"text", "hello   <i>world</i>", "hello *world*"},
+		{"link", `<a href="https://example.com">example</a>`, "[example](https://example.com)"},
+		{"link with markdown in href", "<a href=\"https://example.com/a b)![x](https://evil.example)\">example</a>", "[example](https://example.com/a%20b%29![x]%28https://evil.example%29)"},
+		{"anchor without href", `<a name="x">example</a>`, "example"},
+		{"heading and paragraph", "<h2>Status</h2><p>all good</p>", "## Status\n\nall good"},
+		{"list", "<ul><li>one</li><li>two</li></ul>", "- one\n- two"},
+		{"break", "a<br>b", "a\nb"},
+		{"skips head and style", "<html><head><title>t</title><style>p{}</style></head><body>body</body></html>", "body"},
+		{"pre", "<pre>a  b\nc</pre>", "```\na  b\nc\n```"},
+		{"inline code", "run <code>make</code>", "run `make`"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, htmlToMarkdown(c.html))
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package mail
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/loopback"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errRecipientDomain = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 2},
+		Message:      "Recipient domain not accepted",
+	}
+	errUnknownToken = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+		Message:      "Unknown application token",
+	}
+	errTemporary = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+		Message:      "Message could not be stored, try again later",
+	}
+)
+
+// Server accepts emails via SMTP and creates a message for every recipient of
+// the form <application-token>@<domain>.
+//
+// The messages are created by sending a request to the POST /message endpoint
+// of the given handler, therefore the same authentication and processing as for
+// messages created over HTTP applies.
+type Server struct {
+	smtp    *smtp.Server
+	handler http.Handler
+	conf    config.SMTPServer
+}
+
+// NewServer creates a new SMTP server which passes the received emails to the
+// given http handler. STARTTLS is offered if a certificate is configured,
+// authentication is only accepted over TLS unless AllowInsecureAuth is set.
+func NewServer(conf config.SMTPServer, handler http.Handler) (*Server, error) {
+	s := &Server{handler: handler, conf: conf}
+	s.smtp = smtp.NewServer(s)
+	s.smtp.Domain = conf.Domain
+	s.smtp.MaxMessageBytes = int64(conf.MaxMessageBytes)
+	s.smtp.MaxRecipients = 50
+	s.smtp.ReadTimeout = time.Minute
+	s.smtp.WriteTimeout = time.Minute
+	s.smtp.AllowInsecureAuth = conf.AllowInsecureAuth
+	s.smtp.ErrorLog = smtpLogWriter{}
+	if conf.CertFile != "" || conf.CertKey != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.CertKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the smtp server certificate: %w", err)
+		}
+		s.smtp.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return s, nil
+}
+
+// Serve accepts incoming SMTP connections on the listener.
+func (s *Server) Serve(l net.Listener) error {
+	err := s.smtp.Serve(l)
+	if errors.Is(err, smtp.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops the server and closes all open connections.
+func (s *Server) Close() error {
+	return s.smtp.Close()
+}
+
+// NewSession implements smtp.Backend.
+func (s *Server) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &session{server: s, remoteAddr: c.Conn().RemoteAddr().String()}, nil
+}
+
+func (s *Server) authRequired() bool {
+	return s.conf.Username != "" || s.conf.Password != ""
+}
+
+func (s *Server) deliver(token, remoteAddr string, mail *parsedMail) error {
+	msg := map[string]any{
+		"title":   mail.Title,
+		"message": mail.Message,
+	}
+	if mail.Priority != nil {
+		msg["priority"] = *mail.Priority
+	}
+	if mail.Markdown {
+		msg["extras"] = map[string]any{
+			"client::display": map[string]any{"contentType": "text/markdown"},
+		}
+	}
+	resp, err := loopback.CreateMessage(s.handler, token, remoteAddr, msg)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.Status == http.StatusUnauthorized || resp.Status == http.StatusForbidden:
+		return errUnknownToken
+	case resp.Status >= 500:
+		return errTemporary
+	case resp.Status >= 400:
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+			Message:      fmt.Sprintf("Message rejected: %s", resp.ErrorDescription()),
+		}
+	}
+	return nil
+}
+
+type session struct {
+	server        *Server
+	remoteAddr    string
+	authenticated bool
+	recipients    []string
+}
+
+func (s *session) AuthMechanisms() []string {
+	if !s.server.authRequired() {
+		return nil
+	}
+	return []string{sasl.Plain}
+}
+
+func (s *session) Auth(mech string) (sasl.Server, error) {
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		validUsername := subtle.ConstantTimeCompare([]byte(username), []byte(s.server.conf.Username)) == 1
+		validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(s.server.conf.Password)) == 1
+		if !validUsername || !validPassword {
+			return smtp.ErrAuthFailed
+		}
+		s.authenticated = true
+		return nil
+	}), nil
+}
+
+func (s *session) Mail(from string, opts *smtp.MailOptions) error {
+	if s.server.authRequired() && !s.authenticated {
+		return smtp.ErrAuthRequired
+	}
+	return nil
+}
+
+func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
+	if s.server.authRequired() && !s.authenticated {
+		return smtp.ErrAuthRequired
+	}
+	idx := strings.LastIndex(to, "@")
+	if idx <= 0 || !strings.EqualFold(to[idx+1:], s.server.conf.Domain) {
+		return errRecipientDomain
+	}
+	s.recipients = append(s.recipients, to)
+	return nil
+}
+
+func (s *session) Data(r io.Reader) error {
+	if s.server.authRequired() && !s.authenticated {
+		return smtp.ErrAuthRequired
+	}
+	mail, err := parseMail(r)
+	if err != nil {
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+			Message:      fmt.Sprintf("Cannot parse message: %s", err),
+		}
+	}
+
+	var failed []string
+	var lastErr error
+	for _, recipient := range s.recipients {
+		token := recipient[:strings.LastIndex(recipient, "@")]
+		if err := s.server.deliver(token, s.remoteAddr, mail); err != nil {
+			log.Warn().Err(err).Str("remote_addr", s.remoteAddr).Msg("Could not deliver email")
+			failed = append(failed, fmt.Sprintf("%s: %s", recipient, errorMessage(err)))
+			lastErr = err
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(failed) == len(s.recipients):
+		return lastErr
+	default:
+		// SMTP has a single reply to DATA, the failed recipients are listed in it.
+		// The error is permanent, otherwise a retry duplicates the delivered messages.
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 5, 0},
+			Message:      "Message not delivered to " + strings.Join(failed, "; "),
+		}
+	}
+}
+
+func errorMessage(err error) string {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Message
+	}
+	return err.Error()
+}
+
+func (s *session) Reset() {
+	s.recipients = nil
+}
+
+func (s *session) Logout() error {
+	return nil
+}
+
+// smtpLogWriter routes the smtp server log output through zerolog.
+type smtpLogWriter struct{}
+
+func (smtpLogWriter) Printf(format string, args ...any) {
+	log.Warn().Str("component", "smtp").Msgf(format, args...)
+}
+
+func (smtpLogWriter) Println(args ...any) {
+	log.Warn().Str("component", "smtp").Msg(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
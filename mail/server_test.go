@@ -0,0 +1,264 @@
+package mail
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	netsmtp "net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receivedMessage struct {
+	Token string
+	Body  map[string]any
+}
+
+type fakeHandler struct {
+	mutex    sync.Mutex
+	status   int
+	received []receivedMessage
+}
+
+func (h *fakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	body := map[string]any{}
+	raw, _ := io.ReadAll(r.Body)
+	json.Unmarshal(raw, &body)
+	if r.Method == http.MethodPost && r.URL.Path == "/message" {
+		h.received = append(h.received, receivedMessage{Token: r.Header.Get("X-Gotify-Key"), Body: body})
+	}
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+		w.Write([]byte(`{"error":"Bad Request","errorCode":400,"errorDescription":"oops"}`))
+	}
+}
+
+func (h *fakeHandler) messages() []receivedMessage {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.received
+}
+
+func startServer(t *testing.T, conf config.SMTPServer, handler http.Handler) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewServer(conf, handler)
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func defaultConf() config.SMTPServer {
+	return config.SMTPServer{Domain: "gotify.local", MaxMessageBytes: 1024 * 1024}
+}
+
+func TestServer_createsMessage(t *testing.T) {
+	handler := &fakeHandler{}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "ups@example.com", []string{"Aapptoken@gotify.local"},
+		[]byte("Subject: Power failure\r\n\r\nRunning on battery.\r\n"))
+	require.NoError(t, err)
+
+	messages := handler.messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Aapptoken", messages[0].Token)
+	assert.Equal(t, "Power failure", messages[0].Body["title"])
+	assert.Equal(t, "Running on battery.", messages[0].Body["message"])
+	assert.Nil(t, messages[0].Body["extras"])
+}
+
+func TestServer_multipleRecipients(t *testing.T) {
+	handler := &fakeHandler{}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"one@GOTIFY.local", "two@gotify.local"},
+		[]byte("Subject: Disk\r\nX-Gotify-Priority: 8\r\n\r\nDisk full\r\n"))
+	require.NoError(t, err)
+
+	messages := handler.messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "one", messages[0].Token)
+	assert.Equal(t, "two", messages[1].Token)
+	assert.Equal(t, float64(8), messages[1].Body["priority"])
+}
+
+func TestServer_rejectsForeignDomain(t *testing.T) {
+	handler := &fakeHandler{}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"token@example.com"},
+		[]byte("Subject: Disk\r\n\r\nDisk full\r\n"))
+	assert.ErrorContains(t, err, "550")
+	assert.Empty(t, handler.messages())
+}
+
+func TestServer_rejectsUnknownToken(t *testing.T) {
+	handler := &fakeHandler{status: http.StatusUnauthorized}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"unknown@gotify.local"},
+		[]byte("Subject: Disk\r\n\r\nDisk full\r\n"))
+	assert.ErrorContains(t, err, "Unknown application token")
+}
+
+func TestServer_rejectedMessage(t *testing.T) {
+	handler := &fakeHandler{status: http.StatusBadRequest}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"token@gotify.local"},
+		[]byte("Subject: Disk\r\n\r\nDisk full\r\n"))
+	assert.ErrorContains(t, err, "oops")
+}
+
+func TestServer_messageTooLarge(t *testing.T) {
+	handler := &fakeHandler{}
+	conf := defaultConf()
+	conf.MaxMessageBytes = 100
+	addr := startServer(t, conf, handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"token@gotify.local"},
+		[]byte("Subject: Disk\r\n\r\n"+strings.Repeat("a", 200)+"\r\n"))
+	assert.Error(t, err)
+	assert.Empty(t, handler.messages())
+}
+
+func TestServer_auth(t *testing.T) {
+	handler := &fakeHandler{}
+	conf := defaultConf()
+	conf.Username = "printer"
+	conf.Password = "secret"
+	conf.CertFile, conf.CertKey = writeCertificate(t)
+	addr := startServer(t, conf, handler)
+	mail := "Subject: Toner\r\n\r\nToner low\r\n"
+
+	client, err := netsmtp.Dial(addr)
+	require.NoError(t, err)
+	err = client.Mail("printer@example.com")
+	assert.ErrorContains(t, err, "authenticat")
+	client.Close()
+
+	client = dialTLS(t, addr)
+	err = client.Auth(netsmtp.PlainAuth("", "printer", "wrong", "127.0.0.1"))
+	assert.ErrorContains(t, err, "535")
+
+	client = dialTLS(t, addr)
+	require.NoError(t, client.Auth(netsmtp.PlainAuth("", "printer", "secret", "127.0.0.1")))
+	sendMail(t, client, "token@gotify.local", mail)
+	assert.Len(t, handler.messages(), 1)
+}
+
+func TestServer_authRequiresTLS(t *testing.T) {
+	handler := &fakeHandler{}
+	conf := defaultConf()
+	conf.Username = "printer"
+	conf.Password = "secret"
+	addr := startServer(t, conf, handler)
+	host, _, _ := net.SplitHostPort(addr)
+
+	err := netsmtp.SendMail(addr, netsmtp.PlainAuth("", "printer", "secret", host), "printer@example.com",
+		[]string{"token@gotify.local"}, []byte("Subject: Toner\r\n\r\nToner low\r\n"))
+	assert.ErrorContains(t, err, "doesn't support AUTH")
+	assert.Empty(t, handler.messages())
+}
+
+func TestServer_allowInsecureAuth(t *testing.T) {
+	handler := &fakeHandler{}
+	conf := defaultConf()
+	conf.Username = "printer"
+	conf.Password = "secret"
+	conf.AllowInsecureAuth = true
+	addr := startServer(t, conf, handler)
+	host, _, _ := net.SplitHostPort(addr)
+
+	err := netsmtp.SendMail(addr, netsmtp.PlainAuth("", "printer", "secret", host), "printer@example.com",
+		[]string{"token@gotify.local"}, []byte("Subject: Toner\r\n\r\nToner low\r\n"))
+	assert.NoError(t, err)
+	assert.Len(t, handler.messages(), 1)
+}
+
+func TestServer_partiallyDelivered(t *testing.T) {
+	handler := &tokenHandler{valid: "good"}
+	addr := startServer(t, defaultConf(), handler)
+
+	err := netsmtp.SendMail(addr, nil, "nas@example.com", []string{"good@gotify.local", "bad@gotify.local"},
+		[]byte("Subject: Disk\r\n\r\nDisk full\r\n"))
+	assert.ErrorContains(t, err, "554")
+	assert.ErrorContains(t, err, "bad@gotify.local: Unknown application token")
+	assert.NotContains(t, err.Error(), "good@")
+	assert.Equal(t, 1, handler.delivered)
+}
+
+type tokenHandler struct {
+	valid     string
+	delivered int
+}
+
+func (h *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Gotify-Key") != h.valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	h.delivered++
+}
+
+func dialTLS(t *testing.T, addr string) *netsmtp.Client {
+	client, err := netsmtp.Dial(addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	require.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true}))
+	return client
+}
+
+func sendMail(t *testing.T, client *netsmtp.Client, to, mail string) {
+	require.NoError(t, client.Mail("printer@example.com"))
+	require.NoError(t, client.Rcpt(to))
+	w, err := client.Data()
+	require.NoError(t, err)
+	_, err = io.WriteString(w, mail)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func writeCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gotify.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotify/server/v2/database"
+)
+
+func migrateDBCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gotify migrate-db", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	from := fs.String("from", "", "the source database as <dialect>:<connection>, e.g. sqlite3:data/gotify.db")
+	to := fs.String("to", "", "the target database as <dialect>:<connection>, e.g. postgres:\"host=localhost dbname=gotify\"")
+	force := fs.Bool("force", false, "delete all rows of a non-empty target database before copying")
+	batchSize := fs.Int("batch-size", 500, "the amount of rows inserted at once")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	fromDialect, fromConnection, err := parseDatabaseURL(*from)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify migrate-db: --from:", err)
+		return 2
+	}
+	toDialect, toConnection, err := parseDatabaseURL(*to)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify migrate-db: --to:", err)
+		return 2
+	}
+	if fromDialect == toDialect && fromConnection == toConnection {
+		fmt.Fprintln(stderr, "gotify migrate-db: the source and the target database must be different")
+		return 2
+	}
+
+	if fromDialect == "sqlite3" {
+		// database.New would create an empty database
+		if _, err := os.Stat(fromConnection); err != nil {
+			fmt.Fprintln(stderr, "gotify migrate-db: cannot open source database:", err)
+			return 1
+		}
+	}
+
+	source, err := database.New(fromDialect, fromConnection, database.Pool{}, "", "", 0, false, time.Now)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify migrate-db: cannot open source database:", err)
+		return 1
+	}
+	defer source.Close()
+	target, err := database.New(toDialect, toConnection, database.Pool{}, "", "", 0, false, time.Now)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify migrate-db: cannot open target database:", err)
+		return 1
+	}
+	defer target.Close()
+
+	counts, err := source.CopyTo(target, *force, *batchSize)
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify migrate-db:", err)
+		if errors.Is(err, database.ErrTargetNotEmpty) {
+			fmt.Fprintln(stderr, "Use --force to delete all rows of the target database.")
+		}
+		return 1
+	}
+	for _, count := range counts {
+		fmt.Fprintf(stdout, "%-20s %d rows\n", count.Table, count.Rows)
+	}
+	fmt.Fprintf(stdout, "Copied all tables from %s to %s\n", fromDialect, toDialect)
+	return 0
+}
+
+// parseDatabaseURL splits <dialect>:<connection>.
+func parseDatabaseURL(value string) (dialect, connection string, err error) {
+	dialect, connection, found := strings.Cut(value, ":")
+	if !found || connection == "" {
+		return "", "", errors.New("expected <dialect>:<connection>")
+	}
+	switch dialect {
+	case "sqlite3", "mysql", "postgres":
+		return dialect, connection, nil
+	default:
+		return "", "", fmt.Errorf("unsupported dialect %q, expected sqlite3, mysql or postgres", dialect)
+	}
+}
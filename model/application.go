@@ -48,6 +48,12 @@ type Application struct {
 	// required: false
 	// example: 4
 	DefaultPriority int `form:"defaultPriority" query:"defaultPriority" json:"defaultPriority"`
+	// The default number of seconds after which messages of this application expire.
+	// 0 means the messages do not expire.
+	//
+	// required: false
+	// example: 3600
+	DefaultTTLSeconds int `form:"defaultTTLSeconds" query:"defaultTTLSeconds" json:"defaultTTLSeconds"`
 	// The date the application was created.
 	//
 	// read only: true
@@ -64,4 +70,17 @@ type Application struct {
 	// required: true
 	// example: a1
 	SortKey string `gorm:"type:bytes;uniqueIndex:uix_application_user_id_sort_key,priority:2,length:255" form:"sortKey" query:"sortKey" json:"sortKey"`
+	// The id of the group owning the application. Messages are delivered to all members of the group.
+	// Not set for applications without group.
+	//
+	// read only: true
+	// example: 3
+	GroupID uint `gorm:"index" json:"groupId,omitempty"`
+	// The permission of the current user if the application was shared by another user.
+	// Not set for own applications.
+	//
+	// read only: true
+	// enum: read,manage
+	// example: read
+	SharedPermission string `gorm:"-" json:"sharedPermission,omitempty"`
 }
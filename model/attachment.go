@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Attachment Model
+//
+// The Attachment holds information about a file uploaded together with a message.
+// Attachments are referenced in the extras of the message under the key client::attachments.
+//
+// swagger:model Attachment
+type Attachment struct {
+	// The attachment id.
+	//
+	// read only: true
+	// required: true
+	// example: 7
+	ID uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	// The id of the message the attachment belongs to.
+	//
+	// read only: true
+	// required: true
+	// example: 25
+	MessageID uint `gorm:"index" json:"messageId"`
+	// The id of the user whose storage the attachment uses.
+	UserID uint `gorm:"index" json:"-"`
+	// The name of the uploaded file.
+	//
+	// read only: true
+	// required: true
+	// example: screenshot.png
+	Name string `json:"name"`
+	// The name of the stored file.
+	//
+	// read only: true
+	// required: true
+	// example: P1yPwpWwNcTFHcZAhPykBsWxD.png
+	File string `gorm:"type:varchar(180);uniqueIndex:uix_attachments_file" json:"file"`
+	// The detected content type of the file.
+	//
+	// read only: true
+	// required: true
+	// example: image/png
+	ContentType string `json:"contentType"`
+	// The size of the file in bytes.
+	//
+	// read only: true
+	// required: true
+	// example: 24653
+	Size int64 `json:"size"`
+	// The date the attachment was uploaded.
+	//
+	// read only: true
+	// required: true
+	// example: 2019-01-01T00:00:00Z
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// EscalationPolicy Model
+//
+// The EscalationPolicy defines how messages of an application are repeated until they are acknowledged.
+//
+// swagger:model EscalationPolicy
+type EscalationPolicy struct {
+	// The application id this policy belongs to.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ApplicationID uint `gorm:"primaryKey;autoIncrement:false" json:"appid"`
+	// Messages with at least this priority are repeated until they are acknowledged.
+	//
+	// required: true
+	// example: 10
+	MinPriority int `json:"minPriority"`
+	// The number of minutes between repeated deliveries.
+	//
+	// required: true
+	// example: 5
+	IntervalMinutes int `json:"intervalMinutes"`
+	// The number of repeated deliveries after which the message is escalated. 0 disables escalation.
+	//
+	// required: true
+	// example: 3
+	EscalateAfter int `json:"escalateAfter"`
+	// The id of the user the message is escalated to. 0 means no user.
+	//
+	// example: 2
+	EscalateToUserID uint `json:"escalateToUserId"`
+	// The email address the message is escalated to.
+	//
+	// example: oncall@example.com
+	EscalateToEmail string `json:"escalateToEmail"`
+}
+
+// Escalation holds the state of a message which is repeated until it is acknowledged.
+type Escalation struct {
+	MessageID     uint `gorm:"primaryKey;autoIncrement:false"`
+	ApplicationID uint `gorm:"index"`
+	Attempts      int
+	Escalated     bool
+	NextAt        time.Time `gorm:"index"`
+}
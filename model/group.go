@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Group Model
+//
+// The Group is a team of users. Messages of applications owned by the group are delivered to all members.
+//
+// swagger:model Group
+type Group struct {
+	// The group id.
+	//
+	// read only: true
+	// required: true
+	// example: 3
+	ID uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	// The name of the group.
+	//
+	// required: true
+	// example: ops
+	Name string `gorm:"type:varchar(180);uniqueIndex:uix_groups_name" json:"name"`
+	// The ids of the members.
+	//
+	// required: true
+	// example: [1, 2]
+	Members []uint `gorm:"-" json:"members"`
+	// The date the group was created.
+	//
+	// read only: true
+	// required: true
+	// example: 2019-01-01T00:00:00Z
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GroupMember holds the membership of a user in a group.
+type GroupMember struct {
+	GroupID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID  uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
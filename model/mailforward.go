@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// MailForwardRule Model
+//
+// The MailForwardRule holds information about when messages of a user should be forwarded via email.
+//
+// swagger:model MailForwardRule
+type MailForwardRule struct {
+	// The rule id.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ID     uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID uint `gorm:"index" json:"-"`
+	// The email address the messages are forwarded to.
+	//
+	// required: true
+	// example: ops@example.com
+	Recipient string `gorm:"type:text" json:"recipient"`
+	// The minimum priority a message must have to be forwarded.
+	//
+	// required: true
+	// example: 8
+	MinPriority int `json:"minPriority"`
+	// Only forward messages of this application. 0 forwards messages of all applications.
+	//
+	// required: true
+	// example: 0
+	ApplicationID uint `json:"appid"`
+	// Only forward messages while no client of the user is connected to the stream.
+	//
+	// required: true
+	// example: true
+	OnlyWhenOffline bool `json:"onlyWhenOffline"`
+	// The date the rule was created.
+	//
+	// read only: true
+	// required: true
+	// example: 2019-01-01T00:00:00Z
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Matches returns whether a message with the given application and priority
+// should be forwarded by this rule.
+func (r *MailForwardRule) Matches(appID uint, priority int, offline bool) bool {
+	if r.ApplicationID != 0 && r.ApplicationID != appID {
+		return false
+	}
+	if r.OnlyWhenOffline && !offline {
+		return false
+	}
+	return priority >= r.MinPriority
+}
@@ -6,13 +6,14 @@ import (
 
 // Message holds information about a message.
 type Message struct {
-	ID            uint `gorm:"autoIncrement;primaryKey;index"`
-	ApplicationID uint
+	ID            uint   `gorm:"autoIncrement;primaryKey;index"`
+	ApplicationID uint   `gorm:"index"`
 	Message       string `gorm:"type:text"`
 	Title         string `gorm:"type:text"`
 	Priority      int
 	Extras        []byte
 	Date          time.Time
+	ExpiresAt     *time.Time `gorm:"index"`
 }
 
 // MessageExternal Model
@@ -63,6 +64,16 @@ type MessageExternal struct {
 	// required: true
 	// example: 2018-02-27T19:36:10.5045044+01:00
 	Date time.Time `json:"date"`
+	// The date the message expires and is deleted. Not set if the message does not expire.
+	//
+	// read only: true
+	// example: 2018-02-27T20:36:10.5045044+01:00
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Whether the current user marked the message as read.
+	//
+	// read only: true
+	// example: true
+	Read bool `json:"read,omitempty"`
 }
 
 // CreateMessage Model
@@ -99,4 +110,41 @@ type CreateMessage struct {
 	//
 	// example: {"home::appliances::thermostat::change_temperature":{"temperature":23},"home::appliances::lighting::on":{"brightness":15}}
 	Extras map[string]any `form:"-" query:"-" json:"extras,omitempty"`
+	// The time the message should be delivered. If in the future, the message is stored
+	// and delivered to the clients when due, otherwise it is delivered immediately.
+	//
+	// example: 2024-01-05T09:00:00Z
+	DeliverAt *time.Time `form:"deliverAt" query:"deliverAt" json:"deliverAt,omitempty"`
+	// The time the message expires and is deleted. Cannot be combined with ttlSeconds.
+	//
+	// example: 2024-01-05T10:00:00Z
+	ExpiresAt *time.Time `form:"expiresAt" query:"expiresAt" json:"expiresAt,omitempty"`
+	// The number of seconds after delivery the message expires and is deleted.
+	// If neither expiresAt nor ttlSeconds is set, then the default ttl of the
+	// application will be used.
+	//
+	// example: 3600
+	TTLSeconds *int `form:"ttlSeconds" query:"ttlSeconds" json:"ttlSeconds,omitempty" binding:"omitempty,min=1"`
+}
+
+// MessageState holds the state of a message for a single user.
+type MessageState struct {
+	MessageID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Read      bool `gorm:"column:is_read"`
+	Deleted   bool `gorm:"column:is_deleted"`
+}
+
+// MessageFilter restricts the messages returned when querying the messages of a user.
+// Unset fields don't restrict the result.
+type MessageFilter struct {
+	MinPriority    *int
+	MaxPriority    *int
+	After          *time.Time
+	Before         *time.Time
+	ApplicationIDs []uint
+	// ExtrasKeys requires all keys to be present in the extras of the message.
+	ExtrasKeys []string
+	// Ascending orders the messages by ascending ids, since then returns messages with a greater id.
+	Ascending bool
 }
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// SchemaMigration records a versioned migration which was applied to the database.
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
@@ -0,0 +1,118 @@
+package model
+
+// UserQuota Model
+//
+// The UserQuota holds the limits of a user which differ from the defaults of the server configuration.
+// A limit of null uses the default, a limit of 0 disables the limit.
+//
+// swagger:model UserQuota
+type UserQuota struct {
+	// The user id.
+	//
+	// read only: true
+	// required: true
+	// example: 25
+	UserID uint `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	// The maximum amount of applications.
+	//
+	// example: 20
+	MaxApplications *int64 `json:"maxApplications"`
+	// The maximum amount of clients.
+	//
+	// example: 10
+	MaxClients *int64 `json:"maxClients"`
+	// The maximum amount of stored messages.
+	//
+	// example: 10000
+	MaxMessages *int64 `json:"maxMessages"`
+	// The maximum size of the application images and attachments in bytes.
+	//
+	// example: 104857600
+	MaxStorageBytes *int64 `json:"maxStorageBytes"`
+	// The maximum size of the plugin storage in bytes.
+	//
+	// example: 1048576
+	MaxPluginStorageBytes *int64 `json:"maxPluginStorageBytes"`
+}
+
+// QuotaLimits Model
+//
+// The limits of a user, 0 means unlimited.
+//
+// swagger:model QuotaLimits
+type QuotaLimits struct {
+	// The maximum amount of applications.
+	//
+	// required: true
+	// example: 20
+	Applications int64 `json:"applications"`
+	// The maximum amount of clients.
+	//
+	// required: true
+	// example: 10
+	Clients int64 `json:"clients"`
+	// The maximum amount of stored messages.
+	//
+	// required: true
+	// example: 10000
+	Messages int64 `json:"messages"`
+	// The maximum size of the application images and attachments in bytes.
+	//
+	// required: true
+	// example: 104857600
+	StorageBytes int64 `json:"storageBytes"`
+	// The maximum size of the plugin storage in bytes.
+	//
+	// required: true
+	// example: 1048576
+	PluginStorageBytes int64 `json:"pluginStorageBytes"`
+}
+
+// QuotaUsage Model
+//
+// The resources used by a user.
+//
+// swagger:model QuotaUsage
+type QuotaUsage struct {
+	// The amount of applications.
+	//
+	// required: true
+	// example: 3
+	Applications int64 `json:"applications"`
+	// The amount of clients.
+	//
+	// required: true
+	// example: 2
+	Clients int64 `json:"clients"`
+	// The amount of stored messages.
+	//
+	// required: true
+	// example: 1337
+	Messages int64 `json:"messages"`
+	// The size of the application images and attachments in bytes.
+	//
+	// required: true
+	// example: 52428
+	StorageBytes int64 `json:"storageBytes"`
+	// The size of the plugin storage in bytes.
+	//
+	// required: true
+	// example: 512
+	PluginStorageBytes int64 `json:"pluginStorageBytes"`
+}
+
+// Quota Model
+//
+// The limits and the usage of a user.
+//
+// swagger:model Quota
+type Quota struct {
+	// The limits.
+	//
+	// required: true
+	Limits QuotaLimits `json:"limits"`
+	// The usage.
+	//
+	// required: true
+	Usage QuotaUsage `json:"usage"`
+}
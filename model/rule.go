@@ -0,0 +1,109 @@
+package model
+
+import "time"
+
+// The actions a rule can perform.
+const (
+	RuleActionSetPriority = "setPriority"
+	RuleActionCopy        = "copy"
+	RuleActionDrop        = "drop"
+	RuleActionTag         = "tag"
+	RuleActionWebhook     = "webhook"
+)
+
+// RuleTagsExtrasKey is the extras key the tags added by rules are stored in.
+const RuleTagsExtrasKey = "server::tags"
+
+// Rule Model
+//
+// The Rule performs an action on incoming messages of a user which match all its conditions.
+// Rules are evaluated in the order of their ids.
+//
+// swagger:model Rule
+type Rule struct {
+	// The rule id.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ID     uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID uint `gorm:"index" json:"-"`
+	// The name of the rule.
+	//
+	// required: true
+	// example: Copy disk alerts to ops
+	Name string `gorm:"type:text" json:"name"`
+	// Only match messages of this application. 0 matches messages of all applications.
+	//
+	// required: true
+	// example: 0
+	ApplicationID uint `json:"appid"`
+	// Only match messages with a title matching this regular expression.
+	//
+	// required: true
+	// example: (?i)disk
+	TitlePattern string `gorm:"type:text" json:"titlePattern"`
+	// Only match messages with a message matching this regular expression.
+	//
+	// required: true
+	// example: full$
+	MessagePattern string `gorm:"type:text" json:"messagePattern"`
+	// Only match messages with at least this priority.
+	//
+	// example: 5
+	MinPriority *int `json:"minPriority"`
+	// Only match messages with at most this priority.
+	//
+	// example: 10
+	MaxPriority *int `json:"maxPriority"`
+	// Only match messages which have this extras key.
+	//
+	// required: true
+	// example: client::notification
+	ExtrasKey string `gorm:"type:text" json:"extrasKey"`
+	// Only match messages received after this time of day (HH:MM, server time zone).
+	// If activeFrom is after activeUntil, the time range spans midnight.
+	//
+	// required: true
+	// example: 22:00
+	ActiveFrom string `json:"activeFrom"`
+	// Only match messages received before this time of day (HH:MM, server time zone).
+	//
+	// required: true
+	// example: 07:00
+	ActiveUntil string `json:"activeUntil"`
+	// The action performed on matching messages.
+	//
+	// required: true
+	// enum: setPriority,copy,drop,tag,webhook
+	// example: copy
+	Action string `json:"action"`
+	// The new priority for the setPriority action.
+	//
+	// required: true
+	// example: 2
+	Priority int `json:"priority"`
+	// The application the message is copied to for the copy action.
+	// Applications shared with the manage permission can be used as well.
+	//
+	// required: true
+	// example: 7
+	TargetApplicationID uint `json:"targetAppid"`
+	// The tag added to the extras key server::tags for the tag action.
+	//
+	// required: true
+	// example: infra
+	Tag string `gorm:"type:text" json:"tag"`
+	// The url the message is posted to for the webhook action.
+	// Loopback, private and link-local addresses are rejected unless allowed by the server configuration.
+	//
+	// required: true
+	// example: https://example.com/hook
+	WebhookURL string `gorm:"type:text" json:"webhookUrl"`
+	// The date the rule was created.
+	//
+	// read only: true
+	// required: true
+	// example: 2019-01-01T00:00:00Z
+	CreatedAt time.Time `json:"createdAt"`
+}
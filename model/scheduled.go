@@ -0,0 +1,76 @@
+package model
+
+import "time"
+
+// ScheduledMessage holds a message which is delivered at a later time.
+type ScheduledMessage struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement"`
+	ApplicationID uint   `gorm:"index"`
+	Message       string `gorm:"type:text"`
+	Title         string `gorm:"type:text"`
+	Priority      int
+	Extras        []byte
+	DeliverAt     time.Time `gorm:"index"`
+	ExpiresAt     *time.Time
+	TTLSeconds    int
+	CreatedAt     time.Time
+}
+
+// ScheduledMessageExternal Model
+//
+// The ScheduledMessage holds information about a message which is not yet delivered.
+//
+// swagger:model ScheduledMessage
+type ScheduledMessageExternal struct {
+	// The scheduled message id.
+	//
+	// read only: true
+	// required: true
+	// example: 25
+	ID uint `json:"id"`
+	// The application id that send this message.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ApplicationID uint `json:"appid"`
+	// The message. Markdown (excluding html) is allowed.
+	//
+	// required: true
+	// example: Renew the certificate.
+	Message string `json:"message"`
+	// The title of the message.
+	//
+	// required: true
+	// example: Reminder
+	Title string `json:"title"`
+	// The priority of the message.
+	//
+	// required: true
+	// example: 2
+	Priority int `json:"priority"`
+	// The extra data sent along the message.
+	//
+	// example: {"home::appliances::thermostat::change_temperature":{"temperature":23}}
+	Extras map[string]any `json:"extras,omitempty"`
+	// The time the message will be delivered.
+	//
+	// read only: true
+	// required: true
+	// example: 2024-01-05T09:00:00Z
+	DeliverAt time.Time `json:"deliverAt"`
+	// The time the message expires after it was delivered.
+	//
+	// example: 2024-01-05T10:00:00Z
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// The number of seconds after delivery the message expires.
+	//
+	// example: 3600
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+	// The date the message was scheduled.
+	//
+	// read only: true
+	// required: true
+	// example: 2018-02-27T19:36:10.5045044+01:00
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// The permissions an application can be shared with.
+const (
+	SharePermissionRead   = "read"
+	SharePermissionManage = "manage"
+)
+
+// ApplicationShare Model
+//
+// The ApplicationShare grants another user access to an application.
+// Members can read the messages of the application and receive them via the stream.
+// Members with the manage permission can additionally send and delete messages and edit the application.
+//
+// swagger:model ApplicationShare
+type ApplicationShare struct {
+	// The id of the shared application.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ApplicationID uint `gorm:"primaryKey;autoIncrement:false" json:"appid"`
+	// The id of the user the application is shared with.
+	//
+	// read only: true
+	// required: true
+	// example: 2
+	UserID uint `gorm:"primaryKey;autoIncrement:false;index" json:"userId"`
+	// The permission of the user.
+	//
+	// required: true
+	// enum: read,manage
+	// example: read
+	Permission string `json:"permission"`
+	// The date the application was shared.
+	//
+	// read only: true
+	// required: true
+	// example: 2019-01-01T00:00:00Z
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package model
+
+const (
+	// StreamEventMessagesDeleted is the event type sent when messages were deleted.
+	StreamEventMessagesDeleted = "messagesDeleted"
+	// StreamEventMessageAcknowledged is the event type sent when a message was acknowledged.
+	StreamEventMessageAcknowledged = "messageAcknowledged"
+)
+
+// StreamEvent Model
+//
+// The StreamEvent is sent over the stream to clients which subscribed to events.
+//
+// swagger:model StreamEvent
+type StreamEvent struct {
+	// The event type.
+	//
+	// required: true
+	// example: messagesDeleted
+	Event string `json:"event"`
+	// The ids of the affected messages.
+	//
+	// example: [25, 26]
+	IDs []uint `json:"ids,omitempty"`
+}
@@ -0,0 +1,33 @@
+package model
+
+// WebhookTemplate Model
+//
+// The WebhookTemplate maps the JSON body of requests to /webhook/{token} to a message.
+// Every field is a Go template executed with the decoded JSON body as data.
+//
+// swagger:model WebhookTemplate
+type WebhookTemplate struct {
+	// The application id this template belongs to.
+	//
+	// read only: true
+	// required: true
+	// example: 5
+	ApplicationID uint `gorm:"primaryKey;autoIncrement:false" json:"appid"`
+	// The template for the message title. If empty or rendered empty, the application name is used.
+	//
+	// example: {{.repository.full_name}}
+	Title string `gorm:"type:text" form:"title" query:"title" json:"title"`
+	// The template for the message.
+	//
+	// required: true
+	// example: {{.pusher.name}} pushed {{len .commits}} commits
+	Message string `gorm:"type:text" form:"message" query:"message" json:"message" binding:"required"`
+	// The template for the priority. Must render to a number. If empty or rendered empty, the default priority of the application is used.
+	//
+	// example: {{if eq .action "failed"}}8{{else}}2{{end}}
+	Priority string `gorm:"type:text" form:"priority" query:"priority" json:"priority"`
+	// The template for the extras. Must render to a JSON object. If empty or rendered empty, no extras are set.
+	//
+	// example: {"client::notification":{"click":{"url":{{json .compare}}}}}
+	Extras string `gorm:"type:text" form:"extras" query:"extras" json:"extras"`
+}
@@ -0,0 +1,128 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/loopback"
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	userIDPlaceholder = "{userid}"
+	publishTimeout    = 30 * time.Second
+	disconnectQuiesce = 250
+)
+
+// Bridge connects gotify to a MQTT broker. Every stored message is published
+// to a per user topic and payloads received on the subscribed topics are turned
+// into messages of the mapped application.
+//
+// The messages are created by sending a request to the POST /message endpoint
+// of the given handler, therefore the same authentication and processing as for
+// messages created over HTTP applies.
+type Bridge struct {
+	conf    config.MQTT
+	handler http.Handler
+	client  paho.Client
+}
+
+// NewBridge creates a MQTT bridge, it does not connect to the broker until
+// Connect is called.
+func NewBridge(conf config.MQTT, handler http.Handler) *Bridge {
+	b := &Bridge{conf: conf, handler: handler}
+	opts := paho.NewClientOptions().
+		AddBroker(conf.Broker).
+		SetClientID(conf.ClientID).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Str("broker", conf.Broker).Msg("Lost connection to MQTT broker")
+		})
+	b.client = paho.NewClient(opts)
+	return b
+}
+
+// Connect connects to the broker in the background. Failed connection attempts
+// are retried until Close is called.
+func (b *Bridge) Connect() {
+	b.client.Connect()
+}
+
+// Close disconnects from the broker.
+func (b *Bridge) Close() {
+	b.client.Disconnect(disconnectQuiesce)
+}
+
+// Notify publishes the message to the topic of the user, it never blocks.
+func (b *Bridge) Notify(userID uint, message *model.MessageExternal) {
+	if b.conf.PublishTopic == "" {
+		return
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not encode message for MQTT")
+		return
+	}
+	topic := strings.ReplaceAll(b.conf.PublishTopic, userIDPlaceholder, strconv.FormatUint(uint64(userID), 10))
+	token := b.client.Publish(topic, byte(b.conf.QoS), false, payload)
+	go func() {
+		if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+			log.Warn().Err(token.Error()).Str("topic", topic).Uint("message_id", message.ID).Msg("Could not publish message to MQTT")
+		}
+	}()
+}
+
+func (b *Bridge) onConnect(client paho.Client) {
+	log.Info().Str("broker", b.conf.Broker).Msg("Connected to MQTT broker")
+	for topic, appToken := range b.conf.Subscriptions {
+		token := client.Subscribe(topic, byte(b.conf.QoS), b.receive(appToken))
+		go func(topic string) {
+			if token.Wait() && token.Error() != nil {
+				log.Error().Err(token.Error()).Str("topic", topic).Msg("Could not subscribe to MQTT topic")
+			}
+		}(topic)
+	}
+}
+
+func (b *Bridge) receive(appToken string) paho.MessageHandler {
+	return func(_ paho.Client, m paho.Message) {
+		msg, err := parsePayload(m.Payload())
+		if err != nil {
+			log.Warn().Err(err).Str("topic", m.Topic()).Msg("Ignoring MQTT message")
+			return
+		}
+		resp, err := loopback.CreateMessage(b.handler, appToken, "", msg)
+		if err != nil {
+			log.Error().Err(err).Str("topic", m.Topic()).Msg("Could not create message from MQTT")
+			return
+		}
+		if resp.Status >= 400 {
+			log.Warn().Int("status", resp.Status).Str("topic", m.Topic()).Str("error", resp.ErrorDescription()).Msg("Could not create message from MQTT")
+		}
+	}
+}
+
+// parsePayload accepts either a JSON object like the body of POST /message or
+// plain text which is used as the message.
+func parsePayload(payload []byte) (any, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+	if payload[0] == '{' && json.Valid(payload) {
+		return json.RawMessage(payload), nil
+	}
+	return map[string]any{"message": string(payload)}, nil
+}
@@ -0,0 +1,150 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/model"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Token string
+	Body  map[string]any
+}
+
+type fakeHandler struct {
+	mutex    sync.Mutex
+	requests []request
+	status   int
+}
+
+func (h *fakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := request{Token: r.Header.Get("X-Gotify-Key")}
+	json.Unmarshal(body, &req.Body)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requests = append(h.requests, req)
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+}
+
+func (h *fakeHandler) received() []request {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]request{}, h.requests...)
+}
+
+func startBroker(t *testing.T) (*mochi.Server, string) {
+	server := mochi.New(&mochi.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, server.AddHook(new(auth.AllowHook), nil))
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	require.NoError(t, server.AddListener(tcp))
+	require.NoError(t, server.Serve())
+	t.Cleanup(func() { server.Close() })
+	return server, "tcp://" + tcp.Address()
+}
+
+func startBridge(t *testing.T, conf config.MQTT, handler http.Handler) *Bridge {
+	conf.ClientID = "gotify-test"
+	bridge := NewBridge(conf, handler)
+	bridge.Connect()
+	t.Cleanup(bridge.Close)
+	require.Eventually(t, bridge.client.IsConnectionOpen, 5*time.Second, 10*time.Millisecond)
+	return bridge
+}
+
+func waitForSubscriber(t *testing.T, broker *mochi.Server, topic string) {
+	require.Eventually(t, func() bool {
+		return len(broker.Topics.Subscribers(topic).Subscriptions) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBridge_publishesMessages(t *testing.T) {
+	broker, address := startBroker(t)
+	received := make(chan packets.Packet, 1)
+	require.NoError(t, broker.Subscribe("gotify/user/+/message", 1, func(cl *mochi.Client, sub packets.Subscription, pk packets.Packet) {
+		received <- pk
+	}))
+
+	bridge := startBridge(t, config.MQTT{Broker: address, PublishTopic: "gotify/user/{userid}/message"}, &fakeHandler{})
+	priority := 5
+	bridge.Notify(3, &model.MessageExternal{ID: 7, ApplicationID: 2, Title: "Door", Message: "open", Priority: &priority})
+
+	select {
+	case pk := <-received:
+		assert.Equal(t, "gotify/user/3/message", pk.TopicName)
+		var msg model.MessageExternal
+		require.NoError(t, json.Unmarshal(pk.Payload, &msg))
+		assert.Equal(t, uint(7), msg.ID)
+		assert.Equal(t, "Door", msg.Title)
+		assert.Equal(t, "open", msg.Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not published")
+	}
+}
+
+func TestBridge_createsMessagesFromSubscriptions(t *testing.T) {
+	broker, address := startBroker(t)
+	handler := &fakeHandler{}
+	startBridge(t, config.MQTT{Broker: address, Subscriptions: map[string]string{
+		"home/alarm/#": "Aalarm",
+		"home/door":    "Adoor",
+	}}, handler)
+
+	waitForSubscriber(t, broker, "home/alarm/kitchen")
+
+	require.NoError(t, broker.Publish("home/alarm/kitchen", []byte(`{"title":"Smoke","message":"kitchen","priority":10}`), false, 0))
+	require.Eventually(t, func() bool { return len(handler.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	req := handler.received()[0]
+	assert.Equal(t, "Aalarm", req.Token)
+	assert.Equal(t, map[string]any{"title": "Smoke", "message": "kitchen", "priority": float64(10)}, req.Body)
+}
+
+func TestBridge_ignoresEmptyPayload(t *testing.T) {
+	broker, address := startBroker(t)
+	handler := &fakeHandler{status: 400}
+	startBridge(t, config.MQTT{Broker: address, Subscriptions: map[string]string{"home/door": "Adoor"}}, handler)
+
+	waitForSubscriber(t, broker, "home/door")
+
+	broker.Publish("home/door", []byte("  "), false, 0)
+	broker.Publish("home/door", []byte("opened"), false, 0)
+	require.Eventually(t, func() bool { return len(handler.received()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if assert.Len(t, handler.received(), 1) {
+		assert.Equal(t, map[string]any{"message": "opened"}, handler.received()[0].Body)
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	_, err := parsePayload([]byte(" \n"))
+	assert.Error(t, err)
+
+	msg, err := parsePayload([]byte("door opened\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"message": "door opened"}, msg)
+
+	msg, err = parsePayload([]byte(`{"message":"hi","priority":3}`))
+	require.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`{"message":"hi","priority":3}`), msg)
+
+	msg, err = parsePayload([]byte(`{not json`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"message": "{not json"}, msg)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/gotify/server/v2/auth"
 	"github.com/gotify/server/v2/model"
 	"github.com/gotify/server/v2/plugin/compat"
+	"github.com/gotify/server/v2/rules"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
@@ -43,6 +44,18 @@ type Notifier interface {
 	Notify(userID uint, message *model.MessageExternal)
 }
 
+// RuleEngine evaluates the rules of users against new messages.
+type RuleEngine interface {
+	Evaluate(userID uint, msg *model.Message) (*rules.Result, error)
+	Dispatch(result *rules.Result, msg *model.Message)
+}
+
+// Quota limits the plugin storage and the messages of users.
+type Quota interface {
+	CheckPluginStorage(userID, pluginID uint, size int64) error
+	CheckMessages(userID uint, n int64) error
+}
+
 // Manager is an encapsulating layer for plugins and manages all plugins and its instances.
 type Manager struct {
 	mutex     *sync.RWMutex
@@ -51,10 +64,13 @@ type Manager struct {
 	messages  chan MessageWithUserID
 	db        Database
 	mux       *gin.RouterGroup
+	quota     Quota
 }
 
 // NewManager created a Manager from configurations.
-func NewManager(db Database, directory string, mux *gin.RouterGroup, notifier Notifier) (*Manager, error) {
+// The rules of the users are evaluated against plugin messages if ruleEngine isn't nil.
+// The plugin storage and the messages of the users are limited if quota isn't nil.
+func NewManager(db Database, directory string, mux *gin.RouterGroup, notifier Notifier, ruleEngine RuleEngine, quota Quota) (*Manager, error) {
 	manager := &Manager{
 		mutex:     &sync.RWMutex{},
 		instances: map[uint]compat.PluginInstance{},
@@ -62,6 +78,7 @@ func NewManager(db Database, directory string, mux *gin.RouterGroup, notifier No
 		messages:  make(chan MessageWithUserID),
 		db:        db,
 		mux:       mux,
+		quota:     quota,
 	}
 
 	go func() {
@@ -77,9 +94,31 @@ func NewManager(db Database, directory string, mux *gin.RouterGroup, notifier No
 			if message.Message.Extras != nil {
 				internalMsg.Extras, _ = json.Marshal(message.Message.Extras)
 			}
+			var result *rules.Result
+			if ruleEngine != nil {
+				var err error
+				if result, err = ruleEngine.Evaluate(message.UserID, internalMsg); err != nil {
+					log.Error().Err(err).Uint("user_id", message.UserID).Msg("Could not evaluate rules for plugin message")
+				} else if result.Drop {
+					continue
+				}
+				message.Message.Priority = &internalMsg.Priority
+				if len(internalMsg.Extras) != 0 {
+					json.Unmarshal(internalMsg.Extras, &message.Message.Extras)
+				}
+			}
+			if quota != nil {
+				if err := quota.CheckMessages(message.UserID, 1); err != nil {
+					log.Warn().Err(err).Uint("user_id", message.UserID).Msg("Could not create plugin message")
+					continue
+				}
+			}
 			db.CreateMessage(internalMsg)
 			message.Message.ID = internalMsg.ID
 			notifier.Notify(message.UserID, &message.Message)
+			if result != nil {
+				ruleEngine.Dispatch(result, internalMsg)
+			}
 		}
 	}()
 
@@ -270,6 +309,42 @@ func (m *Manager) InitializeForUserID(userID uint) error {
 	return fmt.Errorf("user with id %d not found", userID)
 }
 
+// InitializeUser creates the plugin configurations and internal applications of a user without starting the plugins.
+// It's used by commands running outside of the server, the server creates the plugin instances on start.
+func InitializeUser(db Database, directory string, userID uint) error {
+	m := &Manager{
+		mutex:     &sync.RWMutex{},
+		instances: map[uint]compat.PluginInstance{},
+		plugins:   map[string]compat.Plugin{},
+		db:        db,
+	}
+	if err := m.loadPlugins(directory); err != nil {
+		return err
+	}
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user with id %d not found", userID)
+	}
+	userCtx := compat.UserContext{ID: user.ID, Name: user.Name, Admin: user.Admin}
+	for _, p := range m.plugins {
+		info := p.PluginInfo()
+		pluginConf, err := db.GetPluginConfByUserAndPath(userID, info.ModulePath)
+		if err != nil {
+			return err
+		}
+		if pluginConf != nil {
+			continue
+		}
+		if _, err := m.createPluginConf(p.NewPluginInstance(userCtx), info, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Manager) initializeForUser(user model.User) error {
 	userCtx := compat.UserContext{
 		ID:    user.ID,
@@ -346,7 +421,7 @@ func (m *Manager) initializeSingleUserPlugin(userCtx compat.UserContext, p compa
 		})
 	}
 	if compat.HasSupport(instance, compat.Storager) {
-		instance.SetStorageHandler(dbStorageHandler{pluginConf.ID, m.db})
+		instance.SetStorageHandler(dbStorageHandler{pluginConf.ID, pluginConf.UserID, m.db, m.quota})
 	}
 	if compat.HasSupport(instance, compat.Configurer) {
 		m.initializeConfigurerForSingleUserPlugin(instance, pluginConf)
@@ -17,6 +17,7 @@ import (
 	"github.com/gotify/server/v2/model"
 	"github.com/gotify/server/v2/plugin/compat"
 	"github.com/gotify/server/v2/plugin/testing/mock"
+	"github.com/gotify/server/v2/rules"
 	"github.com/gotify/server/v2/test"
 	"github.com/gotify/server/v2/test/testdb"
 	"github.com/stretchr/testify/assert"
@@ -64,7 +65,7 @@ func (s *ManagerSuite) SetupSuite() {
 	s.makeDanglingPluginConf(1)
 
 	e := gin.New()
-	manager, err := NewManager(s.db.GormDatabase, s.tmpDir.Path(), e.Group("/plugin/:id/custom/"), s)
+	manager, err := NewManager(s.db.GormDatabase, s.tmpDir.Path(), e.Group("/plugin/:id/custom/"), s, nil, nil)
 	s.e = e
 	assert.Nil(s.T(), err)
 
@@ -356,15 +357,25 @@ func TestManagerSuite(t *testing.T) {
 }
 
 func TestNewManager_CannotLoadDirectory_expectError(t *testing.T) {
-	_, err := NewManager(nil, "<>", nil, nil)
+	_, err := NewManager(nil, "<>", nil, nil, nil, nil)
 	assert.Error(t, err)
 }
 
 func TestNewManager_NonPluginFile_expectError(t *testing.T) {
-	_, err := NewManager(nil, path.Join(test.GetProjectDir(), "test/assets/"), nil, nil)
+	_, err := NewManager(nil, path.Join(test.GetProjectDir(), "test/assets/"), nil, nil, nil, nil)
 	assert.Error(t, err)
 }
 
+func TestInitializeUser_CannotLoadDirectory_expectError(t *testing.T) {
+	assert.Error(t, InitializeUser(nil, "<>", 1))
+}
+
+func TestInitializeUser_unknownUser_expectError(t *testing.T) {
+	db := testdb.NewDB(t)
+	defer db.Close()
+	assert.EqualError(t, InitializeUser(db, "", 3), "user with id 3 not found")
+}
+
 func TestNewManager_InternalApplicationManagement(t *testing.T) {
 	db := testdb.NewDBWithDefaultUser(t)
 
@@ -380,7 +391,7 @@ func TestNewManager_InternalApplicationManagement(t *testing.T) {
 		if app, err := db.GetApplicationByToken("Ainternal_obsolete"); assert.NoError(t, err) {
 			assert.True(t, app.Internal)
 		}
-		_, err := NewManager(db, "", nil, nil)
+		_, err := NewManager(db, "", nil, nil, nil, nil)
 		assert.Nil(t, err)
 		if app, err := db.GetApplicationByToken("Ainternal_obsolete"); assert.NoError(t, err) {
 			assert.False(t, app.Internal)
@@ -406,7 +417,7 @@ func TestNewManager_InternalApplicationManagement(t *testing.T) {
 		if app, err := db.GetApplicationByToken("Ainternal_not_loaded"); assert.NoError(t, err) {
 			assert.True(t, app.Internal)
 		}
-		_, err := NewManager(db, "", nil, nil)
+		_, err := NewManager(db, "", nil, nil, nil, nil)
 		assert.Nil(t, err)
 		if app, err := db.GetApplicationByToken("Ainternal_not_loaded"); assert.NoError(t, err) {
 			assert.False(t, app.Internal)
@@ -433,7 +444,7 @@ func TestNewManager_InternalApplicationManagement(t *testing.T) {
 		if app, err := db.GetApplicationByToken("Ainternal_loaded"); assert.NoError(t, err) {
 			assert.False(t, app.Internal)
 		}
-		manager, err := NewManager(db, "", nil, nil)
+		manager, err := NewManager(db, "", nil, nil, nil, nil)
 		assert.Nil(t, err)
 		assert.Nil(t, manager.LoadPlugin(new(mock.Plugin)))
 		assert.Nil(t, manager.InitializeForUserID(1))
@@ -456,7 +467,7 @@ func TestNewManager_MessengerAddedAfterInit_createsApplication(t *testing.T) {
 		Token:      auth.GeneratePluginToken(),
 	}))
 
-	manager, err := NewManager(db, "", nil, nil)
+	manager, err := NewManager(db, "", nil, nil, nil, nil)
 	assert.Nil(t, err)
 	assert.Nil(t, manager.LoadPlugin(new(mock.Plugin)))
 	// The mock plugin supports Messenger, so re-initializing must back-fill the
@@ -517,7 +528,7 @@ func TestNewManager_MessengerAddedAfterInit_createApplicationError(t *testing.T)
 	}
 	seedMessengerConfWithoutApplication(t, db)
 
-	manager, err := NewManager(db, "", nil, nil)
+	manager, err := NewManager(db, "", nil, nil, nil, nil)
 	assert.Nil(t, err)
 	assert.Nil(t, manager.LoadPlugin(new(mock.Plugin)))
 
@@ -533,7 +544,7 @@ func TestNewManager_MessengerAddedAfterInit_updatePluginConfError(t *testing.T)
 	}
 	seedMessengerConfWithoutApplication(t, db)
 
-	manager, err := NewManager(db, "", nil, nil)
+	manager, err := NewManager(db, "", nil, nil, nil, nil)
 	assert.Nil(t, err)
 	assert.Nil(t, manager.LoadPlugin(new(mock.Plugin)))
 
@@ -548,3 +559,76 @@ func TestPluginFileLoadError(t *testing.T) {
 	assert.Contains(t, err.Error(), "test.so")
 	assert.Contains(t, err.Error(), "test error")
 }
+
+type channelNotifier chan MessageWithUserID
+
+func (c channelNotifier) Notify(uid uint, message *model.MessageExternal) {
+	c <- MessageWithUserID{Message: *message, UserID: uid}
+}
+
+func TestNewManager_appliesRules(t *testing.T) {
+	db := testdb.NewDBWithDefaultUser(t)
+	db.User(1).App(5)
+	db.CreateRule(&model.Rule{UserID: 1, TitlePattern: "^spam", Action: model.RuleActionDrop})
+	db.CreateRule(&model.Rule{UserID: 1, Action: model.RuleActionTag, Tag: "plugin"})
+	notifier := make(channelNotifier)
+
+	manager, err := NewManager(db, "", nil, notifier, rules.NewEngine(db, notifier), nil)
+	assert.Nil(t, err)
+
+	priority := 3
+	manager.messages <- MessageWithUserID{UserID: 1, Message: model.MessageExternal{ApplicationID: 5, Title: "spam", Priority: &priority}}
+	manager.messages <- MessageWithUserID{UserID: 1, Message: model.MessageExternal{ApplicationID: 5, Title: "backup done", Priority: &priority}}
+
+	select {
+	case msg := <-notifier:
+		assert.Equal(t, "backup done", msg.Message.Title)
+		assert.Equal(t, map[string]any{"server::tags": []any{"plugin"}}, msg.Message.Extras)
+	case <-time.After(1 * time.Second):
+		assert.Fail(t, "read message time out")
+	}
+	if msgs, err := db.GetMessagesByApplication(5); assert.NoError(t, err) && assert.Len(t, msgs, 1) {
+		assert.Equal(t, "backup done", msgs[0].Title)
+		assert.JSONEq(t, `{"server::tags":["plugin"]}`, string(msgs[0].Extras))
+	}
+}
+
+// rejectFirstMessage is a quota which rejects the first message.
+type rejectFirstMessage struct {
+	checked bool
+}
+
+func (q *rejectFirstMessage) CheckPluginStorage(userID, pluginID uint, size int64) error {
+	return nil
+}
+
+func (q *rejectFirstMessage) CheckMessages(userID uint, n int64) error {
+	if !q.checked {
+		q.checked = true
+		return errors.New("messages quota exceeded")
+	}
+	return nil
+}
+
+func TestNewManager_checksMessageQuota(t *testing.T) {
+	db := testdb.NewDBWithDefaultUser(t)
+	db.User(1).App(5)
+	notifier := make(channelNotifier)
+
+	manager, err := NewManager(db, "", nil, notifier, nil, &rejectFirstMessage{})
+	assert.Nil(t, err)
+
+	priority := 3
+	manager.messages <- MessageWithUserID{UserID: 1, Message: model.MessageExternal{ApplicationID: 5, Title: "over quota", Priority: &priority}}
+	manager.messages <- MessageWithUserID{UserID: 1, Message: model.MessageExternal{ApplicationID: 5, Title: "within quota", Priority: &priority}}
+
+	select {
+	case msg := <-notifier:
+		assert.Equal(t, "within quota", msg.Message.Title)
+	case <-time.After(1 * time.Second):
+		assert.Fail(t, "read message time out")
+	}
+	if msgs, err := db.GetMessagesByApplication(5); assert.NoError(t, err) && assert.Len(t, msgs, 1) {
+		assert.Equal(t, "within quota", msgs[0].Title)
+	}
+}
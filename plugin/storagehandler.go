@@ -2,10 +2,17 @@ package plugin
 
 type dbStorageHandler struct {
 	pluginID uint
+	userID   uint
 	db       Database
+	quota    Quota
 }
 
 func (c dbStorageHandler) Save(b []byte) error {
+	if c.quota != nil {
+		if err := c.quota.CheckPluginStorage(c.userID, c.pluginID, int64(len(b))); err != nil {
+			return err
+		}
+	}
 	conf, err := c.db.GetPluginConfByID(c.pluginID)
 	if err != nil {
 		return err
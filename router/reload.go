@@ -0,0 +1,64 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/gotify/server/v2/api/stream"
+	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/config"
+)
+
+// liveSettings holds the middlewares for settings which are applied without a restart.
+type liveSettings struct {
+	responseHeaders atomic.Pointer[map[string]string]
+	cors            atomic.Pointer[gin.HandlerFunc]
+}
+
+func (l *liveSettings) set(conf *config.Configuration) {
+	headers := conf.Server.ResponseHeaders
+	corsHandler := cors.New(auth.CorsConfig(conf))
+	l.responseHeaders.Store(&headers)
+	l.cors.Store(&corsHandler)
+}
+
+func (l *liveSettings) writeResponseHeaders(ctx *gin.Context) {
+	for header, value := range *l.responseHeaders.Load() {
+		ctx.Header(header, value)
+	}
+}
+
+func (l *liveSettings) handleCors(ctx *gin.Context) {
+	(*l.cors.Load())(ctx)
+}
+
+// reloader returns a function applying the response headers, the cors settings and the allowed stream origins of conf.
+// Nothing is applied if a setting is invalid.
+func reloader(live *liveSettings, streamHandler *stream.API) func(conf *config.Configuration) error {
+	return func(conf *config.Configuration) error {
+		if err := validateOrigins(config.EnvServerCorsAllowOrigins, conf.Server.Cors.AllowOrigins); err != nil {
+			return err
+		}
+		if err := validateOrigins(config.EnvServerStreamAllowedOrigins, conf.Server.Stream.AllowedOrigins); err != nil {
+			return err
+		}
+		if err := auth.CorsConfig(conf).Validate(); err != nil {
+			return fmt.Errorf("invalid cors settings: %w", err)
+		}
+		live.set(conf)
+		streamHandler.SetAllowedOrigins(conf.Server.Stream.AllowedOrigins)
+		return nil
+	}
+}
+
+func validateOrigins(env string, origins []string) error {
+	for _, origin := range origins {
+		if _, err := regexp.Compile(origin); err != nil {
+			return fmt.Errorf("invalid value for %s (%q): %w", env, origin, err)
+		}
+	}
+	return nil
+}
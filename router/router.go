@@ -3,29 +3,33 @@ package router
 import (
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gotify/location"
 	"github.com/gotify/server/v2/api"
 	"github.com/gotify/server/v2/api/stream"
 	"github.com/gotify/server/v2/auth"
+	"github.com/gotify/server/v2/backup"
 	"github.com/gotify/server/v2/config"
 	"github.com/gotify/server/v2/database"
 	"github.com/gotify/server/v2/docs"
 	gerror "github.com/gotify/server/v2/error"
+	"github.com/gotify/server/v2/mail"
 	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/mqtt"
 	"github.com/gotify/server/v2/plugin"
+	"github.com/gotify/server/v2/rules"
 	"github.com/gotify/server/v2/ui"
 	"github.com/rs/zerolog/log"
 )
 
 // Create creates the gin engine with all routes.
-func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Configuration) (*gin.Engine, func()) {
+// The returned reload function applies the response headers, the cors settings and the allowed stream origins
+// of a changed configuration.
+func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Configuration) (*gin.Engine, func(), func(*config.Configuration) error) {
 	g := gin.New()
 
 	g.RemoveExtraSlash = true
@@ -89,28 +93,94 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 		SecureCookie: conf.Server.SecureCookie,
 		CrossOrigin:  http.NewCrossOriginProtection(),
 	}
-	messageHandler := api.MessageAPI{Notifier: streamHandler, DB: db}
+	// userNotifiers deliver a message to a single user, they are called for the owner and every member of the application.
+	userNotifiers := api.Notifiers{streamHandler}
+	closeables := []func(){streamHandler.Close}
+	var mailer api.Mailer
+	if conf.SMTP.Host != "" {
+		forwarder := mail.NewForwarder(conf.SMTP, db, streamHandler.HasClients)
+		userNotifiers = append(userNotifiers, forwarder)
+		closeables = append(closeables, forwarder.Close)
+		mailer = forwarder
+	}
+	var mqttBridge *mqtt.Bridge
+	if conf.MQTT.Enabled {
+		mqttBridge = mqtt.NewBridge(conf.MQTT, g)
+		userNotifiers = append(userNotifiers, mqttBridge)
+		closeables = append(closeables, mqttBridge.Close)
+	}
+	memberNotifier := &api.ShareNotifier{DB: db, Notifier: userNotifiers}
+	notifier := api.Notifiers{memberNotifier}
+	quotaHandler := &api.QuotaAPI{
+		DB:       db,
+		ImageDir: conf.UploadedImagesDir,
+		Defaults: model.QuotaLimits{
+			Applications:       int64(conf.Quota.MaxApplications),
+			Clients:            int64(conf.Quota.MaxClients),
+			Messages:           int64(conf.Quota.MaxMessages),
+			StorageBytes:       int64(conf.Quota.MaxStorageBytes),
+			PluginStorageBytes: int64(conf.Quota.MaxPluginStorageBytes),
+		},
+	}
+	attachmentHandler := &api.AttachmentAPI{
+		DB:             db,
+		Dir:            conf.Attachments.Dir,
+		MaxBytes:       int64(conf.Attachments.MaxBytes),
+		UserQuotaBytes: int64(conf.Attachments.UserQuotaBytes),
+		Quota:          quotaHandler,
+	}
+	// removes the attachments of messages deleted while the server was stopped or together with their user.
+	attachmentHandler.CleanupAttachments()
+	// expired messages are removed for all users who can read the application.
+	reaper := api.NewMessageReaper(db, api.ApplicationDeletionNotifiers{&api.ShareDeletionNotifier{DB: db, Notifier: streamHandler}, attachmentHandler})
+	notifier = append(notifier, reaper)
+	closeables = append(closeables, reaper.Close)
+	escalator := api.NewEscalator(db, memberNotifier, mailer)
+	notifier = append(notifier, escalator)
+	closeables = append(closeables, escalator.Close)
+	ruleEngine := rules.NewEngine(db, notifier)
+	ruleEngine.AllowPrivateWebhooks = conf.Rules.AllowPrivateWebhooks
+	ruleEngine.Quota = quotaHandler
+	ruleEngine.Attachments = attachmentHandler
+	scheduler := api.NewMessageScheduler(db, notifier, ruleEngine, quotaHandler)
+	closeables = append(closeables, scheduler.Close)
+	messageHandler := api.MessageAPI{Notifier: notifier, DB: db, Scheduler: scheduler, Reaper: reaper, Rules: ruleEngine, Attachments: attachmentHandler, Quota: quotaHandler}
 	healthHandler := api.HealthAPI{DB: db}
+	imageHandler := api.ImageAPI{ImageDir: conf.UploadedImagesDir}
 	clientHandler := api.ClientAPI{
 		DB:            db,
 		ImageDir:      conf.UploadedImagesDir,
 		NotifyDeleted: streamHandler.NotifyDeletedClient,
+		Quota:         quotaHandler,
 	}
 	applicationHandler := api.ApplicationAPI{
-		DB:       db,
-		ImageDir: conf.UploadedImagesDir,
+		DB:          db,
+		ImageDir:    conf.UploadedImagesDir,
+		Attachments: attachmentHandler,
+		Quota:       quotaHandler,
 	}
+	mailForwardHandler := api.MailForwardAPI{DB: db}
+	webhookHandler := api.WebhookAPI{DB: db, Messages: &messageHandler}
+	ruleHandler := api.RuleAPI{DB: db, Rules: ruleEngine}
+	groupHandler := api.GroupAPI{DB: db}
+	backupHandler := api.BackupAPI{Backup: &backup.Backup{
+		DB:             db.DB,
+		ImagesDir:      conf.UploadedImagesDir,
+		AttachmentsDir: conf.Attachments.Dir,
+		Version:        vInfo.Version,
+	}}
+	escalationHandler := api.EscalationAPI{DB: db, Notifier: streamHandler, MailEnabled: mailer != nil}
 	sessionHandler := api.SessionAPI{DB: db, NotifyDeleted: streamHandler.NotifyDeletedClient, SecureCookie: conf.Server.SecureCookie}
 	userChangeNotifier := new(api.UserChangeNotifier)
 	userHandler := api.UserAPI{DB: db, PasswordStrength: conf.PassStrength, UserChangeNotifier: userChangeNotifier, Registration: conf.Registration}
 
-	pluginManager, err := plugin.NewManager(db, conf.PluginsDir, g.Group("/plugin/:id/custom/"), streamHandler)
+	pluginManager, err := plugin.NewManager(db, conf.PluginsDir, g.Group("/plugin/:id/custom/"), notifier, ruleEngine, quotaHandler)
 	if err != nil {
 		panic(err)
 	}
 	pluginHandler := api.PluginAPI{
 		Manager:  pluginManager,
-		Notifier: streamHandler,
+		Notifier: notifier,
 		DB:       db,
 	}
 
@@ -132,17 +202,17 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 
 	g.Match([]string{"GET", "HEAD"}, "/health", healthHandler.Health)
 	g.GET("/swagger", docs.Serve)
-	g.StaticFS("/image", &onlyImageFS{inner: gin.Dir(conf.UploadedImagesDir, false)})
+	g.Match([]string{"GET", "HEAD"}, "/image/:name", imageHandler.GetImage)
 
 	g.GET("/docs", docs.UI)
 
+	live := &liveSettings{}
+	live.set(conf)
 	g.Use(func(ctx *gin.Context) {
 		ctx.Header("Content-Type", "application/json")
-		for header, value := range conf.Server.ResponseHeaders {
-			ctx.Header(header, value)
-		}
+		live.writeResponseHeaders(ctx)
 	})
-	g.Use(cors.New(auth.CorsConfig(conf)))
+	g.Use(live.handleCors)
 
 	{
 		g.GET("/plugin", authentication.RequireClient, pluginHandler.GetPlugins)
@@ -192,7 +262,10 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 		ctx.JSON(200, &model.GotifyInfo{Version: vInfo.Version, Oidc: conf.OIDC.Enabled, Register: conf.Registration})
 	})
 
-	g.Group("/").Use(authentication.RequireApplicationOrClient).POST("/message", messageHandler.CreateMessage)
+	messageAuth := g.Group("/").Use(authentication.RequireApplicationOrClient)
+	messageAuth.POST("/message", messageHandler.CreateMessage)
+	messageAuth.POST("/message/batch", messageHandler.CreateMessages)
+	g.Group("/webhook").Use(authentication.RequireApplicationTokenParam("token")).POST("/:token", webhookHandler.ReceiveWebhook)
 
 	clientAuth := g.Group("")
 	{
@@ -204,11 +277,28 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 			app.POST("/:id/image", applicationHandler.UploadApplicationImage)
 			app.DELETE("/:id/image", applicationHandler.RemoveApplicationImage)
 			app.PUT("/:id", applicationHandler.UpdateApplication)
+			app.GET("/:id/webhook", webhookHandler.GetWebhookTemplate)
+			app.PUT("/:id/webhook", webhookHandler.UpdateWebhookTemplate)
+			app.DELETE("/:id/webhook", webhookHandler.DeleteWebhookTemplate)
+			app.POST("/:id/webhook/test", webhookHandler.TestWebhookTemplate)
+			app.GET("/:id/escalation", escalationHandler.GetEscalationPolicy)
+			app.PUT("/:id/escalation", escalationHandler.UpdateEscalationPolicy)
+			app.DELETE("/:id/escalation", escalationHandler.DeleteEscalationPolicy)
+			app.GET("/:id/share", applicationHandler.GetApplicationShares)
+			app.PUT("/:id/share/:userId", applicationHandler.ShareApplication)
+			app.DELETE("/:id/share/:userId", applicationHandler.UnshareApplication)
 
 			tokenMessage := app.Group("/:id/message")
 			{
 				tokenMessage.GET("", messageHandler.GetMessagesWithApplication)
 				tokenMessage.DELETE("", messageHandler.DeleteMessageWithApplication)
+				tokenMessage.POST("/import", messageHandler.ImportMessages)
+			}
+
+			scheduled := app.Group("/:id/scheduled")
+			{
+				scheduled.GET("", messageHandler.GetScheduledMessages)
+				scheduled.DELETE("/:scheduledId", messageHandler.DeleteScheduledMessage)
 			}
 		}
 
@@ -219,15 +309,41 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 			client.PUT("/:id", clientHandler.UpdateClient)
 		}
 
+		if conf.SMTP.Host != "" {
+			mailForward := clientAuth.Group("/mail/forward")
+			{
+				mailForward.GET("", mailForwardHandler.GetMailForwardRules)
+				mailForward.POST("", mailForwardHandler.CreateMailForwardRule)
+				mailForward.PUT("/:id", mailForwardHandler.UpdateMailForwardRule)
+				mailForward.DELETE("/:id", mailForwardHandler.DeleteMailForwardRule)
+			}
+		}
+
 		message := clientAuth.Group("/message")
 		{
 			message.GET("", messageHandler.GetMessages)
+			message.GET("/export", messageHandler.ExportMessages)
 			message.DELETE("", messageHandler.DeleteMessages)
 			message.DELETE("/:id", messageHandler.DeleteMessage)
+			message.POST("/:id/read", messageHandler.MarkMessageRead)
+			message.POST("/:id/ack", escalationHandler.AcknowledgeMessage)
+		}
+
+		clientAuth.GET("/attachment/:file", attachmentHandler.GetAttachment)
+
+		rule := clientAuth.Group("/rule")
+		{
+			rule.GET("", ruleHandler.GetRules)
+			rule.POST("", ruleHandler.CreateRule)
+			rule.POST("/test", ruleHandler.TestRules)
+			rule.PUT("/:id", ruleHandler.UpdateRule)
+			rule.DELETE("/:id", ruleHandler.DeleteRule)
 		}
 
 		clientAuth.GET("/stream", streamHandler.Handle)
 		clientAuth.GET("current/user", userHandler.GetCurrentUser)
+		clientAuth.GET("current/user/group", groupHandler.GetCurrentUserGroups)
+		clientAuth.GET("current/user/quota", quotaHandler.GetCurrentUserQuota)
 		clientAuth.POST("/auth/logout", sessionHandler.Logout)
 	}
 
@@ -248,11 +364,41 @@ func Create(db *database.GormDatabase, vInfo *model.VersionInfo, conf *config.Co
 		authAdmin.DELETE("/:id", userHandler.DeleteUserByID)
 		authAdmin.GET("/:id", userHandler.GetUserByID)
 		authAdmin.POST("/:id", userHandler.UpdateUserByID)
+		authAdmin.GET("/:id/quota", quotaHandler.GetUserQuota)
+		authAdmin.PUT("/:id/quota", quotaHandler.UpdateUserQuota)
+	}
+
+	groupAdmin := g.Group("/group")
+	{
+		groupAdmin.Use(authentication.RequireAdmin)
+		groupAdmin.GET("", groupHandler.GetGroups)
+		groupAdmin.POST("", groupHandler.CreateGroup)
+		groupAdmin.GET("/:id", groupHandler.GetGroupByID)
+		groupAdmin.PUT("/:id", groupHandler.UpdateGroupByID)
+		groupAdmin.DELETE("/:id", groupHandler.DeleteGroupByID)
 	}
-	return g, streamHandler.Close
+
+	backupAdmin := g.Group("/backup")
+	{
+		backupAdmin.Use(authentication.RequireAdmin)
+		backupAdmin.GET("", backupHandler.CreateBackup)
+	}
+
+	if mqttBridge != nil {
+		// connect after all routes are registered, subscribed messages are passed to them.
+		mqttBridge.Connect()
+	}
+	return g, func() {
+		for _, closeable := range closeables {
+			closeable()
+		}
+	}, reloader(live, streamHandler)
 }
 
-var tokenRegexp = regexp.MustCompile("token=[^&]+")
+var (
+	tokenRegexp        = regexp.MustCompile("token=[^&]+")
+	webhookTokenRegexp = regexp.MustCompile("^/webhook/[^/?]+")
+)
 
 func accessLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -272,6 +418,7 @@ func accessLogger() gin.HandlerFunc {
 			path = path + "?" + rawQuery
 		}
 		path = tokenRegexp.ReplaceAllString(path, "token=[masked]")
+		path = webhookTokenRegexp.ReplaceAllString(path, "/webhook/[masked]")
 
 		latency := time.Since(start)
 		if latency > time.Minute {
@@ -301,15 +448,3 @@ func accessLogger() gin.HandlerFunc {
 		evt.Msg("HTTP")
 	}
 }
-
-type onlyImageFS struct {
-	inner http.FileSystem
-}
-
-func (fs *onlyImageFS) Open(name string) (http.File, error) {
-	ext := filepath.Ext(name)
-	if !api.ValidApplicationImageExt(ext) {
-		return nil, fmt.Errorf("invalid file")
-	}
-	return fs.inner.Open(name)
-}
@@ -39,7 +39,7 @@ func (s *IntegrationSuite) BeforeTest(string, string) {
 	s.db = testdb.NewDBWithDefaultUser(s.T())
 	assert.Nil(s.T(), err)
 
-	g, closable := Create(s.db.GormDatabase,
+	g, closable, _ := Create(s.db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config.Configuration{PassStrength: 5},
 	)
@@ -79,7 +79,7 @@ func TestHeadersFromConfiguration(t *testing.T) {
 		"Access-Control-Allow-Origin": "http://test1.com",
 	}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -100,6 +100,50 @@ func TestHeadersFromConfiguration(t *testing.T) {
 	assert.Equal(t, "Nice", res.Header.Get("New-Cool-Header"))
 }
 
+func TestReload(t *testing.T) {
+	mode.Set(mode.Prod)
+	db := testdb.NewDBWithDefaultUser(t)
+	defer db.Close()
+
+	conf := config.Configuration{PassStrength: 5}
+	conf.Server.ResponseHeaders = map[string]string{"New-Cool-Header": "Nice"}
+	g, closable, reload := Create(db.GormDatabase,
+		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
+		&conf,
+	)
+	server := httptest.NewServer(g)
+	defer func() {
+		closable()
+		server.Close()
+	}()
+	get := func() *http.Response {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", server.URL, "version"), nil)
+		assert.Nil(t, err)
+		req.Header.Add("Origin", "http://test.com")
+		res, err := client.Do(req)
+		assert.Nil(t, err)
+		return res
+	}
+
+	res := get()
+	assert.Equal(t, "Nice", res.Header.Get("New-Cool-Header"))
+	assert.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+
+	changed := config.Configuration{PassStrength: 5}
+	changed.Server.ResponseHeaders = map[string]string{"Other-Header": "Cool"}
+	changed.Server.Cors.AllowOrigins = []string{"http://test.com"}
+	assert.NoError(t, reload(&changed))
+	res = get()
+	assert.Equal(t, "", res.Header.Get("New-Cool-Header"))
+	assert.Equal(t, "Cool", res.Header.Get("Other-Header"))
+	assert.Equal(t, "http://test.com", res.Header.Get("Access-Control-Allow-Origin"))
+
+	invalid := config.Configuration{PassStrength: 5}
+	invalid.Server.Stream.AllowedOrigins = []string{"("}
+	assert.EqualError(t, reload(&invalid), "invalid value for GOTIFY_SERVER_STREAM_ALLOWEDORIGINS (\"(\"): error parsing regexp: missing closing ): `(`")
+	assert.Equal(t, "Cool", get().Header.Get("Other-Header"), "nothing is applied")
+}
+
 func TestHeadersFromCORSConfig(t *testing.T) {
 	mode.Set(mode.Prod)
 	db := testdb.NewDBWithDefaultUser(t)
@@ -108,7 +152,7 @@ func TestHeadersFromCORSConfig(t *testing.T) {
 	config := config.Configuration{PassStrength: 5}
 	config.Server.Cors.AllowOrigins = []string{"---", "http://test.com"}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -137,7 +181,7 @@ func TestInvalidOrigin(t *testing.T) {
 	config := config.Configuration{PassStrength: 5}
 	config.Server.Cors.AllowOrigins = []string{"---", "http://test.com"}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -169,7 +213,7 @@ func TestAllowedOriginFromResponseHeaders(t *testing.T) {
 		"Access-Control-Allow-Methods": "GET,POST",
 	}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -207,7 +251,7 @@ func TestAllowedWildcardOriginInHeader(t *testing.T) {
 		"Access-Control-Allow-Methods": "GET,POST",
 	}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -236,7 +280,7 @@ func TestCORSHeaderRegex(t *testing.T) {
 	config := config.Configuration{PassStrength: 5}
 	config.Server.Cors.AllowOrigins = []string{"---", "^http://test\\d{3}.com$"}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -274,7 +318,7 @@ func TestCORSConfigOverride(t *testing.T) {
 	config.Server.Cors.AllowMethods = []string{"GET", "OPTIONS"}
 	config.Server.Cors.AllowHeaders = []string{"Content-Type"}
 
-	g, closable := Create(db.GormDatabase,
+	g, closable, _ := Create(db.GormDatabase,
 		&model.VersionInfo{Version: "1.0.0", BuildDate: "2018-02-20-17:30:47", Commit: "asdasds"},
 		&config,
 	)
@@ -344,6 +388,36 @@ func (s *IntegrationSuite) TestSendMessage() {
 	assert.Equal(s.T(), token.ID, msg.ApplicationID)
 }
 
+func (s *IntegrationSuite) TestWebhook() {
+	req := s.newRequest("POST", "application", `{"name": "github", "defaultPriority": 3}`)
+	req.SetBasicAuth("admin", "pw")
+	res, err := client.Do(req)
+	assert.Nil(s.T(), err)
+	app := &model.Application{}
+	json.NewDecoder(res.Body).Decode(app)
+
+	req = s.newRequest("POST", "webhook/"+app.Token, `{"pusher": {"name": "jmattheis"}}`)
+	doRequestAndExpect(s.T(), req, 404, `{"error":"Not Found", "errorCode":404, "errorDescription":"application has no webhook template"}`)
+
+	req = s.newRequest("PUT", fmt.Sprintf("application/%d/webhook", app.ID), `{"message": "{{.pusher.name}} pushed"}`)
+	req.SetBasicAuth("admin", "pw")
+	doRequestAndExpect(s.T(), req, 200, fmt.Sprintf(`{"appid":%d, "title":"", "message":"{{.pusher.name}} pushed", "priority":"", "extras":""}`, app.ID))
+
+	req = s.newRequest("POST", "webhook/unknown", `{"pusher": {"name": "jmattheis"}}`)
+	doRequestAndExpect(s.T(), req, 401, `{"error":"Unauthorized", "errorCode":401, "errorDescription":"you need to provide a valid access token or user credentials to access this api"}`)
+
+	req = s.newRequest("POST", "webhook/"+app.Token, `{"pusher": {"name": "jmattheis"}}`)
+	res, err = client.Do(req)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 200, res.StatusCode)
+	msg := &model.MessageExternal{}
+	json.NewDecoder(res.Body).Decode(msg)
+	assert.Equal(s.T(), "jmattheis pushed", msg.Message)
+	assert.Equal(s.T(), "github", msg.Title)
+	assert.Equal(s.T(), 3, *msg.Priority)
+	assert.Equal(s.T(), app.ID, msg.ApplicationID)
+}
+
 func (s *IntegrationSuite) TestPluginLoadFail_expectPanic() {
 	db := testdb.NewDBWithDefaultUser(s.T())
 	defer db.Close()
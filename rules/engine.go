@@ -0,0 +1,278 @@
+// Package rules evaluates the routing rules of users against new messages.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/rs/zerolog/log"
+)
+
+const webhookTimeout = 10 * time.Second
+
+var errPrivateWebhook = errors.New("webhooks to loopback, private and link-local addresses aren't allowed")
+
+// The Database interface for encapsulating database access.
+type Database interface {
+	GetRulesByUser(userID uint) ([]*model.Rule, error)
+	GetApplicationByID(id uint) (*model.Application, error)
+	GetApplicationShare(appID, userID uint) (*model.ApplicationShare, error)
+	IsGroupMember(groupID, userID uint) (bool, error)
+	CreateMessageWithAttachments(message *model.Message, attachments []*model.Attachment) error
+}
+
+// Attachments copies the attachments of messages for their copies.
+type Attachments interface {
+	// CopyAttachments stores copies of the attachments of the message in the storage of the user.
+	// It returns the copied attachments and the extras of the message referencing them.
+	CopyAttachments(msg *model.Message, userID uint) ([]*model.Attachment, []byte, error)
+	// RemoveAttachments deletes the stored files of copied attachments which were not persisted.
+	RemoveAttachments(attachments []*model.Attachment)
+}
+
+// Quota limits the messages of users.
+type Quota interface {
+	CheckMessages(userID uint, n int64) error
+}
+
+// Notifier notifies when a new message was created.
+type Notifier interface {
+	Notify(userID uint, message *model.MessageExternal)
+}
+
+// Result holds the outcome of evaluating the rules of a user against a message.
+type Result struct {
+	// The ids of the matched rules.
+	Matched []uint
+	// Whether the message should be dropped.
+	Drop bool
+	// The ids of the applications the message should be copied to.
+	Copies []uint
+	// The urls the message should be posted to.
+	Webhooks []string
+}
+
+// Engine evaluates the rules of users against new messages and performs their actions.
+type Engine struct {
+	DB       Database
+	Notifier Notifier
+	// AllowPrivateWebhooks allows webhooks to loopback, private and link-local addresses.
+	// Rules are created by users, so by default they can't reach services in the network of the server.
+	AllowPrivateWebhooks bool
+	// Quota limits the copies, a copy isn't created if the owner of the target application exceeds the message limit.
+	Quota Quota
+	// Attachments copies the attachments of copied messages, without it copies share the attachments of the original.
+	Attachments Attachments
+	client      *http.Client
+}
+
+// NewEngine creates an Engine. Copies of messages are announced via notifier.
+func NewEngine(db Database, notifier Notifier) *Engine {
+	e := &Engine{DB: db, Notifier: notifier}
+	// the address is checked when connecting, so redirects and DNS changes can't bypass it.
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: e.checkWebhookAddress}
+	e.client = &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout},
+	}
+	return e
+}
+
+func (e *Engine) checkWebhookAddress(network, address string, _ syscall.RawConn) error {
+	if e.AllowPrivateWebhooks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsUnspecified() || addr.IsMulticast() || addr.IsInterfaceLocalMulticast() || sharedAddressSpace.Contains(addr) {
+		return errPrivateWebhook
+	}
+	return nil
+}
+
+// sharedAddressSpace is used for carrier-grade NAT (RFC 6598) and isn't covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Evaluate evaluates the rules of the user in order against the message.
+// The priority and extras of the message are modified in place, copies and
+// webhooks must be performed with Dispatch after the message was stored.
+func (e *Engine) Evaluate(userID uint, msg *model.Message) (*Result, error) {
+	rules, err := e.DB.GetRulesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	extras := map[string]any{}
+	if len(msg.Extras) != 0 {
+		json.Unmarshal(msg.Extras, &extras)
+	}
+	extrasChanged := false
+
+	for _, rule := range rules {
+		compiled, err := Compile(rule)
+		if err != nil {
+			log.Warn().Err(err).Uint("rule_id", rule.ID).Msg("Skipping invalid rule")
+			continue
+		}
+		if !compiled.Matches(msg, extras) {
+			continue
+		}
+		result.Matched = append(result.Matched, rule.ID)
+
+		switch rule.Action {
+		case model.RuleActionSetPriority:
+			msg.Priority = rule.Priority
+		case model.RuleActionCopy:
+			if !slices.Contains(result.Copies, rule.TargetApplicationID) && e.canCopyTo(userID, rule.TargetApplicationID) {
+				result.Copies = append(result.Copies, rule.TargetApplicationID)
+			}
+		case model.RuleActionTag:
+			extrasChanged = addTag(extras, rule.Tag) || extrasChanged
+		case model.RuleActionWebhook:
+			if !slices.Contains(result.Webhooks, rule.WebhookURL) {
+				result.Webhooks = append(result.Webhooks, rule.WebhookURL)
+			}
+		case model.RuleActionDrop:
+			result.Drop = true
+			return result, nil
+		}
+	}
+
+	if extrasChanged {
+		msg.Extras, _ = json.Marshal(extras)
+	}
+	return result, nil
+}
+
+// canCopyTo returns whether the user may still create messages in the application,
+// the application may have been unshared since the rule was saved.
+func (e *Engine) canCopyTo(userID, appID uint) bool {
+	app, err := e.DB.GetApplicationByID(appID)
+	if err != nil || app == nil {
+		return false
+	}
+	if app.UserID == userID {
+		return true
+	}
+	if app.GroupID != 0 {
+		if member, err := e.DB.IsGroupMember(app.GroupID, userID); err == nil && member {
+			return true
+		}
+	}
+	share, err := e.DB.GetApplicationShare(appID, userID)
+	return err == nil && share != nil && share.Permission == model.SharePermissionManage
+}
+
+// Dispatch copies the stored message to other applications and posts it to webhooks according to the result.
+func (e *Engine) Dispatch(result *Result, msg *model.Message) {
+	for _, appID := range result.Copies {
+		if appID == msg.ApplicationID {
+			continue
+		}
+		app, err := e.DB.GetApplicationByID(appID)
+		if err != nil || app == nil {
+			log.Warn().Err(err).Uint("app_id", appID).Msg("Could not copy message, application not found")
+			continue
+		}
+		cp := &model.Message{
+			ApplicationID: appID,
+			Message:       msg.Message,
+			Title:         msg.Title,
+			Priority:      msg.Priority,
+			Extras:        msg.Extras,
+			Date:          msg.Date,
+			ExpiresAt:     msg.ExpiresAt,
+		}
+		if e.Quota != nil {
+			if err := e.Quota.CheckMessages(app.UserID, 1); err != nil {
+				log.Warn().Err(err).Uint("app_id", appID).Msg("Could not copy message")
+				continue
+			}
+		}
+		var attachments []*model.Attachment
+		if e.Attachments != nil {
+			attachments, cp.Extras, err = e.Attachments.CopyAttachments(msg, app.UserID)
+			if err != nil {
+				log.Warn().Err(err).Uint("app_id", appID).Msg("Could not copy attachments of message")
+				continue
+			}
+		}
+		if err := e.DB.CreateMessageWithAttachments(cp, attachments); err != nil {
+			if e.Attachments != nil {
+				e.Attachments.RemoveAttachments(attachments)
+			}
+			log.Error().Err(err).Uint("app_id", appID).Msg("Could not copy message")
+			continue
+		}
+		e.Notifier.Notify(app.UserID, toExternalMessage(cp))
+	}
+
+	if len(result.Webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(toExternalMessage(msg))
+	if err != nil {
+		log.Error().Err(err).Uint("message_id", msg.ID).Msg("Could not encode message for webhook")
+		return
+	}
+	for _, url := range result.Webhooks {
+		go e.post(url, body)
+	}
+}
+
+func (e *Engine) post(url string, body []byte) {
+	resp, err := e.client.Post(url, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("url", url).Msg("Could not post message to rule webhook")
+	}
+}
+
+func addTag(extras map[string]any, tag string) bool {
+	var tags []any
+	if existing, ok := extras[model.RuleTagsExtrasKey].([]any); ok {
+		tags = existing
+	}
+	if slices.Contains(tags, any(tag)) {
+		return false
+	}
+	extras[model.RuleTagsExtrasKey] = append(tags, tag)
+	return true
+}
+
+func toExternalMessage(msg *model.Message) *model.MessageExternal {
+	priority := msg.Priority
+	res := &model.MessageExternal{
+		ID:            msg.ID,
+		ApplicationID: msg.ApplicationID,
+		Message:       msg.Message,
+		Title:         msg.Title,
+		Priority:      &priority,
+		Date:          msg.Date,
+		ExpiresAt:     msg.ExpiresAt,
+	}
+	if len(msg.Extras) != 0 {
+		res.Extras = make(map[string]any)
+		json.Unmarshal(msg.Extras, &res.Extras)
+	}
+	return res
+}
@@ -0,0 +1,196 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/mode"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/test/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	mutex    sync.Mutex
+	messages map[uint][]*model.MessageExternal
+}
+
+func (n *recordingNotifier) Notify(userID uint, msg *model.MessageExternal) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.messages == nil {
+		n.messages = map[uint][]*model.MessageExternal{}
+	}
+	n.messages[userID] = append(n.messages[userID], msg)
+}
+
+func newTestEngine(t *testing.T) (*Engine, *testdb.Database, *recordingNotifier) {
+	mode.Set(mode.TestDev)
+	db := testdb.NewDB(t)
+	t.Cleanup(db.Close)
+	notifier := &recordingNotifier{}
+	return NewEngine(db, notifier), db, notifier
+}
+
+func TestEngine_Evaluate_appliesActionsInOrder(t *testing.T) {
+	engine, db, _ := newTestEngine(t)
+	db.User(1).App(1)
+	db.CreateRule(&model.Rule{UserID: 1, TitlePattern: "disk", MinPriority: intPtr(5), Action: model.RuleActionTag, Tag: "infra"})
+	db.CreateRule(&model.Rule{UserID: 1, ApplicationID: 1, Action: model.RuleActionSetPriority, Priority: 2})
+	db.CreateRule(&model.Rule{UserID: 1, MinPriority: intPtr(5), Action: model.RuleActionCopy, TargetApplicationID: 7})
+	db.CreateRule(&model.Rule{UserID: 1, Action: model.RuleActionWebhook, WebhookURL: "https://example.com/hook"})
+	db.CreateRule(&model.Rule{UserID: 2, Action: model.RuleActionDrop})
+
+	msg := &model.Message{ApplicationID: 1, Title: "disk full", Priority: 8, Extras: []byte(`{"client::display":{"contentType":"text/plain"}}`), Date: time.Now()}
+	result, err := engine.Evaluate(1, msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, &Result{Matched: []uint{1, 2, 4}, Webhooks: []string{"https://example.com/hook"}}, result)
+	assert.Equal(t, 2, msg.Priority)
+	assert.JSONEq(t, `{"client::display":{"contentType":"text/plain"},"server::tags":["infra"]}`, string(msg.Extras))
+}
+
+func TestEngine_Evaluate_dropStopsEvaluation(t *testing.T) {
+	engine, db, _ := newTestEngine(t)
+	db.User(1).App(1)
+	db.CreateRule(&model.Rule{UserID: 1, TitlePattern: "^spam", Action: model.RuleActionDrop})
+	db.CreateRule(&model.Rule{UserID: 1, Action: model.RuleActionSetPriority, Priority: 2})
+
+	msg := &model.Message{ApplicationID: 1, Title: "spam", Priority: 8, Date: time.Now()}
+	result, err := engine.Evaluate(1, msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, &Result{Matched: []uint{1}, Drop: true}, result)
+	assert.Equal(t, 8, msg.Priority)
+}
+
+func TestEngine_Evaluate_skipsInvalidRules(t *testing.T) {
+	engine, db, _ := newTestEngine(t)
+	db.User(1).App(1)
+	db.CreateRule(&model.Rule{UserID: 1, TitlePattern: "(", Action: model.RuleActionDrop})
+	db.CreateRule(&model.Rule{UserID: 1, Action: model.RuleActionTag, Tag: "a"})
+	db.CreateRule(&model.Rule{UserID: 1, Action: model.RuleActionTag, Tag: "a"})
+
+	msg := &model.Message{ApplicationID: 1, Date: time.Now()}
+	result, err := engine.Evaluate(1, msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, &Result{Matched: []uint{2, 3}}, result)
+	assert.JSONEq(t, `{"server::tags":["a"]}`, string(msg.Extras))
+}
+
+func TestEngine_Dispatch_copiesMessage(t *testing.T) {
+	engine, db, notifier := newTestEngine(t)
+	db.User(1).App(1)
+	db.User(2).App(7)
+
+	msg := &model.Message{ApplicationID: 1, Title: "disk full", Message: "sda1", Priority: 8, Date: time.Now()}
+	require.NoError(t, db.CreateMessage(msg))
+	engine.Dispatch(&Result{Copies: []uint{7, 1, 99}}, msg)
+
+	copies, err := db.GetMessagesByApplication(7)
+	require.NoError(t, err)
+	if assert.Len(t, copies, 1) {
+		assert.NotEqual(t, msg.ID, copies[0].ID)
+		assert.Equal(t, "disk full", copies[0].Title)
+		assert.Equal(t, "sda1", copies[0].Message)
+		assert.Equal(t, 8, copies[0].Priority)
+	}
+	if msgs, err := db.GetMessagesByApplication(1); assert.NoError(t, err) {
+		assert.Len(t, msgs, 1, "no copy to the source application")
+	}
+	if assert.Len(t, notifier.messages[2], 1) {
+		assert.Equal(t, copies[0].ID, notifier.messages[2][0].ID)
+	}
+	assert.Empty(t, notifier.messages[1])
+}
+
+// quotaByUser rejects messages of the users mapped to true.
+type quotaByUser map[uint]bool
+
+func (q quotaByUser) CheckMessages(userID uint, n int64) error {
+	if q[userID] {
+		return errors.New("messages quota exceeded")
+	}
+	return nil
+}
+
+func TestEngine_Dispatch_checksQuotaOfTargetOwner(t *testing.T) {
+	engine, db, notifier := newTestEngine(t)
+	db.User(1).App(1)
+	db.User(2).App(7)
+	db.User(3).App(8)
+	engine.Quota = quotaByUser{2: true}
+
+	msg := &model.Message{ApplicationID: 1, Message: "sda1", Date: time.Now()}
+	require.NoError(t, db.CreateMessage(msg))
+	engine.Dispatch(&Result{Copies: []uint{7, 8}}, msg)
+
+	if copies, err := db.GetMessagesByApplication(7); assert.NoError(t, err) {
+		assert.Empty(t, copies)
+	}
+	if copies, err := db.GetMessagesByApplication(8); assert.NoError(t, err) {
+		assert.Len(t, copies, 1)
+	}
+	assert.Empty(t, notifier.messages[2])
+	assert.Len(t, notifier.messages[3], 1)
+}
+
+func TestEngine_Dispatch_postsWebhook(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	engine.AllowPrivateWebhooks = true
+	received := make(chan *model.MessageExternal, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		msg := &model.MessageExternal{}
+		json.Unmarshal(body, msg)
+		received <- msg
+	}))
+	defer server.Close()
+
+	engine.Dispatch(&Result{Webhooks: []string{server.URL}}, &model.Message{ID: 3, ApplicationID: 1, Title: "disk full", Priority: 8})
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, uint(3), msg.ID)
+		assert.Equal(t, "disk full", msg.Title)
+	case <-time.After(time.Second):
+		assert.Fail(t, "webhook was not called")
+	}
+}
+
+func TestEngine_Dispatch_rejectsPrivateWebhooks(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	called := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer server.Close()
+
+	_, err := engine.client.Post(server.URL, "application/json", nil)
+	assert.ErrorIs(t, err, errPrivateWebhook)
+	select {
+	case <-called:
+		assert.Fail(t, "webhook to loopback address was called")
+	default:
+	}
+}
+
+func TestEngine_checkWebhookAddress(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	for _, address := range []string{"127.0.0.1:80", "[::1]:80", "10.1.2.3:80", "192.168.0.1:443", "169.254.169.254:80", "[fe80::1]:80", "0.0.0.0:80", "100.64.0.1:80", "[::ffff:127.0.0.1]:80"} {
+		assert.ErrorIs(t, engine.checkWebhookAddress("tcp", address, nil), errPrivateWebhook, address)
+	}
+	for _, address := range []string{"93.184.216.34:443", "[2606:2800:220:1::1]:443"} {
+		assert.NoError(t, engine.checkWebhookAddress("tcp", address, nil), address)
+	}
+	engine.AllowPrivateWebhooks = true
+	assert.NoError(t, engine.checkWebhookAddress("tcp", "127.0.0.1:80", nil))
+}
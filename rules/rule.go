@@ -0,0 +1,145 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+)
+
+const (
+	timeOfDayLayout = "15:04"
+	regexpCacheSize = 1000
+)
+
+var regexpCache = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: map[string]*regexp.Regexp{}}
+
+// Compiled is a rule with parsed conditions, ready to be matched against messages.
+type Compiled struct {
+	Rule    *model.Rule
+	title   *regexp.Regexp
+	message *regexp.Regexp
+	from    int
+	until   int
+}
+
+// Compile validates the rule and parses its conditions.
+func Compile(rule *model.Rule) (*Compiled, error) {
+	c := &Compiled{Rule: rule, from: -1, until: -1}
+	var err error
+	if rule.TitlePattern != "" {
+		if c.title, err = compileRegexp(rule.TitlePattern); err != nil {
+			return nil, fmt.Errorf("invalid titlePattern: %s", err)
+		}
+	}
+	if rule.MessagePattern != "" {
+		if c.message, err = compileRegexp(rule.MessagePattern); err != nil {
+			return nil, fmt.Errorf("invalid messagePattern: %s", err)
+		}
+	}
+	if (rule.ActiveFrom == "") != (rule.ActiveUntil == "") {
+		return nil, errors.New("activeFrom and activeUntil must be set together")
+	}
+	if rule.ActiveFrom != "" {
+		if c.from, err = parseTimeOfDay(rule.ActiveFrom); err != nil {
+			return nil, fmt.Errorf("invalid activeFrom: %s", err)
+		}
+		if c.until, err = parseTimeOfDay(rule.ActiveUntil); err != nil {
+			return nil, fmt.Errorf("invalid activeUntil: %s", err)
+		}
+	}
+
+	switch rule.Action {
+	case model.RuleActionSetPriority, model.RuleActionDrop:
+	case model.RuleActionCopy:
+		if rule.TargetApplicationID == 0 {
+			return nil, errors.New("the copy action requires targetAppid")
+		}
+	case model.RuleActionTag:
+		if rule.Tag == "" {
+			return nil, errors.New("the tag action requires tag")
+		}
+	case model.RuleActionWebhook:
+		u, err := url.Parse(rule.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("the webhook action requires an http or https webhookUrl")
+		}
+	default:
+		return nil, fmt.Errorf("unknown action %q", rule.Action)
+	}
+	return c, nil
+}
+
+// Matches returns whether the message with the given decoded extras fulfills all conditions of the rule.
+func (c *Compiled) Matches(msg *model.Message, extras map[string]any) bool {
+	rule := c.Rule
+	if rule.ApplicationID != 0 && rule.ApplicationID != msg.ApplicationID {
+		return false
+	}
+	if c.title != nil && !c.title.MatchString(msg.Title) {
+		return false
+	}
+	if c.message != nil && !c.message.MatchString(msg.Message) {
+		return false
+	}
+	if rule.MinPriority != nil && msg.Priority < *rule.MinPriority {
+		return false
+	}
+	if rule.MaxPriority != nil && msg.Priority > *rule.MaxPriority {
+		return false
+	}
+	if rule.ExtrasKey != "" {
+		if _, ok := extras[rule.ExtrasKey]; !ok {
+			return false
+		}
+	}
+	if c.from != -1 && !inTimeRange(c.from, c.until, msg.Date.Local()) {
+		return false
+	}
+	return true
+}
+
+// compileRegexp returns the compiled pattern, patterns are cached because the
+// rules are compiled for every new message.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+	if compiled, ok := regexpCache.compiled[pattern]; ok {
+		return compiled, nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexpCache.compiled) >= regexpCacheSize {
+		// patterns of changed or deleted rules are never removed, start over instead.
+		clear(regexpCache.compiled)
+	}
+	regexpCache.compiled[pattern] = compiled
+	return compiled, nil
+}
+
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse(timeOfDayLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("%q must have the format HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inTimeRange returns whether the time of day of t is inside [from, until).
+// The range spans midnight if from is after until.
+func inTimeRange(from, until int, t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if from <= until {
+		return minute >= from && minute < until
+	}
+	return minute >= from || minute < until
+}
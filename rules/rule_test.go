@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(x int) *int {
+	return &x
+}
+
+func TestCompile_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule model.Rule
+		err  string
+	}{
+		{"titlePattern", model.Rule{TitlePattern: "(", Action: "drop"}, "invalid titlePattern"},
+		{"messagePattern", model.Rule{MessagePattern: "[", Action: "drop"}, "invalid messagePattern"},
+		{"only activeFrom", model.Rule{ActiveFrom: "22:00", Action: "drop"}, "activeFrom and activeUntil must be set together"},
+		{"activeFrom format", model.Rule{ActiveFrom: "10pm", ActiveUntil: "07:00", Action: "drop"}, "invalid activeFrom"},
+		{"activeUntil format", model.Rule{ActiveFrom: "22:00", ActiveUntil: "25:00", Action: "drop"}, "invalid activeUntil"},
+		{"copy without target", model.Rule{Action: "copy"}, "requires targetAppid"},
+		{"tag without tag", model.Rule{Action: "tag"}, "requires tag"},
+		{"webhook without url", model.Rule{Action: "webhook"}, "requires an http or https webhookUrl"},
+		{"webhook with other scheme", model.Rule{Action: "webhook", WebhookURL: "ftp://example.com"}, "requires an http or https webhookUrl"},
+		{"unknown action", model.Rule{Action: "explode"}, `unknown action "explode"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile(&test.rule)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestCompiled_Matches(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 5, hour, minute, 0, 0, time.Local)
+	}
+	msg := func(appID uint, title, message string, priority int, date time.Time) *model.Message {
+		return &model.Message{ApplicationID: appID, Title: title, Message: message, Priority: priority, Date: date}
+	}
+
+	tests := []struct {
+		name    string
+		rule    model.Rule
+		msg     *model.Message
+		extras  map[string]any
+		matches bool
+	}{
+		{"no conditions", model.Rule{}, msg(1, "", "", 0, at(12, 0)), nil, true},
+		{"application", model.Rule{ApplicationID: 1}, msg(1, "", "", 0, at(12, 0)), nil, true},
+		{"other application", model.Rule{ApplicationID: 2}, msg(1, "", "", 0, at(12, 0)), nil, false},
+		{"title", model.Rule{TitlePattern: "(?i)disk"}, msg(1, "Disk full", "", 0, at(12, 0)), nil, true},
+		{"title mismatch", model.Rule{TitlePattern: "disk"}, msg(1, "Disk full", "", 0, at(12, 0)), nil, false},
+		{"message", model.Rule{MessagePattern: "^/dev/sd"}, msg(1, "", "/dev/sda1 is full", 0, at(12, 0)), nil, true},
+		{"message mismatch", model.Rule{MessagePattern: "^/dev/sd"}, msg(1, "", "sda1 is full", 0, at(12, 0)), nil, false},
+		{"min priority", model.Rule{MinPriority: intPtr(5)}, msg(1, "", "", 5, at(12, 0)), nil, true},
+		{"below min priority", model.Rule{MinPriority: intPtr(5)}, msg(1, "", "", 4, at(12, 0)), nil, false},
+		{"max priority", model.Rule{MaxPriority: intPtr(5)}, msg(1, "", "", 5, at(12, 0)), nil, true},
+		{"above max priority", model.Rule{MaxPriority: intPtr(5)}, msg(1, "", "", 6, at(12, 0)), nil, false},
+		{"extras key", model.Rule{ExtrasKey: "client::display"}, msg(1, "", "", 0, at(12, 0)), map[string]any{"client::display": map[string]any{}}, true},
+		{"missing extras key", model.Rule{ExtrasKey: "client::display"}, msg(1, "", "", 0, at(12, 0)), map[string]any{}, false},
+		{"in time range", model.Rule{ActiveFrom: "09:00", ActiveUntil: "17:00"}, msg(1, "", "", 0, at(9, 0)), nil, true},
+		{"after time range", model.Rule{ActiveFrom: "09:00", ActiveUntil: "17:00"}, msg(1, "", "", 0, at(17, 0)), nil, false},
+		{"overnight before midnight", model.Rule{ActiveFrom: "22:00", ActiveUntil: "07:00"}, msg(1, "", "", 0, at(23, 30)), nil, true},
+		{"overnight after midnight", model.Rule{ActiveFrom: "22:00", ActiveUntil: "07:00"}, msg(1, "", "", 0, at(6, 59)), nil, true},
+		{"outside overnight", model.Rule{ActiveFrom: "22:00", ActiveUntil: "07:00"}, msg(1, "", "", 0, at(12, 0)), nil, false},
+		{
+			"all conditions",
+			model.Rule{ApplicationID: 1, TitlePattern: "disk", MinPriority: intPtr(5)},
+			msg(1, "disk full", "", 5, at(12, 0)), nil, true,
+		},
+		{
+			"one condition fails",
+			model.Rule{ApplicationID: 1, TitlePattern: "disk", MinPriority: intPtr(5)},
+			msg(1, "disk full", "", 4, at(12, 0)), nil, false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.rule.Action = model.RuleActionDrop
+			compiled, err := Compile(&test.rule)
+			require.NoError(t, err)
+			assert.Equal(t, test.matches, compiled.Matches(test.msg, test.extras))
+		})
+	}
+}
+
+func TestCompile_cachesPatterns(t *testing.T) {
+	first, err := Compile(&model.Rule{TitlePattern: "^disk", Action: model.RuleActionDrop})
+	require.NoError(t, err)
+	second, err := Compile(&model.Rule{MessagePattern: "^disk", Action: model.RuleActionDrop})
+	require.NoError(t, err)
+	assert.Same(t, first.title, second.message)
+}
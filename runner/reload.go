@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"crypto/tls"
+	"os"
+	"sync/atomic"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// liveSettings are applied on reload, changes of other settings require a restart.
+var liveSettings = map[string]bool{
+	config.EnvLogLevel:                   true,
+	config.EnvServerResponseHeaders:      true,
+	config.EnvServerCorsAllowOrigins:     true,
+	config.EnvServerCorsAllowMethods:     true,
+	config.EnvServerCorsAllowHeaders:     true,
+	config.EnvServerStreamAllowedOrigins: true,
+	config.EnvServerSSLCertFile:          true,
+	config.EnvServerSSLCertKey:           true,
+}
+
+// certificate holds the TLS certificate, it's replaced on reload.
+type certificate struct {
+	current atomic.Pointer[tls.Certificate]
+}
+
+func (c *certificate) load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.current.Store(&cert)
+	return nil
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
+
+func reloadOnSignal(done <-chan struct{}, onSignal <-chan os.Signal, conf *config.Configuration, cert *certificate, apply func(*config.Configuration) error) {
+	r := &reloader{started: conf, applied: conf, cert: cert, apply: apply}
+	for {
+		select {
+		case <-done:
+			return
+		case <-onSignal:
+			log.Info().Msg("Received SIGHUP, reloading configuration")
+			r.reload()
+		}
+	}
+}
+
+// reloader applies the live settings of the reloaded configuration.
+type reloader struct {
+	// started is the configuration on start, other settings are only applied by a restart.
+	started *config.Configuration
+	// applied is the configuration of the last successful reload.
+	applied *config.Configuration
+	cert    *certificate
+	apply   func(*config.Configuration) error
+}
+
+// reload reads the configuration and applies the live settings. Live settings are compared to the
+// last applied configuration, other settings to the configuration on start as they still require a restart.
+func (r *reloader) reload() {
+	conf, futureLogs := config.Get()
+	failed := false
+	for _, futureLog := range futureLogs {
+		if futureLog.Level == zerolog.FatalLevel || futureLog.Level == zerolog.PanicLevel {
+			log.Error().Msg(futureLog.Msg)
+			failed = true
+		}
+	}
+	if failed {
+		log.Error().Msg("Configuration not reloaded because of invalid settings")
+		return
+	}
+
+	var applied, restart []string
+	for _, env := range config.Changed(r.applied, conf) {
+		if liveSettings[env] {
+			applied = append(applied, env)
+		}
+	}
+	for _, env := range config.Changed(r.started, conf) {
+		if !liveSettings[env] {
+			restart = append(restart, env)
+		}
+	}
+	if r.apply != nil {
+		if err := r.apply(conf); err != nil {
+			log.Error().Err(err).Msg("Configuration not reloaded")
+			return
+		}
+	}
+	r.applied = conf
+	zerolog.SetGlobalLevel(conf.LogLevel.AsZeroLogLevel())
+	if r.cert != nil {
+		// the certificate is loaded even without changed settings, the files may have been renewed
+		if err := r.cert.load(conf.Server.SSL.CertFile, conf.Server.SSL.CertKey); err != nil {
+			log.Error().Err(err).Msg("Cannot reload the TLS certificate, the previous certificate is still used")
+		}
+	}
+	if len(restart) > 0 {
+		log.Warn().Strs("settings", restart).Msg("Changed settings require a restart")
+	}
+	log.Info().Strs("applied", applied).Msg("Configuration reloaded")
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,15 +13,21 @@ import (
 	"time"
 
 	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/mail"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 )
 
-// Run starts the http server and if configured a https server.
-func Run(router http.Handler, conf *config.Configuration) error {
+// Run starts the http server and if configured a https server and a smtp server.
+// On SIGHUP the configuration is read again and the log level, the TLS certificate and the settings
+// handled by reload are applied, reload may be nil.
+func Run(router http.Handler, conf *config.Configuration, reload func(*config.Configuration) error) error {
 	shutdown := make(chan error)
 	go doShutdownOnSignal(shutdown)
+	onReload := make(chan os.Signal, 1)
+	signal.Notify(onReload, syscall.SIGHUP)
+	defer signal.Stop(onReload)
 
 	httpListener, err := startListening("plain connection", conf.Server.ListenAddr, conf.Server.Port, conf.Server.KeepAlivePeriodSeconds)
 	if err != nil {
@@ -29,11 +36,18 @@ func Run(router http.Handler, conf *config.Configuration) error {
 	defer httpListener.Close()
 
 	s := &http.Server{Handler: router}
+	var cert *certificate
 	if conf.Server.SSL.Enabled {
 		if conf.Server.SSL.LetsEncrypt.Enabled {
 			applyLetsEncrypt(s, conf)
 		} else if conf.Server.SSL.CertFile == "" || conf.Server.SSL.CertKey == "" {
 			log.Fatal().Msg("CertFile and CertKey must be set to use HTTPS when LetsEncrypt is disabled, please set GOTIFY_SERVER_SSL_CERTFILE and GOTIFY_SERVER_SSL_CERTKEY")
+		} else {
+			cert = &certificate{}
+			if err := cert.load(conf.Server.SSL.CertFile, conf.Server.SSL.CertKey); err != nil {
+				return err
+			}
+			s.TLSConfig = &tls.Config{GetCertificate: cert.get}
 		}
 
 		httpsListener, err := startListening("TLS connection", conf.Server.SSL.ListenAddr, conf.Server.SSL.Port, conf.Server.KeepAlivePeriodSeconds)
@@ -43,7 +57,8 @@ func Run(router http.Handler, conf *config.Configuration) error {
 		defer httpsListener.Close()
 
 		go func() {
-			err := s.ServeTLS(httpsListener, conf.Server.SSL.CertFile, conf.Server.SSL.CertKey)
+			// the certificate is provided by the TLSConfig
+			err := s.ServeTLS(httpsListener, "", "")
 			doShutdown(shutdown, err)
 		}()
 	}
@@ -52,6 +67,28 @@ func Run(router http.Handler, conf *config.Configuration) error {
 		doShutdown(shutdown, err)
 	}()
 
+	if conf.SMTPServer.Enabled {
+		smtpListener, err := startListening("smtp", conf.SMTPServer.ListenAddr, conf.SMTPServer.Port, conf.Server.KeepAlivePeriodSeconds)
+		if err != nil {
+			return err
+		}
+		defer smtpListener.Close()
+
+		smtpServer, err := mail.NewServer(conf.SMTPServer, router)
+		if err != nil {
+			return err
+		}
+		defer smtpServer.Close()
+		go func() {
+			err := smtpServer.Serve(smtpListener)
+			doShutdown(shutdown, err)
+		}()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go reloadOnSignal(done, onReload, conf, cert, reload)
+
 	err = <-shutdown
 	log.Info().Err(err).Msg("Shutting down")
 
@@ -94,6 +131,23 @@ func startListening(connectionType, listenAddr string, port, keepAlive int) (net
 	return l, err
 }
 
+// ClientNetworkAndAddr returns the network and the address for connecting to the plain http server,
+// an unspecified listen address is replaced with localhost.
+func ClientNetworkAndAddr(conf *config.Configuration) (string, string) {
+	network, addr := getNetworkAndAddr(conf.Server.ListenAddr, conf.Server.Port)
+	if network != "tcp" {
+		return network, addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return network, addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	return network, addr
+}
+
 func getNetworkAndAddr(listenAddr string, port int) (string, string) {
 	if after, ok := strings.CutPrefix(listenAddr, "unix:"); ok {
 		return "unix", after
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/database"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/runner"
+)
+
+// messageInput is read for the message if it's - or not given.
+var messageInput io.Reader = os.Stdin
+
+type sendMessage struct {
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
+func sendCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gotify send", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	serverURL := fs.String("url", "", "the url of the server, defaults to the plain http listener of the configuration, e.g. http://localhost:80")
+	appToken := fs.String("app-token", "", "the token of the application sending the message")
+	appID := fs.Uint("app-id", 0, "the id of the application sending the message, its token is read from the configured database")
+	title := fs.String("title", "", "the title of the message")
+	priority := fs.Int("priority", 0, "the priority of the message, defaults to the default priority of the application")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "gotify send: expected at most one message argument, quote messages containing spaces")
+		return 2
+	}
+	if (*appToken == "") == (*appID == 0) {
+		fmt.Fprintln(stderr, "gotify send: either --app-token or --app-id must be set")
+		return 2
+	}
+
+	msg := sendMessage{Title: *title}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "priority" {
+			msg.Priority = priority
+		}
+	})
+	if text := fs.Arg(0); text != "" && text != "-" {
+		msg.Message = text
+	} else {
+		content, err := io.ReadAll(messageInput)
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify send: cannot read message:", err)
+			return 1
+		}
+		msg.Message = strings.TrimRight(string(content), "\r\n")
+	}
+	if msg.Message == "" {
+		fmt.Fprintln(stderr, "gotify send: the message must not be empty")
+		return 2
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	token := *appToken
+	baseURL := strings.TrimSuffix(*serverURL, "/")
+	if baseURL != "" && *appID == 0 {
+		id, err := postMessage(client, baseURL, token, &msg)
+		return printSent(id, err, stdout, stderr)
+	}
+
+	var conf *config.Configuration
+	if *appID != 0 {
+		var db *database.GormDatabase
+		var ok bool
+		if conf, db, ok = openCommandDatabase(stderr); !ok {
+			return 1
+		}
+		app, err := db.GetApplicationByID(*appID)
+		db.Close()
+		if err != nil {
+			fmt.Fprintln(stderr, "gotify send:", err)
+			return 1
+		}
+		if app == nil {
+			fmt.Fprintf(stderr, "gotify send: application with id %d does not exist\n", *appID)
+			return 1
+		}
+		token = app.Token
+	} else {
+		var ok bool
+		if conf, ok = loadCommandConfig(stderr); !ok {
+			return 1
+		}
+	}
+	if baseURL == "" {
+		network, addr := runner.ClientNetworkAndAddr(conf)
+		baseURL = "http://" + addr
+		if network == "unix" {
+			baseURL = "http://localhost"
+			client.Transport = &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			}}
+		}
+	}
+
+	id, err := postMessage(client, baseURL, token, &msg)
+	return printSent(id, err, stdout, stderr)
+}
+
+func printSent(id uint, err error, stdout, stderr io.Writer) int {
+	if err != nil {
+		fmt.Fprintln(stderr, "gotify send:", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "Sent message", id)
+	return 0
+}
+
+func postMessage(client *http.Client, baseURL, token string, msg *sendMessage) (uint, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/message", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := model.Error{}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.ErrorDescription != "" {
+			return 0, fmt.Errorf("%s: %s", resp.Status, apiErr.ErrorDescription)
+		}
+		return 0, errors.New(resp.Status)
+	}
+	created := model.MessageExternal{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return 0, fmt.Errorf("cannot read response: %w", err)
+	}
+	return created.ID, nil
+}
@@ -34,7 +34,7 @@ type MessageBuilder struct {
 
 // NewDBWithDefaultUser creates a new test db instance with the default user.
 func NewDBWithDefaultUser(t *testing.T) *Database {
-	db, err := database.New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), "admin", "pw", 5, true, nowFunc)
+	db, err := database.New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), database.Pool{}, "admin", "pw", 5, true, nowFunc)
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 	return &Database{GormDatabase: db, t: t}
@@ -42,7 +42,7 @@ func NewDBWithDefaultUser(t *testing.T) *Database {
 
 // NewDB creates a new test db instance.
 func NewDB(t *testing.T) *Database {
-	db, err := database.New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), "admin", "pw", 5, false, nowFunc)
+	db, err := database.New("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", fmt.Sprint(time.Now().UnixNano())), database.Pool{}, "admin", "pw", 5, false, nowFunc)
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 	return &Database{GormDatabase: db, t: t}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gotify/server/v2/auth/password"
+	"github.com/gotify/server/v2/config"
+	"github.com/gotify/server/v2/database"
+	"github.com/gotify/server/v2/model"
+	"github.com/gotify/server/v2/plugin"
+)
+
+// passwordInput is read for passwords not given with --password.
+var passwordInput io.Reader = os.Stdin
+
+func userCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "gotify user: missing subcommand, expected list, create, set-password, set-admin or delete")
+		return 2
+	}
+	subcommand := args[0]
+	fs := flag.NewFlagSet("gotify user "+subcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var admin *bool
+	var pass *string
+	wantArgs := 1
+	switch subcommand {
+	case "list":
+		wantArgs = 0
+	case "create":
+		admin = fs.Bool("admin", false, "create an admin user")
+		pass = fs.String("password", "", "the password, read from stdin if not set")
+	case "set-password":
+		pass = fs.String("password", "", "the password, read from stdin if not set")
+	case "set-admin":
+		wantArgs = 2
+	case "delete":
+	default:
+		fmt.Fprintf(stderr, "gotify user: unknown subcommand %q, expected list, create, set-password, set-admin or delete\n", subcommand)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != wantArgs {
+		fmt.Fprintf(stderr, "gotify user %s: expected %d argument(s), got %d\n", subcommand, wantArgs, fs.NArg())
+		return 2
+	}
+	name := fs.Arg(0)
+	var setAdmin bool
+	if subcommand == "set-admin" {
+		var err error
+		if setAdmin, err = strconv.ParseBool(fs.Arg(1)); err != nil {
+			fmt.Fprintf(stderr, "gotify user set-admin: expected true or false, got %q\n", fs.Arg(1))
+			return 2
+		}
+	}
+
+	conf, db, ok := openCommandDatabase(stderr)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	var err error
+	switch subcommand {
+	case "list":
+		err = listUsers(db, stdout)
+	case "create":
+		err = createUser(conf, db, name, *pass, *admin, stdout)
+	case "set-password":
+		err = setUserPassword(conf, db, name, *pass, stdout)
+	case "set-admin":
+		err = setUserAdmin(db, name, setAdmin, stdout)
+	case "delete":
+		err = deleteUser(db, name, stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gotify user %s: %s\n", subcommand, err)
+		return 1
+	}
+	return 0
+}
+
+func listUsers(db *database.GormDatabase, stdout io.Writer) error {
+	users, err := db.GetUsers()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tADMIN")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%t\n", user.ID, user.Name, user.Admin)
+	}
+	return w.Flush()
+}
+
+func createUser(conf *config.Configuration, db *database.GormDatabase, name, pass string, admin bool, stdout io.Writer) error {
+	existing, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errors.New("username already exists")
+	}
+	pass, err = readPassword(pass)
+	if err != nil {
+		return err
+	}
+	user := &model.User{Name: name, Admin: admin, Pass: password.CreatePassword(pass, conf.PassStrength)}
+	if err := db.CreateUser(user); err != nil {
+		return err
+	}
+	if err := plugin.InitializeUser(db, conf.PluginsDir, user.ID); err != nil {
+		return fmt.Errorf("cannot initialize plugins: %w", err)
+	}
+	fmt.Fprintf(stdout, "Created user %s with id %d\n", user.Name, user.ID)
+	return nil
+}
+
+func setUserPassword(conf *config.Configuration, db *database.GormDatabase, name, pass string, stdout io.Writer) error {
+	user, err := requireUser(db, name)
+	if err != nil {
+		return err
+	}
+	pass, err = readPassword(pass)
+	if err != nil {
+		return err
+	}
+	user.Pass = password.CreatePassword(pass, conf.PassStrength)
+	if err := db.UpdateUser(user); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Changed the password of", user.Name)
+	return nil
+}
+
+func setUserAdmin(db *database.GormDatabase, name string, admin bool, stdout io.Writer) error {
+	user, err := requireUser(db, name)
+	if err != nil {
+		return err
+	}
+	if user.Admin && !admin {
+		if err := requireOtherAdmin(db); err != nil {
+			return err
+		}
+	}
+	user.Admin = admin
+	if err := db.UpdateUser(user); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Set admin of %s to %t\n", user.Name, user.Admin)
+	return nil
+}
+
+func deleteUser(db *database.GormDatabase, name string, stdout io.Writer) error {
+	user, err := requireUser(db, name)
+	if err != nil {
+		return err
+	}
+	if user.Admin {
+		if err := requireOtherAdmin(db); err != nil {
+			return err
+		}
+	}
+	if err := db.DeleteUserByID(user.ID); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Deleted user", user.Name)
+	return nil
+}
+
+func requireUser(db *database.GormDatabase, name string) (*model.User, error) {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %q does not exist", name)
+	}
+	return user, nil
+}
+
+func requireOtherAdmin(db *database.GormDatabase) error {
+	adminCount, err := db.CountUser(&model.User{Admin: true})
+	if err != nil {
+		return err
+	}
+	if adminCount == 1 {
+		return errors.New("cannot delete last admin")
+	}
+	return nil
+}
+
+// readPassword returns pass or the first line of passwordInput if pass is empty.
+func readPassword(pass string) (string, error) {
+	if pass == "" {
+		line, err := bufio.NewReader(passwordInput).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		pass = strings.TrimRight(line, "\r\n")
+	}
+	if pass == "" {
+		return "", errors.New("the password must not be empty")
+	}
+	return pass, nil
+}
@@ -0,0 +1,221 @@
+// Package webhook renders messages from arbitrary JSON bodies using the webhook
+// templates of applications.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/gotify/server/v2/model"
+)
+
+// emptyIfNil is appended to the pipeline of every action, text/template would
+// print missing keys and JSON null values as "<no value>".
+const emptyIfNil = "emptyIfNil"
+
+var funcs = template.FuncMap{
+	emptyIfNil: func(value any) any {
+		if value == nil {
+			return ""
+		}
+		return value
+	},
+	"json":     toJSON,
+	"default":  defaultValue,
+	"path":     path,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"truncate": truncate,
+	"join":     join,
+}
+
+// Template is a compiled webhook template.
+type Template struct {
+	title    *template.Template
+	message  *template.Template
+	priority *template.Template
+	extras   *template.Template
+}
+
+// Compile parses all fields of the webhook template.
+func Compile(t *model.WebhookTemplate) (*Template, error) {
+	var err error
+	compiled := &Template{}
+	if compiled.title, err = parseTemplate("title", t.Title); err != nil {
+		return nil, err
+	}
+	if compiled.message, err = parseTemplate("message", t.Message); err != nil {
+		return nil, err
+	}
+	if compiled.priority, err = parseTemplate("priority", t.Priority); err != nil {
+		return nil, err
+	}
+	if compiled.extras, err = parseTemplate("extras", t.Extras); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			printEmptyForNil(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+func printEmptyForNil(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			printEmptyForNil(child)
+		}
+	case *parse.ActionNode:
+		// actions with variable declarations don't print anything
+		if len(node.Pipe.Decl) == 0 {
+			node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      node.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(emptyIfNil).SetPos(node.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		printEmptyForNil(node.List)
+		printEmptyForNil(node.ElseList)
+	case *parse.RangeNode:
+		printEmptyForNil(node.List)
+		printEmptyForNil(node.ElseList)
+	case *parse.WithNode:
+		printEmptyForNil(node.List)
+		printEmptyForNil(node.ElseList)
+	}
+}
+
+// Render decodes the JSON body and executes the templates with it.
+func (t *Template) Render(body []byte) (*model.CreateMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keep numbers as written, otherwise large ids would be printed like 1.234e+06.
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("body is not valid JSON: %w", err)
+	}
+
+	msg := &model.CreateMessage{}
+	var err error
+	if msg.Title, err = execute(t.title, data); err != nil {
+		return nil, err
+	}
+	if msg.Message, err = execute(t.message, data); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(msg.Message) == "" {
+		return nil, errors.New("message template rendered an empty message")
+	}
+
+	priority, err := execute(t.priority, data)
+	if err != nil {
+		return nil, err
+	}
+	if priority = strings.TrimSpace(priority); priority != "" {
+		value, err := strconv.Atoi(priority)
+		if err != nil {
+			return nil, fmt.Errorf("priority template must render to a number, got %q", priority)
+		}
+		msg.Priority = &value
+	}
+
+	extras, err := execute(t.extras, data)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(extras) != "" {
+		if err := json.Unmarshal([]byte(extras), &msg.Extras); err != nil {
+			return nil, fmt.Errorf("extras template must render to a JSON object: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+func execute(tmpl *template.Template, data any) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render %s template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+func toJSON(value any) (string, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func defaultValue(fallback, value any) any {
+	if value == nil {
+		return fallback
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return fallback
+	}
+	return value
+}
+
+// path returns the value at the dot separated path, array elements are
+// accessed by their index. It returns nil if the path does not exist.
+func path(data any, p string) any {
+	current := data
+	for _, segment := range strings.Split(p, ".") {
+		if segment == "" {
+			continue
+		}
+		switch value := current.(type) {
+		case map[string]any:
+			current = value[segment]
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil
+			}
+			current = value[index]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+func truncate(length int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length]) + "…"
+}
+
+func join(sep string, list any) string {
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+	parts := make([]string, value.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(value.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
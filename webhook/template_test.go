@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/gotify/server/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const push = `{
+	"ref": "refs/heads/main",
+	"compare": "https://github.com/gotify/server/compare/a...b",
+	"repository": {"full_name": "gotify/server", "id": 123456789},
+	"pusher": {"name": "jmattheis"},
+	"commits": [{"message": "Fix bug"}, {"message": "Add feature"}],
+	"tags": ["a", "b"]
+}`
+
+func render(t *testing.T, tmpl *model.WebhookTemplate, body string) (*model.CreateMessage, error) {
+	compiled, err := Compile(tmpl)
+	require.NoError(t, err)
+	return compiled.Render([]byte(body))
+}
+
+func TestRender(t *testing.T) {
+	msg, err := render(t, &model.WebhookTemplate{
+		Title:    "{{.repository.full_name}}",
+		Message:  "{{.pusher.name}} pushed {{len .commits}} commits to {{.ref}}",
+		Priority: `{{if eq .ref "refs/heads/main"}}8{{else}}2{{end}}`,
+		Extras:   `{"client::notification":{"click":{"url":{{json .compare}}}}}`,
+	}, push)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gotify/server", msg.Title)
+	assert.Equal(t, "jmattheis pushed 2 commits to refs/heads/main", msg.Message)
+	if assert.NotNil(t, msg.Priority) {
+		assert.Equal(t, 8, *msg.Priority)
+	}
+	assert.Equal(t, map[string]any{
+		"client::notification": map[string]any{"click": map[string]any{"url": "https://github.com/gotify/server/compare/a...b"}},
+	}, msg.Extras)
+}
+
+func TestRender_optionalFields(t *testing.T) {
+	msg, err := render(t, &model.WebhookTemplate{Message: "{{.pusher.name}}"}, push)
+	require.NoError(t, err)
+	assert.Equal(t, "", msg.Title)
+	assert.Nil(t, msg.Priority)
+	assert.Nil(t, msg.Extras)
+}
+
+func TestRender_functions(t *testing.T) {
+	msg, err := render(t, &model.WebhookTemplate{
+		Title:   `{{default "unknown" .missing}} {{upper .pusher.name}}`,
+		Message: `{{path . "commits.1.message"}}|{{path . "commits.5.message"}}|{{join ", " .tags}}|{{truncate 3 "abcdef"}}|{{.repository.id}}|{{.nope}}`,
+	}, push)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown JMATTHEIS", msg.Title)
+	assert.Equal(t, "Add feature||a, b|abc…|123456789|", msg.Message)
+}
+
+func TestRender_errors(t *testing.T) {
+	_, err := render(t, &model.WebhookTemplate{Message: "{{.pusher.name}}"}, `not json`)
+	assert.EqualError(t, err, "body is not valid JSON: invalid character 'o' in literal null (expecting 'u')")
+
+	_, err = render(t, &model.WebhookTemplate{Message: "{{.missing}}"}, push)
+	assert.EqualError(t, err, "message template rendered an empty message")
+
+	_, err = render(t, &model.WebhookTemplate{Message: "x", Priority: "{{.ref}}"}, push)
+	assert.EqualError(t, err, `priority template must render to a number, got "refs/heads/main"`)
+
+	_, err = render(t, &model.WebhookTemplate{Message: "x", Extras: "{{.ref}}"}, push)
+	assert.ErrorContains(t, err, "extras template must render to a JSON object")
+
+	_, err = render(t, &model.WebhookTemplate{Message: "{{index .commits 5}}"}, push)
+	assert.ErrorContains(t, err, "could not render message template")
+}
+
+func TestCompile_invalidTemplate(t *testing.T) {
+	_, err := Compile(&model.WebhookTemplate{Message: "ok", Title: "{{.title"})
+	assert.ErrorContains(t, err, "invalid title template")
+
+	_, err = Compile(&model.WebhookTemplate{Message: "{{unknown .x}}"})
+	assert.ErrorContains(t, err, "invalid message template")
+}
+
+func TestRender_missingValues(t *testing.T) {
+	msg, err := render(t, &model.WebhookTemplate{
+		Title:   `{{.nope}}{{with .pusher}}{{.missing}}{{end}}{{define "x"}}{{.gone}}{{end}}{{template "x" .}}`,
+		Message: `{{.text}} {{.nested.missing}} {{.null}}`,
+	}, `{"text":"literal <no value> stays","null":null}`)
+	require.NoError(t, err)
+	assert.Equal(t, "", msg.Title)
+	assert.Equal(t, "literal <no value> stays  ", msg.Message)
+}